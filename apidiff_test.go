@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestCompareAPI tests the classification of exported API changes between
+// two versions of a module
+func TestCompareAPI(t *testing.T) {
+	base := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/lib\n\ngo 1.22\n",
+		"client.go": `package lib
+
+import "context"
+
+// Client calls the service
+type Client struct {
+	Addr    string
+	Timeout int
+	retries int
+}
+
+// Do sends a request
+func (c *Client) Do(ctx context.Context, req string) (string, error) { return "", nil }
+
+// String describes the client
+func (c Client) String() string { return c.Addr }
+
+// Fetch fetches n items
+func Fetch(ctx context.Context, n int) error { return nil }
+
+// OldName adds
+func OldName(a, b int) int { return a + b }
+
+// Version of the library
+const Version = "1.0"
+
+// Max items
+const Max = 10
+`,
+		"store.go": `package lib
+
+import "io"
+
+// Store stores values
+type Store interface {
+	Get(key string) (string, error)
+}
+
+// Sealed is implemented in this package only
+type Sealed interface {
+	Get() string
+	private()
+}
+
+// Reader reads
+type Reader interface {
+	io.Reader
+}
+`,
+		"old/old.go":            "package old\n\n// Gone is going away\nfunc Gone() {}\n",
+		"internal/impl/impl.go": "package impl\n\n// Helper helps\nfunc Helper() {}\n",
+		"cmd/tool/main.go":      "package main\n\nfunc main() {}\n",
+		"client_test.go":        "package lib\n\n// TestHelper is test-only\nfunc TestHelper() {}\n",
+	})
+	head := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/lib\n\ngo 1.22\n",
+		"client.go": `package lib
+
+import "context"
+
+// Client calls the service
+type Client struct {
+	Addr   string
+	Header map[string]string
+}
+
+// Do sends a request
+func (c *Client) Do(ctx context.Context, req string, opts ...string) (string, error) { return "", nil }
+
+// String describes the client
+func (c *Client) String() string { return c.Addr }
+
+// Fetch fetches n items
+func Fetch(c context.Context, count int) error { return nil }
+
+// NewName adds
+func NewName(x, y int) int { return x + y }
+
+// New returns a client
+func New() *Client { return &Client{} }
+
+// Version of the library
+const Version = "1.1"
+
+// Max items
+const Max = 5 * 2
+`,
+		"store.go": `package lib
+
+import "io"
+
+// Store stores values
+type Store interface {
+	Get(key string) (string, error)
+	Put(key, value string) error
+}
+
+// Sealed is implemented in this package only
+type Sealed interface {
+	Get() string
+	Put()
+	private()
+}
+
+// Reader reads
+type Reader interface {
+	io.Reader
+}
+`,
+		"extra/extra.go":        "package extra\n\n// Tool is new\nfunc Tool() {}\n",
+		"internal/impl/impl.go": "package impl\n\n// Other replaces Helper\nfunc Other() {}\n",
+	})
+
+	svc := analyzer.NewService()
+	extract := func(root string) analyzer.API {
+		files, err := svc.IndexSourceFiles(root)
+		require.NoError(t, err)
+		return svc.ExtractAPI(files)
+	}
+	baseAPI, headAPI := extract(base), extract(head)
+	assert.NotContains(t, baseAPI, "example.com/lib/internal/impl")
+	assert.NotContains(t, baseAPI["example.com/lib"].Objects, "TestHelper")
+	assert.Equal(t, "func(context.Context, string) (string, error)", baseAPI["example.com/lib"].Objects["Client.Do"].Type)
+
+	report := analyzer.CompareAPI(baseAPI, headAPI)
+	var found []string
+	for _, c := range report.Changes {
+		found = append(found, fmt.Sprintf("%s %s %s %v", c.Package, c.Symbol, c.Kind, c.Breaking))
+	}
+	assert.Equal(t, []string{
+		"example.com/lib/old  removed true",
+		"example.com/lib Client changed true",
+		"example.com/lib Client.Do changed true",
+		"example.com/lib Client.Header added false",
+		"example.com/lib Client.String changed true",
+		"example.com/lib Client.Timeout removed true",
+		"example.com/lib New added false",
+		"example.com/lib OldName renamed true",
+		"example.com/lib Sealed.Put added false",
+		"example.com/lib Store.Put added true",
+		"example.com/lib Version changed true",
+		"example.com/lib/extra  added false",
+	}, found)
+	assert.Equal(t, 8, report.Breaking)
+	assert.Equal(t, 4, report.Compatible)
+	assert.Equal(t, "major", report.Bump)
+
+	for _, c := range report.Changes {
+		switch c.Symbol {
+		case "Client":
+			assert.Equal(t, "type Client is no longer comparable", c.Message)
+		case "OldName":
+			assert.Equal(t, "OldName was renamed to NewName", c.Message)
+		case "Version":
+			assert.Equal(t, `untyped string = "1.0"`, c.Old)
+			assert.Equal(t, `untyped string = "1.1"`, c.New)
+			assert.Equal(t, "client.go", c.File)
+		}
+	}
+
+	// No change is a patch release, and additions alone a minor one
+	assert.Equal(t, "patch", analyzer.CompareAPI(baseAPI, baseAPI).Bump)
+	delete(headAPI, "example.com/lib")
+	delete(baseAPI, "example.com/lib")
+	delete(baseAPI, "example.com/lib/old")
+	assert.Equal(t, "minor", analyzer.CompareAPI(baseAPI, headAPI).Bump)
+}
+
+// TestExtractAPIMalformedReceiver tests that a method declaration with an
+// empty receiver list is left out instead of failing the extraction
+func TestExtractAPIMalformedReceiver(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/lib\n\ngo 1.22\n",
+		"lib.go": "package lib\n\nfunc () Broken() {}\n\n// Kept is kept\nfunc Kept() {}\n",
+	})
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	api := svc.ExtractAPI(files)
+	require.Contains(t, api, "example.com/lib")
+	assert.Contains(t, api["example.com/lib"].Objects, "Kept")
+	assert.NotContains(t, api["example.com/lib"].Objects, "Broken")
+}
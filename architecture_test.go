@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestCheckArchitecture tests layering rules over Go packages, including
+// transitive imports, and cycle detection over JavaScript directories
+func TestCheckArchitecture(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		".codeanalyzer/architecture.yaml": `layers:
+  handlers: [handlers/...]
+  services: [services]
+rules:
+  - name: vision is independent of knowledge
+    from: [internal/vision]
+    deny: [internal/knowledge/...]
+  - name: handlers only use services
+    from: [handlers]
+    allow: [services]
+`,
+		"internal/vision/vision.go": `package vision
+
+import "example.com/app/internal/util"
+
+// See looks
+func See() string { return util.Fetch() }
+`,
+		"internal/util/util.go": `package util
+
+import (
+	"strings"
+
+	"example.com/app/internal/knowledge/store"
+)
+
+// Fetch fetches
+func Fetch() string { return strings.ToUpper(store.Get()) }
+`,
+		"internal/knowledge/store/store.go": "package store\n\n// Get gets\nfunc Get() string { return \"\" }\n",
+		"services/services.go":              "package services\n\n// Run runs\nfunc Run() {}\n",
+		"handlers/handlers.go": `package handlers
+
+import (
+	"net/http"
+
+	"example.com/app/handlers/auth"
+	"example.com/app/internal/util"
+	"example.com/app/services"
+)
+
+// Handle handles
+func Handle(w http.ResponseWriter) { services.Run(); auth.Check(); util.Fetch() }
+`,
+		"handlers/auth/auth.go": "package auth\n\n// Check checks\nfunc Check() {}\n",
+		"web/a/a.js":            "import { b } from '../b/b';\n\nexport const a = () => b();\n",
+		"web/b/b.js":            "import { c } from '../c/c';\n\nexport const b = () => c();\n",
+		"web/c/c.js":            "// loops back\nimport { a } from '../a/a';\nimport React from 'react';\n\nexport const c = () => a();\n",
+	})
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+	config, err := svc.LoadArchitectureConfig(root)
+	require.NoError(t, err)
+	require.NotNil(t, config)
+
+	violations := svc.CheckArchitecture(files, graph, config)
+	var found []string
+	for _, v := range violations {
+		found = append(found, fmt.Sprintf("%s %s:%d %s", v.Kind, v.File, v.Line, strings.Join(v.Chain, " -> ")))
+	}
+	assert.Equal(t, []string{
+		"denied internal/vision/vision.go:3 internal/vision -> internal/util -> internal/knowledge/store",
+		"not-allowed handlers/handlers.go:7 handlers -> internal/util",
+		"cycle web/a/a.js:1 web/a -> web/b -> web/c -> web/a",
+	}, found)
+
+	findings := svc.ArchitectureFindings(violations)
+	require.Len(t, findings, 3)
+	assert.Equal(t, analyzer.RuleArchitectureViolation, findings[0].Rule)
+	assert.Equal(t, "internal/vision must not depend on internal/knowledge/store (vision is independent of knowledge): internal/vision -> internal/util -> internal/knowledge/store", findings[0].Message)
+	assert.Equal(t, analyzer.RuleImportCycle, findings[2].Rule)
+
+	// Violations are part of the repository findings
+	all, _, err := svc.AnalyzeFindings(root)
+	require.NoError(t, err)
+	var rules []string
+	for _, f := range all {
+		rules = append(rules, f.Rule)
+	}
+	assert.Contains(t, rules, analyzer.RuleImportCycle)
+
+	// Cycles can be allowed and rules are validated
+	config.AllowCycles = true
+	assert.Len(t, svc.CheckArchitecture(files, graph, config), 2)
+	_, err = analyzer.ParseArchitectureConfig([]byte("rules:\n  - from: [a]\n"))
+	assert.Error(t, err)
+	_, err = analyzer.ParseArchitectureConfig([]byte("rules:\n  - from: [a]\n    forbid: [b]\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+	"github.com/teathis/codeanalyzer/internal/repository"
+)
+
+// TestFingerprintFindings tests that fingerprints survive line shifts but
+// change with the rule, the enclosing symbol and the code
+func TestFingerprintFindings(t *testing.T) {
+	source := `package app
+
+// Load reads a value
+func Load(k string) string {
+	v := k
+	return v
+}
+
+// Save writes a value
+func Save(k string) string {
+	v := k
+	return v
+}
+`
+	root := writeRepo(t, map[string]string{
+		"go.mod":     "module example.com/app\n\ngo 1.22\n",
+		"app/app.go": source,
+	})
+	svc := analyzer.NewService()
+	fingerprint := func(findings ...analyzer.AnalysisResult) []string {
+		files, err := svc.IndexSourceFiles(root)
+		require.NoError(t, err)
+		graph, err := svc.BuildCodeKnowledgeGraph(files)
+		require.NoError(t, err)
+		var fps []string
+		for _, f := range svc.FingerprintFindings(root, findings, graph) {
+			require.NotEmpty(t, f.Fingerprint)
+			fps = append(fps, f.Fingerprint)
+		}
+		return fps
+	}
+	finding := func(rule string, line int) analyzer.AnalysisResult {
+		return analyzer.AnalysisResult{Rule: rule, File: "app/app.go", Line: line, Message: rule, Level: "warning"}
+	}
+
+	before := fingerprint(finding("unused", 5), finding("unused", 11), finding("shadow", 5))
+	assert.Len(t, before, 3)
+	assert.NotEqual(t, before[0], before[1]) // same code in another function
+	assert.NotEqual(t, before[0], before[2]) // another rule
+
+	// Moving the code down and reindenting keeps the fingerprints
+	shifted := "package app\n\nimport \"strings\"\n\nvar _ = strings.ToUpper\n" + source[len("package app\n"):]
+	shifted = shifted[:len(shifted)-len("\treturn v\n}\n")] + "  return   v\n}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app/app.go"), []byte(shifted), 0644))
+	after := fingerprint(finding("shadow", 9), finding("unused", 15), finding("unused", 9))
+	assert.Equal(t, []string{before[2], before[1], before[0]}, after)
+
+	// Duplicate findings are counted rather than collapsed
+	dup := fingerprint(finding("unused", 9), finding("unused", 9))
+	assert.NotEqual(t, dup[0], dup[1])
+}
+
+// TestCompareWithBase tests that findings are split into new, fixed and
+// unchanged relative to a base commit and a stored baseline
+func TestCompareWithBase(t *testing.T) {
+	workspace := t.TempDir()
+	root := filepath.Join(workspace, "app")
+	repo, err := git.PlainInit(root, false)
+	require.NoError(t, err)
+
+	base := commitFiles(t, repo, root, "Initial", map[string]string{
+		"go.mod":       "module example.com/app\n\ngo 1.22\n",
+		"a/a.go":       "package a\n\n// A branches\n" + branchyGo("A", analyzer.MaxCyclomaticComplexity),
+		"py/script.py": "def run():\n    return 1\n",
+	})
+	commitFiles(t, repo, root, "Add b", map[string]string{
+		"b/b.go": "package b\n\n// B branches\n" + branchyGo("B", analyzer.MaxCyclomaticComplexity),
+	})
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	_, err = wt.Remove("py/script.py")
+	require.NoError(t, err)
+	commitFiles(t, repo, root, "Drop script", nil)
+
+	svc := analyzer.NewService()
+	repos, err := repository.NewService(workspace)
+	require.NoError(t, err)
+
+	commit, err := repos.ResolveRef("app", "HEAD~2")
+	require.NoError(t, err)
+	assert.Equal(t, base, commit.Hash)
+	ref, head, err := repos.HeadRef("app")
+	require.NoError(t, err)
+	assert.Equal(t, "master", ref)
+	assert.Equal(t, "Drop script", head.Message)
+
+	// Repository IDs cannot leave the workspace
+	_, err = repos.ResolveRef("../app", "HEAD")
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, repos.CheckoutCommit("app", base, dir))
+	baseFindings, _, err := svc.AnalyzeFindings(dir)
+	require.NoError(t, err)
+	headFindings, _, err := svc.AnalyzeFindings(root)
+	require.NoError(t, err)
+
+	comparison := analyzer.CompareFindings(baseFindings, headFindings)
+	require.Len(t, comparison.New, 1)
+	assert.Equal(t, "b/b.go", comparison.New[0].File)
+	require.Len(t, comparison.Fixed, 1)
+	assert.Equal(t, "py/script.py", comparison.Fixed[0].File)
+	require.Len(t, comparison.Unchanged, 1)
+	assert.Equal(t, "a/a.go", comparison.Unchanged[0].File)
+
+	// A stored baseline round-trips
+	stored, err := svc.LoadBaseline(root)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+	require.NoError(t, svc.SaveBaseline(root, &analyzer.Baseline{Commit: base, Findings: baseFindings}))
+	stored, err = svc.LoadBaseline(root)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.False(t, stored.CreatedAt.IsZero())
+	assert.Equal(t, comparison, analyzer.CompareFindings(stored.Findings, headFindings))
+
+	// The baseline is not analyzed as part of the repository
+	again, _, err := svc.AnalyzeFindings(root)
+	require.NoError(t, err)
+	assert.Equal(t, headFindings, again)
+}
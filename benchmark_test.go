@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"runtime"
 	"testing"
 
 	"gonum.org/v1/gonum/mat"
 
 	"github.com/teathis/codeanalyzer/internal/agent"
+	"github.com/teathis/codeanalyzer/internal/analyzer"
 	"github.com/teathis/codeanalyzer/internal/config"
 	"github.com/teathis/codeanalyzer/internal/knowledge"
 	"github.com/teathis/codeanalyzer/internal/rl"
@@ -145,3 +149,46 @@ func BenchmarkDiagnosisResult(b *testing.B) {
 	}
 	_ = result
 }
+
+// BenchmarkAnalysisPipeline benchmarks indexing, static analysis and graph
+// building of a synthetic 10k-file repository with increasing worker counts.
+// Each run with several workers reports its speedup over a single worker,
+// which should approach the worker count on an idle machine.
+func BenchmarkAnalysisPipeline(b *testing.B) {
+	root := writeSyntheticRepo(b, 10000)
+
+	workerCounts := []int{1, 2, 4}
+	if n := runtime.GOMAXPROCS(0); n > 4 {
+		workerCounts = append(workerCounts, n)
+	}
+	var sequential float64 // ns/op with one worker
+	for _, workers := range workerCounts {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			svc := &analyzer.Service{Pipeline: analyzer.PipelineOptions{Workers: workers}}
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				files, _, err := svc.IndexSourceFilesContext(ctx, root)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, _, err := svc.RunStaticAnalysisContext(ctx, files); err != nil {
+					b.Fatal(err)
+				}
+				if _, _, err := svc.BuildCodeKnowledgeGraphContext(ctx, files); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+
+			perOp := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
+			if workers == 1 {
+				sequential = perOp
+				return
+			}
+			if sequential > 0 {
+				b.ReportMetric(sequential/perOp, "speedup")
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+	"github.com/teathis/codeanalyzer/internal/repository"
+	"github.com/teathis/codeanalyzer/internal/validation"
+)
+
+// commitFiles writes files into a worktree and commits them
+func commitFiles(t *testing.T, repo *git.Repository, root, message string, files map[string]string) string {
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		_, err := wt.Add(name)
+		require.NoError(t, err)
+	}
+	hash, err := wt.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "Dev", Email: "dev@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	return hash.String()
+}
+
+// TestBisectSearch tests the binary search with skipped and flaky commits
+func TestBisectSearch(t *testing.T) {
+	svc := analyzer.NewService()
+	commits := []string{"c1", "c2", "c3", "c4", "c5", "c6", "c7"}
+	verdicts := func(firstBad int, skip map[string]bool, flaky map[string]int) analyzer.BisectTest {
+		return func(ctx context.Context, commit string) (analyzer.BisectVerdict, error) {
+			if skip[commit] {
+				return analyzer.BisectSkip, nil
+			}
+			for i, c := range commits {
+				if c != commit {
+					continue
+				}
+				if i >= firstBad {
+					return analyzer.BisectBad, nil
+				}
+				// Flaky commits fail a number of times before passing
+				if flaky[commit] > 0 {
+					flaky[commit]--
+					return analyzer.BisectBad, nil
+				}
+			}
+			return analyzer.BisectGood, nil
+		}
+	}
+
+	result, err := svc.Bisect(context.Background(), commits, verdicts(4, nil, nil), analyzer.BisectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "c5", result.Culprit)
+	assert.Len(t, result.Steps, 3)
+
+	// Skipped commits are worked around
+	result, err = svc.Bisect(context.Background(), commits, verdicts(4, map[string]bool{"c3": true}, nil), analyzer.BisectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "c5", result.Culprit)
+
+	// A skipped commit next to the culprit makes it ambiguous
+	result, err = svc.Bisect(context.Background(), commits, verdicts(4, map[string]bool{"c5": true}, nil), analyzer.BisectOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Culprit)
+	assert.Equal(t, []string{"c5", "c6"}, result.Candidates)
+
+	// A flaky failure is rerun and judged good
+	result, err = svc.Bisect(context.Background(), commits, verdicts(4, nil, map[string]int{"c4": 1}), analyzer.BisectOptions{Retries: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "c5", result.Culprit)
+	var flaky []string
+	for _, step := range result.Steps {
+		if step.Flaky {
+			flaky = append(flaky, step.Commit)
+			assert.Equal(t, 2, step.Runs)
+		}
+	}
+	assert.Equal(t, []string{"c4"}, flaky)
+
+	// Without reruns the flaky failure misleads the search
+	result, err = svc.Bisect(context.Background(), commits, verdicts(4, nil, map[string]int{"c4": 1}), analyzer.BisectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "c4", result.Culprit)
+
+	_, err = svc.Bisect(context.Background(), commits, verdicts(10, nil, nil), analyzer.BisectOptions{VerifyBad: true})
+	assert.Error(t, err)
+}
+
+// TestBisectRepository tests finding the commit that broke a test in a git
+// repository and attaching it to the diagnoses
+func TestBisectRepository(t *testing.T) {
+	workspace := t.TempDir()
+	root := filepath.Join(workspace, "app")
+	repo, err := git.PlainInit(root, false)
+	require.NoError(t, err)
+
+	good := commitFiles(t, repo, root, "Add calc", map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"calc/calc.go": `package calc
+
+// Add adds two numbers
+func Add(a, b int) int {
+	return a + b
+}
+
+// Scale multiplies a number
+func Scale(a, k int) int {
+	return a * k
+}
+`,
+		"calc/calc_test.go": `package calc
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	if Add(2, 3) != 5 {
+		t.Fatal(Add(2, 3))
+	}
+}
+`,
+	})
+	commitFiles(t, repo, root, "Document calc", map[string]string{"README.md": "calc\n"})
+	commitFiles(t, repo, root, "Add notes", map[string]string{"NOTES.md": "notes\n"})
+	commitFiles(t, repo, root, "Break the build", map[string]string{"calc/extra.go": "package calc\n\nfunc broken() int { return \"\" }\n"})
+	commitFiles(t, repo, root, "Fix the build", map[string]string{"calc/extra.go": "package calc\n"})
+	culprit := commitFiles(t, repo, root, "Optimize Add\n\nUse subtraction.", map[string]string{
+		"calc/calc.go": `package calc
+
+// Add adds two numbers
+func Add(a, b int) int {
+	return a - b
+}
+
+// Scale multiplies a number
+func Scale(a, k int) int {
+	return a * k
+}
+`,
+	})
+	bad := commitFiles(t, repo, root, "Add more notes", map[string]string{"NOTES.md": "more notes\n"})
+
+	repos, err := repository.NewService(workspace)
+	require.NoError(t, err)
+	commits, err := repos.CommitRange("app", good, bad)
+	require.NoError(t, err)
+	require.Len(t, commits, 6)
+	assert.Equal(t, "Document calc", commits[0].Message)
+	assert.Equal(t, bad, commits[5].Hash)
+
+	diff, err := repos.CommitDiff("app", culprit)
+	require.NoError(t, err)
+	assert.Contains(t, diff.Patch, "-\treturn a + b\n+\treturn a - b")
+	require.Len(t, diff.Files, 1)
+	assert.Equal(t, []repository.LineRange{{Start: 5, End: 5}}, diff.Files[0].Lines)
+
+	// Churn counts the recent commits touching each file
+	churn, err := repos.FileChurn("app", 3)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"NOTES.md": 1, "calc/calc.go": 1, "calc/extra.go": 1}, churn)
+
+	svc := analyzer.NewService()
+	validator := validation.NewService(svc)
+	opts := validation.DefaultOptions(root)
+	report, err := validator.Bisect(context.Background(), repos, "app", good, bad, opts, analyzer.BisectOptions{Retries: 1, VerifyBad: true})
+	require.NoError(t, err)
+	require.NotNil(t, report.Regression, report.Bisect)
+	assert.Equal(t, culprit, report.Bisect.Culprit)
+	assert.Equal(t, "Optimize Add\n\nUse subtraction.", report.Regression.Message)
+	assert.Contains(t, report.Regression.Diff, "return a - b")
+	assert.Equal(t, []string{"func:example.com/app/calc.Add"}, report.Regression.TouchedNodes)
+	assert.NotEmpty(t, report.LogPath)
+
+	skipped := false
+	for _, step := range report.Bisect.Steps {
+		if step.Verdict == analyzer.BisectSkip {
+			skipped = true
+		}
+	}
+	assert.True(t, skipped, "the commit that does not build is skipped")
+
+	// The touched node is diagnosed as a regression
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+	diagnoses := svc.AttachRegression(nil, report.Regression, graph)
+	require.Len(t, diagnoses, 1)
+	assert.Equal(t, "regression", diagnoses[0].RuleID)
+	assert.Equal(t, "func:example.com/app/calc.Add", diagnoses[0].NodeID)
+	assert.Contains(t, diagnoses[0].Cause, "Optimize Add")
+	assert.Same(t, report.Regression, diagnoses[0].Regression)
+
+	// Existing diagnoses of touched nodes gain confidence
+	boosted := svc.AttachRegression([]analyzer.Diagnosis{{NodeID: "func:example.com/app/calc.Add", RuleID: "type-mismatch", Confidence: 0.4}}, report.Regression, graph)
+	assert.InDelta(t, 0.7, boosted[0].Confidence, 1e-9)
+	assert.Equal(t, "commit", boosted[0].Evidence[0].Kind)
+}
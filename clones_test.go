@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestDetectClones tests type-1 and type-2 clone groups and that a
+// diagnosis on one copy flags the others
+func TestDetectClones(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"orders/orders.go": `package orders
+
+// Total sums the prices of the first n items
+func Total(prices []int, n int) int {
+	sum := 0
+	for i := 0; i < n; i++ {
+		sum += prices[i] * 2
+	}
+	return sum
+}
+`,
+		// The same code with other comments and layout
+		"billing/billing.go": `package billing
+
+// Total adds up prices
+func Total(prices []int, n int) int {
+	sum := 0
+	for i := 0; i < n; i++ { sum += prices[i] * 2 } // doubled
+	return sum
+}
+`,
+		// Renamed identifiers and another literal
+		"stock/stock.go": `package stock
+
+// Count totals the quantities
+func Count(qty []int, limit int) int {
+	acc := 0
+	for j := 0; j < limit; j++ {
+		acc += qty[j] * 3
+	}
+	return acc
+}
+
+// Other is unrelated
+func Other(s string) string { return s + "!" }
+`,
+		"web/a.js": "function pad(s) {\n  while (s.length < 8) {\n    s = '0' + s;\n  }\n  return s;\n}\n",
+		"web/b.js": "function pad(s) {\n  // copied\n  while (s.length < 8) { s = '0' + s; }\n  return s;\n}\n",
+	})
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+
+	report, err := svc.DetectClones(files, analyzer.CloneOptions{MinTokens: 20})
+	require.NoError(t, err)
+	require.Len(t, report.Groups, 2)
+
+	goClones := report.Groups[0]
+	assert.Equal(t, 2, goClones.Type)
+	require.Len(t, goClones.Fragments, 3)
+	assert.Equal(t, "billing/billing.go", goClones.Fragments[0].File)
+	assert.Equal(t, 1, goClones.Fragments[0].StartLine) // the package clause matches too
+	assert.Equal(t, 8, goClones.Fragments[0].EndLine)
+	assert.Equal(t, "orders/orders.go", goClones.Fragments[1].File)
+	assert.Equal(t, "stock/stock.go", goClones.Fragments[2].File)
+
+	jsClones := report.Groups[1]
+	assert.Equal(t, 1, jsClones.Type)
+	require.Len(t, jsClones.Fragments, 2)
+	assert.Equal(t, "web/a.js", jsClones.Fragments[0].File)
+	assert.Equal(t, "web/b.js", jsClones.Fragments[1].File)
+	assert.Equal(t, goClones.Tokens*2+jsClones.Tokens, report.DuplicatedTokens)
+
+	// A longer minimum finds nothing
+	none, err := svc.DetectClones(files, analyzer.CloneOptions{MinTokens: 200})
+	require.NoError(t, err)
+	assert.Empty(t, none.Groups)
+
+	// The copies are linked in the graph
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+	graph = svc.AddDuplicateEdges(graph, report)
+	assert.Equal(t, "file:stock/stock.go", goClones.Fragments[2].NodeID)
+	assert.Equal(t, []string{"func:example.com/app/stock.Count"}, goClones.Fragments[2].Symbols)
+	edges := graphEdges(graph)
+	assert.Contains(t, edges, "func:example.com/app/orders.Total duplicate_of func:example.com/app/billing.Total")
+	assert.Contains(t, edges, "func:example.com/app/billing.Total duplicate_of func:example.com/app/stock.Count")
+	assert.Contains(t, edges, "func:example.com/app/stock.Count duplicate_of func:example.com/app/billing.Total")
+	// Copies are linked through the first copy only
+	assert.NotContains(t, edges, "func:example.com/app/orders.Total duplicate_of func:example.com/app/stock.Count")
+	assert.Contains(t, edges, "func:web/a.js#pad duplicate_of func:web/b.js#pad")
+	assert.NotContains(t, edges, "func:example.com/app/stock.Other duplicate_of func:example.com/app/orders.Total")
+
+	// Adding the edges again does not duplicate them
+	again := len(graphEdges(svc.AddDuplicateEdges(graph, report)))
+	assert.Equal(t, len(edges), again)
+
+	// A diagnosis on one copy flags its siblings
+	diagnoses, err := svc.DiagnoseRootCauseWithOptions([]string{"func:example.com/app/orders.Total"}, graph, analyzer.DiagnoseOptions{
+		RepoPath: root,
+		Logs:     []analyzer.ErrorLog{{Message: "panic: runtime error: index out of range [5] with length 5"}},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, diagnoses)
+	assert.ElementsMatch(t, []string{"func:example.com/app/billing.Total", "func:example.com/app/stock.Count"}, diagnoses[0].Duplicates)
+	var duplicates []analyzer.Evidence
+	for _, e := range diagnoses[0].Evidence {
+		if e.Kind == "duplicate" {
+			duplicates = append(duplicates, e)
+		}
+	}
+	require.Len(t, duplicates, 2)
+	assert.Equal(t, 4, duplicates[0].Line)
+}
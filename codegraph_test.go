@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// writeRepo writes files into a temporary repository and returns its root
+func writeRepo(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+// buildGraph indexes a repository and builds its code knowledge graph
+func buildGraph(t *testing.T, root string) map[string]analyzer.GraphNode {
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+
+	nodes := make(map[string]analyzer.GraphNode, len(graph))
+	for _, node := range graph {
+		nodes[node.ID] = node
+	}
+	return nodes
+}
+
+// hasEdge reports whether node has an edge of the given type to target
+func hasEdge(node analyzer.GraphNode, edgeType, target string) bool {
+	for _, edge := range node.Edges {
+		if edge.Type == edgeType && edge.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+// TestBuildGoKnowledgeGraph tests Go declarations, ranges and typed edges
+func TestBuildGoKnowledgeGraph(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.22\n",
+		"store/store.go": `package store
+
+// Store loads users
+type Store interface {
+	Get(id int) (*User, error)
+}
+
+// Base holds shared fields
+type Base struct{ ID int }
+
+// User is a stored user
+type User struct {
+	Base
+	Name string
+}
+
+type memStore struct{ users map[int]*User }
+
+func (m *memStore) Get(id int) (*User, error) {
+	return m.users[id], nil
+}
+
+// New creates a store
+func New() Store {
+	return &memStore{users: map[int]*User{}}
+}
+`,
+		"api/api.go": `package api
+
+import "example.com/shop/store"
+
+func Lookup(s store.Store, id int) string {
+	u, _ := s.Get(id)
+	return name(u)
+}
+
+func name(u *store.User) string { return u.Name }
+`,
+	})
+
+	nodes := buildGraph(t, root)
+
+	get, ok := nodes["method:example.com/shop/store.memStore.Get"]
+	require.True(t, ok)
+	assert.Equal(t, analyzer.NodeMethod, get.Type)
+	assert.Equal(t, "memStore", get.Receiver)
+	assert.Equal(t, 19, get.StartLine)
+	assert.Equal(t, 21, get.EndLine)
+	assert.Contains(t, get.Relations, "file:store/store.go")
+
+	lookup := nodes["func:example.com/shop/api.Lookup"]
+	assert.True(t, hasEdge(lookup, analyzer.EdgeCalls, get.ID), "interface call dispatches to implementation")
+	assert.True(t, hasEdge(lookup, analyzer.EdgeCalls, "func:example.com/shop/api.name"))
+	assert.True(t, hasEdge(lookup, analyzer.EdgeReferences, "type:example.com/shop/store.Store"))
+
+	assert.True(t, hasEdge(nodes["type:example.com/shop/store.memStore"], analyzer.EdgeImplements, "type:example.com/shop/store.Store"))
+	assert.True(t, hasEdge(nodes["type:example.com/shop/store.User"], analyzer.EdgeEmbeds, "type:example.com/shop/store.Base"))
+	assert.True(t, hasEdge(nodes["pkg:example.com/shop/api"], analyzer.EdgeImports, "pkg:example.com/shop/store"))
+	assert.True(t, hasEdge(nodes["file:api/api.go"], analyzer.EdgeContains, lookup.ID))
+	assert.Equal(t, analyzer.NodeInterface, nodes["type:example.com/shop/store.Store"].Type)
+}
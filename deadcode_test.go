@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestFindDeadCode tests that unused functions, types, constants and fields
+// are reported, and how exported symbols, main packages and tests are rooted
+func TestFindDeadCode(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"store/store.go": `package store
+
+const limit = 10
+
+const unusedLimit = 20
+
+// Store keeps values
+type Store struct {
+	items []string
+	stale bool
+	Name  string
+	Tag   string ` + "`json:\"tag\"`" + `
+}
+
+type cache struct{}
+
+// Add stores a value
+func (s *Store) Add(v string) {
+	if len(s.items) < limit {
+		s.items = append(s.items, clean(v))
+	}
+}
+
+func clean(v string) string { return v }
+
+func unused() {}
+
+func (c cache) get() {}
+
+// Unused is exported but never called
+func Unused() {}
+
+func onlyTests() int { return 1 }
+`,
+		"store/store_test.go": `package store
+
+import "testing"
+
+func TestOnly(t *testing.T) { _ = onlyTests() }
+`,
+		"cmd/app/main.go": `package main
+
+import "example.com/app/store"
+
+func main() {
+	s := &store.Store{}
+	s.Add("x")
+}
+
+func tool() {}
+`,
+	})
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+
+	messages := func(findings []analyzer.AnalysisResult) []string {
+		var out []string
+		for _, f := range findings {
+			assert.Equal(t, analyzer.RuleDeadCode, f.Rule)
+			out = append(out, f.Message)
+		}
+		return out
+	}
+
+	// By default exported symbols are roots and tests are left out
+	findings := svc.FindDeadCode(files, graph, analyzer.DeadCodeOptions{})
+	assert.ElementsMatch(t, []string{
+		"function tool is unused",
+		"constant unusedLimit is unused",
+		"field stale is unused",
+		"struct cache is unused",
+		"method get is unused",
+		"function unused is unused",
+		"function onlyTests is unused",
+	}, messages(findings))
+	for _, f := range findings {
+		if f.Message == "function unused is unused" {
+			assert.Equal(t, "store/store.go", f.File)
+			assert.Equal(t, 26, f.Line)
+		}
+	}
+
+	// Exported symbols must be used inside the module
+	exported := messages(svc.FindDeadCode(files, graph, analyzer.DeadCodeOptions{Exported: true}))
+	assert.Contains(t, exported, "function Unused is unused")
+	assert.Contains(t, exported, "field Name is unused")
+	assert.NotContains(t, exported, "struct Store is unused")
+	assert.NotContains(t, exported, "method Add is unused")
+	assert.NotContains(t, exported, "field Tag is unused") // tagged for encoders
+
+	// Tests and main packages keep what they use
+	rooted := messages(svc.FindDeadCode(files, graph, analyzer.DeadCodeOptions{MainAndTestsAsRoots: true}))
+	assert.NotContains(t, rooted, "function onlyTests is unused")
+	assert.NotContains(t, rooted, "function tool is unused")
+	assert.Contains(t, rooted, "function unused is unused")
+}
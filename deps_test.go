@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestParseDependencies tests the manifests and lockfiles of each
+// ecosystem, the dependency nodes of the code graph and the changes
+// between two trees
+func TestParseDependencies(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": `module example.com/app
+
+go 1.22
+
+require (
+	github.com/gin-gonic/gin v1.9.1
+	golang.org/x/text v0.14.0 // indirect
+)
+
+require github.com/old/lib v1.0.0
+
+replace github.com/old/lib => github.com/old/lib v1.0.1
+`,
+		"go.sum": "github.com/gin-gonic/gin v1.9.1 h1:abc=\ngithub.com/gin-gonic/gin v1.9.1/go.mod h1:def=\n",
+		"api/api.go": `package api
+
+import "github.com/gin-gonic/gin/binding"
+
+// Bind returns the JSON binding
+func Bind() interface{} { return binding.JSON }
+`,
+		"web/package.json": `{"dependencies": {"lodash": "^4.17.0", "@babel/core": "^7.0.0"}, "devDependencies": {"jest": "^29.0.0"}}`,
+		"web/package-lock.json": `{"lockfileVersion": 3, "packages": {
+	"": {"name": "web"},
+	"node_modules/lodash": {"version": "4.17.21"},
+	"node_modules/@babel/core": {"version": "7.23.0", "dependencies": {"debug": "^4.1.0"}},
+	"node_modules/debug": {"version": "4.3.4"},
+	"node_modules/jest": {"version": "29.7.0", "dev": true}
+}}`,
+		"web/app.js":        "import _ from 'lodash/fp';\nimport core from '@babel/core';\n\nexport function run() {\n  return _;\n}\n",
+		"site/package.json": `{"dependencies": {"left-pad": "^1.1.0"}}`,
+		"site/yarn.lock": `# yarn lockfile v1
+
+"left-pad@^1.1.0", left-pad@^1.2.0:
+  version "1.3.0"
+  resolved "https://registry.yarnpkg.com/left-pad/-/left-pad-1.3.0.tgz"
+`,
+		"py/requirements.txt": "# pinned\nRequests[socks]==2.31.0\nflask>=2.0 ; python_version > '3.8'\n-r other.txt\n",
+		"py/pyproject.toml": `[project]
+name = "svc"
+dependencies = [
+  "pydantic>=2",
+  "PyYAML==6.0.1",
+]
+
+[project.optional-dependencies]
+test = ["pytest>=7"]
+
+[tool.poetry.group.dev.dependencies]
+black = "23.1.0"
+`,
+		"py/app.py": "import requests\nimport yaml\n\ndef fetch():\n    return requests.get('x')\n",
+		"java/pom.xml": `<project>
+  <groupId>com.example</groupId>
+  <version>1.0.0</version>
+  <properties><jackson.version>2.15.2</jackson.version></properties>
+  <dependencyManagement><dependencies>
+    <dependency><groupId>org.slf4j</groupId><artifactId>slf4j-api</artifactId><version>2.0.9</version></dependency>
+  </dependencies></dependencyManagement>
+  <dependencies>
+    <dependency><groupId>com.fasterxml.jackson.core</groupId><artifactId>jackson-databind</artifactId><version>${jackson.version}</version></dependency>
+    <dependency><groupId>org.slf4j</groupId><artifactId>slf4j-api</artifactId></dependency>
+    <dependency><groupId>junit</groupId><artifactId>junit</artifactId><version>[4.0,5.0)</version><scope>test</scope></dependency>
+  </dependencies>
+</project>
+`,
+	})
+	svc := analyzer.NewService()
+	deps, depErrs, err := svc.ParseDependencies(root)
+	require.NoError(t, err)
+	assert.Empty(t, depErrs)
+
+	byName := make(map[string]analyzer.Dependency)
+	for _, d := range deps {
+		byName[d.Ecosystem+" "+d.Name] = d
+	}
+	assert.Len(t, deps, 17)
+
+	gin := byName["Go github.com/gin-gonic/gin"]
+	assert.Equal(t, "v1.9.1", gin.Version)
+	assert.True(t, gin.Direct)
+	assert.Equal(t, "h1:abc=", gin.Hash)
+	assert.False(t, byName["Go golang.org/x/text"].Direct)
+	assert.Equal(t, "v1.0.1", byName["Go github.com/old/lib"].Version)
+
+	lodash := byName["npm lodash"]
+	assert.Equal(t, "4.17.21", lodash.Version)
+	assert.Equal(t, "^4.17.0", lodash.Constraint)
+	assert.Equal(t, "web/package.json", lodash.Manifest)
+	assert.Equal(t, "dev", byName["npm jest"].Scope)
+	debug := byName["npm debug"]
+	assert.False(t, debug.Direct)
+	assert.Equal(t, "web/package-lock.json", debug.Manifest)
+	assert.Equal(t, "1.3.0", byName["npm left-pad"].Version)
+
+	assert.Equal(t, "2.31.0", byName["PyPI requests"].Version)
+	assert.Equal(t, ">=2.0", byName["PyPI flask"].Constraint)
+	assert.Empty(t, byName["PyPI flask"].Version)
+	assert.Equal(t, "6.0.1", byName["PyPI pyyaml"].Version)
+	assert.Equal(t, "test", byName["PyPI pytest"].Scope)
+	assert.Equal(t, "dev", byName["PyPI black"].Scope)
+	assert.Equal(t, "23.1.0", byName["PyPI black"].Version)
+
+	assert.Equal(t, "2.15.2", byName["Maven com.fasterxml.jackson.core:jackson-databind"].Version)
+	assert.Equal(t, "2.0.9", byName["Maven org.slf4j:slf4j-api"].Version)
+	junit := byName["Maven junit:junit"]
+	assert.Equal(t, "[4.0,5.0)", junit.Constraint)
+	assert.Equal(t, "test", junit.Scope)
+
+	// Imported packages depend on the dependencies providing them
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+	graph = svc.AddDependencyNodes(graph, deps)
+	edges := graphEdges(graph)
+	assert.Contains(t, edges, "pkg:github.com/gin-gonic/gin/binding depends_on dep:Go:github.com/gin-gonic/gin")
+	assert.Contains(t, edges, "pkg:lodash/fp depends_on dep:npm:lodash")
+	assert.Contains(t, edges, "pkg:@babel/core depends_on dep:npm:@babel/core")
+	assert.Contains(t, edges, "dep:npm:@babel/core depends_on dep:npm:debug")
+	assert.Contains(t, edges, "pkg:requests depends_on dep:PyPI:requests")
+	for _, node := range graph {
+		if node.ID == "dep:npm:lodash" {
+			assert.Equal(t, analyzer.NodeDependency, node.Type)
+			assert.Equal(t, "4.17.21", node.Properties["version"])
+		}
+	}
+	assert.Len(t, graphEdges(svc.AddDependencyNodes(graph, deps)), len(edges))
+
+	// Changes between two trees
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	}
+	write("py/requirements.txt", "requests==2.28.0\nurllib3==2.0.7\n")
+	write("web/package-lock.json", `{"lockfileVersion": 3, "packages": {
+	"node_modules/lodash": {"version": "4.17.21"},
+	"node_modules/@babel/core": {"version": "7.24.0-rc.1"},
+	"node_modules/jest": {"version": "29.7.0", "dev": true}
+}}`)
+	head, _, err := svc.ParseDependencies(root)
+	require.NoError(t, err)
+	changes := make(map[string]analyzer.DependencyChange)
+	for _, c := range analyzer.DiffDependencies(deps, head) {
+		changes[c.Name] = c
+	}
+	assert.Len(t, changes, 5)
+	assert.Equal(t, analyzer.DependencyChange{Ecosystem: "PyPI", Name: "requests", Manifest: "py/requirements.txt", Kind: "downgraded", From: "2.31.0", To: "2.28.0", Direct: true}, changes["requests"])
+	assert.Equal(t, "added", changes["urllib3"].Kind)
+	assert.Equal(t, "removed", changes["flask"].Kind)
+	assert.Equal(t, "removed", changes["debug"].Kind)
+	assert.Equal(t, "upgraded", changes["@babel/core"].Kind)
+
+	// A broken manifest is reported without hiding the others, and a
+	// lockfile without packages leaves the declared dependencies once
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "broken"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "ui"), 0755))
+	write("broken/pom.xml", "<project><dependencies>")
+	write("ui/package.json", `{"dependencies": {"react": "^18.0.0"}}`)
+	write("ui/package-lock.json", `{"lockfileVersion": 3, "packages": {}}`)
+	again, depErrs, err := svc.ParseDependencies(root)
+	require.NoError(t, err)
+	require.Len(t, depErrs, 1)
+	assert.Equal(t, "broken/pom.xml", depErrs[0].Path)
+	assert.Contains(t, depErrs[0].Error, "failed to parse broken/pom.xml")
+	assert.Len(t, again, len(head)+1)
+	var react []analyzer.Dependency
+	for _, d := range again {
+		if d.Name == "react" {
+			react = append(react, d)
+		}
+	}
+	require.Len(t, react, 1)
+	assert.Equal(t, "^18.0.0", react[0].Constraint)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+const fixSource = `package users
+
+import "strconv"
+
+// User is a stored user
+type User struct {
+	Name string
+}
+
+// Load parses the id of a user
+func Load(u *User, ids []int, i int) (int, error) {
+	// the name holds the id
+	n, _ := strconv.Atoi(u.Name)
+	return n + ids[i], nil
+}
+`
+
+// TestSuggestFixes tests patches generated for a diagnosed nil dereference
+func TestSuggestFixes(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod":         "module example.com/app\n\ngo 1.22\n",
+		"users/users.go": fixSource,
+	})
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+
+	suspect := "func:example.com/app/users.Load"
+	diagnoses, err := svc.DiagnoseRootCauseWithOptions([]string{suspect}, graph, analyzer.DiagnoseOptions{
+		RepoPath: root,
+		Logs: []analyzer.ErrorLog{{
+			Message: "panic: runtime error: invalid memory address or nil pointer dereference",
+			Frames:  []analyzer.StackFrame{{File: "users/users.go", Line: 13}},
+		}},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, diagnoses)
+	require.Equal(t, "nil-dereference", diagnoses[0].RuleID)
+
+	patches, err := svc.SuggestFixes(root, diagnoses[:1], graph)
+	require.NoError(t, err)
+	require.Len(t, patches, 2)
+
+	assert.Equal(t, suspect, patches[0].NodeID)
+	assert.Equal(t, "nil-dereference", patches[0].RuleID)
+	assert.Equal(t, "handle-ignored-error", patches[0].Fix)
+	assert.Equal(t, `--- a/users/users.go
++++ b/users/users.go
+@@ -10,6 +10,9 @@
+ // Load parses the id of a user
+ func Load(u *User, ids []int, i int) (int, error) {
+ 	// the name holds the id
+-	n, _ := strconv.Atoi(u.Name)
++	n, err := strconv.Atoi(u.Name)
++	if err != nil {
++		return 0, err
++	}
+ 	return n + ids[i], nil
+ }
+`, patches[0].Diff)
+
+	assert.Equal(t, "nil-check-params", patches[1].Fix)
+	assert.Contains(t, patches[1].Diff, "-import \"strconv\"\n+import (\n+\t\"errors\"\n+\t\"strconv\"\n+)\n")
+	assert.Contains(t, patches[1].Diff, "+\tif u == nil {\n+\t\treturn 0, errors.New(\"u is nil\")\n+\t}\n \t// the name holds the id\n")
+
+	// Fixes that do not apply produce no patch
+	patches, err = svc.SuggestFixes(root, []analyzer.Diagnosis{{NodeID: suspect, RuleID: "deadlock", Fixes: []string{"defer-unlock"}}}, graph)
+	require.NoError(t, err)
+	assert.Empty(t, patches)
+
+	// Only discarded values of type error are handled, without clashing
+	// with another err
+	err = os.WriteFile(filepath.Join(root, "users", "parse.go"), []byte(`package users
+
+import (
+	"strconv"
+
+	"example.com/ext"
+)
+
+// Pair discards a second int
+func Pair() (int, int) { return 1, 2 }
+
+// Parse parses values
+func Parse(s string) (int, error) {
+	a, _ := Pair()
+	b, _ := ext.Do(s)
+	c, _ := strconv.Atoi(s)
+	if c > 0 {
+		d, _ := strconv.Atoi(s)
+		c += d
+		err := strconv.ErrRange
+		return c, err
+	}
+	return a + b + c, nil
+}
+`), 0644)
+	require.NoError(t, err)
+	files, err = svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err = svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+	patches, err = svc.SuggestFixes(root, []analyzer.Diagnosis{{NodeID: "func:example.com/app/users.Parse", RuleID: "nil-dereference", Fixes: []string{"handle-ignored-error"}}}, graph)
+	require.NoError(t, err)
+	require.Len(t, patches, 1)
+	assert.Equal(t, `--- a/users/parse.go
++++ b/users/parse.go
+@@ -13,7 +13,10 @@
+ func Parse(s string) (int, error) {
+ 	a, _ := Pair()
+ 	b, _ := ext.Do(s)
+-	c, _ := strconv.Atoi(s)
++	c, err := strconv.Atoi(s)
++	if err != nil {
++		return 0, err
++	}
+ 	if c > 0 {
+ 		d, _ := strconv.Atoi(s)
+ 		c += d
+`, patches[0].Diff)
+}
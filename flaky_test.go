@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+	"github.com/teathis/codeanalyzer/internal/validation"
+)
+
+// goTestOutput renders go test -json events for the given test outcomes
+func goTestOutput(pkg string, outcomes map[string]string, elapsed float64) string {
+	var sb strings.Builder
+	sb.WriteString(`{"Action":"start","Package":"` + pkg + `"}` + "\n")
+	for test, action := range outcomes {
+		sb.WriteString(`{"Action":"run","Package":"` + pkg + `","Test":"` + test + `"}` + "\n")
+		sb.WriteString(`{"Action":"output","Package":"` + pkg + `","Test":"` + test + `","Output":"=== RUN ` + test + `\n"}` + "\n")
+		sb.WriteString(`{"Action":"` + action + `","Package":"` + pkg + `","Test":"` + test + `","Elapsed":` + fmt.Sprintf("%g", elapsed) + "}\n")
+	}
+	sb.WriteString("# build output that is not JSON\n")
+	sb.WriteString(`{"Action":"fail","Package":"` + pkg + `","Elapsed":1.5}` + "\n")
+	return sb.String()
+}
+
+// TestDetectFlakyTests tests pass rates, timing spread and graph
+// correlation of tests over repeated runs, and the down-weighting of
+// flaky failures in localization
+func TestDetectFlakyTests(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"store/store.go": `package store
+
+// Fetch fetches
+func Fetch() string { return "" }
+
+// Parse parses
+func Parse() string { return "" }
+`,
+		"store/store_test.go": `package store
+
+import "testing"
+
+func TestFetch(t *testing.T) {
+	if Fetch() != "" {
+		t.Fatal("unexpected")
+	}
+}
+
+func TestParse(t *testing.T) {
+	if Parse() != "" {
+		t.Fatal("unexpected")
+	}
+}
+`,
+	})
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+
+	results := analyzer.ParseGoTestJSON(goTestOutput("example.com/app/store", map[string]string{"TestFetch": "fail"}, 2))
+	require.Len(t, results, 1, "package events and other lines are ignored")
+	assert.Equal(t, analyzer.TestResult{Package: "example.com/app/store", Test: "TestFetch", Action: "fail", Elapsed: 2}, results[0])
+
+	var runs []analyzer.TestRun
+	for i, fetch := range []string{"pass", "fail", "pass", "pass"} {
+		output := goTestOutput("example.com/app/store", map[string]string{
+			"TestFetch":     fetch,
+			"TestParse":     "pass",
+			"TestParse/sub": "skip",
+		}, float64(i+1))
+		runs = append(runs, analyzer.TestRun{Source: "upload", Results: analyzer.ParseGoTestJSON(output)})
+	}
+
+	report := svc.DetectFlakyTests(runs, graph)
+	assert.Equal(t, 4, report.Runs)
+	assert.Equal(t, 1, report.Flaky)
+	require.Len(t, report.Tests, 3)
+	fetch := report.Tests[0]
+	assert.Equal(t, "TestFetch", fetch.Test)
+	assert.True(t, fetch.Flaky)
+	assert.Equal(t, 0.75, fetch.PassRate)
+	assert.Equal(t, 2.5, fetch.MeanSeconds)
+	assert.InDelta(t, 1.118, fetch.StdDevSeconds, 0.001)
+	assert.Equal(t, "func:example.com/app/store.TestFetch", fetch.NodeID)
+	assert.Equal(t, []string{"func:example.com/app/store.Fetch"}, fetch.Covers)
+
+	assert.Equal(t, "TestParse", report.Tests[1].Test)
+	assert.False(t, report.Tests[1].Flaky)
+	assert.Equal(t, 1.0, report.Tests[1].PassRate)
+	sub := report.Tests[2]
+	assert.Equal(t, 4, sub.Skipped)
+	assert.Equal(t, "func:example.com/app/store.TestParse", sub.NodeID, "subtests map to their parent")
+	assert.Equal(t, map[string]bool{"func:example.com/app/store.TestFetch": true}, report.FlakyNodes())
+
+	// Runs are kept in the repository's test history
+	history, err := svc.RecordTestRuns(root, runs[:2])
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+	_, err = svc.RecordTestRuns(root, runs[2:])
+	require.NoError(t, err)
+	history, err = svc.LoadTestHistory(root)
+	require.NoError(t, err)
+	require.Len(t, history, 4)
+	assert.False(t, history[0].CreatedAt.IsZero())
+	assert.Equal(t, report, svc.DetectFlakyTests(history, graph))
+
+	// Failures in a flaky test weigh less than those in a stable one
+	seeds := []string{"func:example.com/app/store.TestFetch", "func:example.com/app/store.TestParse"}
+	score := func(suspects []analyzer.Suspect, id string) float64 {
+		for _, s := range suspects {
+			if s.NodeID == id {
+				return s.Score
+			}
+		}
+		return 0
+	}
+	opts := analyzer.DefaultLocalizeOptions()
+	before := svc.RankSuspects(seeds, graph, opts)
+	opts.FlakyTests = report.FlakyNodes()
+	after := svc.RankSuspects(seeds, graph, opts)
+	assert.Less(t, score(after, seeds[0])/score(after, seeds[1]), score(before, seeds[0])/score(before, seeds[1]))
+	assert.Equal(t, seeds[1], svc.LocalizeErrorsWithOptions(seeds, graph, opts)[0])
+
+	// The down-weight holds when every failure is in a flaky test
+	flakyOnly := seeds[:1]
+	opts.FlakyTests = nil
+	stable := svc.RankSuspects(flakyOnly, graph, opts)
+	opts.FlakyTests = report.FlakyNodes()
+	flaky := svc.RankSuspects(flakyOnly, graph, opts)
+	require.NotEmpty(t, flaky)
+	assert.Less(t, score(flaky, seeds[0]), score(stable, seeds[0]))
+	for i := range flaky {
+		for _, s := range stable {
+			if s.NodeID == flaky[i].NodeID {
+				assert.InDelta(t, opts.FlakyWeight*s.Propagation, flaky[i].Propagation, 1e-9)
+			}
+		}
+	}
+
+	// Repeated runs only take package patterns, never flags
+	validator := validation.NewService(svc)
+	for _, pkg := range []string{"-exec=sh", "./store -run=x", "../other", "./../other", "store/../..", "./store/.hidden"} {
+		_, err := validator.RunTestsRepeatedly(context.Background(), root, pkg, 1, validation.DefaultOptions(root))
+		assert.Error(t, err, pkg)
+	}
+	runs, err = validator.RunTestsRepeatedly(context.Background(), root, "./store/...", 2, validation.DefaultOptions(root))
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Len(t, runs[0].Results, 2)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// graphEdges lists the edges of a graph as "source type target" strings
+func graphEdges(graph []analyzer.GraphNode) []string {
+	var edges []string
+	for _, node := range graph {
+		edges = append(edges, "node "+node.ID)
+		for _, e := range node.Edges {
+			edges = append(edges, node.ID+" "+e.Type+" "+e.Target)
+		}
+	}
+	sort.Strings(edges)
+	return edges
+}
+
+// TestAnalyzeIncremental tests that only changed files and their
+// dependents are re-analyzed, and that the result matches a full analysis
+func TestAnalyzeIncremental(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"store/store.go": `package store
+
+// Get returns a value
+func Get(k string) string { return k }
+`,
+		"store/keys.go":  "package store\n\n// Key is a key\ntype Key string\n",
+		"api/api.go":     "package api\n\nimport \"example.com/app/store\"\n\n// Handle serves a key\nfunc Handle(k string) string { return store.Get(k) }\n",
+		"util/util.go":   "package util\n\nimport \"strings\"\n\n// Upper upper-cases\nfunc Upper(s string) string { return strings.ToUpper(s) }\n",
+		"web/app.js":     "import { helper } from './helper';\n\nfunction main() {\n  return helper();\n}\n",
+		"web/helper.js":  "export function helper() {\n  return 1;\n}\n",
+		"web/other.js":   "function other() {\n  return 2;\n}\n",
+		"native/main.cc": "int main() { return 0; }\n",
+	})
+	svc := analyzer.NewService()
+	analyze := func() *analyzer.IncrementalResult {
+		files, err := svc.IndexSourceFiles(root)
+		require.NoError(t, err)
+		result, err := svc.AnalyzeIncremental(root, files)
+		require.NoError(t, err)
+
+		// The incremental result matches a full analysis
+		graph, err := svc.BuildCodeKnowledgeGraph(files)
+		require.NoError(t, err)
+		assert.Equal(t, graphEdges(graph), graphEdges(result.Graph))
+		findings, err := svc.RunStaticAnalysis(files)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, findings, result.Findings)
+		return result
+	}
+
+	first := analyze()
+	assert.Equal(t, analyzer.CacheStats{Files: 8, Changed: 8}, first.Stats)
+
+	second := analyze()
+	assert.Equal(t, analyzer.CacheStats{Files: 8, Hits: 8, HitRate: 1}, second.Stats)
+
+	// A change to a package re-analyzes the package and its importers
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	}
+	write("store/store.go", "package store\n\n// Get returns a value\nfunc Get(k string) string { return lookup(k) }\n\nfunc lookup(k string) string { return k }\n")
+	third := analyze()
+	assert.Equal(t, 1, third.Stats.Changed)
+	assert.Equal(t, 2, third.Stats.Dependents) // store/keys.go and api/api.go
+	assert.Equal(t, 5, third.Stats.Hits)
+	assert.InDelta(t, 5.0/8, third.Stats.HitRate, 1e-9)
+
+	// Imports between other languages are followed too
+	write("web/helper.js", "export function helper() {\n  return 3;\n}\n")
+	fourth := analyze()
+	assert.Equal(t, 1, fourth.Stats.Changed)
+	assert.Equal(t, 1, fourth.Stats.Dependents)
+
+	// Removing a file re-analyzes its dependents
+	require.NoError(t, os.Remove(filepath.Join(root, "store/keys.go")))
+	fifth := analyze()
+	assert.Equal(t, 1, fifth.Stats.Removed)
+	assert.Equal(t, 0, fifth.Stats.Changed)
+	assert.Equal(t, 2, fifth.Stats.Dependents)
+
+	// Rules are part of the cache key
+	require.NoError(t, os.MkdirAll(filepath.Join(root, analyzer.RulesDir), 0755))
+	write(filepath.Join(analyzer.RulesDir, "extra.yaml"), "rules: []\n")
+	sixth := analyze()
+	assert.Equal(t, 0, sixth.Stats.Hits)
+}
+
+// TestAnalyzeIncrementalInterfaces tests that calls through interfaces keep
+// their targets in packages the caller does not import
+func TestAnalyzeIncrementalInterfaces(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod":     "module example.com/app\n\ngo 1.22\n",
+		"api/api.go": "package api\n\n// Store holds values\ntype Store interface {\n\tGet() string\n}\n",
+		"svc/svc.go": "package svc\n\nimport \"example.com/app/api\"\n\n// Use reads the store\nfunc Use(s api.Store) string { return s.Get() }\n",
+		"impl/mem.go": `package impl
+
+// Mem is an in-memory store
+type Mem struct{}
+
+// Get returns the value
+func (Mem) Get() string { return "" }
+`,
+	})
+	svc := analyzer.NewService()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	}
+	analyze := func() *analyzer.IncrementalResult {
+		files, err := svc.IndexSourceFiles(root)
+		require.NoError(t, err)
+		result, err := svc.AnalyzeIncremental(root, files)
+		require.NoError(t, err)
+		graph, err := svc.BuildCodeKnowledgeGraph(files)
+		require.NoError(t, err)
+		assert.Equal(t, graphEdges(graph), graphEdges(result.Graph))
+		return result
+	}
+	dispatch := "func:example.com/app/svc.Use calls method:example.com/app/impl.Mem.Get"
+
+	assert.Contains(t, graphEdges(analyze().Graph), dispatch)
+
+	// A comment-only edit to the caller keeps the dispatch edge
+	write("svc/svc.go", "package svc\n\nimport \"example.com/app/api\"\n\n// Use reads the given store\nfunc Use(s api.Store) string { return s.Get() }\n")
+	edited := analyze()
+	assert.Contains(t, graphEdges(edited.Graph), dispatch)
+	assert.Equal(t, 1, edited.Stats.Changed)
+
+	// A new implementation refreshes the callers and the interface
+	write("impl/disk.go", "package impl\n\n// Disk is an on-disk store\ntype Disk struct{}\n\n// Get returns the value\nfunc (Disk) Get() string { return \"\" }\n")
+	added := analyze()
+	assert.Contains(t, graphEdges(added.Graph), "func:example.com/app/svc.Use calls method:example.com/app/impl.Disk.Get")
+	assert.Equal(t, 1, added.Stats.Changed)
+	assert.Positive(t, added.Stats.Dependents)
+}
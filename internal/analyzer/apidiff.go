@@ -0,0 +1,418 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// Kinds of API objects
+const (
+	APIFunc            = "func"
+	APIVar             = "var"
+	APIConst           = "const"
+	APIType            = "type"
+	APIMethod          = "method"
+	APIField           = "field"
+	APIInterfaceMethod = "interface method"
+)
+
+// API is the exported API of the Go packages of a tree, by import path
+type API map[string]*PackageAPI
+
+// PackageAPI is the exported API of a Go package. Methods, fields and
+// interface methods are named after their type, as in "Client.Do".
+type PackageAPI struct {
+	Path    string               `json:"path"`
+	Objects map[string]APIObject `json:"objects"`
+}
+
+// APIObject is an exported declaration
+type APIObject struct {
+	Kind       string `json:"kind"`
+	Type       string `json:"type,omitempty"`       // signature, type expression or underlying kind; const values follow " = "
+	Pointer    bool   `json:"pointer,omitempty"`    // method with a pointer receiver
+	Comparable bool   `json:"comparable,omitempty"` // type usable with ==
+	Sealed     bool   `json:"sealed,omitempty"`     // interface with unexported methods, which other packages cannot implement
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+}
+
+// APIChange is a difference between two versions of a package API
+type APIChange struct {
+	Package  string `json:"package"`
+	Symbol   string `json:"symbol"`
+	Kind     string `json:"kind"` // added, removed, renamed or changed
+	Breaking bool   `json:"breaking"`
+	Message  string `json:"message"`
+	Old      string `json:"old,omitempty"`
+	New      string `json:"new,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// APIReport lists the API changes between two trees
+type APIReport struct {
+	Changes    []APIChange `json:"changes"`
+	Breaking   int         `json:"breaking"`
+	Compatible int         `json:"compatible"`
+	Bump       string      `json:"bump"` // semantic version part to increase: major, minor or patch
+}
+
+// ExtractAPI returns the exported API of the importable Go packages of a
+// tree: main, test and internal packages are left out. Types are read
+// from the declarations, as packages outside the repository are not
+// type-checked.
+func (s *Service) ExtractAPI(files []SourceFile) API {
+	prog := loadGoProgram(files)
+	api := make(API)
+	for _, pkg := range prog.Packages {
+		if pkg.Name == "main" || strings.HasSuffix(pkg.ImportPath, "_test") || isInternalPackage(pkg.ImportPath) {
+			continue
+		}
+		p := &PackageAPI{Path: pkg.ImportPath, Objects: make(map[string]APIObject)}
+		for _, file := range pkg.Files {
+			if strings.HasSuffix(file.Path, "_test.go") {
+				continue
+			}
+			addFileAPI(p, prog.Fset, pkg, file)
+		}
+		api[pkg.ImportPath] = p
+	}
+	return api
+}
+
+// isInternalPackage reports whether a package can only be imported from
+// its own module tree
+func isInternalPackage(importPath string) bool {
+	return importPath == "internal" || strings.HasPrefix(importPath, "internal/") ||
+		strings.Contains(importPath, "/internal/") || strings.HasSuffix(importPath, "/internal")
+}
+
+// addFileAPI adds the exported declarations of a file
+func addFileAPI(p *PackageAPI, fset *token.FileSet, pkg *goPackage, file *goFile) {
+	add := func(name string, pos token.Pos, obj APIObject) {
+		obj.File, obj.Line = file.Path, fset.Position(pos).Line
+		p.Objects[name] = obj
+	}
+
+	for _, decl := range file.AST.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			if d.Recv == nil {
+				add(d.Name.Name, d.Name.Pos(), APIObject{Kind: APIFunc, Type: signatureString(d.Type)})
+				continue
+			}
+			if len(d.Recv.List) == 0 {
+				continue // malformed receiver
+			}
+			recv := d.Recv.List[0].Type
+			_, pointer := recv.(*ast.StarExpr)
+			if base := receiverBase(recv); ast.IsExported(base) {
+				add(base+"."+d.Name.Name, d.Name.Pos(), APIObject{Kind: APIMethod, Type: signatureString(d.Type), Pointer: pointer})
+			}
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.ValueSpec:
+					for i, name := range sp.Names {
+						if !name.IsExported() {
+							continue
+						}
+						obj := APIObject{Kind: APIVar}
+						if d.Tok == token.CONST {
+							obj.Kind = APIConst
+						}
+						if sp.Type != nil {
+							obj.Type = types.ExprString(sp.Type)
+						} else if def := pkg.Info.Defs[name]; def != nil && def.Type() != types.Typ[types.Invalid] {
+							obj.Type = types.TypeString(def.Type(), types.RelativeTo(pkg.Types))
+						}
+						if c, ok := pkg.Info.Defs[name].(*types.Const); ok {
+							value := c.Val().ExactString()
+							if c.Val().Kind() == constant.Unknown && i < len(sp.Values) {
+								value = types.ExprString(sp.Values[i])
+							}
+							obj.Type += " = " + value
+						}
+						add(name.Name, name.Pos(), obj)
+					}
+
+				case *ast.TypeSpec:
+					if sp.Name.IsExported() {
+						addTypeAPI(add, pkg, sp)
+					}
+				}
+			}
+		}
+	}
+}
+
+// addTypeAPI adds an exported type with its exported fields or interface
+// methods
+func addTypeAPI(add func(string, token.Pos, APIObject), pkg *goPackage, sp *ast.TypeSpec) {
+	name := sp.Name.Name
+	obj := APIObject{Kind: APIType, Type: types.ExprString(sp.Type)}
+	if def := pkg.Info.Defs[sp.Name]; def != nil {
+		obj.Comparable = types.Comparable(def.Type())
+	}
+	var tparams string
+	if sp.TypeParams != nil {
+		tparams = "[" + fieldListString(sp.TypeParams, true) + "]"
+	}
+
+	switch t := sp.Type.(type) {
+	case *ast.StructType:
+		obj.Type = "struct"
+		for _, f := range t.Fields.List {
+			fieldType := types.ExprString(f.Type)
+			if len(f.Names) == 0 {
+				// Embedded fields are named after their type
+				if base := receiverBase(f.Type); ast.IsExported(base) {
+					add(name+"."+base, f.Type.Pos(), APIObject{Kind: APIField, Type: "embedded " + fieldType})
+				}
+				continue
+			}
+			for _, n := range f.Names {
+				if n.IsExported() {
+					add(name+"."+n.Name, n.Pos(), APIObject{Kind: APIField, Type: fieldType})
+				}
+			}
+		}
+
+	case *ast.InterfaceType:
+		obj.Type = "interface"
+		for _, m := range t.Methods.List {
+			if len(m.Names) == 0 {
+				// Embedded interfaces and type constraints
+				add(name+"."+types.ExprString(m.Type), m.Type.Pos(), APIObject{Kind: APIInterfaceMethod, Type: "embedded"})
+				continue
+			}
+			for _, n := range m.Names {
+				if !n.IsExported() {
+					obj.Sealed = true
+					continue
+				}
+				if ft, ok := m.Type.(*ast.FuncType); ok {
+					add(name+"."+n.Name, n.Pos(), APIObject{Kind: APIInterfaceMethod, Type: signatureString(ft)})
+				}
+			}
+		}
+	}
+	if sp.Assign.IsValid() {
+		obj.Type = "= " + obj.Type
+	}
+	obj.Type = tparams + obj.Type
+	add(name, sp.Name.Pos(), obj)
+}
+
+// signatureString renders a function type without parameter names, which
+// callers do not depend on
+func signatureString(ft *ast.FuncType) string {
+	var b strings.Builder
+	b.WriteString("func")
+	if ft.TypeParams != nil {
+		b.WriteString("[" + fieldListString(ft.TypeParams, true) + "]")
+	}
+	b.WriteString("(" + fieldListString(ft.Params, false) + ")")
+	if ft.Results != nil && len(ft.Results.List) > 0 {
+		results := fieldListString(ft.Results, false)
+		if len(ft.Results.List) == 1 && len(ft.Results.List[0].Names) <= 1 {
+			b.WriteString(" " + results)
+		} else {
+			b.WriteString(" (" + results + ")")
+		}
+	}
+	return b.String()
+}
+
+// fieldListString renders the types of a parameter list, once per name.
+// Type parameters keep their names, which their constraints refer to.
+func fieldListString(list *ast.FieldList, named bool) string {
+	if list == nil {
+		return ""
+	}
+	var parts []string
+	for _, f := range list.List {
+		typ := types.ExprString(f.Type)
+		if named {
+			var names []string
+			for _, n := range f.Names {
+				names = append(names, n.Name)
+			}
+			parts = append(parts, strings.Join(names, ", ")+" "+typ)
+			continue
+		}
+		for i := 0; i < max(len(f.Names), 1); i++ {
+			parts = append(parts, typ)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// receiverBase returns the type name of a receiver or embedded field
+func receiverBase(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverBase(e.X)
+	case *ast.IndexExpr:
+		return receiverBase(e.X)
+	case *ast.IndexListExpr:
+		return receiverBase(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// CompareAPI classifies the API changes between two trees following the
+// apidiff rules: removing or changing anything is breaking, and so is
+// adding a method to an interface others may implement or making a
+// comparable struct incomparable. Additions are compatible. A removed and
+// an added symbol with the same shape are reported as a rename.
+func CompareAPI(base, head API) *APIReport {
+	report := &APIReport{}
+	for _, path := range sortedKeys(base) {
+		if _, ok := head[path]; !ok {
+			report.Changes = append(report.Changes, APIChange{
+				Package: path, Kind: "removed", Breaking: true, Message: "package " + path + " was removed",
+			})
+		}
+	}
+	for _, path := range sortedKeys(head) {
+		old, ok := base[path]
+		if !ok {
+			report.Changes = append(report.Changes, APIChange{
+				Package: path, Kind: "added", Message: "package " + path + " was added",
+			})
+			continue
+		}
+		report.Changes = append(report.Changes, comparePackageAPI(old, head[path])...)
+	}
+
+	for _, c := range report.Changes {
+		if c.Breaking {
+			report.Breaking++
+		} else {
+			report.Compatible++
+		}
+	}
+	switch {
+	case report.Breaking > 0:
+		report.Bump = "major"
+	case report.Compatible > 0:
+		report.Bump = "minor"
+	default:
+		report.Bump = "patch"
+	}
+	return report
+}
+
+// comparePackageAPI compares two versions of a package
+func comparePackageAPI(old, cur *PackageAPI) []APIChange {
+	var changes []APIChange
+	change := func(symbol, kind string, breaking bool, msg string, before, after *APIObject) {
+		c := APIChange{Package: cur.Path, Symbol: symbol, Kind: kind, Breaking: breaking, Message: msg}
+		if before != nil {
+			c.Old, c.File, c.Line = before.Type, before.File, before.Line
+		}
+		if after != nil {
+			c.New, c.File, c.Line = after.Type, after.File, after.Line
+		}
+		changes = append(changes, c)
+	}
+	// Members of added or removed types are covered by their type
+	inBoth := func(symbol string) bool {
+		parent, _, ok := strings.Cut(symbol, ".")
+		if !ok {
+			return true
+		}
+		_, inOld := old.Objects[parent]
+		_, inCur := cur.Objects[parent]
+		return inOld && inCur
+	}
+
+	removed, added := renameCandidates(old, cur)
+	renamed := make(map[string]bool)
+	for shape, from := range removed {
+		to, ok := added[shape]
+		if !ok || len(from) != 1 || len(to) != 1 {
+			continue
+		}
+		before, after := old.Objects[from[0]], cur.Objects[to[0]]
+		renamed[from[0]], renamed[to[0]] = true, true
+		change(from[0], "renamed", true, from[0]+" was renamed to "+to[0], &before, &after)
+	}
+
+	for _, symbol := range sortedKeys(old.Objects) {
+		before := old.Objects[symbol]
+		after, ok := cur.Objects[symbol]
+		switch {
+		case renamed[symbol] || !inBoth(symbol):
+		case !ok:
+			change(symbol, "removed", true, before.Kind+" "+symbol+" was removed", &before, nil)
+		case before.Kind != after.Kind:
+			change(symbol, "changed", true, symbol+" changed from "+before.Kind+" to "+after.Kind, &before, &after)
+		case before.Kind == APIMethod && before.Pointer != after.Pointer:
+			if after.Pointer {
+				change(symbol, "changed", true, "method "+symbol+" now has a pointer receiver", &before, &after)
+			} else {
+				change(symbol, "changed", false, "method "+symbol+" now has a value receiver", &before, &after)
+			}
+		case before.Type != after.Type && before.Type != "" && after.Type != "":
+			change(symbol, "changed", true, before.Kind+" "+symbol+" changed from "+before.Type+" to "+after.Type, &before, &after)
+		case before.Kind == APIType && before.Comparable && !after.Comparable:
+			change(symbol, "changed", true, "type "+symbol+" is no longer comparable", &before, &after)
+		}
+	}
+
+	for _, symbol := range sortedKeys(cur.Objects) {
+		after := cur.Objects[symbol]
+		if _, ok := old.Objects[symbol]; ok || renamed[symbol] || !inBoth(symbol) {
+			continue
+		}
+		if after.Kind == APIInterfaceMethod {
+			parent, _, _ := strings.Cut(symbol, ".")
+			if !old.Objects[parent].Sealed {
+				change(symbol, "added", true, "method "+symbol+" was added to an interface others may implement", nil, &after)
+				continue
+			}
+		}
+		change(symbol, "added", false, after.Kind+" "+symbol+" was added", nil, &after)
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Symbol < changes[j].Symbol })
+	return changes
+}
+
+// renameCandidates groups the top-level symbols only in the old or the
+// new package by their shape: kind, type and members
+func renameCandidates(old, cur *PackageAPI) (map[string][]string, map[string][]string) {
+	group := func(p, other *PackageAPI) map[string][]string {
+		shapes := make(map[string][]string)
+		for _, symbol := range sortedKeys(p.Objects) {
+			if _, ok := other.Objects[symbol]; ok || strings.Contains(symbol, ".") {
+				continue
+			}
+			obj := p.Objects[symbol]
+			shape := obj.Kind + " " + obj.Type
+			for _, member := range sortedKeys(p.Objects) {
+				if rest, ok := strings.CutPrefix(member, symbol+"."); ok {
+					shape += "\x00" + rest + " " + p.Objects[member].Type
+				}
+			}
+			shapes[shape] = append(shapes[shape], symbol)
+		}
+		return shapes
+	}
+	return group(old, cur), group(cur, old)
+}
@@ -0,0 +1,434 @@
+package analyzer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ArchitectureFile holds the layering rules of a repository, relative to
+// the repository root
+const ArchitectureFile = ".codeanalyzer/architecture.yaml"
+
+// Rule IDs of architecture findings
+const (
+	RuleArchitectureViolation = "architecture-violation"
+	RuleImportCycle           = "import-cycle"
+)
+
+// ArchitectureConfig declares the layers of a repository and the imports
+// allowed between them
+type ArchitectureConfig struct {
+	Layers      map[string][]string `json:"layers,omitempty" yaml:"layers"` // layer name -> package patterns
+	Rules       []ArchitectureRule  `json:"rules" yaml:"rules"`
+	AllowCycles bool                `json:"allowCycles,omitempty" yaml:"allowCycles"`
+}
+
+// ArchitectureRule restricts the imports of the packages matching From.
+// Patterns are repository directories or Go import paths, "/..." matching
+// subpackages too, or layer names. Denied packages must not be reached
+// through any chain of imports; when Allow is set, the packages may only
+// import the allowed ones, their own layer and external packages.
+type ArchitectureRule struct {
+	Name  string   `json:"name,omitempty" yaml:"name"`
+	From  []string `json:"from" yaml:"from"`
+	Allow []string `json:"allow,omitempty" yaml:"allow"`
+	Deny  []string `json:"deny,omitempty" yaml:"deny"`
+}
+
+// ArchitectureViolation is an import breaking a rule, or an import cycle
+type ArchitectureViolation struct {
+	Rule  string   `json:"rule"`
+	Kind  string   `json:"kind"` // "denied", "not-allowed" or "cycle"
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Chain []string `json:"chain"` // packages from From to To, each importing the next
+	File  string   `json:"file,omitempty"`
+	Line  int      `json:"line,omitempty"`
+}
+
+// importUnit is a package of the import graph: a Go package, a directory
+// of other sources, or an external package
+type importUnit struct {
+	name       string // repository directory, or import path when external
+	importPath string
+	external   bool
+	imports    map[string]importSite // unit name -> first import of it
+}
+
+// importSite is a file importing another unit
+type importSite struct {
+	file   string
+	target GraphNode
+}
+
+// LoadArchitectureConfig reads the layering rules of a repository, or nil
+// if it has none
+func (s *Service) LoadArchitectureConfig(repoPath string) (*ArchitectureConfig, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, ArchitectureFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read architecture rules: %w", err)
+	}
+	return ParseArchitectureConfig(data)
+}
+
+// ParseArchitectureConfig parses and validates YAML or JSON layering rules
+func ParseArchitectureConfig(data []byte) (*ArchitectureConfig, error) {
+	var config ArchitectureConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse architecture rules: %w", err)
+	}
+	for i, r := range config.Rules {
+		if r.Name == "" {
+			config.Rules[i].Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if len(r.From) == 0 {
+			return nil, fmt.Errorf("architecture rule %s has no from patterns", config.Rules[i].Name)
+		}
+		if len(r.Allow)+len(r.Deny) == 0 {
+			return nil, fmt.Errorf("architecture rule %s has no allow or deny patterns", config.Rules[i].Name)
+		}
+	}
+	return &config, nil
+}
+
+// CheckArchitecture checks the package import graph against layering
+// rules and, unless allowed, reports each import cycle once
+func (s *Service) CheckArchitecture(files []SourceFile, graph []GraphNode, config *ArchitectureConfig) []ArchitectureViolation {
+	units := importUnits(graph)
+	names := sortedKeys(units)
+
+	var violations []ArchitectureViolation
+	for _, rule := range config.Rules {
+		from := config.expand(rule.From)
+		deny := config.expand(rule.Deny)
+		allow := config.expand(rule.Allow)
+		for _, name := range names {
+			u := units[name]
+			if u.external || !u.matches(from) {
+				continue
+			}
+			if len(deny) > 0 {
+				for _, chain := range deniedChains(units, name, deny) {
+					violations = append(violations, ArchitectureViolation{
+						Rule: rule.Name, Kind: "denied", From: name, To: chain[len(chain)-1], Chain: chain,
+					})
+				}
+			}
+			if len(allow) > 0 {
+				for _, target := range sortedKeys(u.imports) {
+					t := units[target]
+					if t.external || t.matches(allow) || t.matches(from) {
+						continue
+					}
+					violations = append(violations, ArchitectureViolation{
+						Rule: rule.Name, Kind: "not-allowed", From: name, To: target, Chain: []string{name, target},
+					})
+				}
+			}
+		}
+	}
+	if !config.AllowCycles {
+		for _, cycle := range importCycles(units, names) {
+			violations = append(violations, ArchitectureViolation{
+				Rule: "cycle", Kind: "cycle", From: cycle[0], To: cycle[1], Chain: cycle,
+			})
+		}
+	}
+
+	// Violations point at the import starting their chain
+	sources := make(map[string]SourceFile)
+	for _, f := range files {
+		sources[f.Path] = f
+	}
+	for i := range violations {
+		v := &violations[i]
+		site := units[v.Chain[0]].imports[v.Chain[1]]
+		v.File = site.file
+		v.Line = importLine(sources[site.file], site.target)
+	}
+	return violations
+}
+
+// ArchitectureFindings returns the findings of architecture violations
+func (s *Service) ArchitectureFindings(violations []ArchitectureViolation) []AnalysisResult {
+	var findings []AnalysisResult
+	for _, v := range violations {
+		rule, msg := RuleArchitectureViolation, ""
+		switch v.Kind {
+		case "denied":
+			msg = fmt.Sprintf("%s must not depend on %s (%s): %s", v.From, v.To, v.Rule, strings.Join(v.Chain, " -> "))
+		case "not-allowed":
+			msg = fmt.Sprintf("%s may not import %s (%s)", v.From, v.To, v.Rule)
+		case "cycle":
+			rule = RuleImportCycle
+			msg = "import cycle: " + strings.Join(v.Chain, " -> ")
+		}
+		findings = append(findings, AnalysisResult{
+			Rule:    rule,
+			File:    v.File,
+			Line:    max(v.Line, 1),
+			Column:  1,
+			Message: msg,
+			Level:   "error",
+		})
+	}
+	return findings
+}
+
+// expand replaces the layer names of a pattern list with their patterns
+func (c *ArchitectureConfig) expand(patterns []string) []string {
+	var expanded []string
+	for _, p := range patterns {
+		if layer, ok := c.Layers[p]; ok {
+			expanded = append(expanded, layer...)
+		} else {
+			expanded = append(expanded, p)
+		}
+	}
+	return expanded
+}
+
+// matches reports whether a unit matches one of the patterns, by its
+// directory or its import path
+func (u *importUnit) matches(patterns []string) bool {
+	for _, p := range patterns {
+		for _, name := range []string{u.name, u.importPath} {
+			if name != "" && matchPackagePattern(p, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPackagePattern matches a package against a pattern. "a/..." covers
+// a and its subpackages, and shell wildcards match one path element.
+func matchPackagePattern(pattern, name string) bool {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/")
+	if base, ok := strings.CutSuffix(pattern, "/..."); ok {
+		if base == "" || base == "." {
+			return true
+		}
+		if ok, _ := path.Match(base, name); ok {
+			return true
+		}
+		for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if ok, _ := path.Match(base, dir); ok {
+				return true
+			}
+		}
+		return false
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// importUnits builds the package import graph: Go packages import each
+// other directly, and the files of other languages are grouped by
+// directory
+func importUnits(graph []GraphNode) map[string]*importUnit {
+	byID := make(map[string]GraphNode, len(graph))
+	for _, node := range graph {
+		byID[node.ID] = node
+	}
+	goFiles := make(map[string]string) // file node -> Go package unit
+	units := make(map[string]*importUnit)
+	unit := func(name, importPath string, external bool) *importUnit {
+		u, ok := units[name]
+		if !ok {
+			u = &importUnit{name: name, importPath: importPath, external: external, imports: make(map[string]importSite)}
+			units[name] = u
+		}
+		return u
+	}
+	unitOf := func(node GraphNode) *importUnit {
+		switch {
+		case node.Type == NodePackage && node.Properties["external"] == true:
+			return unit(node.Package, node.Package, true)
+		case node.Type == NodePackage:
+			return unit(node.Path, node.Package, false)
+		case node.Type == NodeFile:
+			if pkg, ok := goFiles[node.ID]; ok {
+				return units[pkg]
+			}
+			return unit(path.Dir(node.Path), "", false)
+		}
+		return nil
+	}
+
+	for _, node := range graph {
+		if node.Type != NodePackage || node.Properties["external"] == true {
+			continue
+		}
+		u := unitOf(node)
+		for _, e := range node.Edges {
+			if e.Type == EdgeContains {
+				goFiles[e.Target] = u.name
+			}
+		}
+	}
+	for _, node := range graph {
+		if node.Type != NodeFile {
+			continue
+		}
+		from := unitOf(node)
+		for _, e := range node.Edges {
+			target, ok := byID[e.Target]
+			if e.Type != EdgeImports || !ok {
+				continue
+			}
+			to := unitOf(target)
+			if to == nil || to == from {
+				continue
+			}
+			if site, ok := from.imports[to.name]; !ok || node.Path < site.file {
+				from.imports[to.name] = importSite{file: node.Path, target: target}
+			}
+		}
+	}
+	return units
+}
+
+// deniedChains returns the shortest import chain from a unit to each
+// denied unit it reaches, without going through other denied units
+func deniedChains(units map[string]*importUnit, start string, deny []string) [][]string {
+	parent := map[string]string{start: ""}
+	queue := []string{start}
+	var chains [][]string
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if name != start && units[name].matches(deny) {
+			var chain []string
+			for n := name; n != ""; n = parent[n] {
+				chain = append([]string{n}, chain...)
+			}
+			chains = append(chains, chain)
+			continue
+		}
+		for _, next := range sortedKeys(units[name].imports) {
+			if _, seen := parent[next]; !seen {
+				parent[next] = name
+				queue = append(queue, next)
+			}
+		}
+	}
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i][len(chains[i])-1] < chains[j][len(chains[j])-1]
+	})
+	return chains
+}
+
+// importCycles finds the strongly connected components of the internal
+// import graph and returns the shortest cycle through the first package
+// of each
+func importCycles(units map[string]*importUnit, names []string) [][]string {
+	var (
+		index    = make(map[string]int)
+		low      = make(map[string]int)
+		onStack  = make(map[string]bool)
+		stack    []string
+		counter  int
+		cycles   [][]string
+		strongly func(string)
+	)
+	strongly = func(name string) {
+		index[name], low[name] = counter, counter
+		counter++
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, next := range sortedKeys(units[name].imports) {
+			if units[next].external {
+				continue
+			}
+			if _, seen := index[next]; !seen {
+				strongly(next)
+				low[name] = min(low[name], low[next])
+			} else if onStack[next] {
+				low[name] = min(low[name], index[next])
+			}
+		}
+		if low[name] != index[name] {
+			return
+		}
+
+		component := make(map[string]bool)
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			component[n] = true
+			if n == name {
+				break
+			}
+		}
+		if len(component) > 1 {
+			cycles = append(cycles, shortestCycle(units, sortedKeys(component)[0], component))
+		}
+	}
+	for _, name := range names {
+		if _, seen := index[name]; !seen && !units[name].external {
+			strongly(name)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// shortestCycle returns the shortest import chain from a package back to
+// itself within its component
+func shortestCycle(units map[string]*importUnit, start string, component map[string]bool) []string {
+	parent := make(map[string]string)
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, next := range sortedKeys(units[name].imports) {
+			if next == start {
+				chain := []string{start}
+				for n := name; n != start; n = parent[n] {
+					chain = append([]string{n}, chain...)
+				}
+				return append([]string{start}, chain...)
+			}
+			if _, seen := parent[next]; !seen && component[next] {
+				parent[next] = name
+				queue = append(queue, next)
+			}
+		}
+	}
+	return []string{start}
+}
+
+// importLine returns the line of a file importing a graph node
+func importLine(file SourceFile, target GraphNode) int {
+	src, err := readSource(file)
+	if err != nil {
+		return 0
+	}
+	needle := target.Package
+	if target.Type == NodeFile {
+		needle = strings.TrimSuffix(path.Base(target.Path), path.Ext(target.Path))
+	}
+	for i, line := range strings.Split(string(src), "\n") {
+		if strings.Contains(line, `"`+needle+`"`) || strings.Contains(line, "'"+needle+"'") ||
+			(strings.Contains(line, needle) && (strings.Contains(line, "import") || strings.Contains(line, "require"))) {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,183 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BaselineFile stores the accepted findings of a repository, relative to
+// the repository root
+const BaselineFile = ".codeanalyzer/baseline.json"
+
+// Baseline is a set of findings that later analyses are compared with
+type Baseline struct {
+	Ref       string           `json:"ref,omitempty"`
+	Commit    string           `json:"commit,omitempty"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Findings  []AnalysisResult `json:"findings"`
+}
+
+// FindingComparison splits findings relative to a base
+type FindingComparison struct {
+	New       []AnalysisResult `json:"new"`       // only in the head
+	Fixed     []AnalysisResult `json:"fixed"`     // only in the base
+	Unchanged []AnalysisResult `json:"unchanged"` // in both, as found in the head
+}
+
+// AnalyzeFindings indexes and analyzes a repository tree, fingerprints its
+// findings and marks those silenced by inline suppressions
+func (s *Service) AnalyzeFindings(repoPath string) ([]AnalysisResult, *SuppressionReport, error) {
+	files, err := s.IndexSourceFiles(repoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	findings, err := s.RunStaticAnalysis(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph, err := s.BuildCodeKnowledgeGraph(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	findings = append(findings, s.FindDeadCode(files, graph, DeadCodeOptions{})...)
+	architecture, err := s.LoadArchitectureConfig(repoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if architecture != nil {
+		findings = append(findings, s.ArchitectureFindings(s.CheckArchitecture(files, graph, architecture))...)
+	}
+	return s.ApplySuppressions(files, s.FingerprintFindings(repoPath, findings, graph))
+}
+
+// FingerprintFindings sets the fingerprint of each finding: a hash of its
+// rule, the graph node enclosing it and its source line with whitespace
+// normalized, so findings keep their identity when code around them moves.
+// Identical findings in one symbol are told apart by their order.
+func (s *Service) FingerprintFindings(repoPath string, findings []AnalysisResult, graph []GraphNode) []AnalysisResult {
+	idx := newGraphFileIndex(graph)
+	lines := make(map[string][]string) // file -> lines, read once
+
+	order := make([]int, len(findings))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		fa, fb := findings[order[a]], findings[order[b]]
+		if fa.File != fb.File {
+			return fa.File < fb.File
+		}
+		if fa.Line != fb.Line {
+			return fa.Line < fb.Line
+		}
+		return fa.Column < fb.Column
+	})
+
+	result := make([]AnalysisResult, len(findings))
+	copy(result, findings)
+	seen := make(map[string]int)
+	for _, i := range order {
+		f := &result[i]
+		p := normalizeGraphPath(f.File)
+
+		symbol := fileNodeID(p)
+		if node, _ := idx.locate(p, f.Line); node.ID != "" {
+			symbol = node.ID
+		}
+
+		if _, ok := lines[p]; !ok {
+			content, err := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(p)))
+			if err == nil {
+				lines[p] = strings.Split(string(content), "\n")
+			} else {
+				lines[p] = nil
+			}
+		}
+		context := ""
+		if f.Line > 0 && f.Line <= len(lines[p]) {
+			context = strings.Join(strings.Fields(lines[p][f.Line-1]), " ")
+		}
+
+		rule := f.Rule
+		if rule == "" {
+			rule = f.Message
+		}
+		key := rule + "\x00" + symbol + "\x00" + context
+		seen[key]++
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d", key, seen[key])))
+		f.Fingerprint = hex.EncodeToString(sum[:16])
+	}
+	return result
+}
+
+// CompareFindings splits the head findings into new and unchanged ones and
+// reports base findings missing from the head as fixed, by fingerprint
+func CompareFindings(base, head []AnalysisResult) FindingComparison {
+	comparison := FindingComparison{New: []AnalysisResult{}, Fixed: []AnalysisResult{}, Unchanged: []AnalysisResult{}}
+
+	remaining := make(map[string]int)
+	for _, f := range base {
+		remaining[f.Fingerprint]++
+	}
+	for _, f := range head {
+		if remaining[f.Fingerprint] > 0 {
+			remaining[f.Fingerprint]--
+			comparison.Unchanged = append(comparison.Unchanged, f)
+		} else {
+			comparison.New = append(comparison.New, f)
+		}
+	}
+	for _, f := range base {
+		if remaining[f.Fingerprint] > 0 {
+			remaining[f.Fingerprint]--
+			comparison.Fixed = append(comparison.Fixed, f)
+		}
+	}
+	return comparison
+}
+
+// LoadBaseline reads the stored baseline of a repository, or nil if none
+// has been stored
+func (s *Service) LoadBaseline(repoPath string) (*Baseline, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, BaselineFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline: %w", err)
+	}
+	return &baseline, nil
+}
+
+// SaveBaseline stores the baseline of a repository
+func (s *Service) SaveBaseline(repoPath string, baseline *Baseline) error {
+	if baseline.CreatedAt.IsZero() {
+		baseline.CreatedAt = time.Now()
+	}
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode baseline: %w", err)
+	}
+
+	path := filepath.Join(repoPath, BaselineFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create baseline directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BisectVerdict is the outcome of testing one commit
+type BisectVerdict string
+
+// Bisect verdicts; skip marks commits that cannot be tested, e.g. because
+// they do not build
+const (
+	BisectGood BisectVerdict = "good"
+	BisectBad  BisectVerdict = "bad"
+	BisectSkip BisectVerdict = "skip"
+)
+
+// regressionBoost is the share of the remaining confidence added to a
+// diagnosis whose node the culprit commit changed
+const regressionBoost = 0.5
+
+// regressionConfidence is the confidence of a diagnosis made only from the
+// culprit commit touching a node
+const regressionConfidence = 0.5
+
+// BisectTest tests a commit
+type BisectTest func(ctx context.Context, commit string) (BisectVerdict, error)
+
+// BisectOptions configures a bisection
+type BisectOptions struct {
+	Retries   int  // reruns of a failing commit; a commit that passes any run is good
+	VerifyBad bool // test the bad commit before bisecting
+}
+
+// BisectStep is one tested commit
+type BisectStep struct {
+	Commit  string        `json:"commit"`
+	Verdict BisectVerdict `json:"verdict"`
+	Runs    int           `json:"runs"`
+	Flaky   bool          `json:"flaky"` // failed, then passed on a rerun
+}
+
+// BisectResult is the outcome of a bisection
+type BisectResult struct {
+	Culprit    string       `json:"culprit,omitempty"` // first bad commit, when skipped commits do not hide it
+	Candidates []string     `json:"candidates"`        // commits that may have introduced the failure
+	Steps      []BisectStep `json:"steps"`
+}
+
+// LineRange is an inclusive range of lines
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// ChangedFile is a file changed by a commit, with the changed line ranges
+// in its new version
+type ChangedFile struct {
+	Path  string      `json:"path"`
+	Lines []LineRange `json:"lines"`
+}
+
+// Regression is the commit that introduced a failure
+type Regression struct {
+	Commit       string        `json:"commit"`
+	Message      string        `json:"message"`
+	Author       string        `json:"author"`
+	Diff         string        `json:"diff"`
+	Files        []ChangedFile `json:"files"`
+	TouchedNodes []string      `json:"touchedNodes"` // graph nodes the commit changed
+	Bisect       *BisectResult `json:"bisect,omitempty"`
+}
+
+// Bisect finds the first bad commit with a binary search. commits lists
+// the commits after the last known good one, oldest first, ending with the
+// known bad one. Failing commits are rerun up to Retries times to rule out
+// flaky tests, and skipped commits are worked around; when they make the
+// first bad commit ambiguous, every candidate is reported.
+func (s *Service) Bisect(ctx context.Context, commits []string, test BisectTest, opts BisectOptions) (*BisectResult, error) {
+	if len(commits) == 0 {
+		return nil, errors.New("no commits to bisect")
+	}
+
+	result := &BisectResult{Candidates: []string{}, Steps: []BisectStep{}}
+	check := func(i int) (BisectVerdict, error) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		step := BisectStep{Commit: commits[i]}
+		for {
+			verdict, err := test(ctx, commits[i])
+			if err != nil {
+				return "", fmt.Errorf("failed to test commit %s: %w", commits[i], err)
+			}
+			step.Runs++
+			if verdict == BisectGood && step.Runs > 1 {
+				step.Flaky = true
+			}
+			step.Verdict = verdict
+			if verdict != BisectBad || step.Runs > opts.Retries {
+				break
+			}
+		}
+		result.Steps = append(result.Steps, step)
+		return step.Verdict, nil
+	}
+
+	// lo is the last good commit, -1 for the good ref; hi the first bad one
+	lo, hi := -1, len(commits)-1
+	if opts.VerifyBad {
+		verdict, err := check(hi)
+		if err != nil {
+			return nil, err
+		}
+		if verdict != BisectBad {
+			return nil, fmt.Errorf("bad commit %s tested %s", commits[hi], verdict)
+		}
+	}
+
+	skipped := make(map[int]bool)
+	for {
+		next := -1
+		mid := lo + (hi-lo)/2
+		// Try the midpoint first, then the nearest commits not yet skipped
+		for d := 0; d < hi-lo && next < 0; d++ {
+			for _, i := range []int{mid - d, mid + d} {
+				if i > lo && i < hi && !skipped[i] {
+					next = i
+					break
+				}
+			}
+		}
+		if next < 0 {
+			break
+		}
+
+		verdict, err := check(next)
+		if err != nil {
+			return nil, err
+		}
+		switch verdict {
+		case BisectGood:
+			lo = next
+		case BisectBad:
+			hi = next
+		default:
+			skipped[next] = true
+		}
+	}
+
+	for i := lo + 1; i <= hi; i++ {
+		if skipped[i] || i == hi {
+			result.Candidates = append(result.Candidates, commits[i])
+		}
+	}
+	if len(result.Candidates) == 1 {
+		result.Culprit = result.Candidates[0]
+	}
+	return result, nil
+}
+
+// TouchedNodes returns the graph nodes whose lines a commit changed: the
+// innermost symbols overlapping each changed range, or the file node for
+// changes outside every symbol
+func (s *Service) TouchedNodes(files []ChangedFile, graph []GraphNode) []string {
+	idx := newGraphFileIndex(graph)
+	touched := make(map[string]bool)
+	for _, file := range files {
+		p, _, ok := idx.resolveFile(file.Path)
+		if !ok {
+			continue
+		}
+		for _, r := range file.Lines {
+			var overlapping []GraphNode
+			for _, node := range idx.symbols[p] {
+				if node.StartLine <= r.End && node.EndLine >= r.Start {
+					overlapping = append(overlapping, node)
+				}
+			}
+			if len(overlapping) == 0 {
+				if node := idx.files[p]; node.ID != "" {
+					touched[node.ID] = true
+				}
+				continue
+			}
+			// Skip symbols that enclose another touched symbol, e.g. classes
+			for _, node := range overlapping {
+				inner := false
+				for _, other := range overlapping {
+					if other.ID != node.ID && other.StartLine >= node.StartLine && other.EndLine <= node.EndLine {
+						inner = true
+						break
+					}
+				}
+				if !inner {
+					touched[node.ID] = true
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(touched))
+	for id := range touched {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// AttachRegression attaches the commit that introduced a failure to the
+// diagnoses. Diagnoses of nodes the commit changed gain confidence and
+// commit evidence, and touched nodes without a diagnosis get one.
+func (s *Service) AttachRegression(diagnoses []Diagnosis, regression *Regression, graph []GraphNode) []Diagnosis {
+	nodes := make(map[string]GraphNode, len(graph))
+	for _, node := range graph {
+		nodes[node.ID] = node
+	}
+	touched := make(map[string]bool, len(regression.TouchedNodes))
+	for _, id := range regression.TouchedNodes {
+		touched[id] = true
+	}
+
+	short := regression.Commit
+	if len(short) > 12 {
+		short = short[:12]
+	}
+	subject, _, _ := strings.Cut(regression.Message, "\n")
+	evidence := func(nodeID string) Evidence {
+		node := nodes[nodeID]
+		return Evidence{Kind: "commit", File: node.Path, Line: node.StartLine, Snippet: short + " " + subject}
+	}
+
+	result := make([]Diagnosis, 0, len(diagnoses)+len(touched))
+	diagnosed := make(map[string]bool)
+	for _, d := range diagnoses {
+		d.Regression = regression
+		if touched[d.NodeID] {
+			d.Confidence += (1 - d.Confidence) * regressionBoost
+			d.Evidence = append(d.Evidence, evidence(d.NodeID))
+		}
+		diagnosed[d.NodeID] = true
+		result = append(result, d)
+	}
+
+	for _, id := range regression.TouchedNodes {
+		if diagnosed[id] {
+			continue
+		}
+		name := nodes[id].Name
+		if name == "" {
+			name = id
+		}
+		result = append(result, Diagnosis{
+			NodeID:     id,
+			RuleID:     "regression",
+			Name:       "Regression",
+			Cause:      fmt.Sprintf("%s was changed by commit %s (%s), the first commit where the tests fail", name, short, subject),
+			Confidence: regressionConfidence,
+			Evidence:   []Evidence{evidence(id)},
+			Remediations: []string{
+				"Review the change to " + name + " in commit " + short,
+				"Revert the commit if the change was not intended",
+			},
+			Regression: regression,
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Confidence > result[j].Confidence
+	})
+	return result
+}
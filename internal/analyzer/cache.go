@@ -0,0 +1,543 @@
+package analyzer
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// AnalyzerVersion identifies the per-file analysis. Bump it whenever
+// findings, symbols or metrics change so cached results are recomputed.
+const AnalyzerVersion = "3"
+
+// CacheDir holds cached per-file analysis results, relative to the
+// repository root
+const CacheDir = ".codeanalyzer/cache"
+
+// FileAnalysis is the cached analysis of one file
+type FileAnalysis struct {
+	Path         string             `json:"path"`
+	BlobHash     string             `json:"blobHash"` // git blob hash of the content
+	Language     string             `json:"language"`
+	Findings     []AnalysisResult   `json:"findings"`
+	Nodes        []GraphNode        `json:"nodes"` // nodes declared in the file, its package and the external packages it imports
+	Metrics      map[string]float64 `json:"metrics"`
+	Dependencies []string           `json:"dependencies"` // repository files whose changes affect this analysis
+}
+
+// CacheStats reports how much of an incremental analysis came from the cache
+type CacheStats struct {
+	Files      int     `json:"files"`
+	Hits       int     `json:"hits"`
+	Changed    int     `json:"changed"`    // new or modified files
+	Dependents int     `json:"dependents"` // unchanged files re-analyzed because a dependency changed
+	Removed    int     `json:"removed"`
+	HitRate    float64 `json:"hitRate"`
+}
+
+// IncrementalResult is the outcome of an incremental analysis
+type IncrementalResult struct {
+	Findings []AnalysisResult `json:"findings"`
+	Graph    []GraphNode      `json:"graph"`
+	Stats    CacheStats       `json:"stats"`
+}
+
+// analysisCache is the on-disk store of per-file results for one analyzer
+// and rule version. Results are stored by blob hash, then by path, since
+// findings and node IDs depend on where a file lives.
+type analysisCache struct {
+	dir string
+}
+
+// cacheManifest records the files of the last run
+type cacheManifest struct {
+	Files map[string]string `json:"files"` // path -> blob hash
+}
+
+// cachedFile is a source file of an incremental run
+type cachedFile struct {
+	file  SourceFile
+	path  string // slash-separated repository-relative path
+	blob  string
+	lines int
+	bytes int
+	entry *FileAnalysis // cached result for the blob, if any
+}
+
+// cacheVersion derives the cache key of the analyzer version and the
+// root-cause rules in effect for a repository
+func cacheVersion(repoPath string) (string, error) {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00", AnalyzerVersion)
+	h.Write(defaultRootCauseRules)
+
+	dir := filepath.Join(repoPath, RulesDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read rules directory: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return "", fmt.Errorf("failed to read rule file: %w", err)
+		}
+		fmt.Fprintf(h, "\x00%s\x00", e.Name())
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// loadManifest reads the files of the last run, or none
+func (c *analysisCache) loadManifest() map[string]string {
+	var m cacheManifest
+	data, err := os.ReadFile(filepath.Join(c.dir, "manifest.json"))
+	if err != nil || json.Unmarshal(data, &m) != nil || m.Files == nil {
+		return map[string]string{}
+	}
+	return m.Files
+}
+
+// saveManifest records the files of this run
+func (c *analysisCache) saveManifest(files map[string]string) error {
+	data, err := json.Marshal(cacheManifest{Files: files})
+	if err != nil {
+		return fmt.Errorf("failed to encode cache manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, "manifest.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache manifest: %w", err)
+	}
+	return nil
+}
+
+// objectPath returns the file storing the results of a blob
+func (c *analysisCache) objectPath(blob string) string {
+	return filepath.Join(c.dir, "objects", blob[:2], blob+".json")
+}
+
+// loadObject reads the results stored for a blob, by path
+func (c *analysisCache) loadObject(blob string) map[string]*FileAnalysis {
+	var results map[string]*FileAnalysis
+	data, err := os.ReadFile(c.objectPath(blob))
+	if err != nil || json.Unmarshal(data, &results) != nil {
+		return nil
+	}
+	return results
+}
+
+// load returns the cached result of a file, or nil
+func (c *analysisCache) load(blob, p string) *FileAnalysis {
+	if blob == "" {
+		return nil
+	}
+	return c.loadObject(blob)[p]
+}
+
+// store saves the result of a file
+func (c *analysisCache) store(entry *FileAnalysis) error {
+	if entry.BlobHash == "" {
+		return nil
+	}
+	results := c.loadObject(entry.BlobHash)
+	if results == nil {
+		results = make(map[string]*FileAnalysis)
+	}
+	results[entry.Path] = entry
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("failed to encode cached analysis: %w", err)
+	}
+	objectPath := c.objectPath(entry.BlobHash)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := os.WriteFile(objectPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cached analysis: %w", err)
+	}
+	return nil
+}
+
+// goDependencies relates Go files through their packages and imports
+type goDependencies struct {
+	prog         *goProgram          // only used to compute import paths
+	dirs         map[string][]string // package directory -> files
+	imports      map[string][]string // file -> imported paths
+	byImportPath map[string]string   // import path -> package directory, built on first use
+}
+
+// newGoDependencies creates an empty dependency index for a module
+func newGoDependencies(modulePath string) *goDependencies {
+	return &goDependencies{
+		prog:    &goProgram{ModulePath: modulePath},
+		dirs:    make(map[string][]string),
+		imports: make(map[string][]string),
+	}
+}
+
+// add records the package and imports of a Go file
+func (g *goDependencies) add(p string, src []byte) {
+	g.dirs[path.Dir(p)] = append(g.dirs[path.Dir(p)], p)
+	f, err := parser.ParseFile(token.NewFileSet(), p, src, parser.ImportsOnly)
+	if err != nil && f == nil {
+		return
+	}
+	for _, spec := range f.Imports {
+		if importPath, err := strconv.Unquote(spec.Path.Value); err == nil {
+			g.imports[p] = append(g.imports[p], importPath)
+		}
+	}
+}
+
+// deps returns the files of a Go file's package and of the repository
+// packages it imports
+func (g *goDependencies) deps(p string) []string {
+	if g.byImportPath == nil {
+		g.byImportPath = make(map[string]string, len(g.dirs))
+		for dir := range g.dirs {
+			g.byImportPath[g.prog.importPathFor(dir)] = dir
+		}
+	}
+
+	var deps []string
+	for _, q := range g.dirs[path.Dir(p)] {
+		if q != p {
+			deps = append(deps, q)
+		}
+	}
+	for _, importPath := range g.imports[p] {
+		if dir, ok := g.byImportPath[importPath]; ok && dir != path.Dir(p) {
+			deps = append(deps, g.dirs[dir]...)
+		}
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+// symbolLanguages are the languages whose symbols are lexed
+var symbolLanguages = map[string]bool{"JavaScript": true, "TypeScript": true, "Python": true, "Java": true}
+
+// AnalyzeIncremental runs static analysis and builds the code graph,
+// reusing cached per-file results. Results are keyed by git blob hash and
+// the analyzer and rule version, so only changed files and the files that
+// depend on them through the import graph are re-analyzed.
+func (s *Service) AnalyzeIncremental(repoPath string, files []SourceFile) (*IncrementalResult, error) {
+	version, err := cacheVersion(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	cache := &analysisCache{dir: filepath.Join(repoPath, CacheDir, version)}
+	if err := os.MkdirAll(cache.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	previous := cache.loadManifest()
+
+	// Hash every file; Go imports are read here to find dependents
+	current := make(map[string]*cachedFile, len(files))
+	var paths []string
+	goDeps := newGoDependencies(findModulePath(files))
+	for _, file := range files {
+		cf := &cachedFile{file: file, path: filepath.ToSlash(file.Path)}
+		if src, err := readSource(file); err == nil {
+			cf.blob = plumbing.ComputeHash(plumbing.BlobObject, src).String()
+			cf.lines = strings.Count(string(src), "\n") + 1
+			cf.bytes = len(src)
+			if file.Language == "Go" {
+				goDeps.add(cf.path, src)
+			}
+		}
+		cf.entry = cache.load(cf.blob, cf.path)
+		current[cf.path] = cf
+		paths = append(paths, cf.path)
+	}
+	sort.Strings(paths)
+
+	dirty, stats := s.dirtyFiles(previous, current, paths, goDeps)
+
+	fresh, err := s.analyzeFiles(dirty, current, goDeps)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range fresh {
+		if err := cache.store(entry); err != nil {
+			return nil, err
+		}
+		current[entry.Path].entry = entry
+	}
+	// Unchanged files whose graph nodes changed with the program
+	if regraphed := len(fresh) - len(dirty); regraphed > 0 {
+		stats.Dependents += regraphed
+		stats.Hits -= regraphed
+		stats.HitRate = float64(stats.Hits) / float64(stats.Files)
+	}
+
+	result := &IncrementalResult{Findings: []AnalysisResult{}, Graph: []GraphNode{}, Stats: stats}
+	manifest := make(map[string]string, len(paths))
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		cf := current[p]
+		manifest[p] = cf.blob
+		result.Findings = append(result.Findings, cf.entry.Findings...)
+		for _, node := range cf.entry.Nodes {
+			if !seen[node.ID] {
+				seen[node.ID] = true
+				result.Graph = append(result.Graph, node)
+			}
+		}
+	}
+	if err := cache.saveManifest(manifest); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// dirtyFiles returns the files to re-analyze: new and modified files, and
+// the files depending on them or on removed files
+func (s *Service) dirtyFiles(previous map[string]string, current map[string]*cachedFile, paths []string, goDeps *goDependencies) ([]string, CacheStats) {
+	stats := CacheStats{Files: len(paths)}
+
+	dependents := make(map[string][]string) // file -> files depending on it
+	var seeds []string
+	added := make(map[string]bool) // languages with new files
+	for _, p := range paths {
+		cf := current[p]
+		var deps []string
+		switch {
+		case cf.file.Language == "Go":
+			deps = goDeps.deps(p)
+		case cf.entry != nil:
+			deps = cf.entry.Dependencies
+		}
+		for _, d := range deps {
+			dependents[d] = append(dependents[d], p)
+		}
+
+		if _, ok := previous[p]; !ok {
+			added[cf.file.Language] = true
+		}
+		if cf.entry == nil || previous[p] != cf.blob {
+			seeds = append(seeds, p)
+			stats.Changed++
+		}
+	}
+	for p := range previous {
+		if _, ok := current[p]; !ok {
+			seeds = append(seeds, p)
+			stats.Removed++
+			if languageOf(p) == "Go" {
+				// The rest of the package loses the removed declarations
+				seeds = append(seeds, goDeps.dirs[path.Dir(p)]...)
+			}
+		}
+	}
+
+	// New files may resolve imports that were external so far
+	for _, p := range paths {
+		cf := current[p]
+		if cf.entry != nil && cf.file.Language != "Go" && added[cf.file.Language] && hasExternalImports(cf.entry) {
+			seeds = append(seeds, p)
+		}
+	}
+
+	dirty := make(map[string]bool)
+	for len(seeds) > 0 {
+		p := seeds[len(seeds)-1]
+		seeds = seeds[:len(seeds)-1]
+		if dirty[p] {
+			continue
+		}
+		dirty[p] = true
+		seeds = append(seeds, dependents[p]...)
+	}
+
+	var list []string
+	for _, p := range paths {
+		if dirty[p] {
+			list = append(list, p)
+		}
+	}
+	stats.Dependents = len(list) - stats.Changed
+	stats.Hits = stats.Files - len(list)
+	if stats.Files > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(stats.Files)
+	}
+	return list, stats
+}
+
+// hasExternalImports reports whether a cached file imports a package
+// outside the repository
+func hasExternalImports(entry *FileAnalysis) bool {
+	for _, node := range entry.Nodes {
+		if node.Type == NodePackage && node.Properties["external"] == true {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzeFiles analyzes the dirty files. Go packages are type-checked as
+// one program, since an interface may be implemented in any package, and
+// unchanged Go files whose graph nodes changed are returned as well.
+func (s *Service) analyzeFiles(dirty []string, current map[string]*cachedFile, goDeps *goDependencies) ([]*FileAnalysis, error) {
+	if len(dirty) == 0 {
+		return nil, nil
+	}
+
+	var sources []SourceFile
+	for _, p := range dirty {
+		sources = append(sources, current[p].file)
+	}
+	findings, err := s.RunStaticAnalysis(sources)
+	if err != nil {
+		return nil, err
+	}
+	byFile := make(map[string][]AnalysisResult)
+	for _, f := range findings {
+		p := filepath.ToSlash(f.File)
+		byFile[p] = append(byFile[p], f)
+	}
+
+	// Calls through interfaces and implements edges relate packages that
+	// do not import each other, so every Go file is loaded once one is dirty
+	isDirty := make(map[string]bool, len(dirty))
+	goDirty := false
+	for _, p := range dirty {
+		isDirty[p] = true
+		goDirty = goDirty || current[p].file.Language == "Go"
+	}
+	var goPaths []string
+	var goFiles []SourceFile
+	if goDirty {
+		for p, cf := range current {
+			if cf.file.Language == "Go" {
+				goPaths = append(goPaths, p)
+			}
+		}
+		sort.Strings(goPaths)
+		for _, p := range goPaths {
+			goFiles = append(goFiles, current[p].file)
+		}
+	}
+	var graph []GraphNode
+	if len(goFiles) > 0 {
+		graph = buildGoGraph(loadGoProgram(goFiles))
+	}
+
+	symbolPaths := make(map[string]bool)
+	for p, cf := range current {
+		if symbolLanguages[cf.file.Language] {
+			symbolPaths[p] = true
+		}
+	}
+	var symbolFiles []*symbolFile
+	for _, p := range dirty {
+		cf := current[p]
+		if !symbolLanguages[cf.file.Language] {
+			continue
+		}
+		src, err := readSource(cf.file)
+		if err != nil {
+			continue
+		}
+		if sf, ok := extractSymbols(cf.file, src); ok {
+			symbolFiles = append(symbolFiles, sf)
+		}
+	}
+	graph = append(graph, buildSymbolGraph(symbolFiles, symbolPaths)...)
+
+	nodes := make(map[string]GraphNode, len(graph))
+	declared := make(map[string][]GraphNode)
+	for _, node := range graph {
+		if _, ok := nodes[node.ID]; ok {
+			continue
+		}
+		nodes[node.ID] = node
+		if node.Type != NodePackage {
+			declared[node.Path] = append(declared[node.Path], node)
+		}
+	}
+
+	entries := make([]*FileAnalysis, 0, len(dirty))
+	for _, p := range dirty {
+		findings := byFile[p]
+		if findings == nil {
+			findings = []AnalysisResult{}
+		}
+		entries = append(entries, fileEntry(p, current[p], findings, nodes, declared, goDeps))
+	}
+	for _, p := range goPaths {
+		if isDirty[p] {
+			continue
+		}
+		cf := current[p]
+		entry := fileEntry(p, cf, cf.entry.Findings, nodes, declared, goDeps)
+		before, _ := json.Marshal(cf.entry.Nodes)
+		after, _ := json.Marshal(entry.Nodes)
+		if string(before) != string(after) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// fileEntry builds the cached analysis of a file from the graph nodes of
+// the analyzed files
+func fileEntry(p string, cf *cachedFile, findings []AnalysisResult, nodes map[string]GraphNode, declared map[string][]GraphNode, goDeps *goDependencies) *FileAnalysis {
+	entry := &FileAnalysis{
+		Path:         p,
+		BlobHash:     cf.blob,
+		Language:     cf.file.Language,
+		Findings:     findings,
+		Nodes:        declared[p],
+		Metrics:      map[string]float64{"lines": float64(cf.lines), "bytes": float64(cf.bytes)},
+		Dependencies: []string{},
+	}
+	if cf.file.Language == "Go" {
+		entry.Dependencies = goDeps.deps(p)
+	}
+
+	if file, ok := nodes[fileNodeID(p)]; ok {
+		// The containing package and imported external packages are
+		// stored with each file, so cached files are self-contained
+		related := append([]string{}, file.Relations...)
+		for _, edge := range file.Edges {
+			if edge.Type != EdgeImports {
+				continue
+			}
+			if strings.HasPrefix(edge.Target, "file:") {
+				entry.Dependencies = append(entry.Dependencies, strings.TrimPrefix(edge.Target, "file:"))
+			}
+			if target := nodes[edge.Target]; target.Properties["external"] == true {
+				related = append(related, edge.Target)
+			}
+		}
+		for _, id := range related {
+			if node, ok := nodes[id]; ok && node.Type == NodePackage {
+				entry.Nodes = append(entry.Nodes, node)
+			}
+		}
+	} else {
+		// Remaining files are added as plain file nodes
+		entry.Nodes = []GraphNode{{
+			ID:   fileNodeID(p),
+			Type: NodeFile,
+			Name: path.Base(p),
+			Path: p,
+		}}
+	}
+	return entry
+}
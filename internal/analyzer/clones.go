@@ -0,0 +1,347 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// DefaultMinCloneTokens is the shortest token sequence reported as a clone
+const DefaultMinCloneTokens = 50
+
+// CloneOptions configures clone detection
+type CloneOptions struct {
+	MinTokens int // shortest clone in tokens, DefaultMinCloneTokens when 0
+}
+
+// CloneFragment is one copy of a clone
+type CloneFragment struct {
+	File      string   `json:"file"`
+	StartLine int      `json:"startLine"`
+	EndLine   int      `json:"endLine"`
+	NodeID    string   `json:"nodeId,omitempty"`  // innermost graph node holding the copy, see AddDuplicateEdges
+	Symbols   []string `json:"symbols,omitempty"` // graph nodes copied whole
+}
+
+// CloneGroup is a token sequence found at several places. Type 1 clones
+// are identical apart from layout and comments; type 2 clones also differ
+// in identifiers or literals.
+type CloneGroup struct {
+	ID        string          `json:"id"`
+	Type      int             `json:"type"`
+	Tokens    int             `json:"tokens"`
+	Fragments []CloneFragment `json:"fragments"`
+}
+
+// CloneReport lists the clone groups of a repository
+type CloneReport struct {
+	Groups           []CloneGroup `json:"groups"`
+	DuplicatedTokens int          `json:"duplicatedTokens"` // tokens in every copy but the first of each group
+	TotalTokens      int          `json:"totalTokens"`
+	Errors           []FileError  `json:"errors,omitempty"`
+}
+
+// cloneToken is a token of the concatenated token stream
+type cloneToken struct {
+	norm  int // interned token with identifiers and literals normalized
+	exact int // interned token text
+	file  int // index of the file, or -1 for the separator ending a file
+	line  int
+}
+
+// DetectClones finds type-1 and type-2 clones of at least MinTokens tokens
+// across the source files. Comments and layout are ignored; identifiers
+// and literals are normalized so renamed copies are found too.
+func (s *Service) DetectClones(files []SourceFile, opts CloneOptions) (*CloneReport, error) {
+	minTokens := opts.MinTokens
+	if minTokens <= 0 {
+		minTokens = DefaultMinCloneTokens
+	}
+
+	lexed, fileErrs, err := processFiles(context.Background(), files, s.Pipeline, true, func(file SourceFile, src []byte) (*lexedFile, error) {
+		return lexMetrics(normalizeGraphPath(file.Path), file.Language, src), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Concatenate the token streams, each file ending in a separator no
+	// window can match across
+	intern := make(map[string]int)
+	id := func(text string) int {
+		if n, ok := intern[text]; ok {
+			return n
+		}
+		intern[text] = len(intern)
+		return len(intern) - 1
+	}
+	var (
+		stream []cloneToken
+		paths  []string
+	)
+	for _, f := range lexed {
+		if f == nil {
+			continue
+		}
+		fileIndex := len(paths)
+		paths = append(paths, f.path)
+		for _, tok := range f.tokens {
+			norm := tok.text
+			switch {
+			case tok.literal:
+				norm = "$lit"
+			case tok.operand:
+				norm = "$id"
+			}
+			stream = append(stream, cloneToken{norm: id(norm), exact: id(tok.text), file: fileIndex, line: tok.line})
+		}
+		stream = append(stream, cloneToken{norm: -1 - fileIndex, exact: -1, file: -1})
+	}
+	report := &CloneReport{Groups: []CloneGroup{}, TotalTokens: len(stream) - len(paths), Errors: fileErrs}
+	if len(stream) < minTokens {
+		return report, nil
+	}
+
+	// Hash every window of minTokens tokens within one file
+	buckets := make(map[uint64][]int)
+	const base = 1000003
+	var hash, pow uint64 = 0, 1
+	for i := 0; i < minTokens-1; i++ {
+		pow *= base
+	}
+	valid := 0 // tokens since the last separator
+	for i, tok := range stream {
+		if valid == minTokens {
+			hash -= uint64(stream[i-minTokens].norm+1) * pow
+		}
+		hash = hash*base + uint64(tok.norm+1)
+		if tok.file < 0 {
+			hash, valid = 0, 0
+			continue
+		}
+		valid = min(valid+1, minTokens)
+		if valid == minTokens {
+			start := i - minTokens + 1
+			buckets[hash] = append(buckets[hash], start)
+		}
+	}
+
+	// Extend each matching window against the first window of its bucket
+	// to the maximal match and group the matches by their normalized
+	// tokens. Copies of a window all match the first one, so pairing every
+	// window with every other adds nothing.
+	matches := func(a, b int) bool { return stream[a].norm == stream[b].norm && stream[a].file >= 0 }
+	type fragment struct{ start, end int }
+	groups := make(map[string]map[int]fragment)
+	var keys []string
+	for _, starts := range buckets {
+		a := starts[0]
+		for _, b := range starts[1:] {
+			if a > 0 && matches(a-1, b-1) && (stream[a].file != stream[b].file || b-a >= minTokens) {
+				continue // not the start of the match
+			}
+			n := 0
+			for b+n < len(stream) && matches(a+n, b+n) && (stream[a].file != stream[b].file || a+n < b) {
+				n++
+			}
+			if n < minTokens {
+				continue // a hash collision or an overlapping repeat
+			}
+
+			sum := sha1.New()
+			buf := make([]byte, 8)
+			for _, tok := range stream[a : a+n] {
+				binary.LittleEndian.PutUint64(buf, uint64(tok.norm))
+				sum.Write(buf)
+			}
+			key := hex.EncodeToString(sum.Sum(nil))[:16]
+			if groups[key] == nil {
+				groups[key] = make(map[int]fragment)
+				keys = append(keys, key)
+			}
+			groups[key][a] = fragment{a, a + n}
+			groups[key][b] = fragment{b, b + n}
+		}
+	}
+
+	for _, key := range keys {
+		var frags []fragment
+		for _, f := range groups[key] {
+			frags = append(frags, f)
+		}
+		sort.Slice(frags, func(i, j int) bool { return frags[i].start < frags[j].start })
+
+		group := CloneGroup{ID: "clone:" + key, Type: 1, Tokens: frags[0].end - frags[0].start}
+		for _, f := range frags {
+			for k := 0; k < group.Tokens; k++ {
+				if stream[f.start+k].exact != stream[frags[0].start+k].exact {
+					group.Type = 2
+					break
+				}
+			}
+			group.Fragments = append(group.Fragments, CloneFragment{
+				File:      paths[stream[f.start].file],
+				StartLine: stream[f.start].line,
+				EndLine:   stream[f.end-1].line,
+			})
+		}
+		report.DuplicatedTokens += group.Tokens * (len(frags) - 1)
+		report.Groups = append(report.Groups, group)
+	}
+
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Tokens != report.Groups[j].Tokens {
+			return report.Groups[i].Tokens > report.Groups[j].Tokens
+		}
+		a, b := report.Groups[i].Fragments[0], report.Groups[j].Fragments[0]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.StartLine < b.StartLine
+	})
+	return report, nil
+}
+
+// AddDuplicateEdges links each copy of a clone to the first copy with
+// "duplicate_of" edges in both directions, so a group of n copies adds
+// 2(n-1) edges. When the copies hold the same number of whole symbols, such
+// as functions, the symbols are linked in order; otherwise the innermost
+// nodes holding the copies are linked.
+func (s *Service) AddDuplicateEdges(graph []GraphNode, report *CloneReport) []GraphNode {
+	idx := newGraphFileIndex(graph)
+	index := make(map[string]int, len(graph))
+	for i, node := range graph {
+		index[node.ID] = i
+	}
+	existing := make(map[string]bool)
+	for _, node := range graph {
+		for _, e := range node.Edges {
+			if e.Type == EdgeDuplicateOf {
+				existing[node.ID+"|"+e.Target] = true
+			}
+		}
+	}
+	link := func(a, b string) {
+		i, ok := index[a]
+		if !ok || a == b || existing[a+"|"+b] {
+			return
+		}
+		existing[a+"|"+b] = true
+		graph[i].Edges = append(graph[i].Edges, GraphEdge{Target: b, Type: EdgeDuplicateOf})
+	}
+
+	for g := range report.Groups {
+		frags := report.Groups[g].Fragments
+		symbols := true
+		for i := range frags {
+			frags[i].NodeID = idx.enclosing(frags[i].File, frags[i].StartLine, frags[i].EndLine).ID
+			frags[i].Symbols = idx.within(frags[i].File, frags[i].StartLine, frags[i].EndLine)
+			symbols = symbols && len(frags[i].Symbols) > 0 && len(frags[i].Symbols) == len(frags[0].Symbols)
+		}
+		first := frags[0]
+		for _, f := range frags[1:] {
+			if !symbols {
+				link(first.NodeID, f.NodeID)
+				link(f.NodeID, first.NodeID)
+				continue
+			}
+			for k := range f.Symbols {
+				link(first.Symbols[k], f.Symbols[k])
+				link(f.Symbols[k], first.Symbols[k])
+			}
+		}
+	}
+	return graph
+}
+
+// enclosing returns the innermost node spanning the lines from start to
+// end of the file at p, or the file node
+func (idx *graphFileIndex) enclosing(p string, start, end int) GraphNode {
+	var (
+		best  GraphNode
+		found bool
+	)
+	for _, node := range idx.symbols[p] {
+		if start < node.StartLine || end > node.EndLine {
+			continue
+		}
+		if !found || node.EndLine-node.StartLine < best.EndLine-best.StartLine {
+			best, found = node, true
+		}
+	}
+	if !found {
+		return idx.files[p]
+	}
+	return best
+}
+
+// within returns the outermost symbols lying wholly between the lines start
+// and end of the file at p, in order
+func (idx *graphFileIndex) within(p string, start, end int) []string {
+	var inside []GraphNode
+	for _, node := range idx.symbols[p] {
+		if node.StartLine >= start && node.EndLine <= end {
+			inside = append(inside, node)
+		}
+	}
+	sort.Slice(inside, func(i, j int) bool {
+		if inside[i].StartLine != inside[j].StartLine {
+			return inside[i].StartLine < inside[j].StartLine
+		}
+		return inside[i].EndLine > inside[j].EndLine
+	})
+
+	var ids []string
+	last := 0
+	for _, node := range inside {
+		if node.StartLine > last || len(ids) == 0 {
+			ids = append(ids, node.ID)
+			last = node.EndLine
+		}
+	}
+	return ids
+}
+
+// duplicateSiblings returns the nodes linked to a node as copies of its
+// code. The copies of a clone are linked through its first copy, so the
+// copies linked to the node's own copies are its siblings too.
+func duplicateSiblings(node GraphNode, nodes map[string]GraphNode) []string {
+	var siblings []string
+	seen := map[string]bool{node.ID: true}
+	add := func(n GraphNode) []string {
+		var added []string
+		for _, e := range n.Edges {
+			if e.Type == EdgeDuplicateOf && !seen[e.Target] {
+				seen[e.Target] = true
+				added = append(added, e.Target)
+			}
+		}
+		return added
+	}
+	for _, direct := range add(node) {
+		siblings = append(siblings, direct)
+		siblings = append(siblings, add(nodes[direct])...)
+	}
+	return siblings
+}
+
+// flagDuplicates adds the copies of each diagnosed node to its diagnosis,
+// as code duplicated from a faulty node may share the fault
+func flagDuplicates(diagnoses []Diagnosis, nodes map[string]GraphNode) {
+	for i := range diagnoses {
+		d := &diagnoses[i]
+		for _, sibling := range duplicateSiblings(nodes[d.NodeID], nodes) {
+			node := nodes[sibling]
+			d.Duplicates = append(d.Duplicates, sibling)
+			d.Evidence = append(d.Evidence, Evidence{
+				Kind:    "duplicate",
+				File:    node.Path,
+				Line:    node.StartLine,
+				Snippet: fmt.Sprintf("%s is a copy of this code and may share the cause", sibling),
+			})
+		}
+	}
+}
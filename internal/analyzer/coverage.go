@@ -0,0 +1,303 @@
+package analyzer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Spectrum-based fault localization formulas
+const (
+	FormulaOchiai    = "ochiai"
+	FormulaTarantula = "tarantula"
+	FormulaDStar     = "dstar"
+)
+
+// maxDStar is the DStar score of lines that no passing run executes and
+// every failing run does, whose formula has a zero denominator
+const maxDStar = 1e6
+
+// Coverage records the lines executed by a test run, by repository-relative file
+type Coverage map[string]map[int]bool
+
+// CoverageRun is the coverage of one passing or failing test run
+type CoverageRun struct {
+	Name     string   `json:"name"`
+	Failed   bool     `json:"failed"`
+	Coverage Coverage `json:"-"`
+}
+
+// add marks lines start..end of file as executed
+func (c Coverage) add(file string, start, end int) {
+	lines := c[file]
+	if lines == nil {
+		lines = make(map[int]bool)
+		c[file] = lines
+	}
+	for l := start; l <= end; l++ {
+		lines[l] = true
+	}
+}
+
+// ParseGoCoverProfile parses a profile written by go test -coverprofile.
+// File names are made repository-relative by trimming modulePath.
+func (s *Service) ParseGoCoverProfile(r io.Reader, modulePath string) (Coverage, error) {
+	cov := make(Coverage)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		// file.go:startLine.startCol,endLine.endCol numStmt count
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("invalid cover profile line %d: %q", lineNo, line)
+		}
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid cover profile line %d: %q", lineNo, line)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cover profile count on line %d: %w", lineNo, err)
+		}
+		if count == 0 {
+			continue
+		}
+
+		span := strings.SplitN(fields[0], ",", 2)
+		if len(span) != 2 {
+			return nil, fmt.Errorf("invalid cover profile block on line %d: %q", lineNo, fields[0])
+		}
+		start, err1 := strconv.Atoi(strings.SplitN(span[0], ".", 2)[0])
+		end, err2 := strconv.Atoi(strings.SplitN(span[1], ".", 2)[0])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid cover profile block on line %d: %q", lineNo, fields[0])
+		}
+
+		file := line[:colon]
+		if modulePath != "" {
+			file = strings.TrimPrefix(file, modulePath+"/")
+		}
+		cov.add(file, start, end)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cover profile: %w", err)
+	}
+	return cov, nil
+}
+
+// Coverage formats accepted by ParseCoverage
+const (
+	CoverageFormatGo   = "go"   // go test -coverprofile
+	CoverageFormatLCOV = "lcov" // LCOV tracefile
+)
+
+// ParseCoverage parses a coverage file of the given format, making file
+// names relative to the repository at repoPath
+func (s *Service) ParseCoverage(repoPath, format string, r io.Reader) (Coverage, error) {
+	switch format {
+	case CoverageFormatGo:
+		return s.ParseGoCoverProfile(r, readModulePath(repoPath))
+	case CoverageFormatLCOV:
+		return s.ParseLCOV(r, repoPath)
+	}
+	return nil, fmt.Errorf("unknown coverage format: %s", format)
+}
+
+// ParseLCOV parses an LCOV tracefile. Source paths are normalized relative
+// to repoPath when the file exists in the repository.
+func (s *Service) ParseLCOV(r io.Reader, repoPath string) (Coverage, error) {
+	cov := make(Coverage)
+	resolver := newPathResolver(repoPath)
+	scanner := bufio.NewScanner(r)
+	file := ""
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			file, _ = resolver.resolve(strings.TrimPrefix(line, "SF:"))
+		case strings.HasPrefix(line, "DA:"):
+			// DA:<line>,<execution count>[,<checksum>]
+			parts := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if len(parts) < 2 || file == "" {
+				return nil, fmt.Errorf("invalid LCOV record on line %d: %q", lineNo, line)
+			}
+			l, err1 := strconv.Atoi(parts[0])
+			count, err2 := strconv.ParseFloat(parts[1], 64)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid LCOV record on line %d: %q", lineNo, line)
+			}
+			if count > 0 {
+				cov.add(file, l, l)
+			}
+		case line == "end_of_record":
+			file = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read LCOV file: %w", err)
+	}
+	return cov, nil
+}
+
+// LineSuspiciousness is the spectrum of one source line and its scores
+type LineSuspiciousness struct {
+	File      string  `json:"file"`
+	Line      int     `json:"line"`
+	Failed    int     `json:"failed"` // failing runs executing the line
+	Passed    int     `json:"passed"` // passing runs executing the line
+	Ochiai    float64 `json:"ochiai"`
+	Tarantula float64 `json:"tarantula"`
+	DStar     float64 `json:"dstar"`
+}
+
+// FunctionSuspiciousness is the highest line suspiciousness within a function
+type FunctionSuspiciousness struct {
+	NodeID    string  `json:"nodeId"`
+	Ochiai    float64 `json:"ochiai"`
+	Tarantula float64 `json:"tarantula"`
+	DStar     float64 `json:"dstar"`
+}
+
+// SpectrumReport holds spectrum-based suspiciousness per line and function
+type SpectrumReport struct {
+	FailedRuns int                      `json:"failedRuns"`
+	PassedRuns int                      `json:"passedRuns"`
+	Lines      []LineSuspiciousness     `json:"lines"`
+	Functions  []FunctionSuspiciousness `json:"functions"`
+}
+
+// ComputeSpectrum computes Ochiai, Tarantula and DStar suspiciousness for
+// every line executed by a failing run, and aggregates them per function
+// node of the graph
+func (s *Service) ComputeSpectrum(runs []CoverageRun, graph []GraphNode) SpectrumReport {
+	report := SpectrumReport{Lines: []LineSuspiciousness{}, Functions: []FunctionSuspiciousness{}}
+
+	type lineKey struct {
+		file string
+		line int
+	}
+	counts := make(map[lineKey]*LineSuspiciousness)
+	for _, run := range runs {
+		if run.Failed {
+			report.FailedRuns++
+		} else {
+			report.PassedRuns++
+		}
+		for file, lines := range run.Coverage {
+			for l := range lines {
+				key := lineKey{normalizeGraphPath(file), l}
+				c := counts[key]
+				if c == nil {
+					c = &LineSuspiciousness{File: key.file, Line: l}
+					counts[key] = c
+				}
+				if run.Failed {
+					c.Failed++
+				} else {
+					c.Passed++
+				}
+			}
+		}
+	}
+
+	totalFailed := float64(report.FailedRuns)
+	totalPassed := float64(report.PassedRuns)
+	for _, c := range counts {
+		// Lines no failing run executed cannot explain the failure
+		if c.Failed == 0 {
+			continue
+		}
+		ef, ep := float64(c.Failed), float64(c.Passed)
+		nf := totalFailed - ef
+
+		c.Ochiai = ef / math.Sqrt(totalFailed*(ef+ep))
+		failRatio := ef / totalFailed
+		passRatio := 0.0
+		if totalPassed > 0 {
+			passRatio = ep / totalPassed
+		}
+		c.Tarantula = failRatio / (failRatio + passRatio)
+		// DStar with * = 2; lines executed only and always by failing runs
+		// have no denominator and score highest
+		if ep+nf == 0 {
+			c.DStar = maxDStar
+		} else {
+			c.DStar = ef * ef / (ep + nf)
+		}
+		report.Lines = append(report.Lines, *c)
+	}
+
+	sort.Slice(report.Lines, func(i, j int) bool {
+		a, b := report.Lines[i], report.Lines[j]
+		if a.Ochiai != b.Ochiai {
+			return a.Ochiai > b.Ochiai
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+
+	// A function is as suspicious as its most suspicious line
+	idx := newGraphFileIndex(graph)
+	functions := make(map[string]*FunctionSuspiciousness)
+	var order []string
+	for _, line := range report.Lines {
+		node, confidence := idx.locate(line.File, line.Line)
+		if node.ID == "" || confidence < 1 || (node.Type != NodeFunction && node.Type != NodeMethod) {
+			continue
+		}
+		f := functions[node.ID]
+		if f == nil {
+			f = &FunctionSuspiciousness{NodeID: node.ID}
+			functions[node.ID] = f
+			order = append(order, node.ID)
+		}
+		f.Ochiai = math.Max(f.Ochiai, line.Ochiai)
+		f.Tarantula = math.Max(f.Tarantula, line.Tarantula)
+		f.DStar = math.Max(f.DStar, line.DStar)
+	}
+	for _, id := range order {
+		report.Functions = append(report.Functions, *functions[id])
+	}
+
+	return report
+}
+
+// NodeScores returns the function scores of a formula in [0, 1], for use
+// as LocalizeOptions.Spectrum. Ochiai and Tarantula are already bounded;
+// DStar is scaled by the highest score.
+func (r SpectrumReport) NodeScores(formula string) map[string]float64 {
+	scores := make(map[string]float64, len(r.Functions))
+	maxScore := 0.0
+	for _, f := range r.Functions {
+		switch formula {
+		case FormulaTarantula:
+			scores[f.NodeID] = f.Tarantula
+		case FormulaDStar:
+			scores[f.NodeID] = f.DStar
+			maxScore = math.Max(maxScore, f.DStar)
+		default:
+			scores[f.NodeID] = f.Ochiai
+		}
+	}
+
+	if formula == FormulaDStar && maxScore > 0 {
+		for id, v := range scores {
+			scores[id] = v / maxScore
+		}
+	}
+	return scores
+}
@@ -0,0 +1,296 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// RuleDeadCode is the rule ID of dead code findings
+const RuleDeadCode = "dead-code"
+
+// DeadCodeOptions configures dead code detection
+type DeadCodeOptions struct {
+	// Exported also reports exported symbols no code in the module uses;
+	// otherwise exported symbols are assumed to be used by other modules
+	Exported bool
+	// MainAndTestsAsRoots keeps every declaration of main packages and test
+	// files alive, along with the code they use. Otherwise tests are left
+	// out, so code only tests use is reported, and main packages are only
+	// entered through main and init.
+	MainAndTestsAsRoots bool
+}
+
+// goDecl is a top-level Go declaration with a node in the code graph
+type goDecl struct {
+	id   string
+	obj  types.Object
+	test bool // declared in a _test.go file
+	main bool // declared in a main package
+}
+
+// FindDeadCode reports unused Go functions, methods, types, constants and
+// struct fields. Declarations are alive when they can be reached from the
+// roots - main, init, package variables and, unless opts.Exported is set,
+// exported symbols - along the calls, references and embeds edges of the
+// code graph. Exported methods of live types are kept too, as they may
+// satisfy interfaces outside the module. Constants and fields have no
+// graph nodes; they are alive when live code uses them.
+func (s *Service) FindDeadCode(files []SourceFile, graph []GraphNode, opts DeadCodeOptions) []AnalysisResult {
+	prog := loadGoProgram(files)
+	decls := make(map[string]*goDecl)
+	var order []*goDecl
+	for _, pkg := range prog.Packages {
+		for _, file := range pkg.Files {
+			for _, decl := range file.AST.Decls {
+				for _, d := range declaredNodes(pkg, file, decl) {
+					if _, dup := decls[d.id]; !dup {
+						decls[d.id] = d
+						order = append(order, d)
+					}
+				}
+			}
+		}
+	}
+
+	// Tests are left out of the program unless they are roots
+	ignored := func(d *goDecl) bool { return d.test && !opts.MainAndTestsAsRoots }
+	isRoot := func(d *goDecl) bool {
+		name := d.obj.Name()
+		switch {
+		case ignored(d):
+			return false
+		case opts.MainAndTestsAsRoots && (d.test || d.main):
+			return true
+		case name == "init" || name == "_":
+			return true
+		case name == "main" && d.main && strings.HasPrefix(d.id, "func:"):
+			return true
+		}
+		return d.obj.Exported() && !opts.Exported && !strings.HasPrefix(d.id, "method:")
+	}
+
+	nodes := make(map[string]GraphNode, len(graph))
+	for _, node := range graph {
+		nodes[node.ID] = node
+	}
+	live := make(map[string]bool)
+	var queue []string
+	mark := func(id string) {
+		if d, ok := decls[id]; ok && !live[id] && !ignored(d) {
+			live[id] = true
+			queue = append(queue, id)
+		}
+	}
+	for _, d := range order {
+		if isRoot(d) {
+			mark(d.id)
+		}
+	}
+
+	// Package variables are initialized whether used or not
+	for _, pkg := range prog.Packages {
+		for _, file := range pkg.Files {
+			if strings.HasSuffix(file.Path, "_test.go") && !opts.MainAndTestsAsRoots {
+				continue
+			}
+			for _, decl := range file.AST.Decls {
+				if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.VAR {
+					for _, obj := range usedObjects(pkg, gd) {
+						mark(objectNodeID(obj))
+					}
+				}
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range nodes[id].Edges {
+			switch e.Type {
+			case EdgeCalls, EdgeReferences, EdgeEmbeds:
+				mark(e.Target)
+			case EdgeContains:
+				if target, ok := decls[e.Target]; ok && target.obj.Exported() {
+					mark(e.Target) // exported methods of a live type
+				}
+			}
+		}
+	}
+
+	var findings []AnalysisResult
+	report := func(obj types.Object, kind string) {
+		pos := prog.Fset.Position(obj.Pos())
+		findings = append(findings, AnalysisResult{
+			Rule:    RuleDeadCode,
+			File:    pos.Filename,
+			Line:    pos.Line,
+			Column:  pos.Column,
+			Message: fmt.Sprintf("%s %s is unused", kind, obj.Name()),
+			Level:   "warning",
+		})
+	}
+	reportable := func(obj types.Object) bool {
+		return obj.Name() != "_" && (!obj.Exported() || opts.Exported)
+	}
+
+	for _, d := range order {
+		if live[d.id] || ignored(d) || (opts.MainAndTestsAsRoots && (d.test || d.main)) || !reportable(d.obj) {
+			continue
+		}
+		if node, ok := nodes[d.id]; ok {
+			report(d.obj, node.Type)
+		}
+	}
+
+	// Constants and fields are used by live declarations
+	used := make(map[types.Object]bool)
+	for _, pkg := range prog.Packages {
+		for _, file := range pkg.Files {
+			if strings.HasSuffix(file.Path, "_test.go") && !opts.MainAndTestsAsRoots {
+				continue
+			}
+			for _, decl := range file.AST.Decls {
+				declared := declaredNodes(pkg, file, decl)
+				alive := len(declared) == 0 // constants and variables
+				for _, d := range declared {
+					alive = alive || live[d.id]
+				}
+				if alive {
+					for _, obj := range usedObjects(pkg, decl) {
+						used[obj] = true
+					}
+				}
+			}
+		}
+	}
+	for _, pkg := range prog.Packages {
+		if pkg.Types == nil {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			obj := scope.Lookup(name)
+			pos := prog.Fset.Position(obj.Pos())
+			if strings.HasSuffix(pos.Filename, "_test.go") || (opts.MainAndTestsAsRoots && pkg.Name == "main") {
+				continue
+			}
+			switch obj := obj.(type) {
+			case *types.Const:
+				if !used[obj] && reportable(obj) {
+					report(obj, "constant")
+				}
+			case *types.TypeName:
+				st, ok := obj.Type().Underlying().(*types.Struct)
+				if !ok || !live[objectNodeID(obj)] {
+					continue
+				}
+				for i := 0; i < st.NumFields(); i++ {
+					field := st.Field(i)
+					// Tagged fields are used by encoders through reflection
+					if field.Embedded() || st.Tag(i) != "" || used[field] || !reportable(field) {
+						continue
+					}
+					report(field, "field")
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+// declaredNodes returns the graph declarations of a top-level declaration
+func declaredNodes(pkg *goPackage, file *goFile, decl ast.Decl) []*goDecl {
+	test := strings.HasSuffix(file.Path, "_test.go")
+	main := pkg.Name == "main"
+	var decls []*goDecl
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if obj := pkg.Info.Defs[d.Name]; obj != nil {
+			decls = append(decls, &goDecl{id: objectNodeID(obj), obj: obj, test: test, main: main})
+		}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			if ts, ok := spec.(*ast.TypeSpec); ok {
+				if obj := pkg.Info.Defs[ts.Name]; obj != nil {
+					decls = append(decls, &goDecl{id: objectNodeID(obj), obj: obj, test: test, main: main})
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// objectNodeID returns the graph node ID of a package-level function,
+// method or type
+func objectNodeID(obj types.Object) string {
+	if obj == nil || obj.Pkg() == nil {
+		return ""
+	}
+	pkg := obj.Pkg().Path()
+	switch obj := obj.(type) {
+	case *types.Func:
+		sig, _ := obj.Type().(*types.Signature)
+		if sig == nil || sig.Recv() == nil {
+			return funcNodeID(pkg, obj.Name())
+		}
+		recv := sig.Recv().Type()
+		if p, ok := recv.(*types.Pointer); ok {
+			recv = p.Elem()
+		}
+		if named, ok := recv.(*types.Named); ok {
+			return methodNodeID(pkg, named.Obj().Name(), obj.Name())
+		}
+	case *types.TypeName:
+		if obj.Parent() == obj.Pkg().Scope() {
+			return typeNodeID(pkg, obj.Name())
+		}
+	}
+	return ""
+}
+
+// usedObjects returns the objects used in a declaration. A struct literal
+// without keys uses every field of its type.
+func usedObjects(pkg *goPackage, root ast.Node) []types.Object {
+	var objs []types.Object
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if obj := pkg.Info.Uses[n]; obj != nil {
+				if fn, ok := obj.(*types.Func); ok {
+					obj = fn.Origin()
+				}
+				objs = append(objs, obj)
+			}
+		case *ast.CompositeLit:
+			if len(n.Elts) == 0 {
+				break
+			}
+			if _, keyed := n.Elts[0].(*ast.KeyValueExpr); keyed {
+				break
+			}
+			t := pkg.Info.TypeOf(n)
+			if t == nil {
+				break
+			}
+			if st, ok := t.Underlying().(*types.Struct); ok {
+				for i := 0; i < st.NumFields(); i++ {
+					objs = append(objs, st.Field(i))
+				}
+			}
+		}
+		return true
+	})
+	return objs
+}
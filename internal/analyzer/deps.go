@@ -0,0 +1,1099 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dependency ecosystems, named as in OSV
+const (
+	EcosystemGo    = "Go"
+	EcosystemNPM   = "npm"
+	EcosystemPyPI  = "PyPI"
+	EcosystemMaven = "Maven"
+)
+
+// NodeDependency and EdgeDependsOn link code to the third-party packages
+// it uses, see AddDependencyNodes
+const (
+	NodeDependency = "dependency"
+	EdgeDependsOn  = "depends_on"
+)
+
+// Dependency is a third-party package declared in a manifest or lockfile
+type Dependency struct {
+	Ecosystem  string   `json:"ecosystem"`
+	Name       string   `json:"name"`
+	Version    string   `json:"version,omitempty"`    // resolved version, empty when only a range is known
+	Constraint string   `json:"constraint,omitempty"` // version range declared in the manifest
+	Manifest   string   `json:"manifest"`             // manifest or lockfile declaring it, relative to the repository
+	Direct     bool     `json:"direct"`
+	Scope      string   `json:"scope,omitempty"`     // dev, optional, peer, test...
+	Hash       string   `json:"hash,omitempty"`      // checksum from go.sum
+	Replace    string   `json:"replace,omitempty"`   // replacement of a Go module
+	DependsOn  []string `json:"dependsOn,omitempty"` // names of the dependencies it requires, when the lockfile tells
+}
+
+// DependencyChange is a dependency added, removed or moved to another
+// version between two trees
+type DependencyChange struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	Manifest  string `json:"manifest"`
+	Kind      string `json:"kind"` // added, removed, upgraded, downgraded or changed
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	Direct    bool   `json:"direct"`
+}
+
+// skippedDependencyDirs hold installed packages rather than manifests
+var skippedDependencyDirs = map[string]bool{"node_modules": true, "vendor": true, "site-packages": true, "target": true}
+
+// ParseDependencies finds the dependency manifests and lockfiles of a
+// repository: go.mod and go.sum, package.json with package-lock.json,
+// yarn.lock or pnpm-lock.yaml, requirements*.txt, pyproject.toml and
+// pom.xml. Versions resolved by a lockfile win over the declared ranges,
+// and dependencies only found in the lockfile are listed as indirect.
+// Manifests that cannot be read or parsed are returned as file errors and
+// the others are still parsed.
+func (s *Service) ParseDependencies(repoPath string) ([]Dependency, []FileError, error) {
+	dirs := make(map[string]map[string]string) // directory -> file name -> path
+	err := filepath.WalkDir(repoPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != repoPath && (strings.HasPrefix(d.Name(), ".") || skippedDependencyDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(repoPath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		dir := path.Dir(rel)
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]string)
+		}
+		dirs[dir][d.Name()] = rel
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find dependency manifests: %w", err)
+	}
+
+	var names []string
+	for dir := range dirs {
+		names = append(names, dir)
+	}
+	sort.Strings(names)
+
+	// A manifest that cannot be read or parsed is reported and skipped
+	var fileErrs []FileError
+	fail := func(rel string, err error) {
+		fileErrs = append(fileErrs, FileError{Path: rel, Error: err.Error()})
+	}
+	read := func(rel string) ([]byte, bool) {
+		data, err := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(rel)))
+		if err != nil {
+			fail(rel, fmt.Errorf("failed to read %s: %w", rel, err))
+			return nil, false
+		}
+		return data, true
+	}
+
+	var deps []Dependency
+	for _, dir := range names {
+		files := dirs[dir]
+		var found []Dependency
+		if gomod, ok := files["go.mod"]; ok {
+			if data, ok := read(gomod); ok {
+				found = parseGoMod(gomod, data)
+				if gosum, ok := files["go.sum"]; ok {
+					if data, ok := read(gosum); ok {
+						applyGoSum(found, data)
+					}
+				}
+			}
+		}
+
+		if pkg, ok := files["package.json"]; ok {
+			var direct []Dependency
+			if data, ok := read(pkg); ok {
+				var err error
+				if direct, err = parsePackageJSON(pkg, data); err != nil {
+					fail(pkg, err)
+				}
+			}
+			// Without a usable lockfile the declared ranges are all there is
+			resolved := false
+			for _, lockfile := range []string{"package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml"} {
+				lock, ok := files[lockfile]
+				if !ok {
+					continue
+				}
+				if data, ok := read(lock); ok {
+					locked, err := parseNPMLockfile(lockfile, data)
+					if err != nil {
+						fail(lock, fmt.Errorf("failed to parse %s: %w", lock, err))
+					} else {
+						found = append(found, mergeLocked(direct, locked, lock)...)
+						resolved = true
+					}
+				}
+				break
+			}
+			if !resolved {
+				found = append(found, direct...)
+			}
+		}
+
+		var pyFiles []string
+		for name, rel := range files {
+			if strings.HasPrefix(name, "requirements") && strings.HasSuffix(name, ".txt") {
+				pyFiles = append(pyFiles, rel)
+			}
+		}
+		sort.Strings(pyFiles)
+		for _, rel := range pyFiles {
+			if data, ok := read(rel); ok {
+				found = append(found, parseRequirements(rel, data)...)
+			}
+		}
+		if pyproject, ok := files["pyproject.toml"]; ok {
+			if data, ok := read(pyproject); ok {
+				found = append(found, parsePyProject(pyproject, data)...)
+			}
+		}
+
+		if pom, ok := files["pom.xml"]; ok {
+			if data, ok := read(pom); ok {
+				parsed, err := parsePOM(pom, data)
+				if err != nil {
+					fail(pom, err)
+				} else {
+					found = append(found, parsed...)
+				}
+			}
+		}
+		deps = append(deps, found...)
+	}
+	return deps, fileErrs, nil
+}
+
+// parseGoMod reads the requirements of a go.mod file, applying replace
+// directives
+func parseGoMod(rel string, data []byte) []Dependency {
+	var (
+		deps     []Dependency
+		replaces = make(map[string][2]string) // module or module@version -> new path, version
+		block    string
+	)
+	for _, raw := range strings.Split(string(data), "\n") {
+		line, comment, _ := strings.Cut(raw, "//")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		directive := block
+		switch {
+		case block != "" && fields[0] == ")":
+			block = ""
+			continue
+		case block == "" && len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case block == "":
+			directive, fields = fields[0], fields[1:]
+		}
+
+		switch directive {
+		case "require":
+			if len(fields) < 2 {
+				continue
+			}
+			deps = append(deps, Dependency{
+				Ecosystem: EcosystemGo,
+				Name:      unquoteGoMod(fields[0]),
+				Version:   unquoteGoMod(fields[1]),
+				Manifest:  rel,
+				Direct:    strings.TrimSpace(comment) != "indirect",
+			})
+		case "replace":
+			old, repl, ok := strings.Cut(strings.Join(fields, " "), "=>")
+			if !ok {
+				continue
+			}
+			oldFields, newFields := strings.Fields(old), strings.Fields(repl)
+			if len(oldFields) == 0 || len(newFields) == 0 {
+				continue
+			}
+			key := unquoteGoMod(oldFields[0])
+			if len(oldFields) > 1 {
+				key += "@" + unquoteGoMod(oldFields[1])
+			}
+			target := [2]string{unquoteGoMod(newFields[0]), ""}
+			if len(newFields) > 1 {
+				target[1] = unquoteGoMod(newFields[1])
+			}
+			replaces[key] = target
+		}
+	}
+
+	for i := range deps {
+		d := &deps[i]
+		target, ok := replaces[d.Name+"@"+d.Version]
+		if !ok {
+			target, ok = replaces[d.Name]
+		}
+		if !ok {
+			continue
+		}
+		d.Replace = target[0]
+		if target[1] != "" {
+			d.Replace += " " + target[1]
+			if target[0] == d.Name {
+				d.Version = target[1]
+			}
+		}
+	}
+	return deps
+}
+
+// unquoteGoMod removes the quotes of a go.mod string
+func unquoteGoMod(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// applyGoSum sets the checksums of the modules listed in go.sum
+func applyGoSum(deps []Dependency, data []byte) {
+	sums := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && !strings.HasSuffix(fields[1], "/go.mod") {
+			sums[fields[0]+"@"+fields[1]] = fields[2]
+		}
+	}
+	for i := range deps {
+		deps[i].Hash = sums[deps[i].Name+"@"+deps[i].Version]
+	}
+}
+
+// parsePackageJSON reads the declared dependencies of a package.json
+func parsePackageJSON(rel string, data []byte) ([]Dependency, error) {
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", rel, err)
+	}
+	var deps []Dependency
+	for _, field := range []struct{ key, scope string }{
+		{"dependencies", ""},
+		{"devDependencies", "dev"},
+		{"optionalDependencies", "optional"},
+		{"peerDependencies", "peer"},
+	} {
+		var declared map[string]string
+		if raw, ok := manifest[field.key]; !ok || json.Unmarshal(raw, &declared) != nil {
+			continue
+		}
+		names := make([]string, 0, len(declared))
+		for name := range declared {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			deps = append(deps, Dependency{
+				Ecosystem:  EcosystemNPM,
+				Name:       name,
+				Constraint: declared[name],
+				Manifest:   rel,
+				Direct:     true,
+				Scope:      field.scope,
+			})
+		}
+	}
+	return deps, nil
+}
+
+// lockedPackage is a package version resolved by an npm lockfile
+type lockedPackage struct {
+	name      string
+	version   string
+	specs     []string // ranges resolved to this version, from yarn.lock
+	topLevel  bool     // installed at the top of node_modules
+	dev       bool
+	dependsOn []string
+}
+
+// parseNPMLockfile reads the resolved packages of package-lock.json,
+// npm-shrinkwrap.json, yarn.lock or pnpm-lock.yaml
+func parseNPMLockfile(name string, data []byte) ([]lockedPackage, error) {
+	switch name {
+	case "yarn.lock":
+		return parseYarnLock(data), nil
+	case "pnpm-lock.yaml":
+		return parsePNPMLock(data)
+	}
+
+	type npmEntry struct {
+		Name         string            `json:"name"`
+		Version      string            `json:"version"`
+		Dev          bool              `json:"dev"`
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	var lock struct {
+		Packages     map[string]npmEntry        `json:"packages"`
+		Dependencies map[string]json.RawMessage `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	var locked []lockedPackage
+	if len(lock.Packages) > 0 {
+		// Lockfile version 2 and 3 key packages by their install path
+		for key, e := range lock.Packages {
+			i := strings.LastIndex(key, "node_modules/")
+			if i < 0 || e.Version == "" {
+				continue
+			}
+			name := key[i+len("node_modules/"):]
+			if e.Name != "" {
+				name = e.Name
+			}
+			locked = append(locked, lockedPackage{
+				name:      name,
+				version:   e.Version,
+				topLevel:  i == 0,
+				dev:       e.Dev,
+				dependsOn: sortedKeys(e.Dependencies),
+			})
+		}
+	} else {
+		// Version 1 nests the dependencies of each package
+		var walk func(entries map[string]json.RawMessage, topLevel bool) error
+		walk = func(entries map[string]json.RawMessage, topLevel bool) error {
+			for name, raw := range entries {
+				var e struct {
+					Version      string                     `json:"version"`
+					Dev          bool                       `json:"dev"`
+					Requires     map[string]string          `json:"requires"`
+					Dependencies map[string]json.RawMessage `json:"dependencies"`
+				}
+				if err := json.Unmarshal(raw, &e); err != nil {
+					return err
+				}
+				locked = append(locked, lockedPackage{name: name, version: e.Version, topLevel: topLevel, dev: e.Dev, dependsOn: sortedKeys(e.Requires)})
+				if err := walk(e.Dependencies, false); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := walk(lock.Dependencies, true); err != nil {
+			return nil, err
+		}
+	}
+	return locked, nil
+}
+
+// parseYarnLock reads a yarn.lock of yarn 1 or of later versions
+func parseYarnLock(data []byte) []lockedPackage {
+	var (
+		locked  []lockedPackage
+		current *lockedPackage
+		inDeps  bool
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		switch {
+		case indent == 0 && strings.HasSuffix(trimmed, ":"):
+			// An entry lists the ranges it resolves: "a@^1.0.0", "a@^1.1.0":
+			locked = append(locked, lockedPackage{})
+			current = &locked[len(locked)-1]
+			inDeps = false
+			for _, spec := range strings.Split(strings.TrimSuffix(trimmed, ":"), ",") {
+				spec = strings.Trim(strings.TrimSpace(spec), `"`)
+				if at := strings.LastIndex(spec, "@"); at > 0 {
+					current.name = spec[:at]
+					current.specs = append(current.specs, strings.TrimPrefix(spec[at+1:], "npm:"))
+				}
+			}
+		case current == nil:
+		case indent == 2:
+			key, value := yarnField(trimmed)
+			inDeps = key == "dependencies" || key == "optionalDependencies"
+			if key == "version" {
+				current.version = value
+			}
+		case indent >= 4 && inDeps:
+			if key, _ := yarnField(trimmed); key != "" {
+				current.dependsOn = append(current.dependsOn, key)
+			}
+		}
+	}
+	var result []lockedPackage
+	for _, p := range locked {
+		if p.name != "" && p.version != "" && p.name != "__metadata" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// yarnField splits a yarn.lock line into its key and unquoted value
+func yarnField(line string) (string, string) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok || strings.HasPrefix(key, `"`) && !strings.HasSuffix(key, `"`) {
+		key, value, _ = strings.Cut(line, " ")
+	}
+	return strings.Trim(strings.TrimSpace(key), `"`), strings.Trim(strings.TrimSpace(value), `"`)
+}
+
+// parsePNPMLock reads a pnpm-lock.yaml
+func parsePNPMLock(data []byte) ([]lockedPackage, error) {
+	var lock struct {
+		Importers map[string]struct {
+			Dependencies    map[string]any `yaml:"dependencies"`
+			DevDependencies map[string]any `yaml:"devDependencies"`
+		} `yaml:"importers"`
+		Dependencies map[string]any `yaml:"dependencies"`
+		Packages     map[string]struct {
+			Dev          bool              `yaml:"dev"`
+			Dependencies map[string]string `yaml:"dependencies"`
+		} `yaml:"packages"`
+	}
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	var locked []lockedPackage
+	for key, p := range lock.Packages {
+		// Keys are /name@version, /name/version or name@version, with
+		// peer dependencies in parentheses
+		key = strings.TrimPrefix(key, "/")
+		if i := strings.Index(key, "("); i > 0 {
+			key = key[:i]
+		}
+		sep := strings.LastIndex(key, "@")
+		if sep <= 0 {
+			sep = strings.LastIndex(key, "/")
+		}
+		if sep <= 0 {
+			continue
+		}
+		locked = append(locked, lockedPackage{
+			name:      key[:sep],
+			version:   key[sep+1:],
+			dev:       p.Dev,
+			dependsOn: sortedKeys(p.Dependencies),
+		})
+	}
+
+	// Versions the root package resolves its dependencies to
+	top := make(map[string]bool)
+	addTop := func(deps map[string]any) {
+		for name, v := range deps {
+			version := fmt.Sprint(v)
+			if m, ok := v.(map[string]any); ok {
+				version = fmt.Sprint(m["version"])
+			}
+			if i := strings.Index(version, "("); i > 0 {
+				version = version[:i]
+			}
+			top[name+"@"+version] = true
+		}
+	}
+	addTop(lock.Dependencies)
+	if root, ok := lock.Importers["."]; ok {
+		addTop(root.Dependencies)
+		addTop(root.DevDependencies)
+	}
+	for i := range locked {
+		locked[i].topLevel = top[locked[i].name+"@"+locked[i].version]
+	}
+	return locked, nil
+}
+
+// mergeLocked resolves the versions of the declared npm dependencies with
+// a lockfile and lists the other locked packages as indirect
+func mergeLocked(direct []Dependency, locked []lockedPackage, lockfile string) []Dependency {
+	sort.Slice(locked, func(i, j int) bool {
+		if locked[i].name != locked[j].name {
+			return locked[i].name < locked[j].name
+		}
+		return compareVersions(locked[i].version, locked[j].version) < 0
+	})
+
+	used := make(map[int]bool)
+	deps := make([]Dependency, 0, len(locked))
+	for _, d := range direct {
+		match := -1
+		for i, p := range locked {
+			if p.name != d.Name {
+				continue
+			}
+			if match < 0 || p.topLevel || containsString(p.specs, d.Constraint) {
+				match = i
+			}
+			if p.topLevel || containsString(p.specs, d.Constraint) {
+				break
+			}
+		}
+		if match >= 0 {
+			d.Version = locked[match].version
+			d.DependsOn = locked[match].dependsOn
+			used[match] = true
+		}
+		deps = append(deps, d)
+	}
+	for i, p := range locked {
+		if used[i] {
+			continue
+		}
+		dep := Dependency{
+			Ecosystem: EcosystemNPM,
+			Name:      p.name,
+			Version:   p.version,
+			Manifest:  lockfile,
+			DependsOn: p.dependsOn,
+		}
+		if p.dev {
+			dep.Scope = "dev"
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+var (
+	// requirement matches a PEP 508 requirement: a name, extras and a
+	// version specifier
+	requirement = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[[^\]]*\])?\s*(\(?[^;@]*\)?)`)
+	// pythonNameSeparators are the runs PEP 503 folds into a dash
+	pythonNameSeparators = regexp.MustCompile(`[-_.]+`)
+	// tomlString matches a quoted TOML string
+	tomlString = regexp.MustCompile(`"([^"]*)"|'([^']*)'`)
+	// poetryVersion matches the version of a Poetry dependency table
+	poetryVersion = regexp.MustCompile(`version\s*=\s*["']([^"']*)["']`)
+	// exactVersion matches a version without range operators
+	exactVersion = regexp.MustCompile(`^\d+(\.\d+)*$`)
+	// pomReference matches a property reference of a POM
+	pomReference = regexp.MustCompile(`\$\{([^}]+)\}`)
+)
+
+// parseRequirement parses a PEP 508 requirement
+func parseRequirement(rel, spec, scope string) (Dependency, bool) {
+	m := requirement.FindStringSubmatch(strings.TrimSpace(spec))
+	if m == nil {
+		return Dependency{}, false
+	}
+	d := Dependency{
+		Ecosystem:  EcosystemPyPI,
+		Name:       normalizePythonName(m[1]),
+		Constraint: strings.ReplaceAll(strings.Trim(strings.TrimSpace(m[2]), "()"), " ", ""),
+		Manifest:   rel,
+		Direct:     true,
+		Scope:      scope,
+	}
+	if v, ok := strings.CutPrefix(d.Constraint, "=="); ok && !strings.ContainsAny(v, ",*") {
+		d.Version = v
+	} else if v, ok := strings.CutPrefix(d.Constraint, "==="); ok {
+		d.Version = v
+	}
+	return d, true
+}
+
+// normalizePythonName normalizes a Python distribution name as in PEP 503
+func normalizePythonName(name string) string {
+	return strings.ToLower(pythonNameSeparators.ReplaceAllString(name, "-"))
+}
+
+// parseRequirements reads a pip requirements file. Options, includes and
+// URLs are skipped.
+func parseRequirements(rel string, data []byte) []Dependency {
+	var deps []Dependency
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue
+		}
+		if d, ok := parseRequirement(rel, line, ""); ok {
+			deps = append(deps, d)
+		}
+	}
+	return deps
+}
+
+// parsePyProject reads the PEP 621 and Poetry dependencies of a
+// pyproject.toml. Only the TOML used by these tables is understood.
+func parsePyProject(rel string, data []byte) []Dependency {
+	var (
+		deps  []Dependency
+		table string
+		array string // key of the array being read
+		items []string
+	)
+	flush := func() {
+		scope := ""
+		if table == "project.optional-dependencies" {
+			scope = array
+		}
+		for _, item := range items {
+			if d, ok := parseRequirement(rel, item, scope); ok {
+				deps = append(deps, d)
+			}
+		}
+		array, items = "", nil
+	}
+	collect := func(s string) {
+		for _, m := range tomlString.FindAllStringSubmatch(s, -1) {
+			items = append(items, m[1]+m[2])
+		}
+	}
+
+	for _, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(raw)
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if array != "" {
+			before, _, closed := strings.Cut(line, "]")
+			collect(before)
+			if closed {
+				flush()
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			table = strings.Trim(line, "[] ")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.Trim(strings.TrimSpace(key), `"'`), strings.TrimSpace(value)
+
+		switch {
+		case (table == "project" && key == "dependencies") || table == "project.optional-dependencies":
+			if !strings.HasPrefix(value, "[") {
+				continue
+			}
+			array = key
+			before, _, closed := strings.Cut(value[1:], "]")
+			collect(before)
+			if closed {
+				flush()
+			}
+		case table == "tool.poetry.dependencies" || table == "tool.poetry.dev-dependencies" ||
+			(strings.HasPrefix(table, "tool.poetry.group.") && strings.HasSuffix(table, ".dependencies")):
+			if key == "python" {
+				continue
+			}
+			constraint := strings.Trim(value, `"'`)
+			if strings.HasPrefix(value, "{") {
+				constraint = ""
+				if m := poetryVersion.FindStringSubmatch(value); m != nil {
+					constraint = m[1]
+				}
+			}
+			scope := ""
+			if table != "tool.poetry.dependencies" {
+				scope = "dev"
+				if g := strings.TrimSuffix(strings.TrimPrefix(table, "tool.poetry.group."), ".dependencies"); g != table {
+					scope = g
+				}
+			}
+			d := Dependency{Ecosystem: EcosystemPyPI, Name: normalizePythonName(key), Constraint: constraint, Manifest: rel, Direct: true, Scope: scope}
+			if exactVersion.MatchString(constraint) {
+				d.Version = constraint // Poetry reads a bare version as an exact one
+			}
+			deps = append(deps, d)
+		}
+	}
+	return deps
+}
+
+// pomDependency is a dependency of a Maven POM
+type pomDependency struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Scope      string `xml:"scope"`
+	Optional   string `xml:"optional"`
+}
+
+// parsePOM reads the dependencies of a Maven pom.xml, resolving property
+// references and versions managed by the POM itself
+func parsePOM(rel string, data []byte) ([]Dependency, error) {
+	var pom struct {
+		GroupID string `xml:"groupId"`
+		Version string `xml:"version"`
+		Parent  struct {
+			GroupID string `xml:"groupId"`
+			Version string `xml:"version"`
+		} `xml:"parent"`
+		Properties struct {
+			Entries []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"properties"`
+		Managed      []pomDependency `xml:"dependencyManagement>dependencies>dependency"`
+		Dependencies []pomDependency `xml:"dependencies>dependency"`
+	}
+	if err := xml.Unmarshal(data, &pom); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", rel, err)
+	}
+
+	props := map[string]string{
+		"project.groupId":        firstNonEmpty(pom.GroupID, pom.Parent.GroupID),
+		"project.version":        firstNonEmpty(pom.Version, pom.Parent.Version),
+		"project.parent.version": pom.Parent.Version,
+	}
+	for _, p := range pom.Properties.Entries {
+		props[p.XMLName.Local] = strings.TrimSpace(p.Value)
+	}
+	resolve := func(s string) string {
+		for i := 0; i < 5 && strings.Contains(s, "${"); i++ {
+			s = pomReference.ReplaceAllStringFunc(s, func(ref string) string {
+				if v, ok := props[ref[2:len(ref)-1]]; ok {
+					return v
+				}
+				return ref
+			})
+		}
+		return strings.TrimSpace(s)
+	}
+	managed := make(map[string]string)
+	for _, d := range pom.Managed {
+		managed[resolve(d.GroupID)+":"+resolve(d.ArtifactID)] = resolve(d.Version)
+	}
+
+	var deps []Dependency
+	for _, d := range pom.Dependencies {
+		name := resolve(d.GroupID) + ":" + resolve(d.ArtifactID)
+		version := resolve(d.Version)
+		if version == "" {
+			version = managed[name]
+		}
+		dep := Dependency{Ecosystem: EcosystemMaven, Name: name, Manifest: rel, Direct: true, Scope: d.Scope}
+		if d.Optional == "true" && dep.Scope == "" {
+			dep.Scope = "optional"
+		}
+		// Maven ranges such as [1.0,2.0) are constraints, not versions
+		if strings.ContainsAny(version, "[](),$") {
+			dep.Constraint = version
+		} else {
+			dep.Version = version
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// AddDependencyNodes adds a node per dependency and "depends_on" edges
+// from the external packages the code imports to the dependency providing
+// them, and between dependencies as their lockfile records
+func (s *Service) AddDependencyNodes(graph []GraphNode, deps []Dependency) []GraphNode {
+	index := make(map[string]int, len(graph))
+	for i, node := range graph {
+		index[node.ID] = i
+	}
+	for _, d := range deps {
+		id := dependencyNodeID(d.Ecosystem, d.Name)
+		if _, ok := index[id]; ok {
+			continue // the first manifest declaring a dependency wins
+		}
+		index[id] = len(graph)
+		props := map[string]interface{}{"ecosystem": d.Ecosystem, "direct": d.Direct, "manifest": d.Manifest}
+		if d.Version != "" {
+			props["version"] = d.Version
+		}
+		if d.Constraint != "" {
+			props["constraint"] = d.Constraint
+		}
+		if d.Scope != "" {
+			props["scope"] = d.Scope
+		}
+		graph = append(graph, GraphNode{ID: id, Type: NodeDependency, Name: d.Name, Path: d.Manifest, Package: d.Name, Properties: props})
+	}
+
+	existing := make(map[string]bool)
+	for _, node := range graph {
+		for _, e := range node.Edges {
+			if e.Type == EdgeDependsOn {
+				existing[node.ID+"|"+e.Target] = true
+			}
+		}
+	}
+	link := func(from, to string) {
+		i, ok := index[from]
+		if _, found := index[to]; !ok || !found || from == to || existing[from+"|"+to] {
+			return
+		}
+		existing[from+"|"+to] = true
+		graph[i].Edges = append(graph[i].Edges, GraphEdge{Target: to, Type: EdgeDependsOn})
+	}
+
+	for _, d := range deps {
+		for _, name := range d.DependsOn {
+			link(dependencyNodeID(d.Ecosystem, d.Name), dependencyNodeID(d.Ecosystem, name))
+		}
+	}
+	for _, node := range graph {
+		if node.Type != NodePackage || node.Properties["external"] != true {
+			continue
+		}
+		if d, ok := providingDependency(node.Package, deps); ok {
+			link(node.ID, dependencyNodeID(d.Ecosystem, d.Name))
+		}
+	}
+	return graph
+}
+
+// dependencyNodeID returns the graph node ID of a dependency
+func dependencyNodeID(ecosystem, name string) string {
+	return "dep:" + ecosystem + ":" + name
+}
+
+// providingDependency finds the dependency providing an imported package:
+// the Go module with the longest matching path, the npm package, the
+// Python distribution named like the top-level module or the Maven group
+// the Java package belongs to
+func providingDependency(imported string, deps []Dependency) (Dependency, bool) {
+	var (
+		best    Dependency
+		bestLen = -1
+	)
+	for _, d := range deps {
+		matched := false
+		switch d.Ecosystem {
+		case EcosystemGo:
+			matched = imported == d.Name || strings.HasPrefix(imported, d.Name+"/")
+		case EcosystemNPM:
+			matched = npmPackageName(imported) == d.Name
+		case EcosystemPyPI:
+			top, _, _ := strings.Cut(imported, ".")
+			matched = normalizePythonName(top) == d.Name
+		case EcosystemMaven:
+			group, _, _ := strings.Cut(d.Name, ":")
+			matched = strings.HasPrefix(imported, group+".")
+		}
+		if matched && len(d.Name) > bestLen {
+			best, bestLen = d, len(d.Name)
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// npmPackageName returns the package of an import specifier, keeping the
+// scope of scoped packages: "@scope/pkg/sub" is "@scope/pkg"
+func npmPackageName(spec string) string {
+	parts := strings.SplitN(spec, "/", 3)
+	if strings.HasPrefix(spec, "@") && len(parts) > 1 {
+		return parts[0] + "/" + parts[1]
+	}
+	return parts[0]
+}
+
+// DiffDependencies compares the dependencies of two trees. Dependencies
+// are matched by ecosystem, name and manifest; versions are compared when
+// both are known.
+func DiffDependencies(base, head []Dependency) []DependencyChange {
+	type entry struct {
+		versions []string
+		direct   bool
+	}
+	collect := func(deps []Dependency) (map[string]*entry, []string) {
+		entries := make(map[string]*entry)
+		var keys []string
+		for _, d := range deps {
+			key := d.Ecosystem + "\x00" + d.Manifest + "\x00" + d.Name
+			e, ok := entries[key]
+			if !ok {
+				e = &entry{}
+				entries[key] = e
+				keys = append(keys, key)
+			}
+			if v := firstNonEmpty(d.Version, d.Constraint); v != "" && !containsString(e.versions, v) {
+				e.versions = append(e.versions, v)
+			}
+			e.direct = e.direct || d.Direct
+		}
+		for _, e := range entries {
+			sort.Slice(e.versions, func(i, j int) bool { return compareVersions(e.versions[i], e.versions[j]) < 0 })
+		}
+		return entries, keys
+	}
+	before, baseKeys := collect(base)
+	after, headKeys := collect(head)
+
+	var changes []DependencyChange
+	change := func(key, kind string, from, to *entry) {
+		parts := strings.SplitN(key, "\x00", 3)
+		c := DependencyChange{Ecosystem: parts[0], Manifest: parts[1], Name: parts[2], Kind: kind}
+		if from != nil {
+			c.From = strings.Join(from.versions, ", ")
+			c.Direct = from.direct
+		}
+		if to != nil {
+			c.To = strings.Join(to.versions, ", ")
+			c.Direct = to.direct
+		}
+		changes = append(changes, c)
+	}
+	for _, key := range headKeys {
+		a, b := before[key], after[key]
+		switch {
+		case a == nil:
+			change(key, "added", nil, b)
+		case strings.Join(a.versions, ",") == strings.Join(b.versions, ","):
+		case len(a.versions) == 1 && len(b.versions) == 1 && compareVersions(a.versions[0], b.versions[0]) < 0:
+			change(key, "upgraded", a, b)
+		case len(a.versions) == 1 && len(b.versions) == 1 && compareVersions(a.versions[0], b.versions[0]) > 0:
+			change(key, "downgraded", a, b)
+		default:
+			change(key, "changed", a, b)
+		}
+	}
+	for _, key := range baseKeys {
+		if after[key] == nil {
+			change(key, "removed", before[key], nil)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Manifest != changes[j].Manifest {
+			return changes[i].Manifest < changes[j].Manifest
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// versionPart splits versions into their numeric and textual parts
+var versionPart = regexp.MustCompile(`\d+|[A-Za-z]+`)
+
+// compareVersions orders two versions by their numeric parts; a
+// pre-release such as 1.0.0-rc1 sorts before its release. Range operators
+// and a leading v are ignored.
+func compareVersions(a, b string) int {
+	split := func(v string) ([]string, bool) {
+		v = strings.TrimLeft(v, "^~=<>! v")
+		release, pre, hasPre := strings.Cut(strings.SplitN(v, "+", 2)[0], "-")
+		parts := versionPart.FindAllString(release, -1)
+		if hasPre {
+			parts = append(parts, "~")
+			parts = append(parts, versionPart.FindAllString(pre, -1)...)
+		}
+		return parts, hasPre
+	}
+	pa, _ := split(a)
+	pb, _ := split(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y string
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x == y {
+			continue
+		}
+		// A pre-release marker sorts before a release's end and its parts
+		switch {
+		case x == "~":
+			return -1
+		case y == "~":
+			return 1
+		case x == "":
+			if _, err := strconv.Atoi(y); err != nil {
+				return 1 // 1.0 is after 1.0rc1
+			}
+			return -1
+		case y == "":
+			if _, err := strconv.Atoi(x); err != nil {
+				return -1
+			}
+			return 1
+		}
+		nx, errX := strconv.Atoi(x)
+		ny, errY := strconv.Atoi(y)
+		switch {
+		case errX == nil && errY == nil:
+			if nx < ny {
+				return -1
+			}
+			return 1
+		case errX == nil:
+			return 1 // numbers sort after words: 1.0.1 is after 1.0.beta
+		case errY == nil:
+			return -1
+		case x < y:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return 0
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// firstNonEmpty returns the first string that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
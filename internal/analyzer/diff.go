@@ -0,0 +1,402 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines around each hunk
+	diffContext = 3
+	// maxDiffCells bounds the LCS table; larger changes are diffed as a
+	// single replacement
+	maxDiffCells = 4 << 20
+)
+
+// diffOp is one line of an edit script
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns a unified diff of two versions of a repository file
+// that git apply accepts, or an empty string when they are equal
+func unifiedDiff(path string, before, after []byte) string {
+	if string(before) == string(after) {
+		return ""
+	}
+	a, b := splitLines(string(before)), splitLines(string(after))
+	ops := diffLines(a, b)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+
+	// Line numbers in a and b before ops[i]
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while changes are within twice the context
+		start := max(0, i-diffContext)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(len(ops), end+diffContext)
+
+		aCount, bCount := aLine[end]-aLine[start], bLine[end]-bLine[start]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aLine[start], aCount), hunkRange(bLine[start], bCount))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(strings.TrimSuffix(op.line, "\n"))
+			sb.WriteByte('\n')
+			if !strings.HasSuffix(op.line, "\n") {
+				sb.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats the start,count of a hunk header
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits text into lines that keep their newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a line edit script. The common prefix and suffix are
+// trimmed first, so the LCS table only spans the changed region.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, l := range a[:prefix] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// diffMiddle diffs the changed region with a longest common subsequence
+func diffMiddle(a, b []string) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > maxDiffCells {
+		for _, l := range a {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, diffOp{'+', l})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// diffHunk is a parsed hunk of a unified diff
+type diffHunk struct {
+	oldStart int
+	ops      []diffOp
+}
+
+// filePatch is the parsed diff of one file
+type filePatch struct {
+	oldPath, newPath string // empty for created and deleted files
+	hunks            []diffHunk
+}
+
+// hunkHeader matches @@ -l[,c] +l[,c] @@
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// ApplyUnifiedDiff applies a unified diff, as produced by SuggestFixes or
+// git diff, to the files under root. Hunks must match their context
+// exactly but may have moved. It returns the repository-relative paths of
+// the changed files.
+func ApplyUnifiedDiff(root, diff string) ([]string, error) {
+	patches, err := parseUnifiedDiff(diff)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, p := range patches {
+		target := p.newPath
+		if target == "" {
+			target = p.oldPath
+		}
+		abs, err := patchTarget(root, target)
+		if err != nil {
+			return nil, err
+		}
+
+		var old []string
+		if p.oldPath != "" {
+			content, err := os.ReadFile(abs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", p.oldPath, err)
+			}
+			old = splitLines(string(content))
+		}
+		lines, err := applyHunks(old, p.hunks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to patch %s: %w", target, err)
+		}
+
+		if p.newPath == "" {
+			if err := os.Remove(abs); err != nil {
+				return nil, fmt.Errorf("failed to delete %s: %w", target, err)
+			}
+		} else {
+			if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create directory for %s: %w", target, err)
+			}
+			if err := os.WriteFile(abs, []byte(strings.Join(lines, "")), 0644); err != nil {
+				return nil, fmt.Errorf("failed to write %s: %w", target, err)
+			}
+		}
+		changed = append(changed, target)
+	}
+	return changed, nil
+}
+
+// patchTarget resolves a patch path under root, rejecting paths that escape
+// it. A path through a symbolic link is rejected too, as the link may lead
+// out of root.
+func patchTarget(root, p string) (string, error) {
+	clean := path.Clean("/" + p)[1:]
+	if clean == "" || clean != strings.TrimPrefix(p, "./") {
+		return "", fmt.Errorf("invalid path in patch: %s", p)
+	}
+	abs := root
+	for _, elem := range strings.Split(clean, "/") {
+		abs = filepath.Join(abs, elem)
+		info, err := os.Lstat(abs)
+		if errors.Is(err, fs.ErrNotExist) {
+			break // the rest is created by the patch
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", p, err)
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("path in patch goes through a symbolic link: %s", p)
+		}
+	}
+	return filepath.Join(root, filepath.FromSlash(clean)), nil
+}
+
+// parseUnifiedDiff parses the file sections and hunks of a unified diff
+func parseUnifiedDiff(diff string) ([]filePatch, error) {
+	var (
+		patches    []filePatch
+		current    *filePatch
+		hunk       *diffHunk
+		oldN, newN int // lines of the current hunk still to read
+	)
+	stripPrefix := func(line, marker string) string {
+		p := strings.TrimPrefix(line, marker)
+		if i := strings.IndexByte(p, '\t'); i >= 0 {
+			p = p[:i] // timestamps after the name
+		}
+		if p == "/dev/null" {
+			return ""
+		}
+		if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+			p = p[2:]
+		}
+		return p
+	}
+
+	lines := splitLines(diff)
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\n")
+		switch {
+		case hunk != nil && line == `\ No newline at end of file`:
+			if n := len(hunk.ops); n > 0 {
+				hunk.ops[n-1].line = strings.TrimSuffix(hunk.ops[n-1].line, "\n")
+			}
+		case oldN > 0 || newN > 0:
+			// Hunk lines are counted, so content looking like headers is safe
+			kind := byte(' ')
+			if line != "" {
+				kind, line = line[0], line[1:]
+			}
+			switch kind {
+			case ' ':
+				oldN--
+				newN--
+			case '-':
+				oldN--
+			case '+':
+				newN--
+			default:
+				return nil, fmt.Errorf("invalid line in hunk: %q", lines[i])
+			}
+			hunk.ops = append(hunk.ops, diffOp{kind, line + "\n"})
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			patches = append(patches, filePatch{
+				oldPath: stripPrefix(line, "--- "),
+				newPath: stripPrefix(strings.TrimSuffix(lines[i+1], "\n"), "+++ "),
+			})
+			current, hunk = &patches[len(patches)-1], nil
+			i++
+		case strings.HasPrefix(line, "@@"):
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil || current == nil {
+				return nil, fmt.Errorf("invalid hunk header: %q", line)
+			}
+			start, _ := strconv.Atoi(m[1])
+			oldN, newN = 1, 1
+			if m[2] != "" {
+				oldN, _ = strconv.Atoi(m[2])
+			}
+			if m[4] != "" {
+				newN, _ = strconv.Atoi(m[4])
+			}
+			current.hunks = append(current.hunks, diffHunk{oldStart: start})
+			hunk = &current.hunks[len(current.hunks)-1]
+		default:
+			// git extended headers (diff --git, index, mode) between files
+			hunk = nil
+		}
+	}
+	if oldN > 0 || newN > 0 {
+		return nil, errors.New("patch ends in the middle of a hunk")
+	}
+	if len(patches) == 0 {
+		return nil, errors.New("patch contains no file changes")
+	}
+	return patches, nil
+}
+
+// applyHunks applies hunks in order to the lines of a file
+func applyHunks(old []string, hunks []diffHunk) ([]string, error) {
+	var out []string
+	pos := 0 // next unconsumed line of old
+	for n, h := range hunks {
+		var before, after []string
+		for _, op := range h.ops {
+			if op.kind != '+' {
+				before = append(before, op.line)
+			}
+			if op.kind != '-' {
+				after = append(after, op.line)
+			}
+		}
+
+		at := findHunk(old, before, max(pos, h.oldStart-1), pos)
+		if at < 0 {
+			return nil, fmt.Errorf("hunk %d does not apply", n+1)
+		}
+		out = append(out, old[pos:at]...)
+		out = append(out, after...)
+		pos = at + len(before)
+	}
+	return append(out, old[pos:]...), nil
+}
+
+// findHunk finds lines in old at or after from, searching outward from the
+// expected position
+func findHunk(old, lines []string, expected, from int) int {
+	matches := func(at int) bool {
+		if at < from || at+len(lines) > len(old) {
+			return false
+		}
+		for i, l := range lines {
+			if old[at+i] != l {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; d <= len(old); d++ {
+		if matches(expected + d) {
+			return expected + d
+		}
+		if d > 0 && matches(expected-d) {
+			return expected - d
+		}
+	}
+	return -1
+}
@@ -0,0 +1,715 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Patch is a candidate fix for a diagnosis, as a unified diff against the
+// workspace
+type Patch struct {
+	ID     string `json:"id"`
+	NodeID string `json:"nodeId"` // suspect of the diagnosis the patch fixes
+	RuleID string `json:"ruleId"` // rule of the diagnosis the patch fixes
+	Fix    string `json:"fix"`
+	Title  string `json:"title"`
+	File   string `json:"file"`
+	Diff   string `json:"diff"`
+}
+
+// goFixer rewrites a Go function to remove a known cause of failure
+type goFixer struct {
+	title string
+	// typed fixers are given the type information of the file's package
+	typed bool
+	// apply reports whether fn changed
+	apply func(fset *token.FileSet, f *ast.File, info *types.Info, fn *ast.FuncDecl) bool
+}
+
+// goFixers are the fixes root-cause rules can offer for Go code
+var goFixers = map[string]goFixer{
+	"handle-ignored-error": {"Handle the ignored error", true, handleIgnoredErrors},
+	"nil-check-params":     {"Return early on nil pointer parameters", false, nilCheckParams},
+	"bounds-check":         {"Check the index before indexing", false, boundsCheckIndexes},
+	"comma-ok-assertion":   {"Check the type assertion", false, commaOkAssertions},
+	"defer-unlock":         {"Release the lock with defer", false, deferUnlocks},
+}
+
+// SuggestFixes generates candidate patches for diagnoses of Go functions
+// whose rule offers fixes. Each fix is applied on its own to the workspace
+// version of the file, and the rewritten file is gofmt-formatted.
+func (s *Service) SuggestFixes(repoPath string, diagnoses []Diagnosis, graph []GraphNode) ([]Patch, error) {
+	nodes := make(map[string]GraphNode, len(graph))
+	for _, node := range graph {
+		nodes[node.ID] = node
+	}
+
+	// Standard library packages are type-checked once per call
+	imp := &fixImporter{std: importer.ForCompiler(token.NewFileSet(), "source", nil), fakes: make(map[string]*types.Package)}
+
+	patches := []Patch{}
+	for _, d := range diagnoses {
+		node, ok := nodes[d.NodeID]
+		if !ok || len(d.Fixes) == 0 || languageOf(node.Path) != "Go" || node.StartLine <= 0 {
+			continue
+		}
+		src, err := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(node.Path)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", node.Path, err)
+		}
+
+		for _, name := range d.Fixes {
+			fixer, ok := goFixers[name]
+			if !ok {
+				continue
+			}
+			fixed, err := applyGoFix(repoPath, node.Path, src, node.StartLine, fixer, imp)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply %s to %s: %w", name, node.Path, err)
+			}
+			diff := unifiedDiff(node.Path, src, fixed)
+			if diff == "" {
+				continue
+			}
+			patches = append(patches, Patch{
+				ID:     fmt.Sprintf("%s/%s/%s", d.RuleID, name, d.NodeID),
+				NodeID: d.NodeID,
+				RuleID: d.RuleID,
+				Fix:    name,
+				Title:  fixer.title,
+				File:   node.Path,
+				Diff:   diff,
+			})
+		}
+	}
+	return patches, nil
+}
+
+// applyGoFix rewrites the function declared at line and returns the
+// formatted file, or src unchanged when the fix does not apply
+func applyGoFix(repoPath, path string, src []byte, line int, fixer goFixer, imp types.Importer) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		// Rewriting a file that does not parse could drop code
+		return src, nil
+	}
+	fn, ok := enclosingDecl(fset, f, line).(*ast.FuncDecl)
+	if !ok || fn.Body == nil {
+		return src, nil
+	}
+	var info *types.Info
+	if fixer.typed {
+		info = checkFixPackage(fset, repoPath, path, f, imp)
+	}
+	if !fixer.apply(fset, f, info, fn) {
+		return src, nil
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	// Reformat from source so inserted nodes and imports are laid out as gofmt would
+	return format.Source(buf.Bytes())
+}
+
+// fixImporter type-checks standard library imports from source and stubs
+// out the rest, whose types are then unknown
+type fixImporter struct {
+	std   types.Importer
+	fakes map[string]*types.Package
+}
+
+// Import implements types.Importer
+func (imp *fixImporter) Import(importPath string) (*types.Package, error) {
+	// Standard library paths have no dot in their first element
+	if first, _, _ := strings.Cut(importPath, "/"); !strings.Contains(first, ".") {
+		if pkg, err := imp.std.Import(importPath); err == nil {
+			return pkg, nil
+		}
+	}
+	if fake, ok := imp.fakes[importPath]; ok {
+		return fake, nil
+	}
+	fake := types.NewPackage(importPath, path.Base(importPath))
+	fake.MarkComplete()
+	imp.fakes[importPath] = fake
+	return fake, nil
+}
+
+// checkFixPackage type-checks the file being fixed together with the other
+// files of its package, ignoring type errors
+func checkFixPackage(fset *token.FileSet, repoPath, relPath string, f *ast.File, imp types.Importer) *types.Info {
+	files := []*ast.File{f}
+	dir := path.Dir(relPath)
+	entries, _ := os.ReadDir(filepath.Join(repoPath, filepath.FromSlash(dir)))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || name == path.Base(relPath) ||
+			strings.HasSuffix(name, "_test.go") != strings.HasSuffix(relPath, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(dir), name))
+		if err != nil {
+			continue
+		}
+		other, err := parser.ParseFile(fset, path.Join(dir, name), src, parser.SkipObjectResolution)
+		if err == nil && other.Name.Name == f.Name.Name {
+			files = append(files, other)
+		}
+	}
+
+	info := &types.Info{
+		Types:  make(map[ast.Expr]types.TypeAndValue),
+		Defs:   make(map[*ast.Ident]types.Object),
+		Uses:   make(map[*ast.Ident]types.Object),
+		Scopes: make(map[ast.Node]*types.Scope),
+	}
+	conf := types.Config{Importer: imp, Error: func(error) {}}
+	conf.Check(f.Name.Name, fset, files, info)
+	return info
+}
+
+// handleIgnoredErrors assigns errors discarded with _ and returns them. Only
+// values whose type is known to be error are handled, and only where an err
+// variable can be declared without clashing with another one.
+func handleIgnoredErrors(fset *token.FileSet, f *ast.File, info *types.Info, fn *ast.FuncDecl) bool {
+	if !returnsError(fn) {
+		return false
+	}
+	changed := false
+	for _, pos := range ignoredErrors(fn.Body) {
+		assign, ok := statementAt(fn.Body, pos).(*ast.AssignStmt)
+		if !ok || assign.Tok != token.DEFINE || !discardsError(info, assign) {
+			continue
+		}
+		ret, ok := errorReturn(f, fn, func() ast.Expr { return ast.NewIdent("err") })
+		if !ok {
+			return changed
+		}
+		blank := assign.Lhs[len(assign.Lhs)-1]
+		assign.Lhs[len(assign.Lhs)-1] = &ast.Ident{NamePos: blank.Pos(), Name: "err"}
+		check := &ast.IfStmt{
+			Cond: &ast.BinaryExpr{X: ast.NewIdent("err"), Op: token.NEQ, Y: ast.NewIdent("nil")},
+			Body: &ast.BlockStmt{List: []ast.Stmt{ret}},
+		}
+		changed = insertStmt(fset, fn.Body, assign, check, true) || changed
+	}
+	return changed
+}
+
+// nilCheckParams returns early when a pointer parameter whose fields or
+// methods are used is nil
+func nilCheckParams(fset *token.FileSet, f *ast.File, _ *types.Info, fn *ast.FuncDecl) bool {
+	used := make(map[string]bool)
+	checked := make(map[string]bool)
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if ident, ok := n.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		case *ast.BinaryExpr:
+			if n.Op == token.EQL || n.Op == token.NEQ {
+				if y, ok := n.Y.(*ast.Ident); ok && y.Name == "nil" {
+					checked[types.ExprString(n.X)] = true
+				}
+			}
+		}
+		return true
+	})
+
+	var guards []ast.Stmt
+	for _, field := range fn.Type.Params.List {
+		if _, ok := field.Type.(*ast.StarExpr); !ok {
+			continue
+		}
+		for _, name := range field.Names {
+			if !used[name.Name] || checked[name.Name] {
+				continue
+			}
+			msg := name.Name + " is nil"
+			ret, ok := errorReturn(f, fn, func() ast.Expr { return errorsNew(f, msg) })
+			if !ok {
+				return false
+			}
+			guards = append(guards, &ast.IfStmt{
+				Cond: &ast.BinaryExpr{X: ast.NewIdent(name.Name), Op: token.EQL, Y: ast.NewIdent("nil")},
+				Body: &ast.BlockStmt{List: []ast.Stmt{ret}},
+			})
+		}
+	}
+	if len(guards) == 0 {
+		return false
+	}
+	for i := range guards {
+		guards[i] = positioned(guards[i], fn.Body.Lbrace)
+	}
+	fn.Body.List = append(guards, fn.Body.List...)
+	return true
+}
+
+// boundsCheckIndexes returns early before indexing with an index that is
+// out of range
+func boundsCheckIndexes(fset *token.FileSet, f *ast.File, _ *types.Info, fn *ast.FuncDecl) bool {
+	changed := false
+	guarded := make(map[string]bool)
+	for _, pos := range uncheckedIndexes(fn.Body) {
+		var index *ast.IndexExpr
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if e, ok := n.(*ast.IndexExpr); ok && e.Pos() == pos {
+				index = e
+			}
+			return index == nil
+		})
+		// Only guard indexes whose operands can be evaluated twice
+		if index == nil || !pureExpr(index.X) || !pureExpr(index.Index) {
+			continue
+		}
+		x, i := types.ExprString(index.X), types.ExprString(index.Index)
+		if guarded[x+"["+i+"]"] {
+			continue
+		}
+		stmt := statementAt(fn.Body, pos)
+		if stmt == nil {
+			continue
+		}
+
+		ret, ok := errorReturn(f, fn, func() ast.Expr {
+			return fmtErrorf(f, "index %d out of range [0:%d]", index.Index, lenCall(index.X))
+		})
+		if !ok {
+			return changed
+		}
+		cond := &ast.BinaryExpr{
+			X:  &ast.BinaryExpr{X: index.Index, Op: token.LSS, Y: &ast.BasicLit{Kind: token.INT, Value: "0"}},
+			Op: token.LOR,
+			Y:  &ast.BinaryExpr{X: index.Index, Op: token.GEQ, Y: lenCall(index.X)},
+		}
+		check := &ast.IfStmt{Cond: cond, Body: &ast.BlockStmt{List: []ast.Stmt{ret}}}
+		if insertStmt(fset, fn.Body, stmt, check, false) {
+			guarded[x+"["+i+"]"] = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+// commaOkAssertions turns single-value type assertion assignments into the
+// comma-ok form and returns on a mismatch
+func commaOkAssertions(fset *token.FileSet, f *ast.File, _ *types.Info, fn *ast.FuncDecl) bool {
+	if !returnsError(fn) {
+		return false
+	}
+	changed := false
+	for _, pos := range uncheckedTypeAssertions(fn.Body) {
+		assign, ok := statementAt(fn.Body, pos).(*ast.AssignStmt)
+		if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			continue
+		}
+		assert, ok := assign.Rhs[0].(*ast.TypeAssertExpr)
+		if !ok || assert.Pos() != pos || !pureExpr(assert.X) {
+			continue
+		}
+		ret, ok := errorReturn(f, fn, func() ast.Expr { return fmtErrorf(f, "unexpected type %T", assert.X) })
+		if !ok {
+			return changed
+		}
+		assign.Lhs = append(assign.Lhs, &ast.Ident{NamePos: assign.Lhs[0].End(), Name: "ok"})
+		check := &ast.IfStmt{
+			Cond: &ast.UnaryExpr{Op: token.NOT, X: ast.NewIdent("ok")},
+			Body: &ast.BlockStmt{List: []ast.Stmt{ret}},
+		}
+		changed = insertStmt(fset, fn.Body, assign, check, true) || changed
+	}
+	return changed
+}
+
+// deferUnlocks adds a deferred unlock after locks that are never released
+func deferUnlocks(fset *token.FileSet, f *ast.File, _ *types.Info, fn *ast.FuncDecl) bool {
+	unlocked := make(map[string]bool)
+	for _, unlock := range []string{"Unlock", "RUnlock"} {
+		for _, sel := range lockCalls(fn.Body, unlock) {
+			unlocked[types.ExprString(sel.X)+"."+unlock] = true
+		}
+	}
+
+	changed := false
+	for lock, unlock := range map[string]string{"Lock": "Unlock", "RLock": "RUnlock"} {
+		for _, sel := range lockCalls(fn.Body, lock) {
+			if unlocked[types.ExprString(sel.X)+"."+unlock] {
+				continue
+			}
+			stmt, ok := statementAt(fn.Body, sel.Pos()).(*ast.ExprStmt)
+			if !ok {
+				continue
+			}
+			d := &ast.DeferStmt{Call: &ast.CallExpr{Fun: &ast.SelectorExpr{X: sel.X, Sel: ast.NewIdent(unlock)}}}
+			changed = insertStmt(fset, fn.Body, stmt, d, true) || changed
+		}
+	}
+	return changed
+}
+
+// discardsError reports whether the blank identifier at the end of assign
+// discards a value of type error, and whether err can be declared in its
+// place: an err already in the same scope must be an error declared before
+// the assignment, so it is reused
+func discardsError(info *types.Info, assign *ast.AssignStmt) bool {
+	if info == nil {
+		return false
+	}
+	results, ok := info.TypeOf(assign.Rhs[0]).(*types.Tuple)
+	if !ok || results.Len() != len(assign.Lhs) {
+		return false
+	}
+	errorType := types.Universe.Lookup("error").Type()
+	if !types.Identical(results.At(results.Len()-1).Type(), errorType) {
+		return false
+	}
+
+	// The innermost scope holding the assignment
+	var scope *types.Scope
+	for _, s := range info.Scopes {
+		if s.Contains(assign.Pos()) && (scope == nil || s.End()-s.Pos() < scope.End()-scope.Pos()) {
+			scope = s
+		}
+	}
+	if scope == nil {
+		return false
+	}
+	if obj := scope.Lookup("err"); obj != nil {
+		return obj.Pos() < assign.Pos() && types.Identical(obj.Type(), errorType)
+	}
+	return true
+}
+
+// returnsError reports whether the last result of fn is an error
+func returnsError(fn *ast.FuncDecl) bool {
+	results := fn.Type.Results
+	if results == nil || len(results.List) == 0 {
+		return false
+	}
+	ident, ok := results.List[len(results.List)-1].Type.(*ast.Ident)
+	return ok && ident.Name == "error"
+}
+
+// errorReturn builds a return statement with zero values, and the error
+// built by errExpr for a trailing error result. It fails when a zero value
+// cannot be derived from the syntax alone.
+func errorReturn(f *ast.File, fn *ast.FuncDecl, errExpr func() ast.Expr) (*ast.ReturnStmt, bool) {
+	ret := &ast.ReturnStmt{}
+	if fn.Type.Results == nil {
+		return ret, true
+	}
+	hasError := returnsError(fn)
+	for i, field := range fn.Type.Results.List {
+		n := max(1, len(field.Names))
+		for j := 0; j < n; j++ {
+			if hasError && i == len(fn.Type.Results.List)-1 && j == n-1 {
+				continue
+			}
+			zero, ok := zeroValue(f, field.Type)
+			if !ok {
+				return nil, false
+			}
+			ret.Results = append(ret.Results, zero)
+		}
+	}
+	// Built last, as it may add an import
+	if hasError {
+		ret.Results = append(ret.Results, errExpr())
+	}
+	return ret, true
+}
+
+// zeroValue returns the zero value expression of a type
+func zeroValue(f *ast.File, typ ast.Expr) (ast.Expr, bool) {
+	switch t := typ.(type) {
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return ast.NewIdent("nil"), true
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return ast.NewIdent("nil"), true
+		}
+		return &ast.CompositeLit{Type: t}, true
+	case *ast.StructType:
+		return &ast.CompositeLit{Type: t}, true
+	case *ast.Ident:
+		switch t.Name {
+		case "bool":
+			return ast.NewIdent("false"), true
+		case "string":
+			return &ast.BasicLit{Kind: token.STRING, Value: `""`}, true
+		case "error", "any":
+			return ast.NewIdent("nil"), true
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+			"float32", "float64", "complex64", "complex128", "byte", "rune":
+			return &ast.BasicLit{Kind: token.INT, Value: "0"}, true
+		}
+		// Types declared in the same file
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Name.Name != t.Name || ts.TypeParams != nil {
+					continue
+				}
+				if _, ok := ts.Type.(*ast.StructType); ok {
+					return &ast.CompositeLit{Type: ast.NewIdent(t.Name)}, true
+				}
+				if ts.Assign.IsValid() {
+					return zeroValue(f, ts.Type)
+				}
+				if zero, ok := zeroValue(f, ts.Type); ok {
+					if _, isLit := zero.(*ast.CompositeLit); !isLit {
+						return zero, true
+					}
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// statementAt returns the innermost statement of body, outside function
+// literals, that contains pos and sits in a statement list; that is where
+// new statements can be inserted
+func statementAt(body *ast.BlockStmt, pos token.Pos) ast.Stmt {
+	var found ast.Stmt
+	inClosure := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n == nil || inClosure || pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+		if _, ok := n.(*ast.FuncLit); ok {
+			// Function literals return their own results
+			inClosure = true
+			return false
+		}
+		if list, _ := stmtList(n); list != nil {
+			for _, stmt := range *list {
+				if stmt.Pos() <= pos && pos < stmt.End() {
+					found = stmt
+				}
+			}
+		}
+		return true
+	})
+	if inClosure {
+		return nil
+	}
+	return found
+}
+
+// stmtList returns the statement list of a block-like node and the
+// position that opens it
+func stmtList(n ast.Node) (*[]ast.Stmt, token.Pos) {
+	switch n := n.(type) {
+	case *ast.BlockStmt:
+		return &n.List, n.Lbrace
+	case *ast.CaseClause:
+		return &n.Body, n.Colon
+	case *ast.CommClause:
+		return &n.Body, n.Colon
+	}
+	return nil, token.NoPos
+}
+
+// insertStmt inserts stmt before or after target in the list that holds it.
+// The new statement is positioned at the end of the line of the statement
+// it follows, so comments around it stay attached to their statements.
+func insertStmt(fset *token.FileSet, root ast.Node, target, stmt ast.Stmt, after bool) bool {
+	inserted := false
+	ast.Inspect(root, func(n ast.Node) bool {
+		list, open := stmtList(n)
+		if inserted || list == nil {
+			return !inserted
+		}
+		for i, s := range *list {
+			if s != target {
+				continue
+			}
+			if after {
+				i++
+			}
+			anchor := open
+			if i > 0 {
+				anchor = lineEnd(fset, (*list)[i-1].End())
+			}
+			stmt = positioned(stmt, anchor)
+			*list = append((*list)[:i], append([]ast.Stmt{stmt}, (*list)[i:]...)...)
+			inserted = true
+			return false
+		}
+		return true
+	})
+	return inserted
+}
+
+// lineEnd returns the position of the newline ending the line of pos
+func lineEnd(fset *token.FileSet, pos token.Pos) token.Pos {
+	file := fset.File(pos)
+	line := file.Line(pos)
+	if line < file.LineCount() {
+		return file.LineStart(line+1) - 1
+	}
+	return token.Pos(file.Base() + file.Size())
+}
+
+// positioned returns a deep copy of a new node with every position set to
+// pos. Inserted nodes without positions make the printer move comments.
+func positioned[T ast.Node](n T, pos token.Pos) T {
+	return copyAt(reflect.ValueOf(n), pos).Interface().(T)
+}
+
+// markerPositions are positions whose validity marks an optional token
+var markerPositions = map[string]bool{
+	"CallExpr.Ellipsis": true,
+	"TypeSpec.Assign":   true,
+	"GenDecl.Lparen":    true,
+	"GenDecl.Rparen":    true,
+}
+
+// copyAt deep copies v, replacing all token.Pos values with pos
+func copyAt(v reflect.Value, pos token.Pos) reflect.Value {
+	if v.Type() == reflect.TypeOf(token.NoPos) {
+		return reflect.ValueOf(pos)
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		if _, ok := v.Interface().(*ast.Object); ok {
+			// Objects link back into the tree and carry no positions
+			return v
+		}
+		c := reflect.New(v.Elem().Type())
+		c.Elem().Set(copyAt(v.Elem(), pos))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyAt(v.Elem(), pos))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if !c.Field(i).CanSet() {
+				continue
+			}
+			if markerPositions[v.Type().Name()+"."+v.Type().Field(i).Name] && !v.Field(i).Interface().(token.Pos).IsValid() {
+				// The token is absent; a position would make the printer emit it
+				continue
+			}
+			c.Field(i).Set(copyAt(v.Field(i), pos))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyAt(v.Index(i), pos))
+		}
+		return c
+	}
+	return v
+}
+
+// pureExpr reports whether evaluating e has no side effects
+func pureExpr(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.Ident, *ast.BasicLit:
+		return true
+	case *ast.SelectorExpr:
+		return pureExpr(e.X)
+	case *ast.ParenExpr:
+		return pureExpr(e.X)
+	case *ast.StarExpr:
+		return pureExpr(e.X)
+	case *ast.BinaryExpr:
+		return pureExpr(e.X) && pureExpr(e.Y)
+	case *ast.UnaryExpr:
+		return e.Op != token.ARROW && pureExpr(e.X)
+	}
+	return false
+}
+
+// lenCall builds len(x)
+func lenCall(x ast.Expr) ast.Expr {
+	return &ast.CallExpr{Fun: ast.NewIdent("len"), Args: []ast.Expr{x}}
+}
+
+// errorsNew builds errors.New(msg), importing errors
+func errorsNew(f *ast.File, msg string) ast.Expr {
+	pkg := addImport(f, "errors")
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ast.NewIdent("New")},
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(msg)}},
+	}
+}
+
+// fmtErrorf builds fmt.Errorf(format, args...), importing fmt
+func fmtErrorf(f *ast.File, format string, args ...ast.Expr) ast.Expr {
+	pkg := addImport(f, "fmt")
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ast.NewIdent("Errorf")},
+		Args: append([]ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(format)}}, args...),
+	}
+}
+
+// addImport imports path unless the file already does, and returns the
+// name the package is referred to by
+func addImport(f *ast.File, path string) string {
+	for _, imp := range f.Imports {
+		if p, _ := strconv.Unquote(imp.Path.Value); p == path {
+			if imp.Name != nil {
+				return imp.Name.Name
+			}
+			return path[strings.LastIndex(path, "/")+1:]
+		}
+	}
+
+	name := path[strings.LastIndex(path, "/")+1:]
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		last := gen.Specs[len(gen.Specs)-1]
+		if !gen.Lparen.IsValid() {
+			// A single unparenthesized import becomes a list
+			gen.Lparen, gen.Rparen = last.Pos(), last.End()
+		}
+		spec := &ast.ImportSpec{Path: &ast.BasicLit{ValuePos: last.End(), Kind: token.STRING, Value: strconv.Quote(path)}}
+		gen.Specs = append(gen.Specs, spec)
+		f.Imports = append(f.Imports, spec)
+		return name
+	}
+
+	spec := &ast.ImportSpec{Path: &ast.BasicLit{ValuePos: f.Name.End(), Kind: token.STRING, Value: strconv.Quote(path)}}
+	f.Decls = append([]ast.Decl{&ast.GenDecl{TokPos: f.Name.End(), Tok: token.IMPORT, Specs: []ast.Spec{spec}}}, f.Decls...)
+	f.Imports = append(f.Imports, spec)
+	return name
+}
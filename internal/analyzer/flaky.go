@@ -0,0 +1,251 @@
+package analyzer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TestHistoryFile stores the per-test results of earlier test runs,
+// relative to the repository root
+const TestHistoryFile = ".codeanalyzer/tests.json"
+
+// maxTestHistory is the number of test runs kept in the history
+const maxTestHistory = 100
+
+// defaultFlakyWeight is the seed weight of errors in known-flaky tests
+const defaultFlakyWeight = 0.2
+
+// TestResult is the outcome of one test in one run
+type TestResult struct {
+	Package string  `json:"package"`
+	Test    string  `json:"test"`
+	Action  string  `json:"action"` // pass, fail or skip
+	Elapsed float64 `json:"elapsed"`
+}
+
+// TestRun is the set of test results of one go test invocation
+type TestRun struct {
+	CreatedAt time.Time    `json:"createdAt"`
+	Source    string       `json:"source,omitempty"` // "run" or "upload"
+	Results   []TestResult `json:"results"`
+}
+
+// TestStats summarizes the outcomes and timings of a test over runs
+type TestStats struct {
+	Package       string   `json:"package"`
+	Test          string   `json:"test"`
+	NodeID        string   `json:"nodeId,omitempty"` // test function in the code graph
+	Covers        []string `json:"covers,omitempty"` // functions the test calls directly
+	Runs          int      `json:"runs"`
+	Passed        int      `json:"passed"`
+	Failed        int      `json:"failed"`
+	Skipped       int      `json:"skipped"`
+	PassRate      float64  `json:"passRate"` // passes over runs that were not skipped
+	MeanSeconds   float64  `json:"meanSeconds"`
+	StdDevSeconds float64  `json:"stdDevSeconds"`
+	TimingCV      float64  `json:"timingCv"` // standard deviation over mean duration
+	Flaky         bool     `json:"flaky"`
+}
+
+// FlakyReport is the flakiness of the tests seen over a number of runs
+type FlakyReport struct {
+	Runs  int         `json:"runs"`
+	Tests []TestStats `json:"tests"` // flaky tests first, then by package and name
+	Flaky int         `json:"flaky"`
+}
+
+// ParseGoTestJSON reads the test results of go test -json output. Lines
+// that are not test events, such as build errors, are ignored, and so are
+// package-level events.
+func ParseGoTestJSON(output string) []TestResult {
+	var results []TestResult
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var event struct {
+			Action  string
+			Package string
+			Test    string
+			Elapsed float64
+		}
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &event) != nil || event.Test == "" {
+			continue
+		}
+		switch event.Action {
+		case "pass", "fail", "skip":
+			results = append(results, TestResult{
+				Package: event.Package,
+				Test:    event.Test,
+				Action:  event.Action,
+				Elapsed: event.Elapsed,
+			})
+		}
+	}
+	return results
+}
+
+// DetectFlakyTests computes the pass rate and timing spread of each test
+// over runs. A test that both passed and failed is flaky. Tests are
+// attached to their function in the code graph, and through its calls
+// edges to the code they exercise; subtests map to their parent test.
+func (s *Service) DetectFlakyTests(runs []TestRun, graph []GraphNode) *FlakyReport {
+	report := &FlakyReport{Runs: len(runs), Tests: []TestStats{}}
+	stats := make(map[string]*TestStats)
+	durations := make(map[string][]float64)
+	for _, run := range runs {
+		for _, r := range run.Results {
+			key := r.Package + "\x00" + r.Test
+			st, ok := stats[key]
+			if !ok {
+				st = &TestStats{Package: r.Package, Test: r.Test}
+				stats[key] = st
+			}
+			st.Runs++
+			switch r.Action {
+			case "pass":
+				st.Passed++
+			case "fail":
+				st.Failed++
+			case "skip":
+				st.Skipped++
+				continue
+			}
+			durations[key] = append(durations[key], r.Elapsed)
+		}
+	}
+
+	nodes := make(map[string]GraphNode, len(graph))
+	for _, node := range graph {
+		nodes[node.ID] = node
+	}
+	for key, st := range stats {
+		if ran := st.Passed + st.Failed; ran > 0 {
+			st.PassRate = float64(st.Passed) / float64(ran)
+		}
+		st.MeanSeconds, st.StdDevSeconds = meanStdDev(durations[key])
+		if st.MeanSeconds > 0 {
+			st.TimingCV = st.StdDevSeconds / st.MeanSeconds
+		}
+		st.Flaky = st.Passed > 0 && st.Failed > 0
+
+		root, _, _ := strings.Cut(st.Test, "/")
+		for _, id := range []string{"func:" + st.Package + "." + root, "func:" + st.Package + "_test." + root} {
+			node, ok := nodes[id]
+			if !ok {
+				continue
+			}
+			st.NodeID = id
+			for _, e := range node.Edges {
+				if e.Type == EdgeCalls && !containsString(st.Covers, e.Target) {
+					st.Covers = append(st.Covers, e.Target)
+				}
+			}
+			sort.Strings(st.Covers)
+			break
+		}
+
+		if st.Flaky {
+			report.Flaky++
+		}
+		report.Tests = append(report.Tests, *st)
+	}
+
+	sort.Slice(report.Tests, func(i, j int) bool {
+		a, b := report.Tests[i], report.Tests[j]
+		if a.Flaky != b.Flaky {
+			return a.Flaky
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Test < b.Test
+	})
+	return report
+}
+
+// meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// FlakyNodes returns the test functions of the flaky tests, for
+// LocalizeOptions.FlakyTests
+func (r *FlakyReport) FlakyNodes() map[string]bool {
+	nodes := make(map[string]bool)
+	for _, t := range r.Tests {
+		if t.Flaky && t.NodeID != "" {
+			nodes[t.NodeID] = true
+		}
+	}
+	return nodes
+}
+
+// LoadTestHistory reads the recorded test runs, oldest first
+func (s *Service) LoadTestHistory(repoPath string) ([]TestRun, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, TestHistoryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return []TestRun{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test history: %w", err)
+	}
+
+	var history []TestRun
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse test history: %w", err)
+	}
+	return history, nil
+}
+
+// RecordTestRuns adds test runs to the history, keeping the most recent
+// ones
+func (s *Service) RecordTestRuns(repoPath string, runs []TestRun) ([]TestRun, error) {
+	history, err := s.LoadTestHistory(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if run.CreatedAt.IsZero() {
+			run.CreatedAt = time.Now()
+		}
+		history = append(history, run)
+	}
+	sort.SliceStable(history, func(i, j int) bool { return history[i].CreatedAt.Before(history[j].CreatedAt) })
+	if len(history) > maxTestHistory {
+		history = history[len(history)-maxTestHistory:]
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode test history: %w", err)
+	}
+	path := filepath.Join(repoPath, TestHistoryFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create test history directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write test history: %w", err)
+	}
+	return history, nil
+}
@@ -0,0 +1,694 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goPackage is a parsed and type-checked Go package
+type goPackage struct {
+	ImportPath string
+	Dir        string // repository-relative directory
+	Name       string
+	Files      []*goFile
+	Types      *types.Package
+	Info       *types.Info
+}
+
+// goFile is a parsed Go source file
+type goFile struct {
+	Path  string // repository-relative path
+	AST   *ast.File
+	Lines int
+}
+
+// goProgram is the set of Go packages in a repository
+type goProgram struct {
+	Fset       *token.FileSet
+	ModulePath string
+	Packages   []*goPackage          // sorted by import path
+	byPath     map[string]*goPackage // import path -> package
+}
+
+// loadGoProgram parses and type-checks the Go files of a repository.
+// Imports of packages outside the repository resolve to empty packages, so
+// type information is complete for repository code and best-effort elsewhere.
+func loadGoProgram(files []SourceFile) *goProgram {
+	prog, _, _ := loadGoProgramContext(context.Background(), files, PipelineOptions{})
+	return prog
+}
+
+// loadGoProgramContext parses Go files concurrently, then type-checks the
+// packages. Files that cannot be read or parsed are reported as file errors.
+func loadGoProgramContext(ctx context.Context, files []SourceFile, opts PipelineOptions) (*goProgram, []FileError, error) {
+	prog := &goProgram{
+		Fset:   token.NewFileSet(),
+		byPath: make(map[string]*goPackage),
+	}
+	prog.ModulePath = findModulePath(files)
+
+	var goFiles []SourceFile
+	for _, file := range files {
+		if file.Language == "Go" {
+			goFiles = append(goFiles, file)
+		}
+	}
+	parsed, fileErrs, err := processFiles(ctx, goFiles, opts, true, func(file SourceFile, src []byte) (*ast.File, error) {
+		f, err := parser.ParseFile(prog.Fset, filepath.ToSlash(file.Path), src, parser.ParseComments)
+		if err != nil && f == nil {
+			return nil, err
+		}
+		if !f.Package.IsValid() {
+			// Empty files and files without a package clause belong to no package
+			return nil, errors.New("missing package clause")
+		}
+		return f, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Group files into packages by directory and package clause
+	for i, f := range parsed {
+		if f == nil {
+			continue
+		}
+		file := goFiles[i]
+
+		dir := path.Dir(filepath.ToSlash(file.Path))
+		importPath := prog.importPathFor(dir)
+		if strings.HasSuffix(f.Name.Name, "_test") {
+			importPath += "_test"
+		}
+
+		pkg := prog.byPath[importPath]
+		if pkg == nil {
+			pkg = &goPackage{ImportPath: importPath, Dir: dir, Name: f.Name.Name}
+			prog.byPath[importPath] = pkg
+			prog.Packages = append(prog.Packages, pkg)
+		}
+		pkg.Files = append(pkg.Files, &goFile{
+			Path:  filepath.ToSlash(file.Path),
+			AST:   f,
+			Lines: prog.Fset.File(f.Pos()).LineCount(),
+		})
+	}
+
+	sort.Slice(prog.Packages, func(i, j int) bool {
+		return prog.Packages[i].ImportPath < prog.Packages[j].ImportPath
+	})
+	for _, pkg := range prog.Packages {
+		sort.Slice(pkg.Files, func(i, j int) bool { return pkg.Files[i].Path < pkg.Files[j].Path })
+	}
+
+	imp := &localImporter{prog: prog, checking: make(map[string]bool), fakes: make(map[string]*types.Package)}
+	for _, pkg := range prog.Packages {
+		imp.check(pkg)
+	}
+
+	return prog, fileErrs, nil
+}
+
+// importPathFor returns the import path of the package in a repository directory
+func (p *goProgram) importPathFor(dir string) string {
+	switch {
+	case p.ModulePath == "":
+		return dir
+	case dir == ".":
+		return p.ModulePath
+	default:
+		return p.ModulePath + "/" + dir
+	}
+}
+
+// isLocal reports whether an import path belongs to the repository
+func (p *goProgram) isLocal(importPath string) bool {
+	_, ok := p.byPath[importPath]
+	return ok
+}
+
+// localImporter type-checks repository packages on demand and stubs out the rest
+type localImporter struct {
+	prog     *goProgram
+	checking map[string]bool
+	fakes    map[string]*types.Package
+}
+
+// Import implements types.Importer
+func (imp *localImporter) Import(importPath string) (*types.Package, error) {
+	if pkg, ok := imp.prog.byPath[importPath]; ok && !imp.checking[importPath] {
+		if t := imp.check(pkg); t != nil {
+			return t, nil
+		}
+	}
+
+	if fake, ok := imp.fakes[importPath]; ok {
+		return fake, nil
+	}
+	fake := types.NewPackage(importPath, path.Base(importPath))
+	fake.MarkComplete()
+	imp.fakes[importPath] = fake
+	return fake, nil
+}
+
+// check type-checks pkg once, ignoring type errors
+func (imp *localImporter) check(pkg *goPackage) *types.Package {
+	if pkg.Types != nil {
+		return pkg.Types
+	}
+	imp.checking[pkg.ImportPath] = true
+	defer delete(imp.checking, pkg.ImportPath)
+
+	asts := make([]*ast.File, len(pkg.Files))
+	for i, f := range pkg.Files {
+		asts[i] = f.AST
+	}
+
+	pkg.Info = &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf := types.Config{
+		Importer:         imp,
+		Error:            func(error) {},
+		IgnoreFuncBodies: false,
+	}
+	pkg.Types, _ = conf.Check(pkg.ImportPath, imp.prog.Fset, asts, pkg.Info)
+	return pkg.Types
+}
+
+// findModulePath reads the module path from the go.mod at the repository root
+func findModulePath(files []SourceFile) string {
+	for _, file := range files {
+		if file.AbsPath == "" {
+			continue
+		}
+		return readModulePath(strings.TrimSuffix(filepath.ToSlash(file.AbsPath), filepath.ToSlash(file.Path)))
+	}
+	return ""
+}
+
+// readModulePath reads the module path from the go.mod in root
+func readModulePath(root string) string {
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// Node and edge types of the code knowledge graph
+const (
+	NodePackage   = "package"
+	NodeFile      = "file"
+	NodeStruct    = "struct"
+	NodeInterface = "interface"
+	NodeType      = "type"
+	NodeFunction  = "function"
+	NodeMethod    = "method"
+	NodeClass     = "class"
+
+	EdgeContains    = "contains"
+	EdgeImports     = "imports"
+	EdgeCalls       = "calls"
+	EdgeImplements  = "implements"
+	EdgeEmbeds      = "embeds"
+	EdgeReferences  = "references"
+	EdgeDuplicateOf = "duplicate_of"
+)
+
+// goGraphBuilder builds code graph nodes and edges for a Go program
+type goGraphBuilder struct {
+	prog  *goProgram
+	nodes []GraphNode
+	index map[string]int          // node ID -> position in nodes
+	objs  map[types.Object]string // declared object -> node ID
+	edges map[string]bool         // deduplicates "source|type|target"
+
+	ifaces     []repoInterface // computed once all declarations are added
+	ifacesDone bool
+}
+
+// buildGoGraph returns the graph nodes of every package, file, type,
+// function and method in the program, linked by typed edges
+func buildGoGraph(prog *goProgram) []GraphNode {
+	b := &goGraphBuilder{
+		prog:  prog,
+		index: make(map[string]int),
+		objs:  make(map[types.Object]string),
+		edges: make(map[string]bool),
+	}
+
+	for _, pkg := range prog.Packages {
+		b.addDeclarations(pkg)
+	}
+	for _, pkg := range prog.Packages {
+		b.addImports(pkg)
+		b.addTypeRelations(pkg)
+		b.addBodyEdges(pkg)
+	}
+
+	return b.nodes
+}
+
+// addNode adds a node if its ID is not yet in the graph
+func (b *goGraphBuilder) addNode(node GraphNode) {
+	if _, ok := b.index[node.ID]; ok {
+		return
+	}
+	b.index[node.ID] = len(b.nodes)
+	b.nodes = append(b.nodes, node)
+}
+
+// addEdge adds a typed edge between two existing nodes
+func (b *goGraphBuilder) addEdge(source, edgeType, target string) {
+	if source == "" || target == "" || source == target {
+		return
+	}
+	key := source + "|" + edgeType + "|" + target
+	if b.edges[key] {
+		return
+	}
+	i, ok := b.index[source]
+	if !ok {
+		return
+	}
+	if _, ok := b.index[target]; !ok {
+		return
+	}
+	b.edges[key] = true
+	b.nodes[i].Edges = append(b.nodes[i].Edges, GraphEdge{Target: target, Type: edgeType})
+
+	// Contained nodes list their containers as relations
+	if edgeType == EdgeContains {
+		j := b.index[target]
+		b.nodes[j].Relations = append(b.nodes[j].Relations, source)
+	}
+}
+
+// addDeclarations adds nodes for a package, its files and top-level declarations
+func (b *goGraphBuilder) addDeclarations(pkg *goPackage) {
+	pkgID := packageNodeID(pkg.ImportPath)
+	b.addNode(GraphNode{
+		ID:      pkgID,
+		Type:    NodePackage,
+		Name:    pkg.Name,
+		Path:    pkg.Dir,
+		Package: pkg.ImportPath,
+	})
+
+	for _, file := range pkg.Files {
+		fileID := fileNodeID(file.Path)
+		b.addNode(GraphNode{
+			ID:        fileID,
+			Type:      NodeFile,
+			Name:      path.Base(file.Path),
+			Path:      file.Path,
+			Package:   pkg.ImportPath,
+			StartLine: 1,
+			EndLine:   file.Lines,
+		})
+		b.addEdge(pkgID, EdgeContains, fileID)
+
+		for _, decl := range file.AST.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				b.addFunc(pkg, file, fileID, d)
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						b.addTypeSpec(pkg, file, fileID, d, ts)
+					}
+				}
+			}
+		}
+	}
+}
+
+// addFunc adds a function or method node
+func (b *goGraphBuilder) addFunc(pkg *goPackage, file *goFile, fileID string, d *ast.FuncDecl) {
+	node := GraphNode{
+		Name:      d.Name.Name,
+		Path:      file.Path,
+		Package:   pkg.ImportPath,
+		StartLine: b.prog.Fset.Position(d.Pos()).Line,
+		EndLine:   b.prog.Fset.Position(d.End()).Line,
+	}
+
+	recv := receiverTypeName(d)
+	if recv == "" {
+		node.ID = funcNodeID(pkg.ImportPath, d.Name.Name)
+		node.Type = NodeFunction
+	} else {
+		node.ID = methodNodeID(pkg.ImportPath, recv, d.Name.Name)
+		node.Type = NodeMethod
+		node.Receiver = recv
+	}
+
+	// init and blank functions may be declared several times
+	if _, exists := b.index[node.ID]; exists {
+		node.ID += "@" + file.Path + ":" + strconv.Itoa(node.StartLine)
+	}
+	b.addNode(node)
+	b.addEdge(fileID, EdgeContains, node.ID)
+
+	if obj := pkg.Info.Defs[d.Name]; obj != nil {
+		b.objs[obj] = node.ID
+	}
+}
+
+// addTypeSpec adds a struct, interface or other named type node
+func (b *goGraphBuilder) addTypeSpec(pkg *goPackage, file *goFile, fileID string, d *ast.GenDecl, ts *ast.TypeSpec) {
+	nodeType := NodeType
+	switch ts.Type.(type) {
+	case *ast.StructType:
+		nodeType = NodeStruct
+	case *ast.InterfaceType:
+		nodeType = NodeInterface
+	}
+
+	// Single-spec declarations include the type keyword in their range
+	var start, end token.Pos = ts.Pos(), ts.End()
+	if len(d.Specs) == 1 {
+		start, end = d.Pos(), d.End()
+	}
+
+	node := GraphNode{
+		ID:        typeNodeID(pkg.ImportPath, ts.Name.Name),
+		Type:      nodeType,
+		Name:      ts.Name.Name,
+		Path:      file.Path,
+		Package:   pkg.ImportPath,
+		StartLine: b.prog.Fset.Position(start).Line,
+		EndLine:   b.prog.Fset.Position(end).Line,
+	}
+	b.addNode(node)
+	b.addEdge(fileID, EdgeContains, node.ID)
+
+	if obj := pkg.Info.Defs[ts.Name]; obj != nil {
+		b.objs[obj] = node.ID
+	}
+}
+
+// addImports adds file and package import edges
+func (b *goGraphBuilder) addImports(pkg *goPackage) {
+	pkgID := packageNodeID(pkg.ImportPath)
+	for _, file := range pkg.Files {
+		for _, spec := range file.AST.Imports {
+			importPath := strings.Trim(spec.Path.Value, `"`)
+			targetID := packageNodeID(importPath)
+			if !b.prog.isLocal(importPath) {
+				// External packages are leaves of the graph
+				b.addNode(GraphNode{
+					ID:         targetID,
+					Type:       NodePackage,
+					Name:       path.Base(importPath),
+					Package:    importPath,
+					Properties: map[string]interface{}{"external": true},
+				})
+			}
+			b.addEdge(fileNodeID(file.Path), EdgeImports, targetID)
+			b.addEdge(pkgID, EdgeImports, targetID)
+		}
+	}
+}
+
+// addTypeRelations adds method containment, embeds and implements edges
+func (b *goGraphBuilder) addTypeRelations(pkg *goPackage) {
+	if pkg.Types == nil {
+		return
+	}
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		typeID := b.objs[tn]
+		named, ok := tn.Type().(*types.Named)
+		if typeID == "" || !ok {
+			continue
+		}
+
+		// Methods belong to their receiver type
+		for i := 0; i < named.NumMethods(); i++ {
+			b.addEdge(typeID, EdgeContains, b.objs[named.Method(i)])
+		}
+
+		switch u := named.Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < u.NumFields(); i++ {
+				if field := u.Field(i); field.Embedded() {
+					b.addEdge(typeID, EdgeEmbeds, b.namedTypeID(field.Type()))
+				}
+			}
+		case *types.Interface:
+			for i := 0; i < u.NumEmbeddeds(); i++ {
+				b.addEdge(typeID, EdgeEmbeds, b.namedTypeID(u.EmbeddedType(i)))
+			}
+		}
+	}
+
+	// A type implements every non-empty repository interface in its method set
+	ifaces := b.interfaces()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || types.IsInterface(tn.Type()) || b.objs[tn] == "" {
+			continue
+		}
+		for _, iface := range ifaces {
+			if types.Implements(tn.Type(), iface.Type) || types.Implements(types.NewPointer(tn.Type()), iface.Type) {
+				b.addEdge(b.objs[tn], EdgeImplements, iface.ID)
+			}
+		}
+	}
+}
+
+// repoInterface is a non-empty interface declared in the repository
+type repoInterface struct {
+	ID   string
+	Type *types.Interface
+}
+
+// interfaces lists the non-empty interfaces declared in the program
+func (b *goGraphBuilder) interfaces() []repoInterface {
+	if b.ifacesDone {
+		return b.ifaces
+	}
+	b.ifacesDone = true
+
+	var ifaces []repoInterface
+	for _, pkg := range b.prog.Packages {
+		if pkg.Types == nil {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || b.objs[tn] == "" {
+				continue
+			}
+			if iface, ok := tn.Type().Underlying().(*types.Interface); ok && iface.NumMethods() > 0 {
+				ifaces = append(ifaces, repoInterface{ID: b.objs[tn], Type: iface})
+			}
+		}
+	}
+	b.ifaces = ifaces
+	return ifaces
+}
+
+// namedTypeID returns the node of the repository type t refers to, if any
+func (b *goGraphBuilder) namedTypeID(t types.Type) string {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return b.objs[named.Obj()]
+	}
+	return ""
+}
+
+// addBodyEdges adds calls and references edges from declarations to the
+// repository objects they use
+func (b *goGraphBuilder) addBodyEdges(pkg *goPackage) {
+	for _, file := range pkg.Files {
+		for _, decl := range file.AST.Decls {
+			var (
+				sourceID string
+				root     ast.Node
+			)
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				sourceID = b.objs[pkg.Info.Defs[d.Name]]
+				root = d
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						b.addReferences(pkg, b.objs[pkg.Info.Defs[ts.Name]], ts.Type)
+					}
+				}
+				continue
+			}
+			if sourceID == "" {
+				continue
+			}
+
+			// Called identifiers are recorded so they are not also references
+			called := make(map[*ast.Ident]bool)
+			ast.Inspect(root, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				ident := calleeIdent(call.Fun)
+				if ident == nil {
+					return true
+				}
+				fn, ok := pkg.Info.Uses[ident].(*types.Func)
+				if !ok {
+					return true
+				}
+				called[ident] = true
+				for _, target := range b.callTargets(fn) {
+					b.addEdge(sourceID, EdgeCalls, target)
+				}
+				return true
+			})
+
+			ast.Inspect(root, func(n ast.Node) bool {
+				ident, ok := n.(*ast.Ident)
+				if !ok || called[ident] {
+					return true
+				}
+				if target := b.objs[pkg.Info.Uses[ident]]; target != "" {
+					b.addEdge(sourceID, EdgeReferences, target)
+				}
+				return true
+			})
+		}
+	}
+}
+
+// addReferences adds references edges from a type declaration to the
+// repository types used in its definition
+func (b *goGraphBuilder) addReferences(pkg *goPackage, sourceID string, expr ast.Expr) {
+	if sourceID == "" {
+		return
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			if target := b.objs[pkg.Info.Uses[ident]]; target != "" {
+				b.addEdge(sourceID, EdgeReferences, target)
+			}
+		}
+		return true
+	})
+}
+
+// callTargets resolves a called function to graph nodes. Calls through an
+// interface method dispatch to the method of every implementing type.
+func (b *goGraphBuilder) callTargets(fn *types.Func) []string {
+	if id := b.objs[fn.Origin()]; id != "" {
+		return []string{id}
+	}
+
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok || sig.Recv() == nil || !types.IsInterface(sig.Recv().Type()) {
+		return nil
+	}
+	iface, ok := sig.Recv().Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil
+	}
+
+	var targets []string
+	for obj, id := range b.objs {
+		tn, ok := obj.(*types.TypeName)
+		if !ok || types.IsInterface(tn.Type()) || !strings.HasPrefix(id, "type:") {
+			continue
+		}
+		var recv types.Type = tn.Type()
+		if !types.Implements(recv, iface) {
+			recv = types.NewPointer(recv)
+			if !types.Implements(recv, iface) {
+				continue
+			}
+		}
+		m, _, _ := types.LookupFieldOrMethod(recv, true, fn.Pkg(), fn.Name())
+		if method, ok := m.(*types.Func); ok {
+			if target := b.objs[method]; target != "" {
+				targets = append(targets, target)
+			}
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// calleeIdent returns the identifier naming the function called by expr
+func calleeIdent(expr ast.Expr) *ast.Ident {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.IndexExpr:
+		return calleeIdent(e.X)
+	case *ast.IndexListExpr:
+		return calleeIdent(e.X)
+	case *ast.ParenExpr:
+		return calleeIdent(e.X)
+	}
+	return nil
+}
+
+// receiverTypeName returns the receiver type name of a method declaration
+func receiverTypeName(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return ""
+	}
+	expr := d.Recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// Node IDs are derived from declarations so they are stable across runs
+func packageNodeID(importPath string) string { return "pkg:" + importPath }
+func fileNodeID(path string) string          { return "file:" + path }
+func typeNodeID(pkg, name string) string     { return "type:" + pkg + "." + name }
+func funcNodeID(pkg, name string) string     { return "func:" + pkg + "." + name }
+func methodNodeID(pkg, recv, name string) string {
+	return "method:" + pkg + "." + recv + "." + name
+}
@@ -0,0 +1,812 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LicensePolicyFile holds the allowed and denied licenses of a repository,
+// relative to the repository root
+const LicensePolicyFile = ".codeanalyzer/licenses.yaml"
+
+// Rule IDs of license policy findings
+const (
+	RuleLicenseDenied     = "license-denied"
+	RuleLicenseNotAllowed = "license-not-allowed"
+	RuleLicenseUnknown    = "license-unknown"
+)
+
+// defaultLicenseConfidence is the similarity a text must have with a
+// template to be identified as that license
+const defaultLicenseConfidence = 0.8
+
+// licenseShingle is the number of words compared at once
+const licenseShingle = 3
+
+// Embedded license texts, named after their SPDX identifier. The texts are
+// complete, as a text is compared with the whole template.
+//
+//go:embed licenses/*.txt
+var licenseTemplateFS embed.FS
+
+var (
+	licenseFileName    = regexp.MustCompile(`(?i)^(licen[cs]e|copying|unlicense)(-[a-z0-9.-]+)?(\.(txt|md|rst))?$`)
+	spdxHeader         = regexp.MustCompile(`SPDX-License-Identifier:\s*(.+?)\s*(\*/|-->)?\s*$`)
+	spdxTemplateVar    = regexp.MustCompile(`<<var;[^>]*?original="([^"]*)"[^>]*>>`)
+	spdxTemplateMarker = regexp.MustCompile(`<<[^>]*>>`)
+	commentPrefix      = regexp.MustCompile(`^\s*(//|/\*|\*|#|<!--|--|;|%)`)
+	spdxRefUnsafe      = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+	spdxExpression     = regexp.MustCompile(`^[A-Za-z0-9.+() -]+$`)
+)
+
+// LicenseOptions configures license detection
+type LicenseOptions struct {
+	ModCache      string  // Go module cache, GOMODCACHE or GOPATH/pkg/mod when empty
+	Templates     string  // directory of extra SPDX templates, <id>.template.txt or <id>.txt
+	MinConfidence float64 // text similarity needed to identify a license, 0.8 when zero
+}
+
+// LicenseMatch is a license identified in a file
+type LicenseMatch struct {
+	License    string  `json:"license,omitempty"` // SPDX identifier or expression, empty when unknown
+	File       string  `json:"file"`
+	Line       int     `json:"line,omitempty"`
+	Confidence float64 `json:"confidence"`
+	Source     string  `json:"source"` // "text", "header" or "manifest"
+}
+
+// DependencyLicense is the license of a dependency found in its vendored
+// or cached copy
+type DependencyLicense struct {
+	Dependency Dependency     `json:"dependency"`
+	License    string         `json:"license,omitempty"`  // SPDX expression, empty when unknown
+	Location   string         `json:"location,omitempty"` // directory the dependency was read from
+	Matches    []LicenseMatch `json:"matches,omitempty"`
+}
+
+// LicenseReport lists the licenses of a repository and its dependencies
+type LicenseReport struct {
+	Repository   []LicenseMatch      `json:"repository"` // license files of the repository
+	Headers      []LicenseMatch      `json:"headers"`    // SPDX-License-Identifier headers of source files
+	Dependencies []DependencyLicense `json:"dependencies"`
+	Errors       []FileError         `json:"errors,omitempty"` // manifests that could not be parsed
+}
+
+// LicensePolicy defines the licenses a repository may ship
+type LicensePolicy struct {
+	Allow   []string `json:"allow,omitempty" yaml:"allow"`     // licenses allowed, any license not denied when empty
+	Deny    []string `json:"deny,omitempty" yaml:"deny"`       // licenses never allowed
+	Unknown string   `json:"unknown,omitempty" yaml:"unknown"` // level of unidentified licenses: error, warning (default) or ignore
+	Ignore  []string `json:"ignore,omitempty" yaml:"ignore"`   // dependencies exempted from the policy
+}
+
+// licenseTemplate is a license text reduced to its word shingles
+type licenseTemplate struct {
+	id       string
+	shingles map[string]bool
+}
+
+// loadLicenseTemplates returns the embedded templates, overridden or
+// extended by the templates of a directory
+func loadLicenseTemplates(dir string) ([]licenseTemplate, error) {
+	texts := make(map[string]string)
+	entries, err := fs.ReadDir(licenseTemplateFS, "licenses")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license templates: %w", err)
+	}
+	for _, e := range entries {
+		data, err := fs.ReadFile(licenseTemplateFS, "licenses/"+e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read license template %s: %w", e.Name(), err)
+		}
+		texts[strings.TrimSuffix(e.Name(), ".txt")] = string(data)
+	}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read license templates: %w", err)
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".txt") {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read license template %s: %w", e.Name(), err)
+			}
+			id := strings.TrimSuffix(strings.TrimSuffix(e.Name(), ".txt"), ".template")
+			texts[id] = expandSPDXTemplate(string(data))
+		}
+	}
+
+	var templates []licenseTemplate
+	for _, id := range sortedKeys(texts) {
+		words := licenseWords(texts[id])
+		if len(words) == 0 {
+			continue
+		}
+		templates = append(templates, licenseTemplate{id: id, shingles: licenseShingles(words)})
+	}
+	return templates, nil
+}
+
+// expandSPDXTemplate replaces the variables of an SPDX template with their
+// original text and drops the optional markers
+func expandSPDXTemplate(text string) string {
+	text = spdxTemplateVar.ReplaceAllString(text, "$1")
+	return spdxTemplateMarker.ReplaceAllString(text, "")
+}
+
+// licenseWords normalizes a license text to lower-case words, ignoring
+// copyright notices, punctuation and spelling variants
+func licenseWords(text string) []string {
+	var words []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.ToLower(strings.TrimLeft(line, " \t*#/-"))
+		if strings.HasPrefix(trimmed, "copyright") || strings.HasPrefix(trimmed, "(c)") || strings.HasPrefix(trimmed, "©") {
+			continue
+		}
+		trimmed = strings.ReplaceAll(trimmed, "&", " and ")
+		for _, w := range strings.FieldsFunc(trimmed, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if w == "licence" {
+				w = "license"
+			}
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// licenseShingles returns the runs of consecutive words of a text
+func licenseShingles(words []string) map[string]bool {
+	shingles := make(map[string]bool)
+	if len(words) < licenseShingle {
+		shingles[strings.Join(words, " ")] = true
+		return shingles
+	}
+	for i := 0; i+licenseShingle <= len(words); i++ {
+		shingles[strings.Join(words[i:i+licenseShingle], " ")] = true
+	}
+	return shingles
+}
+
+// identifyLicense returns the template most similar to a text and their
+// Dice coefficient over word shingles. The measure is symmetric, so a
+// template with terms added to it no longer scores as that license. Ties
+// go to the longer template, so that a BSD-3-Clause text is not taken for
+// BSD-2-Clause.
+func identifyLicense(text string, templates []licenseTemplate) (string, float64) {
+	shingles := licenseShingles(licenseWords(text))
+	var (
+		best       string
+		bestScore  float64
+		bestShared int
+	)
+	for _, t := range templates {
+		shared := 0
+		for s := range t.shingles {
+			if shingles[s] {
+				shared++
+			}
+		}
+		score := 2 * float64(shared) / float64(len(shingles)+len(t.shingles))
+		if score > bestScore || (score == bestScore && shared > bestShared) {
+			best, bestScore, bestShared = t.id, score, shared
+		}
+	}
+	return best, math.Round(bestScore*100) / 100
+}
+
+// DetectLicenses identifies the license files of a repository, the SPDX
+// headers of its source files and the licenses of its dependencies. Go
+// modules are read from the vendor directory or the module cache, npm
+// packages from node_modules, where the package.json license field wins
+// over the license files.
+func (s *Service) DetectLicenses(repoPath string, files []SourceFile, deps []Dependency, opts LicenseOptions) (*LicenseReport, error) {
+	if opts.MinConfidence == 0 {
+		opts.MinConfidence = defaultLicenseConfidence
+	}
+	if opts.ModCache == "" {
+		opts.ModCache = goModCache()
+	}
+	templates, err := loadLicenseTemplates(opts.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LicenseReport{}
+	err = filepath.WalkDir(repoPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != repoPath && (strings.HasPrefix(d.Name(), ".") || skippedDependencyDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !licenseFileName.MatchString(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(repoPath, p)
+		if err != nil {
+			return err
+		}
+		match, err := matchLicenseFile(p, filepath.ToSlash(rel), templates, opts.MinConfidence)
+		if err != nil {
+			return err
+		}
+		report.Repository = append(report.Repository, match)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find license files: %w", err)
+	}
+
+	headers, _, err := processFiles(context.Background(), files, s.Pipeline, true, func(file SourceFile, src []byte) ([]LicenseMatch, error) {
+		var found []LicenseMatch
+		for i, line := range strings.Split(string(src), "\n") {
+			m := spdxHeader.FindStringSubmatch(line)
+			if m == nil || !commentPrefix.MatchString(line) {
+				continue
+			}
+			found = append(found, LicenseMatch{License: m[1], File: file.Path, Line: i + 1, Confidence: 1, Source: "header"})
+		}
+		return found, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, found := range headers {
+		report.Headers = append(report.Headers, found...)
+	}
+
+	for _, dep := range deps {
+		dl := DependencyLicense{Dependency: dep}
+		dir := dependencyDir(repoPath, dep, opts.ModCache)
+		if dir != "" {
+			dl.Location = dir
+			if rel, err := filepath.Rel(repoPath, dir); err == nil && !strings.HasPrefix(rel, "..") {
+				dl.Location = filepath.ToSlash(rel)
+			}
+			if dl.Matches, err = dependencyLicenses(dir, templates, opts.MinConfidence); err != nil {
+				return nil, err
+			}
+		}
+		dl.License = combineLicenses(dl.Matches)
+		report.Dependencies = append(report.Dependencies, dl)
+	}
+	return report, nil
+}
+
+// goModCache returns the Go module cache directory
+func goModCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		gopath = filepath.Join(home, "go")
+	}
+	return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+}
+
+// escapeModulePath escapes the upper-case letters of a module path or
+// version the way the module cache does
+func escapeModulePath(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dependencyDir returns the directory holding the code of a dependency,
+// or "" when it is neither vendored nor cached
+func dependencyDir(repoPath string, dep Dependency, modCache string) string {
+	manifestDir := filepath.Join(repoPath, filepath.FromSlash(path.Dir(dep.Manifest)))
+	var candidates []string
+	switch dep.Ecosystem {
+	case EcosystemGo:
+		module, version := dep.Name, dep.Version
+		if fields := strings.Fields(dep.Replace); len(fields) > 0 {
+			if strings.HasPrefix(fields[0], ".") || filepath.IsAbs(fields[0]) {
+				candidates = append(candidates, filepath.Join(manifestDir, fields[0]))
+			}
+			module = fields[0]
+			if len(fields) > 1 {
+				version = fields[1]
+			}
+		}
+		candidates = append(candidates, filepath.Join(manifestDir, "vendor", filepath.FromSlash(dep.Name)))
+		if modCache != "" && version != "" {
+			candidates = append(candidates, filepath.Join(modCache, filepath.FromSlash(escapeModulePath(module))+"@"+escapeModulePath(version)))
+		}
+	case EcosystemNPM:
+		candidates = append(candidates, filepath.Join(manifestDir, "node_modules", filepath.FromSlash(dep.Name)))
+	}
+	for _, dir := range candidates {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// dependencyLicenses identifies the licenses declared by a package.json
+// and the license files at the top of a dependency directory
+func dependencyLicenses(dir string, templates []licenseTemplate, minConfidence float64) ([]LicenseMatch, error) {
+	if data, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		if license := packageJSONLicense(data); license != "" {
+			return []LicenseMatch{{License: license, File: "package.json", Confidence: 1, Source: "manifest"}}, nil
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	var matches []LicenseMatch
+	for _, e := range entries {
+		if e.IsDir() || !licenseFileName.MatchString(e.Name()) {
+			continue
+		}
+		match, err := matchLicenseFile(filepath.Join(dir, e.Name()), e.Name(), templates, minConfidence)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// matchLicenseFile identifies the license of a license file
+func matchLicenseFile(p, rel string, templates []licenseTemplate, minConfidence float64) (LicenseMatch, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return LicenseMatch{}, fmt.Errorf("failed to read %s: %w", rel, err)
+	}
+	match := LicenseMatch{File: rel, Source: "text"}
+	if m := spdxHeader.FindSubmatch(data); m != nil {
+		match.License, match.Confidence, match.Source = string(m[1]), 1, "header"
+		return match, nil
+	}
+	id, score := identifyLicense(string(data), templates)
+	match.Confidence = score
+	if score >= minConfidence {
+		match.License = id
+	}
+	return match, nil
+}
+
+// packageJSONLicense returns the license declared by a package.json,
+// either as an SPDX expression or as the legacy license objects
+func packageJSONLicense(data []byte) string {
+	var manifest struct {
+		License  json.RawMessage `json:"license"`
+		Licenses []struct {
+			Type string `json:"type"`
+		} `json:"licenses"`
+	}
+	if json.Unmarshal(data, &manifest) != nil {
+		return ""
+	}
+	var license string
+	if json.Unmarshal(manifest.License, &license) != nil {
+		var object struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(manifest.License, &object) == nil {
+			license = object.Type
+		}
+	}
+	if license == "" && len(manifest.Licenses) > 0 {
+		var types []string
+		for _, l := range manifest.Licenses {
+			types = append(types, l.Type)
+		}
+		license = strings.Join(types, " OR ")
+	}
+	return license
+}
+
+// combineLicenses returns the expression covering all the identified
+// licenses of a dependency, which ships under each of them
+func combineLicenses(matches []LicenseMatch) string {
+	var ids []string
+	for _, m := range matches {
+		if m.License != "" && !containsString(ids, m.License) {
+			ids = append(ids, m.License)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > 1 {
+		for i, id := range ids {
+			if strings.Contains(id, " ") {
+				ids[i] = "(" + id + ")"
+			}
+		}
+	}
+	return strings.Join(ids, " AND ")
+}
+
+// LoadLicensePolicy reads the license policy of a repository, or nil if
+// it has none
+func (s *Service) LoadLicensePolicy(repoPath string) (*LicensePolicy, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, LicensePolicyFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license policy: %w", err)
+	}
+	return ParseLicensePolicy(data)
+}
+
+// ParseLicensePolicy parses and validates a YAML or JSON license policy
+func ParseLicensePolicy(data []byte) (*LicensePolicy, error) {
+	var policy LicensePolicy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse license policy: %w", err)
+	}
+	switch policy.Unknown {
+	case "":
+		policy.Unknown = "warning"
+	case "error", "warning", "ignore":
+	default:
+		return nil, fmt.Errorf("invalid unknown license level: %s", policy.Unknown)
+	}
+	return &policy, nil
+}
+
+// License verdicts, ordered from best to worst
+const (
+	licenseAllowed = iota
+	licenseNotAllowed
+	licenseDenied
+)
+
+// evaluate returns the verdict of a license expression and the licenses
+// causing it. An OR expression takes its best alternative and an AND
+// expression its worst term.
+func (p *LicensePolicy) evaluate(expr string) (int, []string) {
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr))
+	verdict, offending, _ := p.evaluateOr(tokens)
+	return verdict, offending
+}
+
+// evaluateOr evaluates the OR alternatives at the start of the tokens and
+// returns the remaining tokens
+func (p *LicensePolicy) evaluateOr(tokens []string) (int, []string, []string) {
+	verdict, offending, rest := p.evaluateAnd(tokens)
+	for len(rest) > 0 && strings.EqualFold(rest[0], "OR") {
+		var v int
+		var o []string
+		v, o, rest = p.evaluateAnd(rest[1:])
+		if v < verdict {
+			verdict, offending = v, o
+		}
+	}
+	return verdict, offending, rest
+}
+
+// evaluateAnd evaluates the AND terms at the start of the tokens
+func (p *LicensePolicy) evaluateAnd(tokens []string) (int, []string, []string) {
+	verdict, offending, rest := p.evaluateTerm(tokens)
+	for len(rest) > 0 && strings.EqualFold(rest[0], "AND") {
+		var v int
+		var o []string
+		v, o, rest = p.evaluateTerm(rest[1:])
+		switch {
+		case v > verdict:
+			verdict, offending = v, o
+		case v == verdict:
+			offending = append(offending, o...)
+		}
+	}
+	return verdict, offending, rest
+}
+
+// evaluateTerm evaluates a license, with its exception, or a parenthesized
+// expression
+func (p *LicensePolicy) evaluateTerm(tokens []string) (int, []string, []string) {
+	if len(tokens) == 0 {
+		return licenseAllowed, nil, nil
+	}
+	if tokens[0] == "(" {
+		verdict, offending, rest := p.evaluateOr(tokens[1:])
+		if len(rest) > 0 && rest[0] == ")" {
+			rest = rest[1:]
+		}
+		return verdict, offending, rest
+	}
+
+	id, rest := tokens[0], tokens[1:]
+	if len(rest) > 1 && strings.EqualFold(rest[0], "WITH") {
+		rest = rest[2:] // exceptions only add permissions
+	}
+	switch {
+	case p.matches(p.Deny, id):
+		return licenseDenied, []string{id}, rest
+	case len(p.Allow) > 0 && !p.matches(p.Allow, id):
+		return licenseNotAllowed, []string{id}, rest
+	}
+	return licenseAllowed, nil, rest
+}
+
+// matches reports whether a license is in a policy list. An entry without
+// the -only or -or-later suffix covers both.
+func (p *LicensePolicy) matches(list []string, id string) bool {
+	id = strings.TrimSuffix(id, "+")
+	for _, entry := range list {
+		if strings.EqualFold(entry, id) ||
+			strings.EqualFold(entry+"-only", id) ||
+			strings.EqualFold(entry+"-or-later", id) {
+			return true
+		}
+	}
+	return false
+}
+
+// LicenseFindings checks the licenses of a report against a policy.
+// Denied licenses are errors, licenses missing from the allow list are
+// warnings, and unidentified licenses are reported at the policy's level.
+// Dependency findings point at the manifest declaring the dependency.
+func (s *Service) LicenseFindings(repoPath string, report *LicenseReport, policy *LicensePolicy) []AnalysisResult {
+	if policy == nil {
+		return nil
+	}
+	var findings []AnalysisResult
+	check := func(subject, license, file string, line int) {
+		if license == "" {
+			if policy.Unknown == "ignore" {
+				return
+			}
+			findings = append(findings, AnalysisResult{
+				Rule:    RuleLicenseUnknown,
+				File:    file,
+				Line:    line,
+				Column:  1,
+				Message: fmt.Sprintf("the license of %s could not be identified", subject),
+				Level:   policy.Unknown,
+			})
+			return
+		}
+
+		verdict, offending := policy.evaluate(license)
+		switch verdict {
+		case licenseDenied:
+			findings = append(findings, AnalysisResult{
+				Rule:    RuleLicenseDenied,
+				File:    file,
+				Line:    line,
+				Column:  1,
+				Message: fmt.Sprintf("%s is licensed under %s; %s is denied by the license policy", subject, license, strings.Join(offending, ", ")),
+				Level:   "error",
+			})
+		case licenseNotAllowed:
+			findings = append(findings, AnalysisResult{
+				Rule:    RuleLicenseNotAllowed,
+				File:    file,
+				Line:    line,
+				Column:  1,
+				Message: fmt.Sprintf("%s is licensed under %s; %s is not in the allowed licenses", subject, license, strings.Join(offending, ", ")),
+				Level:   "warning",
+			})
+		}
+	}
+
+	for _, m := range report.Repository {
+		check(m.File, m.License, m.File, 1)
+	}
+	for _, m := range report.Headers {
+		check(m.File, m.License, m.File, m.Line)
+	}
+	lines := make(map[string][]string)
+	for _, dl := range report.Dependencies {
+		dep := dl.Dependency
+		if containsString(policy.Ignore, dep.Name) {
+			continue
+		}
+		if _, ok := lines[dep.Manifest]; !ok {
+			data, _ := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(dep.Manifest)))
+			lines[dep.Manifest] = strings.Split(string(data), "\n")
+		}
+		subject := strings.TrimSpace(dep.Name + " " + dep.Version)
+		check(subject, dl.License, dep.Manifest, dependencyLine(lines[dep.Manifest], dep))
+	}
+	return findings
+}
+
+// SPDXDocument is an SPDX 2.3 software bill of materials
+type SPDXDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      SPDXCreationInfo   `json:"creationInfo"`
+	Packages          []SPDXPackage      `json:"packages"`
+	Relationships     []SPDXRelationship `json:"relationships"`
+}
+
+// SPDXCreationInfo tells when and by what an SPDX document was created
+type SPDXCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+// SPDXPackage is a package of an SPDX document
+type SPDXPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []SPDXExternalRef `json:"externalRefs,omitempty"`
+}
+
+// SPDXExternalRef identifies a package outside the document, such as its
+// package URL
+type SPDXExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+// SPDXRelationship links two elements of an SPDX document
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// ExportSBOM describes a repository and its dependencies as an SPDX 2.3
+// document. The repository package depends on the direct dependencies and
+// on the indirect ones whose dependents are unknown.
+func (s *Service) ExportSBOM(name string, report *LicenseReport, created time.Time) *SPDXDocument {
+	if created.IsZero() {
+		created = time.Now()
+	}
+	created = created.UTC()
+	sum := sha256.Sum256([]byte(name + "\x00" + created.Format(time.RFC3339Nano)))
+
+	rootID := "SPDXRef-Package-" + spdxRefUnsafe.ReplaceAllString(name, "-")
+	doc := &SPDXDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + spdxRefUnsafe.ReplaceAllString(name, "-") + "-" + hex.EncodeToString(sum[:8]),
+		CreationInfo: SPDXCreationInfo{
+			Created:  created.Format(time.RFC3339),
+			Creators: []string{"Tool: codeanalyzer-" + AnalyzerVersion},
+		},
+		Packages: []SPDXPackage{{
+			Name:             name,
+			SPDXID:           rootID,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: spdxLicense(combineLicenses(report.Repository)),
+			LicenseDeclared:  spdxLicense(combineLicenses(report.Repository)),
+			CopyrightText:    "NOASSERTION",
+		}},
+		Relationships: []SPDXRelationship{{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: rootID}},
+	}
+
+	ids := make(map[string]string) // ecosystem and name -> SPDX ID
+	required := make(map[string]bool)
+	for _, dl := range report.Dependencies {
+		dep := dl.Dependency
+		key := dep.Ecosystem + ":" + dep.Name
+		if _, ok := ids[key]; ok {
+			continue
+		}
+		id := "SPDXRef-Package-" + strings.Trim(spdxRefUnsafe.ReplaceAllString(dep.Ecosystem+"-"+dep.Name+"-"+dep.Version, "-"), "-")
+		ids[key] = id
+		for _, child := range dep.DependsOn {
+			required[dep.Ecosystem+":"+child] = true
+		}
+
+		declared := "NOASSERTION"
+		for _, m := range dl.Matches {
+			if m.Source == "manifest" {
+				declared = spdxLicense(m.License)
+			}
+		}
+		pkg := SPDXPackage{
+			Name:             dep.Name,
+			SPDXID:           id,
+			VersionInfo:      dep.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: spdxLicense(dl.License),
+			LicenseDeclared:  declared,
+			CopyrightText:    "NOASSERTION",
+		}
+		if purl := packageURL(dep); purl != "" {
+			pkg.ExternalRefs = []SPDXExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: purl}}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+	}
+
+	linked := make(map[string]bool)
+	for _, dl := range report.Dependencies {
+		dep := dl.Dependency
+		key := dep.Ecosystem + ":" + dep.Name
+		if linked[key] {
+			continue
+		}
+		linked[key] = true
+		if dep.Direct || !required[key] {
+			doc.Relationships = append(doc.Relationships, SPDXRelationship{SPDXElementID: rootID, RelationshipType: "DEPENDS_ON", RelatedSPDXElement: ids[key]})
+		}
+		for _, child := range dep.DependsOn {
+			if id, ok := ids[dep.Ecosystem+":"+child]; ok {
+				doc.Relationships = append(doc.Relationships, SPDXRelationship{SPDXElementID: ids[key], RelationshipType: "DEPENDS_ON", RelatedSPDXElement: id})
+			}
+		}
+	}
+	return doc
+}
+
+// spdxLicense returns a license expression usable in an SPDX document
+func spdxLicense(license string) string {
+	if license == "" || !spdxExpression.MatchString(license) {
+		return "NOASSERTION"
+	}
+	return license
+}
+
+// packageURL returns the package URL of a dependency
+func packageURL(dep Dependency) string {
+	version := ""
+	if dep.Version != "" {
+		version = "@" + dep.Version
+	}
+	switch dep.Ecosystem {
+	case EcosystemGo:
+		return "pkg:golang/" + dep.Name + version
+	case EcosystemNPM:
+		return "pkg:npm/" + strings.Replace(dep.Name, "@", "%40", 1) + version
+	case EcosystemPyPI:
+		return "pkg:pypi/" + dep.Name + version
+	case EcosystemMaven:
+		group, artifact, _ := strings.Cut(dep.Name, ":")
+		return "pkg:maven/" + group + "/" + artifact + version
+	}
+	return ""
+}
@@ -0,0 +1,313 @@
+package analyzer
+
+import (
+	"math"
+	"sort"
+)
+
+// Suspect is a graph node ranked by how likely it is to cause the errors
+type Suspect struct {
+	NodeID      string   `json:"nodeId"`
+	Name        string   `json:"name"`
+	Path        string   `json:"path,omitempty"`
+	Score       float64  `json:"score"`
+	Propagation float64  `json:"propagation"` // normalized random walk score, lowered for errors in flaky tests
+	Churn       float64  `json:"churn"`       // normalized change frequency of the file
+	Complexity  float64  `json:"complexity"`  // normalized complexity of the node
+	Spectrum    float64  `json:"spectrum"`    // spectrum-based suspiciousness from coverage
+	Explanation []string `json:"explanation"` // node IDs from an error node to the suspect
+}
+
+// Fault localization strategies
+const (
+	StrategyGraph    = "graph"    // propagation over the code graph
+	StrategySpectrum = "spectrum" // test coverage spectra only
+	StrategyCombined = "combined" // graph propagation plus coverage spectra
+)
+
+// LocalizeOptions configures fault localization
+type LocalizeOptions struct {
+	Strategy           string             // StrategyGraph, StrategySpectrum or StrategyCombined
+	RestartProbability float64            // probability of jumping back to an error node
+	Iterations         int                // power iterations of the random walk
+	PropagationWeight  float64            // weight of the random walk score
+	ChurnWeight        float64            // weight of the churn signal
+	ComplexityWeight   float64            // weight of the complexity signal
+	EdgeWeights        map[string]float64 // suspicion carried by each edge type
+	SeedWeights        map[string]float64 // optional weight of each error node
+	Churn              map[string]int     // commits touching each repository-relative file
+	Spectrum           map[string]float64 // coverage suspiciousness per node, see SpectrumReport.NodeScores
+	SpectrumWeight     float64            // weight of the spectrum signal in the combined strategy
+	FlakyTests         map[string]bool    // test nodes known to be flaky, see FlakyReport.FlakyNodes
+	FlakyWeight        float64            // seed weight factor of errors in flaky tests
+	Limit              int                // maximum number of suspects, 0 for all
+}
+
+// DefaultLocalizeOptions returns the default fault localization settings
+func DefaultLocalizeOptions() LocalizeOptions {
+	return LocalizeOptions{
+		Strategy:           StrategyGraph,
+		RestartProbability: 0.3,
+		Iterations:         50,
+		PropagationWeight:  0.7,
+		ChurnWeight:        0.15,
+		ComplexityWeight:   0.15,
+		SpectrumWeight:     1.0,
+		FlakyWeight:        defaultFlakyWeight,
+		EdgeWeights: map[string]float64{
+			EdgeCalls:       1.0,
+			EdgeReferences:  0.5,
+			EdgeContains:    0.3,
+			EdgeImplements:  0.3,
+			EdgeEmbeds:      0.3,
+			EdgeDuplicateOf: 0.5,
+		},
+	}
+}
+
+// suspicionGraph is the weighted, undirected adjacency used for propagation
+type suspicionGraph struct {
+	nodes []GraphNode
+	index map[string]int
+	adj   [][]weightedEdge
+}
+
+// weightedEdge is an adjacency entry of the suspicion graph
+type weightedEdge struct {
+	to     int
+	weight float64
+}
+
+// newSuspicionGraph builds the propagation graph; suspicion flows both ways
+// along an edge, since callers of a failing function are as suspect as callees
+func newSuspicionGraph(graph []GraphNode, edgeWeights map[string]float64) *suspicionGraph {
+	g := &suspicionGraph{
+		nodes: graph,
+		index: make(map[string]int, len(graph)),
+		adj:   make([][]weightedEdge, len(graph)),
+	}
+	for i, node := range graph {
+		g.index[node.ID] = i
+	}
+	for i, node := range graph {
+		for _, edge := range node.Edges {
+			w := edgeWeights[edge.Type]
+			j, ok := g.index[edge.Target]
+			if w <= 0 || !ok {
+				continue
+			}
+			g.adj[i] = append(g.adj[i], weightedEdge{to: j, weight: w})
+			g.adj[j] = append(g.adj[j], weightedEdge{to: i, weight: w})
+		}
+	}
+	return g
+}
+
+// randomWalkWithRestart returns the stationary visiting probability of each
+// node for a walk that restarts at the seed distribution
+func (g *suspicionGraph) randomWalkWithRestart(seeds []float64, restart float64, iterations int) []float64 {
+	n := len(g.nodes)
+	outWeight := make([]float64, n)
+	for i, edges := range g.adj {
+		for _, e := range edges {
+			outWeight[i] += e.weight
+		}
+	}
+
+	rank := append([]float64(nil), seeds...)
+	next := make([]float64, n)
+	for it := 0; it < iterations; it++ {
+		for i := range next {
+			next[i] = restart * seeds[i]
+		}
+		dangling := 0.0
+		for i, edges := range g.adj {
+			if rank[i] == 0 {
+				continue
+			}
+			if outWeight[i] == 0 {
+				dangling += rank[i]
+				continue
+			}
+			for _, e := range edges {
+				next[e.to] += (1 - restart) * rank[i] * e.weight / outWeight[i]
+			}
+		}
+		// Walks stuck at nodes without edges restart at the seeds
+		for i := range next {
+			next[i] += (1 - restart) * dangling * seeds[i]
+		}
+
+		delta := 0.0
+		for i := range rank {
+			delta += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if delta < 1e-9 {
+			break
+		}
+	}
+	return rank
+}
+
+// explanationPaths returns, for every node, the shortest path from a seed
+func (g *suspicionGraph) explanationPaths(seeds []int) []int {
+	parent := make([]int, len(g.nodes))
+	for i := range parent {
+		parent[i] = -2 // unvisited
+	}
+	queue := make([]int, 0, len(seeds))
+	for _, s := range seeds {
+		if parent[s] == -2 {
+			parent[s] = -1
+			queue = append(queue, s)
+		}
+	}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, e := range g.adj[u] {
+			if parent[e.to] == -2 {
+				parent[e.to] = u
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return parent
+}
+
+// RankSuspects ranks functions and methods by spreading suspicion from the
+// error nodes over call, reference and containment edges with a random walk
+// with restart, combined with churn and complexity signals. Coverage spectra
+// replace or add to the propagation score depending on opts.Strategy.
+func (s *Service) RankSuspects(errorNodeIDs []string, graph []GraphNode, opts LocalizeOptions) []Suspect {
+	g := newSuspicionGraph(graph, opts.EdgeWeights)
+
+	seeds := make([]float64, len(graph))
+	var seedIdx []int
+	total, unweighted := 0.0, 0.0
+	for _, id := range errorNodeIDs {
+		i, ok := g.index[id]
+		if !ok {
+			continue
+		}
+		w := 1.0
+		if sw, ok := opts.SeedWeights[id]; ok {
+			w = sw
+		}
+		unweighted += w
+		if opts.FlakyTests[id] {
+			// Failures of known-flaky tests are weak evidence
+			w *= opts.FlakyWeight
+		}
+		if seeds[i] == 0 {
+			seedIdx = append(seedIdx, i)
+		}
+		seeds[i] += w
+		total += w
+	}
+	// Normalizing the seeds would cancel the flaky weight when every error
+	// is in a flaky test, so the propagation score is scaled by it instead
+	evidence := 0.0
+	if unweighted > 0 {
+		evidence = total / unweighted
+	}
+	useGraph := opts.Strategy != StrategySpectrum
+	useSpectrum := opts.Strategy == StrategySpectrum || opts.Strategy == StrategyCombined
+	if (total == 0 || !useGraph) && (!useSpectrum || len(opts.Spectrum) == 0) {
+		return []Suspect{}
+	}
+
+	rank := make([]float64, len(graph))
+	if useGraph && total > 0 {
+		for i := range seeds {
+			seeds[i] /= total
+		}
+		rank = g.randomWalkWithRestart(seeds, opts.RestartProbability, opts.Iterations)
+	}
+	parent := g.explanationPaths(seedIdx)
+
+	spectrum := func(node GraphNode) float64 {
+		if !useSpectrum {
+			return 0
+		}
+		return opts.Spectrum[node.ID]
+	}
+
+	// Normalize each signal to [0, 1] over the candidate functions
+	var candidates []int
+	maxRank, maxChurn, maxComplexity := 0.0, 0.0, 0.0
+	for i, node := range graph {
+		if (node.Type != NodeFunction && node.Type != NodeMethod) || rank[i] == 0 && spectrum(node) == 0 {
+			continue
+		}
+		candidates = append(candidates, i)
+		maxRank = math.Max(maxRank, rank[i])
+		maxChurn = math.Max(maxChurn, float64(opts.Churn[node.Path]))
+		maxComplexity = math.Max(maxComplexity, nodeComplexity(node))
+	}
+
+	suspects := make([]Suspect, 0, len(candidates))
+	for _, i := range candidates {
+		node := graph[i]
+		suspect := Suspect{
+			NodeID:   node.ID,
+			Name:     node.Name,
+			Path:     node.Path,
+			Spectrum: spectrum(node),
+		}
+		if maxRank > 0 {
+			suspect.Propagation = evidence * rank[i] / maxRank
+		}
+		if maxChurn > 0 {
+			suspect.Churn = float64(opts.Churn[node.Path]) / maxChurn
+		}
+		if maxComplexity > 0 {
+			suspect.Complexity = nodeComplexity(node) / maxComplexity
+		}
+
+		switch opts.Strategy {
+		case StrategySpectrum:
+			// Churn and complexity only break ties between equal spectra
+			suspect.Score = suspect.Spectrum + 1e-3*(suspect.Churn+suspect.Complexity)
+		default:
+			suspect.Score = opts.PropagationWeight*suspect.Propagation +
+				opts.ChurnWeight*suspect.Churn +
+				opts.ComplexityWeight*suspect.Complexity +
+				opts.SpectrumWeight*suspect.Spectrum
+		}
+
+		for p := i; p >= 0; p = parent[p] {
+			suspect.Explanation = append([]string{graph[p].ID}, suspect.Explanation...)
+		}
+		suspects = append(suspects, suspect)
+	}
+
+	sort.SliceStable(suspects, func(i, j int) bool {
+		if suspects[i].Score != suspects[j].Score {
+			return suspects[i].Score > suspects[j].Score
+		}
+		return suspects[i].NodeID < suspects[j].NodeID
+	})
+	if opts.Limit > 0 && len(suspects) > opts.Limit {
+		suspects = suspects[:opts.Limit]
+	}
+	return suspects
+}
+
+// nodeComplexity returns the cyclomatic complexity recorded on a node, or
+// a size-based estimate when metrics have not been computed
+func nodeComplexity(node GraphNode) float64 {
+	if c, ok := node.Properties["cyclomatic"]; ok {
+		switch v := c.(type) {
+		case int:
+			return float64(v)
+		case float64:
+			return v
+		}
+	}
+	if node.EndLine >= node.StartLine && node.StartLine > 0 {
+		return math.Log1p(float64(node.EndLine - node.StartLine + 1))
+	}
+	return 0
+}
@@ -0,0 +1,367 @@
+package analyzer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadedLogsDir is where logs uploaded for a repository are stored,
+// relative to the repository root
+const UploadedLogsDir = ".codeanalyzer/logs"
+
+// LogSource points back to the log line an error was extracted from
+type LogSource struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+}
+
+// LogOptions controls how log files are parsed
+type LogOptions struct {
+	Since       time.Time // ignore errors logged before Since, if set
+	Until       time.Time // ignore errors logged after Until, if set
+	Deduplicate bool      // collapse repeated errors into one entry with a count
+}
+
+// DefaultLogOptions returns the options used when parsing repository logs
+func DefaultLogOptions() LogOptions {
+	return LogOptions{Deduplicate: true}
+}
+
+const (
+	// maxLogLineSize is the longest log line that is kept; longer lines are truncated
+	maxLogLineSize = 1 << 20
+	// logBlockLines is the number of lines buffered before the stream is
+	// split at the next boundary between log entries
+	logBlockLines = 2000
+)
+
+var (
+	// compiler, linter and test diagnostics in file:line[:col]: message form
+	diagnosticLine = regexp.MustCompile(`(?:^|\s)((?:[A-Za-z]:)?[\w./\\-]+\.(?:go|py|js|jsx|ts|tsx|java|kt|c|cc|cpp|h|hpp|rb|rs|cs)):(\d+)(?::(\d+))?:\s*(.+)$`)
+	// leading timestamps in RFC 3339, ISO 8601 and Go log formats
+	timestampLine = regexp.MustCompile(`^\[?(\d{4}[-/]\d{2}[-/]\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)`)
+)
+
+// DiscoverLogFiles finds log files in a repository: *.log files, CI output,
+// test result files and logs uploaded through the API. Paths are returned
+// relative to the repository root.
+func (s *Service) DiscoverLogFiles(repoPath string) ([]string, error) {
+	uploaded := filepath.Join(repoPath, UploadedLogsDir)
+	var logs []string
+
+	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			// Skip hidden and dependency directories, except for uploaded logs
+			name := info.Name()
+			if path != repoPath && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") &&
+				!strings.HasPrefix(uploaded, path+string(filepath.Separator)) && path != uploaded {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(repoPath, path)
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(path, uploaded+string(filepath.Separator)) || isLogFile(filepath.ToSlash(relPath)) {
+			logs = append(logs, filepath.ToSlash(relPath))
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover log files: %w", err)
+	}
+
+	return logs, nil
+}
+
+// isLogFile reports whether a repository-relative path looks like a log file
+func isLogFile(relPath string) bool {
+	name := strings.ToLower(filepath.Base(relPath))
+	ext := filepath.Ext(name)
+
+	switch {
+	case ext == ".log", strings.Contains(name, ".log."):
+		return true
+	case strings.HasSuffix(name, "-output.txt"), strings.HasSuffix(name, "_output.txt"):
+		return true
+	}
+
+	// Test result files such as JUnit reports and go test -json output
+	for _, dir := range strings.Split(filepath.Dir(relPath), "/") {
+		if dir == "test-results" || dir == "test-reports" {
+			return ext == ".txt" || ext == ".xml" || ext == ".json"
+		}
+	}
+	return false
+}
+
+// SaveLog stores an uploaded log for the repository and returns its
+// repository-relative path. A log uploaded under the name of an earlier one
+// is stored with a numbered suffix rather than replacing it.
+func (s *Service) SaveLog(repoPath, name string, r io.Reader) (string, error) {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." {
+		return "", errors.New("invalid log file name")
+	}
+
+	dir := filepath.Join(repoPath, UploadedLogsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	var f *os.File
+	for i := 1; ; i++ {
+		var err error
+		f, err = os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", fmt.Errorf("failed to create log file: %w", err)
+		}
+		name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return "", fmt.Errorf("failed to write log file: %w", err)
+	}
+
+	return filepath.ToSlash(filepath.Join(UploadedLogsDir, name)), nil
+}
+
+// ParseLogFile parses a repository-relative log file
+func (s *Service) ParseLogFile(repoPath, logPath string, opts LogOptions) ([]ErrorLog, error) {
+	f, err := os.Open(filepath.Join(repoPath, logPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+
+	return s.ParseLogStream(f, logPath, repoPath, opts)
+}
+
+// ParseLogStream extracts errors from a log stream. The stream is read in
+// bounded blocks so large logs are never held in memory at once. Each error
+// keeps a pointer to the line of source it was extracted from.
+func (s *Service) ParseLogStream(r io.Reader, source, repoPath string, opts LogOptions) ([]ErrorLog, error) {
+	p := &logParser{
+		source:   source,
+		opts:     opts,
+		resolver: newPathResolver(repoPath),
+		seen:     make(map[string]int),
+	}
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	lineNo := 0
+	for {
+		line, err := readLogLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log %s: %w", source, err)
+		}
+		lineNo++
+		line = strings.TrimRight(line, "\r")
+
+		if p.shouldFlush(line) {
+			p.flush()
+		}
+		if len(p.block) == 0 {
+			p.blockStart = lineNo
+		}
+		p.block = append(p.block, line)
+	}
+	p.flush()
+
+	return p.logs, nil
+}
+
+// readLogLine reads the next line of a log, truncated to maxLogLineSize so a
+// single oversized line does not fail the whole log
+func readLogLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return string(line), err
+		}
+		if room := maxLogLineSize - len(line); room > 0 {
+			line = append(line, chunk[:min(len(chunk), room)]...)
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// logParser accumulates a log stream into blocks and extracts their errors
+type logParser struct {
+	source     string
+	opts       LogOptions
+	resolver   *pathResolver
+	block      []string
+	blockStart int       // line number of block[0]
+	timestamp  time.Time // most recent timestamp seen in the stream
+	seen       map[string]int
+	logs       []ErrorLog
+}
+
+// shouldFlush reports whether the buffered block can be parsed before line
+// without splitting a multi-line entry such as a stack trace
+func (p *logParser) shouldFlush(line string) bool {
+	n := len(p.block)
+	if n < logBlockLines {
+		return false
+	}
+	if n >= 4*logBlockLines {
+		return true
+	}
+
+	trimmed := strings.TrimSpace(line)
+	return strings.TrimSpace(p.block[n-1]) == "" && trimmed != "" &&
+		!strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") &&
+		!goGoroutine.MatchString(trimmed) && !pyTracebackStart.MatchString(trimmed) &&
+		!isPythonChainMarker(trimmed) && !strings.HasPrefix(trimmed, "Caused by:")
+}
+
+// flush parses the buffered block and resets it
+func (p *logParser) flush() {
+	if len(p.block) == 0 {
+		return
+	}
+
+	// Leading timestamps are stripped so traces written through a logger
+	// are still recognised; only the separator goes, so frame indentation
+	// is kept
+	lines := make([]string, len(p.block))
+	for i, line := range p.block {
+		lines[i] = line
+		if loc := timestampLine.FindStringIndex(line); loc != nil {
+			rest := line[loc[1]:]
+			if strings.HasPrefix(line, "[") {
+				rest = strings.TrimPrefix(rest, "]")
+			}
+			lines[i] = strings.TrimPrefix(rest, " ")
+		}
+	}
+
+	traces, spans := parseTraceLines(lines, p.resolver)
+	next := 0
+	for i := 0; i < len(lines); i++ {
+		p.observeTimestamp(p.block[i])
+
+		// Stack traces are reported at their first line
+		if next < len(spans) && spans[next].start == i {
+			p.add(traces[next], p.blockStart+i)
+			for j := i + 1; j < spans[next].end; j++ {
+				p.observeTimestamp(p.block[j])
+			}
+			i = spans[next].end - 1
+			next++
+			continue
+		}
+
+		m := diagnosticLine.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(m[2])
+		file, _ := p.resolver.resolve(m[1])
+		p.add(ErrorLog{
+			File:    file,
+			Line:    line,
+			Message: strings.TrimSpace(m[4]),
+		}, p.blockStart+i)
+	}
+
+	p.block = p.block[:0]
+}
+
+// observeTimestamp updates the current stream time from a leading timestamp
+func (p *logParser) observeTimestamp(line string) {
+	m := timestampLine.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	if t, ok := parseLogTimestamp(m[1]); ok {
+		p.timestamp = t
+	}
+}
+
+// add records an error found at lineNo, applying the time window and deduplication
+func (p *logParser) add(log ErrorLog, lineNo int) {
+	if !p.timestamp.IsZero() {
+		if !p.opts.Since.IsZero() && p.timestamp.Before(p.opts.Since) {
+			return
+		}
+		if !p.opts.Until.IsZero() && p.timestamp.After(p.opts.Until) {
+			return
+		}
+		log.Timestamp = p.timestamp
+	}
+
+	if p.opts.Deduplicate {
+		key := errorKey(log)
+		if idx, ok := p.seen[key]; ok {
+			p.logs[idx].Count++
+			return
+		}
+		p.seen[key] = len(p.logs)
+	}
+
+	log.Count = 1
+	log.Source = &LogSource{Path: p.source, Line: lineNo}
+	p.logs = append(p.logs, log)
+}
+
+// errorKey identifies repeated occurrences of the same error
+func errorKey(log ErrorLog) string {
+	key := fmt.Sprintf("%s|%s:%d", log.Message, log.File, log.Line)
+	for _, frame := range log.Frames {
+		key += fmt.Sprintf("|%s@%s:%d", frame.Function, frame.File, frame.Line)
+	}
+	return key
+}
+
+// logTimestampLayouts are the timestamp layouts recognised at the start of log lines
+var logTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999-0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006/01/02 15:04:05.999999999",
+	"2006/01/02 15:04:05",
+}
+
+// parseLogTimestamp parses a timestamp matched by timestampLine
+func parseLogTimestamp(value string) (time.Time, bool) {
+	value = strings.Replace(value, ",", ".", 1)
+	for _, layout := range logTimestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
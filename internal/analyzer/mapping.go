@@ -0,0 +1,200 @@
+package analyzer
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrorMapping links an error, or one of its stack frames, to a graph node
+type ErrorMapping struct {
+	ErrorIndex int     `json:"errorIndex"` // index of the error in the mapped logs
+	Frame      int     `json:"frame"`      // index of the stack frame, or -1 for the error location
+	File       string  `json:"file"`
+	Line       int     `json:"line"`
+	NodeID     string  `json:"nodeId"`
+	Confidence float64 `json:"confidence"`
+}
+
+// ErrorMappingReport is the result of mapping errors onto the code graph
+type ErrorMappingReport struct {
+	Mappings []ErrorMapping `json:"mappings"`
+	Unmapped []ErrorLog     `json:"unmapped"`
+}
+
+// Confidence factors for error mappings
+const (
+	exactPathConfidence  = 1.0
+	suffixPathConfidence = 0.7  // path matched by a unique trailing segment sequence
+	fileLevelConfidence  = 0.5  // line falls outside every symbol in the file
+	noLineConfidence     = 0.4  // error carries no line number
+	frameDecay           = 0.85 // per frame below the innermost one
+	causeDecay           = 0.8  // per exception in the cause chain
+)
+
+// graphFileIndex finds the nodes declared in each file of a code graph
+type graphFileIndex struct {
+	files   map[string]GraphNode   // normalized path -> file node
+	symbols map[string][]GraphNode // normalized path -> symbols with line ranges
+}
+
+// newGraphFileIndex indexes the file and symbol nodes of a graph by path
+func newGraphFileIndex(graph []GraphNode) *graphFileIndex {
+	idx := &graphFileIndex{
+		files:   make(map[string]GraphNode),
+		symbols: make(map[string][]GraphNode),
+	}
+	for _, node := range graph {
+		if node.Path == "" {
+			continue
+		}
+		p := normalizeGraphPath(node.Path)
+		switch {
+		case node.Type == NodeFile:
+			idx.files[p] = node
+		case node.Type != NodePackage && node.StartLine > 0:
+			idx.symbols[p] = append(idx.symbols[p], node)
+		}
+	}
+	return idx
+}
+
+// normalizeGraphPath cleans a file path for comparison
+func normalizeGraphPath(p string) string {
+	p = strings.ReplaceAll(p, `\`, "/")
+	p = path.Clean(p)
+	return strings.TrimPrefix(p, "./")
+}
+
+// resolveFile finds the graph path of a file referenced by an error. Paths
+// match exactly after normalization; otherwise the unique graph file whose
+// path is a whole-segment suffix of p is used.
+func (idx *graphFileIndex) resolveFile(p string) (string, float64, bool) {
+	p = normalizeGraphPath(p)
+	if _, ok := idx.files[p]; ok {
+		return p, exactPathConfidence, true
+	}
+
+	match := ""
+	for candidate := range idx.files {
+		if strings.HasSuffix(p, "/"+candidate) {
+			if match != "" {
+				// Ambiguous, e.g. two repositories vendored side by side
+				return "", 0, false
+			}
+			match = candidate
+		}
+	}
+	if match == "" {
+		return "", 0, false
+	}
+	return match, suffixPathConfidence, true
+}
+
+// locate returns the innermost node enclosing line in the file at p
+func (idx *graphFileIndex) locate(p string, line int) (GraphNode, float64) {
+	if line <= 0 {
+		return idx.files[p], noLineConfidence
+	}
+
+	var (
+		best  GraphNode
+		found bool
+	)
+	for _, node := range idx.symbols[p] {
+		if line < node.StartLine || line > node.EndLine {
+			continue
+		}
+		if !found || node.EndLine-node.StartLine < best.EndLine-best.StartLine {
+			best, found = node, true
+		}
+	}
+	if !found {
+		return idx.files[p], fileLevelConfidence
+	}
+	return best, 1.0
+}
+
+// MapErrorsToGraphDetailed maps each error and stack frame to the innermost
+// function or method node enclosing its line, with a confidence score.
+// Errors that match no node are reported as unmapped.
+func (s *Service) MapErrorsToGraphDetailed(logs []ErrorLog, graph []GraphNode) ErrorMappingReport {
+	idx := newGraphFileIndex(graph)
+	report := ErrorMappingReport{Mappings: []ErrorMapping{}, Unmapped: []ErrorLog{}}
+
+	for i, log := range logs {
+		best := make(map[string]int) // node ID -> position in report.Mappings
+		mapped := false
+
+		add := func(frame int, file string, line int, weight float64) {
+			p, pathConfidence, ok := idx.resolveFile(file)
+			if !ok {
+				return
+			}
+			node, lineConfidence := idx.locate(p, line)
+			if node.ID == "" {
+				return
+			}
+			mapping := ErrorMapping{
+				ErrorIndex: i,
+				Frame:      frame,
+				File:       p,
+				Line:       line,
+				NodeID:     node.ID,
+				Confidence: pathConfidence * lineConfidence * weight,
+			}
+			mapped = true
+
+			// Keep the most confident mapping of each node per error
+			if j, ok := best[node.ID]; ok {
+				if mapping.Confidence > report.Mappings[j].Confidence {
+					report.Mappings[j] = mapping
+				}
+				return
+			}
+			best[node.ID] = len(report.Mappings)
+			report.Mappings = append(report.Mappings, mapping)
+		}
+
+		weight := 1.0
+		for l := &log; l != nil; l = l.Cause {
+			if l.File != "" {
+				add(-1, l.File, l.Line, weight)
+			}
+			frameWeight := weight
+			for f, frame := range l.Frames {
+				add(f, frame.File, frame.Line, frameWeight)
+				frameWeight *= frameDecay
+			}
+			weight *= causeDecay
+		}
+
+		if !mapped {
+			report.Unmapped = append(report.Unmapped, log)
+		}
+	}
+
+	return report
+}
+
+// mappedNodeIDs returns the distinct nodes of a mapping report, most confident first
+func mappedNodeIDs(report ErrorMappingReport) []string {
+	confidence := make(map[string]float64)
+	for _, m := range report.Mappings {
+		if m.Confidence > confidence[m.NodeID] {
+			confidence[m.NodeID] = m.Confidence
+		}
+	}
+
+	ids := make([]string, 0, len(confidence))
+	for id := range confidence {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if confidence[ids[i]] != confidence[ids[j]] {
+			return confidence[ids[i]] > confidence[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
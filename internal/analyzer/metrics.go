@@ -0,0 +1,722 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CodeMetrics are the size, complexity and coupling measures of a node.
+// They are also stored in the node's Properties under their JSON names.
+type CodeMetrics struct {
+	LOC                int     `json:"loc"`          // physical lines
+	SLOC               int     `json:"sloc"`         // logical lines, those with code
+	CommentLines       int     `json:"commentLines"` // lines with a comment
+	BlankLines         int     `json:"blankLines"`
+	CommentRatio       float64 `json:"commentRatio"` // comment lines per physical line
+	Cyclomatic         int     `json:"cyclomatic"`
+	HalsteadVolume     float64 `json:"halsteadVolume"`
+	HalsteadDifficulty float64 `json:"halsteadDifficulty"`
+	HalsteadEffort     float64 `json:"halsteadEffort"`
+	Maintainability    float64 `json:"maintainability"` // 0-100, higher is easier to maintain
+	FanIn              int     `json:"fanIn"`           // distinct callers, or importers of a file
+	FanOut             int     `json:"fanOut"`          // distinct callees, or imports of a file
+	AfferentCoupling   int     `json:"afferentCoupling,omitempty"`
+	EfferentCoupling   int     `json:"efferentCoupling,omitempty"`
+	Instability        float64 `json:"instability,omitempty"` // efferent / (afferent + efferent)
+}
+
+// NodeMetrics are the metrics of one graph node
+type NodeMetrics struct {
+	ID      string      `json:"id"`
+	Type    string      `json:"type"`
+	Name    string      `json:"name"`
+	Path    string      `json:"path,omitempty"`
+	Metrics CodeMetrics `json:"metrics"`
+}
+
+// MetricsSummary aggregates the metrics of a repository
+type MetricsSummary struct {
+	Files                  int     `json:"files"`
+	Functions              int     `json:"functions"`
+	LOC                    int     `json:"loc"`
+	SLOC                   int     `json:"sloc"`
+	CommentRatio           float64 `json:"commentRatio"`
+	AverageCyclomatic      float64 `json:"averageCyclomatic"` // per function
+	MaxCyclomatic          int     `json:"maxCyclomatic"`
+	AverageMaintainability float64 `json:"averageMaintainability"` // per file
+}
+
+// MetricsReport holds the metrics of the files, functions and packages of
+// a repository
+type MetricsReport struct {
+	Summary   MetricsSummary `json:"summary"`
+	Files     []NodeMetrics  `json:"files"`
+	Functions []NodeMetrics  `json:"functions"`
+	Packages  []NodeMetrics  `json:"packages"`
+	Errors    []FileError    `json:"errors,omitempty"`
+}
+
+// metricsToken is a token of a lexed file, as counted by Halstead's
+// measures and compared by clone detection
+type metricsToken struct {
+	text     string
+	line     int
+	operand  bool // identifiers and literals, otherwise an operator
+	literal  bool // a string or number operand
+	decision bool // adds a path to the cyclomatic complexity
+}
+
+// lexedFile is a file split into tokens, with the kind of each line
+type lexedFile struct {
+	path    string
+	lines   int
+	code    []bool // by line, from 1
+	comment []bool
+	tokens  []metricsToken
+}
+
+// halstead counts the operators and operands of a piece of code
+type halstead struct {
+	operators map[string]int
+	operands  map[string]int
+}
+
+// newHalstead creates empty counts
+func newHalstead() *halstead {
+	return &halstead{operators: make(map[string]int), operands: make(map[string]int)}
+}
+
+// add counts a token. Closing brackets are counted with the opening ones.
+func (h *halstead) add(tok metricsToken) {
+	switch {
+	case tok.text == ")" || tok.text == "]" || tok.text == "}":
+	case tok.operand:
+		h.operands[tok.text]++
+	default:
+		h.operators[tok.text]++
+	}
+}
+
+// merge adds the counts of another piece of code
+func (h *halstead) merge(other *halstead) {
+	for k, n := range other.operators {
+		h.operators[k] += n
+	}
+	for k, n := range other.operands {
+		h.operands[k] += n
+	}
+}
+
+// measures returns the volume, difficulty and effort
+func (h *halstead) measures() (volume, difficulty, effort float64) {
+	var n1, n2 int
+	for _, n := range h.operators {
+		n1 += n
+	}
+	for _, n := range h.operands {
+		n2 += n
+	}
+	vocabulary := len(h.operators) + len(h.operands)
+	if vocabulary < 2 {
+		return 0, 0, 0
+	}
+	volume = float64(n1+n2) * math.Log2(float64(vocabulary))
+	if len(h.operands) > 0 {
+		difficulty = float64(len(h.operators)) / 2 * float64(n2) / float64(len(h.operands))
+	}
+	return volume, difficulty, difficulty * volume
+}
+
+// maintainabilityIndex returns the maintainability index scaled to 0-100
+func maintainabilityIndex(volume float64, cyclomatic, sloc int) float64 {
+	if sloc == 0 {
+		return 100
+	}
+	mi := 171 - 0.23*float64(cyclomatic) - 16.2*math.Log(float64(sloc))
+	if volume > 0 {
+		mi -= 5.2 * math.Log(volume)
+	}
+	return math.Max(0, math.Min(100, mi*100/171))
+}
+
+// codeRange is a range of lines of a lexed file
+type codeRange struct {
+	file       *lexedFile
+	start, end int
+}
+
+// measure computes the size, complexity and Halstead metrics of the lines
+// of a range. functions is the number of functions it holds, each adding
+// one path to the cyclomatic complexity.
+func measure(ranges []codeRange, functions int) (CodeMetrics, *halstead) {
+	var m CodeMetrics
+	h := newHalstead()
+	decisions := 0
+	for _, r := range ranges {
+		f := r.file
+		start, end := max(r.start, 1), min(r.end, f.lines)
+		for line := start; line <= end; line++ {
+			m.LOC++
+			switch {
+			case f.code[line]:
+				m.SLOC++
+			case !f.comment[line]:
+				m.BlankLines++
+			}
+			if f.comment[line] {
+				m.CommentLines++
+			}
+		}
+		lo := sort.Search(len(f.tokens), func(i int) bool { return f.tokens[i].line >= start })
+		for _, tok := range f.tokens[lo:] {
+			if tok.line > end {
+				break
+			}
+			h.add(tok)
+			if tok.decision {
+				decisions++
+			}
+		}
+	}
+
+	if m.LOC > 0 {
+		m.CommentRatio = float64(m.CommentLines) / float64(m.LOC)
+	}
+	m.Cyclomatic = decisions + max(functions, 1)
+	m.HalsteadVolume, m.HalsteadDifficulty, m.HalsteadEffort = h.measures()
+	m.Maintainability = maintainabilityIndex(m.HalsteadVolume, m.Cyclomatic, m.SLOC)
+	return m, h
+}
+
+// properties stores the metrics in node properties
+func (m CodeMetrics) properties(props map[string]interface{}) {
+	props["loc"] = m.LOC
+	props["sloc"] = m.SLOC
+	props["commentLines"] = m.CommentLines
+	props["blankLines"] = m.BlankLines
+	props["commentRatio"] = m.CommentRatio
+	props["cyclomatic"] = m.Cyclomatic
+	props["halsteadVolume"] = m.HalsteadVolume
+	props["halsteadDifficulty"] = m.HalsteadDifficulty
+	props["halsteadEffort"] = m.HalsteadEffort
+	props["maintainability"] = m.Maintainability
+	props["fanIn"] = m.FanIn
+	props["fanOut"] = m.FanOut
+	if m.AfferentCoupling > 0 || m.EfferentCoupling > 0 {
+		props["afferentCoupling"] = m.AfferentCoupling
+		props["efferentCoupling"] = m.EfferentCoupling
+		props["instability"] = m.Instability
+	}
+}
+
+// ComputeMetrics measures the files, functions and packages of a graph and
+// stores the metrics in the Properties of their nodes. Files are lexed
+// concurrently; files that cannot be read are reported and skipped.
+func (s *Service) ComputeMetrics(files []SourceFile, graph []GraphNode) (*MetricsReport, error) {
+	lexed, fileErrs, err := processFiles(context.Background(), files, s.Pipeline, true, func(file SourceFile, src []byte) (*lexedFile, error) {
+		return lexMetrics(normalizeGraphPath(file.Path), file.Language, src), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]*lexedFile, len(lexed))
+	for _, f := range lexed {
+		if f != nil {
+			byPath[f.path] = f
+		}
+	}
+
+	index := make(map[string]int, len(graph))
+	for i, node := range graph {
+		index[node.ID] = i
+	}
+	fanIn := make(map[string]map[string]bool)
+	for _, node := range graph {
+		for _, e := range node.Edges {
+			if e.Type == EdgeCalls || e.Type == EdgeImports {
+				if fanIn[e.Target] == nil {
+					fanIn[e.Target] = make(map[string]bool)
+				}
+				fanIn[e.Target][node.ID] = true
+			}
+		}
+	}
+	fanOut := func(node GraphNode, edgeType string) int {
+		targets := make(map[string]bool)
+		for _, e := range node.Edges {
+			if e.Type == edgeType && e.Target != node.ID {
+				targets[e.Target] = true
+			}
+		}
+		return len(targets)
+	}
+	store := func(i int, m CodeMetrics) NodeMetrics {
+		if graph[i].Properties == nil {
+			graph[i].Properties = make(map[string]interface{})
+		}
+		m.properties(graph[i].Properties)
+		return NodeMetrics{ID: graph[i].ID, Type: graph[i].Type, Name: graph[i].Name, Path: graph[i].Path, Metrics: m}
+	}
+
+	// Functions per file, to count their entry paths in file complexity
+	functionsIn := make(map[string]int)
+	for _, node := range graph {
+		if node.Type == NodeFunction || node.Type == NodeMethod {
+			functionsIn[normalizeGraphPath(node.Path)]++
+		}
+	}
+
+	report := &MetricsReport{Files: []NodeMetrics{}, Functions: []NodeMetrics{}, Packages: []NodeMetrics{}, Errors: fileErrs}
+	fileHalstead := make(map[string]*halstead)
+	fileMetrics := make(map[string]CodeMetrics)
+	for i, node := range graph {
+		p := normalizeGraphPath(node.Path)
+		f := byPath[p]
+		if f == nil {
+			continue
+		}
+		switch node.Type {
+		case NodeFile:
+			m, h := measure([]codeRange{{f, 1, f.lines}}, functionsIn[p])
+			m.FanIn = len(fanIn[node.ID])
+			m.FanOut = fanOut(node, EdgeImports)
+			fileHalstead[p], fileMetrics[p] = h, m
+			report.Files = append(report.Files, store(i, m))
+		case NodeFunction, NodeMethod:
+			if node.StartLine == 0 {
+				continue
+			}
+			m, _ := measure([]codeRange{{f, node.StartLine, node.EndLine}}, 1)
+			delete(fanIn[node.ID], node.ID) // recursion is not coupling
+			m.FanIn = len(fanIn[node.ID])
+			m.FanOut = fanOut(node, EdgeCalls)
+			report.Functions = append(report.Functions, store(i, m))
+		case NodeClass:
+			m, _ := measure([]codeRange{{f, node.StartLine, node.EndLine}}, 0)
+			store(i, m)
+		}
+	}
+
+	// Packages aggregate their files and are coupled through imports
+	for i, node := range graph {
+		if node.Type != NodePackage || node.Properties["external"] == true {
+			continue
+		}
+		var m CodeMetrics
+		h := newHalstead()
+		decisions, functions := 0, 0
+		for _, e := range node.Edges {
+			target, ok := index[e.Target]
+			if e.Type != EdgeContains || !ok || graph[target].Type != NodeFile {
+				continue
+			}
+			p := normalizeGraphPath(graph[target].Path)
+			fm, ok := fileMetrics[p]
+			if !ok {
+				continue
+			}
+			m.LOC += fm.LOC
+			m.SLOC += fm.SLOC
+			m.CommentLines += fm.CommentLines
+			m.BlankLines += fm.BlankLines
+			decisions += fm.Cyclomatic - max(functionsIn[p], 1)
+			functions += functionsIn[p]
+			h.merge(fileHalstead[p])
+		}
+		if m.LOC > 0 {
+			m.CommentRatio = float64(m.CommentLines) / float64(m.LOC)
+		}
+		m.Cyclomatic = decisions + max(functions, 1)
+		m.HalsteadVolume, m.HalsteadDifficulty, m.HalsteadEffort = h.measures()
+		m.Maintainability = maintainabilityIndex(m.HalsteadVolume, m.Cyclomatic, m.SLOC)
+
+		importers := make(map[string]bool)
+		for source := range fanIn[node.ID] {
+			if j, ok := index[source]; ok && graph[j].Type == NodePackage && source != node.ID {
+				importers[source] = true
+			}
+		}
+		m.AfferentCoupling = len(importers)
+		m.EfferentCoupling = fanOut(node, EdgeImports)
+		m.FanIn, m.FanOut = m.AfferentCoupling, m.EfferentCoupling
+		if total := m.AfferentCoupling + m.EfferentCoupling; total > 0 {
+			m.Instability = float64(m.EfferentCoupling) / float64(total)
+		}
+		report.Packages = append(report.Packages, store(i, m))
+	}
+
+	report.Summary = summarizeMetrics(report)
+	return report, nil
+}
+
+// summarizeMetrics totals the file and function metrics of a report
+func summarizeMetrics(report *MetricsReport) MetricsSummary {
+	summary := MetricsSummary{Files: len(report.Files), Functions: len(report.Functions)}
+	comments := 0
+	for _, f := range report.Files {
+		summary.LOC += f.Metrics.LOC
+		summary.SLOC += f.Metrics.SLOC
+		comments += f.Metrics.CommentLines
+		summary.AverageMaintainability += f.Metrics.Maintainability
+	}
+	if summary.LOC > 0 {
+		summary.CommentRatio = float64(comments) / float64(summary.LOC)
+	}
+	if summary.Files > 0 {
+		summary.AverageMaintainability /= float64(summary.Files)
+	}
+	for _, f := range report.Functions {
+		summary.AverageCyclomatic += float64(f.Metrics.Cyclomatic)
+		summary.MaxCyclomatic = max(summary.MaxCyclomatic, f.Metrics.Cyclomatic)
+	}
+	if summary.Functions > 0 {
+		summary.AverageCyclomatic /= float64(summary.Functions)
+	}
+	return summary
+}
+
+// RuleCyclomaticComplexity reports functions whose cyclomatic complexity
+// exceeds MaxCyclomaticComplexity
+const RuleCyclomaticComplexity = "cyclomatic-complexity"
+
+// MaxCyclomaticComplexity is the highest cyclomatic complexity a function
+// may have before it is reported
+const MaxCyclomaticComplexity = 15
+
+// complexityFindings reports the functions and methods of a file whose
+// cyclomatic complexity exceeds MaxCyclomaticComplexity
+func complexityFindings(file SourceFile, src []byte) []AnalysisResult {
+	type function struct {
+		name       string
+		start, end int
+		column     int
+	}
+	var functions []function
+	if file.Language == "Go" {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, file.Path, src, parser.SkipObjectResolution)
+		if err != nil {
+			return nil
+		}
+		for _, decl := range f.Decls {
+			d, ok := decl.(*ast.FuncDecl)
+			if !ok || d.Body == nil {
+				continue
+			}
+			name := d.Name.Name
+			if recv := receiverTypeName(d); recv != "" {
+				name = recv + "." + name
+			}
+			pos := fset.Position(d.Pos())
+			functions = append(functions, function{name, pos.Line, fset.Position(d.End()).Line, pos.Column})
+		}
+	} else {
+		sf, ok := extractSymbols(file, src)
+		if !ok {
+			return nil
+		}
+		for _, sym := range sf.Symbols {
+			if sym.Kind == NodeFunction || sym.Kind == NodeMethod {
+				functions = append(functions, function{sym.Qualified, sym.StartLine, sym.EndLine, 1})
+			}
+		}
+	}
+	if len(functions) == 0 {
+		return nil
+	}
+
+	lexed := lexMetrics(file.Path, file.Language, src)
+	var findings []AnalysisResult
+	for _, fn := range functions {
+		m, _ := measure([]codeRange{{lexed, fn.start, fn.end}}, 1)
+		if m.Cyclomatic <= MaxCyclomaticComplexity {
+			continue
+		}
+		findings = append(findings, AnalysisResult{
+			Rule:    RuleCyclomaticComplexity,
+			File:    file.Path,
+			Line:    fn.start,
+			Column:  fn.column,
+			Message: fmt.Sprintf("%s has a cyclomatic complexity of %d (maximum %d)", fn.name, m.Cyclomatic, MaxCyclomaticComplexity),
+			Level:   "warning",
+		})
+	}
+	return findings
+}
+
+// lexMetrics splits a file into the tokens and line kinds its metrics are
+// computed from
+func lexMetrics(path, language string, src []byte) *lexedFile {
+	lines := strings.Count(string(src), "\n") + 1
+	if len(src) > 0 && src[len(src)-1] == '\n' {
+		lines--
+	}
+	f := &lexedFile{path: path, lines: lines, code: make([]bool, lines+2), comment: make([]bool, lines+2)}
+	mark := func(kinds []bool, from, to int) {
+		for l := max(from, 1); l <= min(to, lines); l++ {
+			kinds[l] = true
+		}
+	}
+
+	if language == "Go" {
+		lexGoMetrics(f, src, mark)
+		return f
+	}
+	lexGenericMetrics(f, language, src, mark)
+	return f
+}
+
+// lexGoMetrics lexes Go source with the standard scanner
+func lexGoMetrics(f *lexedFile, src []byte, mark func([]bool, int, int)) {
+	fset := token.NewFileSet()
+	file := fset.AddFile(f.path, -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // inserted automatically
+		}
+		start := fset.Position(pos).Line
+		end := start + strings.Count(lit, "\n")
+		if tok == token.COMMENT {
+			mark(f.comment, start, end)
+			continue
+		}
+		mark(f.code, start, end)
+
+		switch {
+		case tok == token.IDENT || tok.IsLiteral():
+			f.tokens = append(f.tokens, metricsToken{text: lit, line: start, operand: true, literal: tok != token.IDENT})
+		default:
+			decision := tok == token.IF || tok == token.FOR || tok == token.CASE || tok == token.LAND || tok == token.LOR
+			f.tokens = append(f.tokens, metricsToken{text: tok.String(), line: start, decision: decision})
+		}
+	}
+}
+
+// Keywords and decision points of the languages lexed generically
+var (
+	clikeMetricsKeywords = setOf("abstract", "async", "await", "break", "case", "catch", "class", "const", "continue",
+		"default", "delete", "do", "else", "enum", "export", "extends", "final", "finally", "for", "from", "function",
+		"if", "implements", "import", "in", "instanceof", "interface", "let", "new", "of", "package", "private",
+		"protected", "public", "return", "static", "super", "switch", "this", "throw", "throws", "try", "typeof",
+		"var", "void", "while", "yield", "struct", "union", "typedef", "sizeof", "namespace", "template", "using")
+	clikeDecisions = setOf("if", "for", "while", "case", "catch", "&&", "||", "?", "??")
+
+	pythonMetricsKeywords = setOf("and", "as", "assert", "async", "await", "break", "case", "class", "continue",
+		"def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is",
+		"lambda", "match", "nonlocal", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield")
+	pythonDecisions = setOf("if", "elif", "for", "while", "except", "case", "and", "or")
+
+	// Longest first, so the longest operator matches
+	metricsOperators = []string{">>>=", "===", "!==", "**=", "...", "<<=", ">>=", "//=", "&&", "||", "??", "?.",
+		"==", "!=", "<=", ">=", "++", "--", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "->", "=>", "::",
+		"<<", ">>", "**", "//", ":="}
+)
+
+// setOf builds a set of strings
+func setOf(items ...string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
+
+// lexGenericMetrics lexes C-like and Python source. It knows comments,
+// strings and operators well enough to count lines and tokens.
+func lexGenericMetrics(f *lexedFile, language string, src []byte, mark func([]bool, int, int)) {
+	python := language == "Python"
+	keywords, decisions := clikeMetricsKeywords, clikeDecisions
+	if python {
+		keywords, decisions = pythonMetricsKeywords, pythonDecisions
+	}
+	emit := func(text string, line int, operand, literal bool) {
+		f.tokens = append(f.tokens, metricsToken{text: text, line: line, operand: operand, literal: literal, decision: decisions[text]})
+	}
+
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		rest := src[i:]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+
+		// Comments
+		case python && c == '#', !python && strings.HasPrefix(string(rest[:min(2, len(rest))]), "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			mark(f.comment, line, line)
+		case !python && strings.HasPrefix(string(rest[:min(2, len(rest))]), "/*"):
+			end := strings.Index(string(rest[2:]), "*/")
+			n := len(rest)
+			if end >= 0 {
+				n = end + 4
+			}
+			lines := strings.Count(string(rest[:n]), "\n")
+			mark(f.comment, line, line+lines)
+			line += lines
+			i += n
+
+		// Strings, including Python's triple-quoted ones
+		case c == '"' || c == '\'' || c == '`':
+			n := stringLiteralLength(rest, python)
+			lines := strings.Count(string(rest[:n]), "\n")
+			mark(f.code, line, line+lines)
+			emit(string(rest[:n]), line, true, true)
+			line += lines
+			i += n
+
+		case c >= '0' && c <= '9':
+			n := 1
+			for n < len(rest) && (isIdentByte(rest[n]) || rest[n] == '.') {
+				n++
+			}
+			mark(f.code, line, line)
+			emit(string(rest[:n]), line, true, true)
+			i += n
+
+		case isIdentStart(c):
+			n := 1
+			for n < len(rest) && isIdentByte(rest[n]) {
+				n++
+			}
+			// String prefixes such as f"..." belong to the literal
+			literal := false
+			if python && n <= 2 && n < len(rest) && (rest[n] == '"' || rest[n] == '\'') {
+				n += stringLiteralLength(rest[n:], true)
+				literal = true
+			}
+			text := string(rest[:n])
+			lines := strings.Count(text, "\n")
+			mark(f.code, line, line+lines)
+			emit(text, line, !keywords[text], literal)
+			line += lines
+			i += n
+
+		default:
+			n := 1
+			for _, op := range metricsOperators {
+				if strings.HasPrefix(string(rest[:min(len(op), len(rest))]), op) {
+					n = len(op)
+					break
+				}
+			}
+			mark(f.code, line, line)
+			emit(string(rest[:n]), line, false, false)
+			i += n
+		}
+	}
+}
+
+// stringLiteralLength returns the length of the string literal that src
+// starts with, up to the end of src when it is not terminated
+func stringLiteralLength(src []byte, python bool) int {
+	quote := src[0]
+	if python && len(src) >= 3 && src[1] == quote && src[2] == quote {
+		end := strings.Index(string(src[3:]), strings.Repeat(string(quote), 3))
+		if end < 0 {
+			return len(src)
+		}
+		return end + 6
+	}
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			if quote != '`' {
+				return i // unterminated
+			}
+		}
+	}
+	return len(src)
+}
+
+// MetricsHistoryFile stores the metrics summaries of earlier runs, relative
+// to the repository root
+const MetricsHistoryFile = ".codeanalyzer/metrics.json"
+
+// MetricsSnapshot is the metrics summary of a repository at one point in
+// time, a point of a trend chart
+type MetricsSnapshot struct {
+	Commit    string         `json:"commit,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Summary   MetricsSummary `json:"summary"`
+}
+
+// LoadMetricsHistory reads the recorded metrics snapshots, oldest first
+func (s *Service) LoadMetricsHistory(repoPath string) ([]MetricsSnapshot, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, MetricsHistoryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return []MetricsSnapshot{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics history: %w", err)
+	}
+
+	var history []MetricsSnapshot
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics history: %w", err)
+	}
+	return history, nil
+}
+
+// RecordMetrics adds a snapshot to the metrics history. A snapshot of a
+// commit replaces the one recorded for the same commit before.
+func (s *Service) RecordMetrics(repoPath string, snapshot MetricsSnapshot) ([]MetricsSnapshot, error) {
+	history, err := s.LoadMetricsHistory(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.CreatedAt.IsZero() {
+		snapshot.CreatedAt = time.Now()
+	}
+	if snapshot.Commit != "" {
+		kept := history[:0]
+		for _, old := range history {
+			if old.Commit != snapshot.Commit {
+				kept = append(kept, old)
+			}
+		}
+		history = kept
+	}
+	history = append(history, snapshot)
+	sort.SliceStable(history, func(i, j int) bool { return history[i].CreatedAt.Before(history[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metrics history: %w", err)
+	}
+	path := filepath.Join(repoPath, MetricsHistoryFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create metrics directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write metrics history: %w", err)
+	}
+	return history, nil
+}
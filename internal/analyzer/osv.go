@@ -0,0 +1,697 @@
+package analyzer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OSVEntry is a vulnerability in the OSV format
+type OSVEntry struct {
+	ID       string        `json:"id"`
+	Aliases  []string      `json:"aliases,omitempty"`
+	Summary  string        `json:"summary,omitempty"`
+	Details  string        `json:"details,omitempty"`
+	Affected []OSVAffected `json:"affected"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity,omitempty"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity,omitempty"`
+	} `json:"database_specific"`
+}
+
+// OSVAffected is a package affected by a vulnerability
+type OSVAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges            []OSVRange `json:"ranges,omitempty"`
+	Versions          []string   `json:"versions,omitempty"`
+	EcosystemSpecific struct {
+		Imports []struct {
+			Path    string   `json:"path"`
+			Symbols []string `json:"symbols,omitempty"`
+		} `json:"imports,omitempty"`
+	} `json:"ecosystem_specific"`
+}
+
+// OSVRange is a range of affected versions, given by the versions that
+// introduce and fix the vulnerability
+type OSVRange struct {
+	Type   string `json:"type"`
+	Events []struct {
+		Introduced   string `json:"introduced,omitempty"`
+		Fixed        string `json:"fixed,omitempty"`
+		LastAffected string `json:"last_affected,omitempty"`
+		Limit        string `json:"limit,omitempty"`
+	} `json:"events"`
+}
+
+// VulnerabilityDatabase is an OSV database loaded for offline matching
+type VulnerabilityDatabase struct {
+	Entries   []OSVEntry
+	byPackage map[string][]int // ecosystem and package name -> entries
+}
+
+// VulnerabilityOptions configures vulnerability matching
+type VulnerabilityOptions struct {
+	// IncludeUnreachable keeps Go matches whose vulnerable symbols the
+	// code never calls
+	IncludeUnreachable bool
+}
+
+// VulnerabilityMatch is a dependency version affected by an advisory
+type VulnerabilityMatch struct {
+	Advisory      string     `json:"advisory"`
+	Aliases       []string   `json:"aliases,omitempty"`
+	Summary       string     `json:"summary,omitempty"`
+	Severity      string     `json:"severity,omitempty"`
+	Dependency    Dependency `json:"dependency"`
+	FixedVersions []string   `json:"fixedVersions,omitempty"`
+	// Reachable tells whether the code calls the vulnerable symbols; it is
+	// only known for Go
+	Reachable  *bool    `json:"reachable,omitempty"`
+	Symbols    []string `json:"symbols,omitempty"`    // vulnerable symbols called
+	CalledFrom []string `json:"calledFrom,omitempty"` // graph nodes calling them
+}
+
+// LoadVulnerabilityDatabase loads the OSV entries of a directory or a zip
+// archive, as downloaded from the OSV bucket for an ecosystem. Each JSON
+// file holds one entry or a list of entries.
+func LoadVulnerabilityDatabase(p string) (*VulnerabilityDatabase, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vulnerability database: %w", err)
+	}
+
+	db := &VulnerabilityDatabase{byPackage: make(map[string][]int)}
+	add := func(name string, data []byte) error {
+		data = bytes.TrimSpace(data)
+		var entries []OSVEntry
+		if bytes.HasPrefix(data, []byte("[")) {
+			err = json.Unmarshal(data, &entries)
+		} else {
+			var entry OSVEntry
+			err = json.Unmarshal(data, &entry)
+			entries = append(entries, entry)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		for _, e := range entries {
+			if e.ID != "" {
+				db.Entries = append(db.Entries, e)
+			}
+		}
+		return nil
+	}
+
+	if !info.IsDir() {
+		if !strings.EqualFold(filepath.Ext(p), ".zip") {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read vulnerability database: %w", err)
+			}
+			if err := add(filepath.Base(p), data); err != nil {
+				return nil, err
+			}
+			return db.index(), nil
+		}
+		archive, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open vulnerability database: %w", err)
+		}
+		defer archive.Close()
+		for _, f := range archive.File {
+			if f.FileInfo().IsDir() || !strings.EqualFold(filepath.Ext(f.Name), ".json") {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			if err := add(f.Name, data); err != nil {
+				return nil, err
+			}
+		}
+		return db.index(), nil
+	}
+
+	err = filepath.WalkDir(p, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(file), ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		return add(file, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.index(), nil
+}
+
+// index orders the entries by ID and indexes them by affected package
+func (db *VulnerabilityDatabase) index() *VulnerabilityDatabase {
+	sort.SliceStable(db.Entries, func(i, j int) bool { return db.Entries[i].ID < db.Entries[j].ID })
+	for i, e := range db.Entries {
+		seen := make(map[string]bool)
+		for _, a := range e.Affected {
+			key := osvPackageKey(a.Package.Ecosystem, a.Package.Name)
+			if !seen[key] {
+				seen[key] = true
+				db.byPackage[key] = append(db.byPackage[key], i)
+			}
+		}
+	}
+	return db
+}
+
+// osvPackageKey identifies a package across the database and manifests.
+// Ecosystem suffixes such as "Debian:11" are dropped and Python names are
+// normalized.
+func osvPackageKey(ecosystem, name string) string {
+	ecosystem, _, _ = strings.Cut(ecosystem, ":")
+	if ecosystem == EcosystemPyPI {
+		name = normalizePythonName(name)
+	}
+	return ecosystem + "\x00" + name
+}
+
+// affects reports whether a version lies in the affected versions
+func (a OSVAffected) affects(version string) bool {
+	for _, v := range a.Versions {
+		if compareVersions(v, version) == 0 {
+			return true
+		}
+	}
+	for _, r := range a.Ranges {
+		if r.Type != "GIT" && r.affects(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// affects evaluates the range events in version order: each event at or
+// below the version opens or closes the affected range
+func (r OSVRange) affects(version string) bool {
+	type event struct {
+		version string
+		opens   bool
+		after   bool // the event takes effect above its version
+	}
+	var events []event
+	for _, e := range r.Events {
+		switch {
+		case e.Introduced != "":
+			events = append(events, event{version: e.Introduced, opens: true})
+		case e.Fixed != "":
+			events = append(events, event{version: e.Fixed})
+		case e.LastAffected != "":
+			events = append(events, event{version: e.LastAffected, after: true})
+		case e.Limit != "":
+			events = append(events, event{version: e.Limit})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return compareVersions(events[i].version, events[j].version) < 0 })
+
+	affected := false
+	for _, e := range events {
+		c := compareVersions(version, e.version)
+		if e.version == "0" {
+			c = 1 // introduced at the first version
+		}
+		if c > 0 || (c == 0 && !e.after) {
+			affected = e.opens
+		}
+	}
+	return affected
+}
+
+// fixedVersions returns the versions fixing an affected package
+func (a OSVAffected) fixedVersions() []string {
+	var fixed []string
+	for _, r := range a.Ranges {
+		for _, e := range r.Events {
+			if e.Fixed != "" && !containsString(fixed, e.Fixed) {
+				fixed = append(fixed, e.Fixed)
+			}
+		}
+	}
+	return fixed
+}
+
+// MatchVulnerabilities matches the resolved dependency versions against
+// the database. Go matches are checked for reachability: the vulnerable
+// symbols an advisory lists, or its packages when it lists none, must be
+// called or imported by code outside tests. Calls to methods of external
+// types are matched by method name in the files importing the package.
+// Unreachable Go matches are dropped unless opts.IncludeUnreachable is set.
+func (s *Service) MatchVulnerabilities(files []SourceFile, deps []Dependency, graph []GraphNode, db *VulnerabilityDatabase, opts VulnerabilityOptions) []VulnerabilityMatch {
+	var (
+		uses    *externalUses
+		matches []VulnerabilityMatch
+	)
+	for _, d := range deps {
+		if d.Version == "" {
+			continue // only a range is known
+		}
+		for _, i := range db.byPackage[osvPackageKey(d.Ecosystem, d.Name)] {
+			entry := db.Entries[i]
+			var affected []OSVAffected
+			for _, a := range entry.Affected {
+				if osvPackageKey(a.Package.Ecosystem, a.Package.Name) == osvPackageKey(d.Ecosystem, d.Name) && a.affects(d.Version) {
+					affected = append(affected, a)
+				}
+			}
+			if len(affected) == 0 {
+				continue
+			}
+
+			m := VulnerabilityMatch{
+				Advisory:   entry.ID,
+				Aliases:    entry.Aliases,
+				Summary:    entry.Summary,
+				Severity:   entry.DatabaseSpecific.Severity,
+				Dependency: d,
+			}
+			for _, a := range affected {
+				for _, v := range a.fixedVersions() {
+					if !containsString(m.FixedVersions, v) {
+						m.FixedVersions = append(m.FixedVersions, v)
+					}
+				}
+			}
+			sort.Slice(m.FixedVersions, func(i, j int) bool { return compareVersions(m.FixedVersions[i], m.FixedVersions[j]) < 0 })
+			if m.Severity == "" && len(entry.Severity) > 0 {
+				m.Severity = entry.Severity[0].Score
+			}
+
+			if d.Ecosystem == EcosystemGo {
+				if uses == nil {
+					uses = findExternalUses(files, graph)
+				}
+				reachable := uses.reach(d.Name, affected, &m)
+				m.Reachable = &reachable
+				if !reachable && !opts.IncludeUnreachable {
+					continue
+				}
+			}
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// externalUses records where Go code outside tests uses external packages
+type externalUses struct {
+	imported map[string]bool                // import paths
+	calls    map[string]map[string][]string // import path -> symbol -> calling graph nodes
+	methods  map[string]map[string][]string // import path -> Type.Method -> calling graph nodes
+	members  map[string]map[string][]string // import path -> method called on a value of unknown type from the package -> calling graph nodes
+}
+
+// valueOrigin is the syntax declaring the type, or giving the value, of a
+// variable or field
+type valueOrigin struct {
+	expr    ast.Expr
+	isType  bool
+	info    *types.Info
+	imports map[string]string // local name -> path of the external imports of the declaring file
+}
+
+// maxOriginSteps bounds how far a value is followed through variables
+const maxOriginSteps = 16
+
+// findExternalUses collects the uses of external packages. The code graph
+// has no nodes for external symbols, so calls are read from the syntax
+// and attributed to the graph nodes enclosing them. External packages are
+// not type-checked, so the receiver of a method call is found by following
+// the variable or field through the type information to its declaration.
+func findExternalUses(files []SourceFile, graph []GraphNode) *externalUses {
+	uses := &externalUses{
+		imported: make(map[string]bool),
+		calls:    make(map[string]map[string][]string),
+		methods:  make(map[string]map[string][]string),
+		members:  make(map[string]map[string][]string),
+	}
+	nodes := make(map[string]bool, len(graph))
+	for _, node := range graph {
+		nodes[node.ID] = true
+	}
+	record := func(m map[string]map[string][]string, importPath, symbol, caller string) {
+		if m[importPath] == nil {
+			m[importPath] = make(map[string][]string)
+		}
+		if !nodes[caller] {
+			caller = ""
+		}
+		if !containsString(m[importPath][symbol], caller) {
+			m[importPath][symbol] = append(m[importPath][symbol], caller)
+		}
+	}
+
+	prog := loadGoProgram(files)
+	origins := goValueOrigins(prog)
+	for _, pkg := range prog.Packages {
+		for _, file := range pkg.Files {
+			if strings.HasSuffix(file.Path, "_test.go") {
+				continue
+			}
+			imports := externalImports(prog, file.AST)
+			if len(imports) == 0 {
+				continue
+			}
+			for _, importPath := range imports {
+				uses.imported[importPath] = true
+			}
+
+			for _, decl := range file.AST.Decls {
+				caller := fileNodeID(normalizeGraphPath(file.Path))
+				if fd, ok := decl.(*ast.FuncDecl); ok {
+					if obj := pkg.Info.Defs[fd.Name]; obj != nil {
+						caller = objectNodeID(obj)
+					}
+				}
+				ast.Inspect(decl, func(n ast.Node) bool {
+					sel, ok := n.(*ast.SelectorExpr)
+					if !ok {
+						return true
+					}
+					site := valueOrigin{expr: sel.X, info: pkg.Info, imports: imports}
+					if importPath, ok := site.packageSelector(sel); ok {
+						record(uses.calls, importPath, sel.Sel.Name, caller)
+						return true
+					}
+					importPath, typeName, ok := origins.resolve(site)
+					switch {
+					case !ok:
+					case typeName != "":
+						record(uses.methods, importPath, typeName+"."+sel.Sel.Name, caller)
+					default:
+						record(uses.members, importPath, sel.Sel.Name, caller)
+					}
+					return true
+				})
+			}
+		}
+	}
+	return uses
+}
+
+// externalImports returns the local names and paths of the packages a file
+// imports from outside the repository
+func externalImports(prog *goProgram, f *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range f.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		if prog.isLocal(importPath) {
+			continue
+		}
+		name := importName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = importPath
+	}
+	return imports
+}
+
+// packageSelector returns the import path of an external package
+// qualifying a selector, as in pkg.Name
+func (o valueOrigin) packageSelector(sel *ast.SelectorExpr) (string, bool) {
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return "", false
+	}
+	importPath, ok := o.imports[x.Name]
+	if !ok {
+		return "", false
+	}
+	if _, isPkg := o.info.Uses[x].(*types.PkgName); isPkg || o.info.Uses[x] == nil {
+		return importPath, true
+	}
+	return "", false
+}
+
+// goOrigins maps the variables and fields of a program to their origin
+type goOrigins map[types.Object]valueOrigin
+
+// goValueOrigins finds the declared type or the first assigned value of
+// every variable, parameter and field of the program
+func goValueOrigins(prog *goProgram) goOrigins {
+	origins := make(goOrigins)
+	for _, pkg := range prog.Packages {
+		for _, file := range pkg.Files {
+			imports := externalImports(prog, file.AST)
+			add := func(id *ast.Ident, expr ast.Expr, isType bool) {
+				obj := pkg.Info.Defs[id]
+				if obj == nil {
+					obj = pkg.Info.Uses[id]
+				}
+				if _, seen := origins[obj]; obj == nil || seen {
+					return
+				}
+				origins[obj] = valueOrigin{expr: expr, isType: isType, info: pkg.Info, imports: imports}
+			}
+			assign := func(names []ast.Expr, values []ast.Expr) {
+				for i, name := range names {
+					id, ok := name.(*ast.Ident)
+					switch {
+					case !ok:
+					case len(values) == len(names):
+						add(id, values[i], false)
+					case len(values) == 1 && i == 0:
+						add(id, values[0], false) // the first result of a call
+					}
+				}
+			}
+			ast.Inspect(file.AST, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.Field:
+					for _, name := range n.Names {
+						add(name, n.Type, true)
+					}
+				case *ast.ValueSpec:
+					if n.Type != nil {
+						for _, name := range n.Names {
+							add(name, n.Type, true)
+						}
+						break
+					}
+					names := make([]ast.Expr, len(n.Names))
+					for i, name := range n.Names {
+						names[i] = name
+					}
+					assign(names, n.Values)
+				case *ast.AssignStmt:
+					assign(n.Lhs, n.Rhs)
+				case *ast.RangeStmt:
+					if id, ok := n.Value.(*ast.Ident); ok {
+						add(id, n.X, false)
+					}
+				}
+				return true
+			})
+		}
+	}
+	return origins
+}
+
+// resolve returns the external package a value comes from, and the name of
+// its type when declared, following variables and fields to their origin
+func (origins goOrigins) resolve(o valueOrigin) (importPath, typeName string, ok bool) {
+	for step := 0; step < maxOriginSteps; step++ {
+		switch e := o.expr.(type) {
+		case *ast.ParenExpr:
+			o.expr = e.X
+		case *ast.StarExpr:
+			o.expr = e.X
+		case *ast.UnaryExpr:
+			o.expr = e.X
+		case *ast.IndexExpr:
+			o.expr = e.X // an instantiated type, or an element of a slice or map
+		case *ast.ArrayType:
+			o.expr = e.Elt
+		case *ast.MapType:
+			o.expr = e.Value
+		case *ast.CompositeLit:
+			o.expr, o.isType = e.Type, true
+		case *ast.CallExpr:
+			sel, isSel := e.Fun.(*ast.SelectorExpr)
+			if o.isType || !isSel {
+				return "", "", false
+			}
+			importPath, ok := o.packageSelector(sel)
+			return importPath, "", ok // the result of a function of the package
+		case *ast.SelectorExpr:
+			if importPath, ok := o.packageSelector(e); ok {
+				if o.isType {
+					return importPath, e.Sel.Name, true
+				}
+				return importPath, "", true
+			}
+			sel := o.info.Selections[e]
+			if o.isType || sel == nil || sel.Kind() != types.FieldVal {
+				return "", "", false
+			}
+			if o, ok = origins[sel.Obj()]; !ok {
+				return "", "", false
+			}
+		case *ast.Ident:
+			if o.isType {
+				return "", "", false
+			}
+			if o, ok = origins[o.info.Uses[e]]; !ok {
+				return "", "", false
+			}
+		default:
+			return "", "", false
+		}
+	}
+	return "", "", false
+}
+
+// reach reports whether the code reaches the vulnerable symbols of a
+// module, recording the symbols and callers in m
+func (u *externalUses) reach(module string, affected []OSVAffected, m *VulnerabilityMatch) bool {
+	inModule := func(p string) bool { return p == module || strings.HasPrefix(p, module+"/") }
+	reachable := false
+	listed := false
+	for _, a := range affected {
+		for _, imp := range a.EcosystemSpecific.Imports {
+			listed = true
+			if !u.imported[imp.Path] {
+				continue
+			}
+			if len(imp.Symbols) == 0 {
+				reachable = true
+				continue
+			}
+			for _, sym := range imp.Symbols {
+				var callers []string
+				if _, method, ok := strings.Cut(sym, "."); ok {
+					callers = append(append(callers, u.methods[imp.Path][sym]...), u.members[imp.Path][method]...)
+				} else {
+					callers = u.calls[imp.Path][sym]
+				}
+				if len(callers) == 0 {
+					continue
+				}
+				reachable = true
+				m.Symbols = append(m.Symbols, imp.Path+"."+sym)
+				for _, c := range callers {
+					if c != "" && !containsString(m.CalledFrom, c) {
+						m.CalledFrom = append(m.CalledFrom, c)
+					}
+				}
+			}
+		}
+	}
+	if !listed {
+		// Without import details any package of the module counts
+		for p := range u.imported {
+			if inModule(p) {
+				return true
+			}
+		}
+	}
+	sort.Strings(m.CalledFrom)
+	return reachable
+}
+
+// importName returns the default name of an imported package, skipping
+// major version suffixes such as math/rand/v2
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if len(name) > 1 && name[0] == 'v' && strings.Contains(importPath, "/") {
+		if _, err := strconv.Atoi(name[1:]); err == nil {
+			name = path.Base(path.Dir(importPath))
+		}
+	}
+	return name
+}
+
+// VulnerabilityFindings reports the matches at the dependency's line in
+// its manifest, with the advisory ID as the rule
+func (s *Service) VulnerabilityFindings(repoPath string, matches []VulnerabilityMatch) []AnalysisResult {
+	lines := make(map[string][]string)
+	var findings []AnalysisResult
+	for _, m := range matches {
+		manifest := m.Dependency.Manifest
+		if _, ok := lines[manifest]; !ok {
+			data, _ := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(manifest)))
+			lines[manifest] = strings.Split(string(data), "\n")
+		}
+		line := dependencyLine(lines[manifest], m.Dependency)
+
+		msg := fmt.Sprintf("%s %s is affected by %s", m.Dependency.Name, m.Dependency.Version, m.Advisory)
+		if len(m.Aliases) > 0 {
+			msg += " (" + strings.Join(m.Aliases, ", ") + ")"
+		}
+		if m.Summary != "" {
+			msg += ": " + m.Summary
+		}
+		if len(m.FixedVersions) > 0 {
+			msg += "; fixed in " + strings.Join(m.FixedVersions, ", ")
+		} else {
+			msg += "; no fixed version"
+		}
+		if len(m.Symbols) > 0 {
+			msg += "; called: " + strings.Join(m.Symbols, ", ")
+		}
+		level := "error"
+		if m.Reachable != nil && !*m.Reachable {
+			level = "info"
+		}
+		findings = append(findings, AnalysisResult{
+			Rule:    m.Advisory,
+			File:    manifest,
+			Line:    line,
+			Column:  1,
+			Message: msg,
+			Level:   level,
+		})
+	}
+	return findings
+}
+
+// dependencyLine returns the line of a manifest declaring a dependency,
+// or 1 when it cannot be found
+func dependencyLine(lines []string, dep Dependency) int {
+	name := dep.Name
+	if dep.Ecosystem == EcosystemMaven {
+		_, name, _ = strings.Cut(name, ":") // the artifact ID
+	}
+	for i, l := range lines {
+		if strings.Contains(strings.ToLower(l), strings.ToLower(name)) {
+			return i + 1
+		}
+	}
+	return 1
+}
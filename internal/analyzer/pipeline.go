@@ -0,0 +1,263 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Pipeline defaults
+const (
+	defaultQueuePerWorker = 2
+	defaultMaxBytes       = 64 << 20
+)
+
+// PipelineOptions configures how files are processed concurrently
+type PipelineOptions struct {
+	Workers   int   // concurrent workers, GOMAXPROCS when 0
+	QueueSize int   // files queued ahead of the workers, twice the workers when 0
+	MaxBytes  int64 // file contents held in memory at once, 64 MiB when 0
+}
+
+// withDefaults fills in unset options
+func (o PipelineOptions) withDefaults() PipelineOptions {
+	if o.Workers <= 0 {
+		o.Workers = runtime.GOMAXPROCS(0)
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultQueuePerWorker * o.Workers
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = defaultMaxBytes
+	}
+	return o
+}
+
+// FileError is a failure to process one file, which does not abort the run
+type FileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// byteBudget bounds the bytes of file content held at once. A file larger
+// than the whole budget waits until it can hold the budget alone.
+type byteBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+// newByteBudget creates a budget of limit bytes
+func newByteBudget(limit int64) *byteBudget {
+	b := &byteBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire reserves n bytes, waiting for other files to be released
+func (b *byteBudget) acquire(ctx context.Context, n int64) error {
+	n = min(n, b.limit)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used+n > b.limit && ctx.Err() == nil {
+		b.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.used += n
+	return nil
+}
+
+// release returns n bytes to the budget
+func (b *byteBudget) release(n int64) {
+	n = min(n, b.limit)
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// wake wakes waiting workers, e.g. when the run is cancelled
+func (b *byteBudget) wake() {
+	b.mu.Lock()
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// processFiles runs fn over files on a bounded pool of workers. Files are
+// queued with back-pressure; with read set, workers load each file's
+// content within the byte budget and drop it once fn returns. Results keep
+// the order of files. Errors and panics are reported per file, while a
+// cancelled context aborts the run.
+func processFiles[T any](ctx context.Context, files []SourceFile, opts PipelineOptions, read bool, fn func(SourceFile, []byte) (T, error)) ([]T, []FileError, error) {
+	opts = opts.withDefaults()
+	results := make([]T, len(files))
+	errs := make([]error, len(files))
+	budget := newByteBudget(opts.MaxBytes)
+	defer context.AfterFunc(ctx, budget.wake)()
+
+	jobs := make(chan int, opts.QueueSize)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				results[i], errs[i] = processFile(ctx, files[i], budget, read, fn)
+			}
+		}()
+	}
+
+feed:
+	for i := range files {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var fileErrs []FileError
+	for i, err := range errs {
+		if err != nil {
+			fileErrs = append(fileErrs, FileError{Path: files[i].Path, Error: err.Error()})
+		}
+	}
+	return results, fileErrs, nil
+}
+
+// processFile reads a file within the budget and runs fn on it
+func processFile[T any](ctx context.Context, file SourceFile, budget *byteBudget, read bool, fn func(SourceFile, []byte) (T, error)) (result T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing file: %v", r)
+		}
+	}()
+	if !read {
+		return fn(file, nil)
+	}
+
+	size := int64(len(file.Content))
+	if file.Content == "" && file.AbsPath != "" {
+		info, err := os.Stat(file.AbsPath)
+		if err != nil {
+			return result, fmt.Errorf("failed to read file: %w", err)
+		}
+		size = info.Size()
+	}
+	if err := budget.acquire(ctx, size); err != nil {
+		return result, err
+	}
+	defer budget.release(size)
+
+	src, err := readSource(file)
+	if err != nil {
+		return result, fmt.Errorf("failed to read file: %w", err)
+	}
+	return fn(file, src)
+}
+
+// walkSourceFiles lists the source files under root, reading directories
+// concurrently. Hidden directories are skipped, and directories that cannot
+// be read are reported without aborting the walk. Files are returned in
+// the lexical order of filepath.Walk.
+func walkSourceFiles(ctx context.Context, root string, opts PipelineOptions) ([]SourceFile, []FileError, error) {
+	opts = opts.withDefaults()
+	if _, err := os.ReadDir(root); err != nil {
+		return nil, nil, fmt.Errorf("failed to index source files: %w", err)
+	}
+
+	var (
+		mu       sync.Mutex
+		files    []SourceFile
+		fileErrs []FileError
+		wg       sync.WaitGroup
+	)
+	sem := make(chan struct{}, opts.Workers)
+
+	var visit func(dir string)
+	visit = func(dir string) {
+		defer wg.Done()
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		entries, err := os.ReadDir(dir)
+		<-sem
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			rel, _ := filepath.Rel(root, dir)
+			fileErrs = append(fileErrs, FileError{Path: rel, Error: err.Error()})
+			return
+		}
+		for _, e := range entries {
+			path := filepath.Join(dir, e.Name())
+			if e.IsDir() {
+				// Skip .git and other hidden directories
+				if !strings.HasPrefix(e.Name(), ".") {
+					wg.Add(1)
+					go visit(path)
+				}
+				continue
+			}
+
+			language := languageOf(path)
+			if language == "" {
+				// Skip non-source files
+				continue
+			}
+			relPath, err := filepath.Rel(root, path)
+			if err != nil {
+				fileErrs = append(fileErrs, FileError{Path: path, Error: err.Error()})
+				continue
+			}
+			files = append(files, SourceFile{
+				Path:     relPath,
+				Language: language,
+				AbsPath:  path,
+			})
+		}
+	}
+
+	wg.Add(1)
+	go visit(root)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return walkOrderLess(files[i].Path, files[j].Path) })
+	sort.Slice(fileErrs, func(i, j int) bool { return walkOrderLess(fileErrs[i].Path, fileErrs[j].Path) })
+	return files, fileErrs, nil
+}
+
+// walkOrderLess orders paths as filepath.Walk visits them, comparing
+// element by element so a directory's files follow the directory
+func walkOrderLess(a, b string) bool {
+	as := strings.Split(a, string(filepath.Separator))
+	bs := strings.Split(b, string(filepath.Separator))
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
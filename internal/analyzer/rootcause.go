@@ -0,0 +1,497 @@
+package analyzer
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RulesDir holds repository-specific root-cause rules, relative to the
+// repository root
+const RulesDir = ".codeanalyzer/rules"
+
+//go:embed rules/rootcause.yaml
+var defaultRootCauseRules []byte
+
+// Confidence factors for root-cause diagnoses
+const (
+	defaultRuleConfidence = 0.5
+	unrelatedErrorFactor  = 0.6  // the matching error does not map to the suspect
+	missingCodeFactor     = 0.75 // the rule checks the code but found no evidence
+	maxEvidence           = 5    // evidence snippets kept per kind
+)
+
+// RootCauseRule is an error signature of the root-cause catalogue
+type RootCauseRule struct {
+	ID           string   `json:"id" yaml:"id"`
+	Name         string   `json:"name" yaml:"name"`
+	Languages    []string `json:"languages,omitempty" yaml:"languages"`
+	Errors       []string `json:"errors,omitempty" yaml:"errors"` // patterns matched against error messages
+	Code         []string `json:"code,omitempty" yaml:"code"`     // patterns matched against the suspect's lines
+	AST          []string `json:"ast,omitempty" yaml:"ast"`       // named checks on the suspect's Go syntax
+	Cause        string   `json:"cause" yaml:"cause"`
+	Confidence   float64  `json:"confidence" yaml:"confidence"`
+	Remediations []string `json:"remediations,omitempty" yaml:"remediations"`
+	Fixes        []string `json:"fixes,omitempty" yaml:"fixes"` // automated fixes, see SuggestFixes
+	Disabled     bool     `json:"disabled,omitempty" yaml:"disabled"`
+
+	errorPatterns []*regexp.Regexp
+	codePatterns  []*regexp.Regexp
+}
+
+// RuleCatalog is an ordered set of root-cause rules
+type RuleCatalog struct {
+	Rules []RootCauseRule `json:"rules" yaml:"rules"`
+}
+
+// Evidence is an error message or source line supporting a diagnosis
+type Evidence struct {
+	Kind    string `json:"kind"` // "error", "code", "commit" or "duplicate"
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Snippet string `json:"snippet"`
+}
+
+// Diagnosis is a root cause matched for a suspect node
+type Diagnosis struct {
+	NodeID       string      `json:"nodeId"`
+	RuleID       string      `json:"ruleId"`
+	Name         string      `json:"name"`
+	Cause        string      `json:"cause"`
+	Confidence   float64     `json:"confidence"`
+	Evidence     []Evidence  `json:"evidence"`
+	Remediations []string    `json:"remediations"`
+	Fixes        []string    `json:"fixes,omitempty"`
+	Regression   *Regression `json:"regression,omitempty"` // commit that introduced the failure, see AttachRegression
+	Duplicates   []string    `json:"duplicates,omitempty"` // copies of the node's code, see AddDuplicateEdges
+}
+
+// DiagnoseOptions configures root-cause diagnosis
+type DiagnoseOptions struct {
+	RepoPath      string       // repository root, used to read the suspect code
+	Logs          []ErrorLog   // errors being diagnosed
+	Catalog       *RuleCatalog // rules to apply, the default catalogue if nil
+	MinConfidence float64      // diagnoses below this confidence are dropped
+}
+
+// DefaultRuleCatalog returns the built-in root-cause catalogue
+func DefaultRuleCatalog() (*RuleCatalog, error) {
+	return ParseRuleCatalog(defaultRootCauseRules, "yaml")
+}
+
+// ParseRuleCatalog parses and validates a catalogue in "yaml" or "json" format
+func ParseRuleCatalog(data []byte, format string) (*RuleCatalog, error) {
+	var catalog RuleCatalog
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&catalog); err != nil {
+			return nil, fmt.Errorf("failed to parse rules: %w", err)
+		}
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&catalog); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse rules: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported rule format: %s", format)
+	}
+
+	if err := catalog.compile(); err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+// compile validates the rules and compiles their patterns
+func (c *RuleCatalog) compile() error {
+	seen := make(map[string]bool)
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.ID == "" {
+			return fmt.Errorf("rule %d has no id", i+1)
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("duplicate rule id: %s", r.ID)
+		}
+		seen[r.ID] = true
+		if r.Disabled {
+			// An override that only turns a rule off needs nothing else
+			continue
+		}
+
+		if len(r.Errors)+len(r.Code)+len(r.AST) == 0 {
+			return fmt.Errorf("rule %s has no error, code or ast patterns", r.ID)
+		}
+		if r.Cause == "" {
+			return fmt.Errorf("rule %s has no cause", r.ID)
+		}
+		if r.Confidence == 0 {
+			r.Confidence = defaultRuleConfidence
+		}
+		if r.Confidence < 0 || r.Confidence > 1 {
+			return fmt.Errorf("rule %s has confidence %v outside [0, 1]", r.ID, r.Confidence)
+		}
+		for _, check := range r.AST {
+			if _, ok := goASTChecks[check]; !ok {
+				return fmt.Errorf("rule %s uses unknown ast check: %s", r.ID, check)
+			}
+		}
+		for _, fix := range r.Fixes {
+			if _, ok := goFixers[fix]; !ok {
+				return fmt.Errorf("rule %s uses unknown fix: %s", r.ID, fix)
+			}
+		}
+
+		var err error
+		if r.errorPatterns, err = compilePatterns(r.Errors); err != nil {
+			return fmt.Errorf("invalid error pattern in rule %s: %w", r.ID, err)
+		}
+		if r.codePatterns, err = compilePatterns(r.Code); err != nil {
+			return fmt.Errorf("invalid code pattern in rule %s: %w", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// compilePatterns compiles a list of regular expressions
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		compiled[i] = re
+	}
+	return compiled, nil
+}
+
+// Merge adds the rules of other to the catalogue; rules with an existing id
+// replace the earlier definition
+func (c *RuleCatalog) Merge(other *RuleCatalog) {
+	index := make(map[string]int, len(c.Rules))
+	for i, r := range c.Rules {
+		index[r.ID] = i
+	}
+	for _, r := range other.Rules {
+		if i, ok := index[r.ID]; ok {
+			c.Rules[i] = r
+			continue
+		}
+		index[r.ID] = len(c.Rules)
+		c.Rules = append(c.Rules, r)
+	}
+}
+
+// LoadRuleCatalog returns the default catalogue extended with the YAML and
+// JSON rule files of a repository, applied in file name order
+func (s *Service) LoadRuleCatalog(repoPath string) (*RuleCatalog, error) {
+	catalog, err := DefaultRuleCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(repoPath, RulesDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return catalog, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules directory: %w", err)
+	}
+
+	// os.ReadDir sorts entries by name
+	for _, entry := range entries {
+		format := ""
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml":
+			format = "yaml"
+		case ".json":
+			format = "json"
+		}
+		if entry.IsDir() || format == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rules file: %w", err)
+		}
+		rules, err := ParseRuleCatalog(data, format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", entry.Name(), err)
+		}
+		catalog.Merge(rules)
+	}
+	return catalog, nil
+}
+
+// appliesTo reports whether the rule covers files of a language
+func (r *RootCauseRule) appliesTo(language string) bool {
+	if len(r.Languages) == 0 {
+		return true
+	}
+	for _, l := range r.Languages {
+		if strings.EqualFold(l, language) {
+			return true
+		}
+	}
+	return false
+}
+
+// DiagnoseRootCauseWithOptions matches the catalogue against the errors and
+// the code of each suspect. Every matching rule yields a diagnosis; the
+// diagnoses of a suspect are ordered by confidence.
+func (s *Service) DiagnoseRootCauseWithOptions(suspectNodeIDs []string, graph []GraphNode, opts DiagnoseOptions) ([]Diagnosis, error) {
+	catalog := opts.Catalog
+	if catalog == nil {
+		var err error
+		if catalog, err = DefaultRuleCatalog(); err != nil {
+			return nil, err
+		}
+	}
+
+	nodes := make(map[string]GraphNode, len(graph))
+	for _, node := range graph {
+		nodes[node.ID] = node
+	}
+
+	// Errors whose location or stack maps onto each node
+	related := make(map[string]map[int]bool)
+	for _, m := range s.MapErrorsToGraphDetailed(opts.Logs, graph).Mappings {
+		if related[m.NodeID] == nil {
+			related[m.NodeID] = make(map[int]bool)
+		}
+		related[m.NodeID][m.ErrorIndex] = true
+	}
+
+	diagnoses := []Diagnosis{}
+	for _, id := range suspectNodeIDs {
+		node, ok := nodes[id]
+		if !ok {
+			continue
+		}
+		code := loadSuspectCode(opts.RepoPath, node)
+		language := languageOf(node.Path)
+
+		var matched []Diagnosis
+		for i := range catalog.Rules {
+			rule := &catalog.Rules[i]
+			if rule.Disabled || !rule.appliesTo(language) {
+				continue
+			}
+			d, ok := rule.diagnose(node, opts.Logs, related[id], code)
+			if ok && d.Confidence >= opts.MinConfidence {
+				matched = append(matched, d)
+			}
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].Confidence > matched[j].Confidence
+		})
+		diagnoses = append(diagnoses, matched...)
+	}
+	flagDuplicates(diagnoses, nodes)
+	return diagnoses, nil
+}
+
+// diagnose matches one rule against a suspect
+func (r *RootCauseRule) diagnose(node GraphNode, logs []ErrorLog, related map[int]bool, code *suspectCode) (Diagnosis, bool) {
+	d := Diagnosis{
+		NodeID:       node.ID,
+		RuleID:       r.ID,
+		Name:         r.Name,
+		Confidence:   r.Confidence,
+		Evidence:     []Evidence{},
+		Remediations: r.Remediations,
+		Fixes:        r.Fixes,
+	}
+	if d.Remediations == nil {
+		d.Remediations = []string{}
+	}
+
+	match := ""
+	if len(r.errorPatterns) > 0 {
+		evidence, m, isRelated := r.matchErrors(logs, related)
+		if len(evidence) == 0 {
+			return Diagnosis{}, false
+		}
+		if !isRelated {
+			d.Confidence *= unrelatedErrorFactor
+		}
+		d.Evidence = append(d.Evidence, evidence...)
+		match = m
+	}
+
+	if len(r.codePatterns)+len(r.AST) > 0 {
+		evidence := r.matchCode(code)
+		if len(evidence) == 0 {
+			// Code-only rules need code evidence; error rules are just less certain
+			if len(r.errorPatterns) == 0 {
+				return Diagnosis{}, false
+			}
+			d.Confidence *= missingCodeFactor
+		}
+		d.Evidence = append(d.Evidence, evidence...)
+	}
+
+	if match == "" {
+		match = r.Name
+	}
+	d.Cause = strings.NewReplacer("{name}", node.Name, "{path}", node.Path, "{match}", match).Replace(r.Cause)
+	return d, true
+}
+
+// matchErrors finds the errors, including chained causes, matching the
+// rule's error patterns. Errors related to the suspect are preferred.
+func (r *RootCauseRule) matchErrors(logs []ErrorLog, related map[int]bool) ([]Evidence, string, bool) {
+	var (
+		evidence  []Evidence
+		match     string
+		isRelated bool
+	)
+	for pass := 0; pass < 2; pass++ {
+		for i := range logs {
+			// Related errors first, then the rest
+			if related[i] != (pass == 0) {
+				continue
+			}
+			for l := &logs[i]; l != nil; l = l.Cause {
+				m := ""
+				for _, re := range r.errorPatterns {
+					if m = re.FindString(l.Message); m != "" {
+						break
+					}
+				}
+				if m == "" {
+					continue
+				}
+				if match == "" {
+					match, isRelated = m, pass == 0
+				}
+				if len(evidence) < maxEvidence {
+					evidence = append(evidence, Evidence{Kind: "error", File: l.File, Line: l.Line, Snippet: l.Message})
+				}
+			}
+		}
+	}
+	return evidence, match, isRelated
+}
+
+// matchCode finds the suspect lines matching the rule's code patterns and
+// AST checks
+func (r *RootCauseRule) matchCode(code *suspectCode) []Evidence {
+	if code == nil {
+		return nil
+	}
+
+	lines := make(map[int]bool)
+	for i, line := range code.lines {
+		for _, re := range r.codePatterns {
+			if re.MatchString(line) {
+				lines[code.start+i] = true
+				break
+			}
+		}
+	}
+	if code.decl != nil {
+		for _, check := range r.AST {
+			for _, pos := range goASTChecks[check](code.decl) {
+				lines[code.fset.Position(pos).Line] = true
+			}
+		}
+	}
+
+	ordered := make([]int, 0, len(lines))
+	for l := range lines {
+		ordered = append(ordered, l)
+	}
+	sort.Ints(ordered)
+	if len(ordered) > maxEvidence {
+		ordered = ordered[:maxEvidence]
+	}
+
+	evidence := make([]Evidence, len(ordered))
+	for i, l := range ordered {
+		evidence[i] = Evidence{Kind: "code", File: code.path, Line: l, Snippet: strings.TrimSpace(code.line(l))}
+	}
+	return evidence
+}
+
+// suspectCode is the source of a suspect node
+type suspectCode struct {
+	path  string
+	lines []string // lines start..end of the node
+	start int
+	fset  *token.FileSet
+	decl  ast.Decl // enclosing Go declaration, nil for other languages
+}
+
+// line returns a line of the node by its line number in the file
+func (c *suspectCode) line(n int) string {
+	if n < c.start || n >= c.start+len(c.lines) {
+		return ""
+	}
+	return c.lines[n-c.start]
+}
+
+// loadSuspectCode reads the source lines of a node, and parses its
+// declaration for Go files. It returns nil when the code is unavailable.
+func loadSuspectCode(repoPath string, node GraphNode) *suspectCode {
+	if repoPath == "" || node.Path == "" || node.StartLine <= 0 {
+		return nil
+	}
+	src, err := os.ReadFile(filepath.Join(repoPath, filepath.FromSlash(node.Path)))
+	if err != nil {
+		return nil
+	}
+
+	all := strings.Split(string(src), "\n")
+	end := node.EndLine
+	if end < node.StartLine || end > len(all) {
+		end = len(all)
+	}
+	if node.StartLine > end {
+		return nil
+	}
+	code := &suspectCode{
+		path:  node.Path,
+		lines: all[node.StartLine-1 : end],
+		start: node.StartLine,
+		fset:  token.NewFileSet(),
+	}
+
+	if languageOf(node.Path) == "Go" {
+		// Syntax errors still leave the declarations that parsed
+		f, _ := parser.ParseFile(code.fset, node.Path, src, parser.SkipObjectResolution)
+		if f != nil {
+			code.decl = enclosingDecl(code.fset, f, node.StartLine)
+		}
+	}
+	return code
+}
+
+// enclosingDecl returns the top-level declaration containing line
+func enclosingDecl(fset *token.FileSet, f *ast.File, line int) ast.Decl {
+	for _, decl := range f.Decls {
+		if fset.Position(decl.Pos()).Line <= line && line <= fset.Position(decl.End()).Line {
+			return decl
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// goASTChecks are the named syntax checks root-cause rules can refer to.
+// Each returns the positions of the suspicious constructs in a declaration.
+var goASTChecks = map[string]func(decl ast.Node) []token.Pos{
+	"ignored-error":             ignoredErrors,
+	"unchecked-type-assertion":  uncheckedTypeAssertions,
+	"unchecked-index":           uncheckedIndexes,
+	"goroutine-map-write":       goroutineMapWrites,
+	"lock-without-defer-unlock": locksWithoutDeferredUnlock,
+}
+
+// ignoredErrors finds calls whose last result, usually an error, is
+// assigned to the blank identifier
+func ignoredErrors(decl ast.Node) []token.Pos {
+	var found []token.Pos
+	ast.Inspect(decl, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Lhs) < 2 || len(assign.Rhs) != 1 {
+			return true
+		}
+		if _, ok := assign.Rhs[0].(*ast.CallExpr); !ok {
+			return true
+		}
+		if ident, ok := assign.Lhs[len(assign.Lhs)-1].(*ast.Ident); ok && ident.Name == "_" {
+			found = append(found, assign.Pos())
+		}
+		return true
+	})
+	return found
+}
+
+// uncheckedTypeAssertions finds type assertions without the comma-ok form
+func uncheckedTypeAssertions(decl ast.Node) []token.Pos {
+	checked := make(map[*ast.TypeAssertExpr]bool)
+	ast.Inspect(decl, func(n ast.Node) bool {
+		var lhs, rhs int
+		var value ast.Expr
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			lhs, rhs = len(n.Lhs), len(n.Rhs)
+			if rhs == 1 {
+				value = n.Rhs[0]
+			}
+		case *ast.ValueSpec:
+			lhs, rhs = len(n.Names), len(n.Values)
+			if rhs == 1 {
+				value = n.Values[0]
+			}
+		}
+		if assert, ok := value.(*ast.TypeAssertExpr); ok && lhs == 2 && rhs == 1 {
+			checked[assert] = true
+		}
+		return true
+	})
+
+	var found []token.Pos
+	ast.Inspect(decl, func(n ast.Node) bool {
+		// Type switches have a nil Type and cannot panic
+		if assert, ok := n.(*ast.TypeAssertExpr); ok && assert.Type != nil && !checked[assert] {
+			found = append(found, assert.Pos())
+		}
+		return true
+	})
+	return found
+}
+
+// uncheckedIndexes finds index and slice expressions with variable bounds
+// on values whose length the declaration never consults, excluding indexes
+// produced by ranging over the same value
+func uncheckedIndexes(decl ast.Node) []token.Pos {
+	lengthChecked := make(map[string]bool)
+	rangeKeys := make(map[string]string) // key variable -> ranged expression
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if fn, ok := n.Fun.(*ast.Ident); ok && (fn.Name == "len" || fn.Name == "cap") && len(n.Args) == 1 {
+				lengthChecked[types.ExprString(n.Args[0])] = true
+			}
+		case *ast.RangeStmt:
+			if key, ok := n.Key.(*ast.Ident); ok {
+				rangeKeys[key.Name] = types.ExprString(n.X)
+			}
+		}
+		return true
+	})
+
+	variable := func(e ast.Expr) bool {
+		if e == nil {
+			return false
+		}
+		_, literal := e.(*ast.BasicLit)
+		return !literal
+	}
+
+	var found []token.Pos
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IndexExpr:
+			x := types.ExprString(n.X)
+			if ident, ok := n.Index.(*ast.Ident); ok && rangeKeys[ident.Name] == x {
+				return true
+			}
+			if variable(n.Index) && !lengthChecked[x] {
+				found = append(found, n.Pos())
+			}
+		case *ast.SliceExpr:
+			if (variable(n.Low) || variable(n.High) || variable(n.Max)) && !lengthChecked[types.ExprString(n.X)] {
+				found = append(found, n.Pos())
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// goroutineMapWrites finds index assignments inside goroutine function
+// literals that take no lock
+func goroutineMapWrites(decl ast.Node) []token.Pos {
+	var found []token.Pos
+	ast.Inspect(decl, func(n ast.Node) bool {
+		stmt, ok := n.(*ast.GoStmt)
+		if !ok {
+			return true
+		}
+		lit, ok := stmt.Call.Fun.(*ast.FuncLit)
+		if !ok || len(lockCalls(lit, "Lock")) > 0 {
+			return true
+		}
+		ast.Inspect(lit.Body, func(n ast.Node) bool {
+			var targets []ast.Expr
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				targets = n.Lhs
+			case *ast.IncDecStmt:
+				targets = []ast.Expr{n.X}
+			}
+			for _, target := range targets {
+				if _, ok := target.(*ast.IndexExpr); ok {
+					found = append(found, target.Pos())
+				}
+			}
+			return true
+		})
+		return true
+	})
+	return found
+}
+
+// locksWithoutDeferredUnlock finds Lock and RLock calls whose receiver is
+// never unlocked with defer in the declaration
+func locksWithoutDeferredUnlock(decl ast.Node) []token.Pos {
+	deferred := make(map[string]bool)
+	ast.Inspect(decl, func(n ast.Node) bool {
+		if d, ok := n.(*ast.DeferStmt); ok {
+			if sel, ok := d.Call.Fun.(*ast.SelectorExpr); ok && (sel.Sel.Name == "Unlock" || sel.Sel.Name == "RUnlock") {
+				deferred[types.ExprString(sel.X)+"."+sel.Sel.Name] = true
+			}
+		}
+		return true
+	})
+
+	var found []token.Pos
+	for lock, unlock := range map[string]string{"Lock": "Unlock", "RLock": "RUnlock"} {
+		for _, sel := range lockCalls(decl, lock) {
+			if !deferred[types.ExprString(sel.X)+"."+unlock] {
+				found = append(found, sel.Pos())
+			}
+		}
+	}
+	return found
+}
+
+// lockCalls returns the selectors of calls to the named method
+func lockCalls(root ast.Node, method string) []*ast.SelectorExpr {
+	var calls []*ast.SelectorExpr
+	ast.Inspect(root, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == method {
+				calls = append(calls, sel)
+			}
+		}
+		return true
+	})
+	return calls
+}
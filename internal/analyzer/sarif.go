@@ -0,0 +1,158 @@
+package analyzer
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// SARIF 2.1.0 identifiers
+const (
+	SARIFVersion = "2.1.0"
+	SARIFSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// SARIFLog is a SARIF 2.1.0 log with the subset of properties we produce
+type SARIFLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun is one run of the analyzer
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+// SARIFTool describes the analyzer and its rules
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+// SARIFDriver is the analyzer's tool component
+type SARIFDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Rules   []SARIFRule `json:"rules"`
+}
+
+// SARIFRule describes a rule reported in the run
+type SARIFRule struct {
+	ID string `json:"id"`
+}
+
+// SARIFResult is one finding
+type SARIFResult struct {
+	RuleID              string             `json:"ruleId"`
+	RuleIndex           int                `json:"ruleIndex"`
+	Level               string             `json:"level"`
+	Message             SARIFMessage       `json:"message"`
+	Locations           []SARIFLocation    `json:"locations"`
+	PartialFingerprints map[string]string  `json:"partialFingerprints,omitempty"`
+	Suppressions        []SARIFSuppression `json:"suppressions,omitempty"`
+}
+
+// SARIFMessage is a plain text message
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFLocation is the location of a finding
+type SARIFLocation struct {
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+}
+
+// SARIFPhysicalLocation is a region of a file
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+	Region           *SARIFRegion          `json:"region,omitempty"`
+}
+
+// SARIFArtifactLocation is a file relative to the repository root
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// SARIFRegion is a position in a file
+type SARIFRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// SARIFSuppression records an inline suppression of a result
+type SARIFSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+// ToSARIF converts findings to a SARIF log. Suppressed findings are kept
+// with their suppression, as SARIF viewers expect.
+func ToSARIF(findings []AnalysisResult) *SARIFLog {
+	ruleIndex := make(map[string]int)
+	var ruleIDs []string
+	for _, f := range findings {
+		if _, ok := ruleIndex[sarifRuleID(f)]; !ok {
+			ruleIndex[sarifRuleID(f)] = 0
+			ruleIDs = append(ruleIDs, sarifRuleID(f))
+		}
+	}
+	sort.Strings(ruleIDs)
+	rules := make([]SARIFRule, len(ruleIDs))
+	for i, id := range ruleIDs {
+		ruleIndex[id] = i
+		rules[i] = SARIFRule{ID: id}
+	}
+
+	results := make([]SARIFResult, 0, len(findings))
+	for _, f := range findings {
+		result := SARIFResult{
+			RuleID:    sarifRuleID(f),
+			RuleIndex: ruleIndex[sarifRuleID(f)],
+			Level:     sarifLevel(f.Level),
+			Message:   SARIFMessage{Text: f.Message},
+			Locations: []SARIFLocation{{PhysicalLocation: SARIFPhysicalLocation{
+				ArtifactLocation: SARIFArtifactLocation{URI: filepath.ToSlash(f.File)},
+			}}},
+		}
+		if f.Line > 0 {
+			result.Locations[0].PhysicalLocation.Region = &SARIFRegion{StartLine: f.Line, StartColumn: f.Column}
+		}
+		if f.Fingerprint != "" {
+			result.PartialFingerprints = map[string]string{"codeanalyzer/v1": f.Fingerprint}
+		}
+		if f.Suppression != nil {
+			result.Suppressions = []SARIFSuppression{{Kind: f.Suppression.Kind, Justification: f.Suppression.Justification}}
+		}
+		results = append(results, result)
+	}
+
+	return &SARIFLog{
+		Version: SARIFVersion,
+		Schema:  SARIFSchema,
+		Runs: []SARIFRun{{
+			Tool:    SARIFTool{Driver: SARIFDriver{Name: "codeanalyzer", Version: AnalyzerVersion, Rules: rules}},
+			Results: results,
+		}},
+	}
+}
+
+// sarifRuleID returns the rule of a finding, which SARIF requires
+func sarifRuleID(f AnalysisResult) string {
+	if f.Rule == "" {
+		return "unknown"
+	}
+	return f.Rule
+}
+
+// sarifLevel maps a finding level to a SARIF level
+func sarifLevel(level string) string {
+	switch level {
+	case "error":
+		return "error"
+	case "warning":
+		return "warning"
+	case "info":
+		return "note"
+	}
+	return "none"
+}
@@ -0,0 +1,626 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Security rule IDs
+const (
+	RuleHardcodedSecret  = "hardcoded-secret"
+	RuleSQLInjection     = "sql-injection"
+	RuleCommandInjection = "command-injection"
+	RuleWeakCrypto       = "weak-crypto"
+	RuleInsecureTLS      = "insecure-tls"
+	RulePathTraversal    = "path-traversal"
+)
+
+// Thresholds for secrets found by their entropy
+const (
+	namedSecretMinLength   = 8   // values assigned to secret-like names
+	namedSecretMinEntropy  = 3.0 // bits per character
+	randomSecretMinLength  = 32  // values of any name
+	randomSecretMinEntropy = 4.5
+)
+
+// tokenFormats are the formats of well-known credentials
+var tokenFormats = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"Stripe key", regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{20,}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP )?PRIVATE KEY`)},
+}
+
+var (
+	// secretName matches identifiers and keys that hold credentials
+	secretName = regexp.MustCompile(`(?i)passw(?:or)?d|pwd|secret|token|api_?key|access_?key|private_?key|credential|auth_?key`)
+	// placeholderSecret matches values that only stand in for a credential
+	placeholderSecret = regexp.MustCompile(`(?i)example|changeme|placeholder|dummy|xxxx|your[_-]|<[^>]*>|\$\{|\{\{|%s|%v`)
+	// randomSecret matches literals that may be random keys
+	randomSecret = regexp.MustCompile(`^[A-Za-z0-9+/=_-]+$`)
+	// namedSecret matches a string literal assigned to a secret-like name
+	namedSecret = regexp.MustCompile(`([\w.]+)["']?\s*(?::|=|:=)\s*(?:['"])([^'"]+)['"]`)
+	// quotedRandom matches long string literals of key characters
+	quotedRandom = regexp.MustCompile(`['"]([A-Za-z0-9+/=_-]{32,})['"]`)
+)
+
+// lineRule is a security rule matched against lines of code
+type lineRule struct {
+	rule     string
+	level    string
+	message  string
+	pattern  *regexp.Regexp
+	requires *regexp.Regexp // also needed on the line when set
+}
+
+// jsSecurityRules apply to JavaScript and TypeScript
+var jsSecurityRules = []lineRule{
+	{RuleSQLInjection, "error", "SQL query built by string concatenation; use query parameters",
+		regexp.MustCompile("(?i)\\.(?:query|execute|raw)\\s*\\(\\s*(?:['\"]\\s*(?:select|insert|update|delete)\\b[^'\"]*['\"]\\s*\\+|`\\s*(?:select|insert|update|delete)\\b[^`]*\\$\\{)"), nil},
+	{RuleCommandInjection, "error", "shell command built from input; pass arguments to execFile or spawn instead",
+		regexp.MustCompile("(?:(?:^|[^.\\w])|child_process\\.)exec(?:Sync)?\\s*\\(\\s*(?:[A-Za-z_$]|['\"][^'\"]*['\"]\\s*\\+|`[^`]*\\$\\{)"), nil},
+	{RuleCommandInjection, "error", "process spawned through a shell; pass arguments without shell: true",
+		regexp.MustCompile(`\bspawn(?:Sync)?\s*\([^)]*shell\s*:\s*true`), nil},
+	{RuleWeakCrypto, "warning", "MD5 and SHA-1 are broken hashes; use SHA-256 or stronger",
+		regexp.MustCompile(`createHash\(\s*['"](?:md5|sha1)['"]`), nil},
+	{RuleWeakCrypto, "warning", "DES and RC4 are broken ciphers; use AES-GCM",
+		regexp.MustCompile(`createCipher(?:iv)?\(\s*['"](?:des|rc4)`), nil},
+	{RuleWeakCrypto, "warning", "Math.random is predictable; use crypto.randomBytes for secrets",
+		regexp.MustCompile(`\bMath\.random\(`), secretName},
+	{RuleInsecureTLS, "error", "TLS certificate verification is disabled",
+		regexp.MustCompile(`rejectUnauthorized\s*:\s*false|NODE_TLS_REJECT_UNAUTHORIZED\s*=\s*['"]?0`), nil},
+	{RulePathTraversal, "error", "file path taken from the request; resolve it under a base directory and reject '..'",
+		regexp.MustCompile(`\b(?:readFile|readFileSync|createReadStream|writeFile|writeFileSync|createWriteStream|sendFile|unlink|unlinkSync|download)\s*\([^)]*\breq\.(?:params|query|body)`), nil},
+}
+
+// pythonSecurityRules apply to Python
+var pythonSecurityRules = []lineRule{
+	{RuleSQLInjection, "error", "SQL query built by string formatting; use query parameters",
+		regexp.MustCompile(`(?i)\.execute(?:many)?\s*\(\s*(?:f['"]\s*(?:select|insert|update|delete)\b[^'"]*\{|['"]\s*(?:select|insert|update|delete)\b[^'"]*['"]\s*(?:%|\+|\.format\())`), nil},
+	{RuleCommandInjection, "error", "shell command built from input; pass an argument list to subprocess instead",
+		regexp.MustCompile(`\bos\.(?:system|popen)\s*\(\s*(?:[A-Za-z_]|f['"]|['"][^'"]*['"]\s*(?:%|\+|\.format\())`), nil},
+	{RuleCommandInjection, "error", "process run through a shell; pass an argument list without shell=True",
+		regexp.MustCompile(`\bsubprocess\.\w+\(.*\bshell\s*=\s*True`), nil},
+	{RuleWeakCrypto, "warning", "MD5 and SHA-1 are broken hashes; use SHA-256 or stronger",
+		regexp.MustCompile(`\bhashlib\.(?:md5|sha1)\s*\(|\bhashlib\.new\(\s*['"](?:md5|sha1)['"]`), nil},
+	{RuleWeakCrypto, "warning", "the random module is predictable; use the secrets module for secrets",
+		regexp.MustCompile(`\brandom\.(?:random|randint|randrange|choice|choices|getrandbits)\s*\(`), secretName},
+	{RuleInsecureTLS, "error", "TLS certificate verification is disabled",
+		regexp.MustCompile(`\bverify\s*=\s*False\b|\bssl\._create_unverified_context\(|\bCERT_NONE\b`), nil},
+	{RulePathTraversal, "error", "file path taken from the request; resolve it under a base directory and reject '..'",
+		regexp.MustCompile(`\b(?:open|send_file|os\.remove|shutil\.rmtree)\s*\([^)]*\brequest\.(?:args|form|values|files|GET|POST|data|json)`), nil},
+}
+
+// securityFindings runs the security rules on one file. Go is checked on
+// its syntax tree and follows request input through local variables;
+// JavaScript, TypeScript and Python are checked line by line.
+func securityFindings(file SourceFile, src []byte) []AnalysisResult {
+	switch file.Language {
+	case "Go":
+		return goSecurityFindings(file.Path, src)
+	case "JavaScript", "TypeScript":
+		return lineSecurityFindings(file.Path, src, "//", jsSecurityRules)
+	case "Python":
+		return lineSecurityFindings(file.Path, src, "#", pythonSecurityRules)
+	}
+	return nil
+}
+
+// lineSecurityFindings matches the rules and secrets against each line,
+// ignoring line comments
+func lineSecurityFindings(p string, src []byte, comment string, rules []lineRule) []AnalysisResult {
+	var findings []AnalysisResult
+	for i, line := range strings.Split(string(src), "\n") {
+		code, _, _ := splitLineComment(line, comment)
+		for _, r := range rules {
+			loc := r.pattern.FindStringIndex(code)
+			if loc == nil || (r.requires != nil && !r.requires.MatchString(code)) {
+				continue
+			}
+			findings = append(findings, AnalysisResult{
+				Rule:    r.rule,
+				File:    p,
+				Line:    i + 1,
+				Column:  loc[0] + 1,
+				Message: r.message,
+				Level:   r.level,
+			})
+		}
+
+		if kind, col, ok := lineSecret(code); ok {
+			findings = append(findings, secretFinding(p, i+1, col, kind))
+		}
+	}
+	return findings
+}
+
+// lineSecret finds a hard-coded credential in a line of code
+func lineSecret(code string) (string, int, bool) {
+	if kind, col, ok := knownToken(code); ok {
+		return kind, col, true
+	}
+	for _, m := range namedSecret.FindAllStringSubmatchIndex(code, -1) {
+		name, value := code[m[2]:m[3]], code[m[4]:m[5]]
+		if secretName.MatchString(name) && looksLikeSecret(value, namedSecretMinLength, namedSecretMinEntropy) {
+			return "credential assigned to " + name, m[4] + 1, true
+		}
+	}
+	for _, m := range quotedRandom.FindAllStringSubmatchIndex(code, -1) {
+		if looksLikeSecret(code[m[2]:m[3]], randomSecretMinLength, randomSecretMinEntropy) {
+			return "random-looking key", m[2] + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// knownToken finds a credential of a well-known format
+func knownToken(s string) (string, int, bool) {
+	for _, f := range tokenFormats {
+		if loc := f.pattern.FindStringIndex(s); loc != nil {
+			return f.name, loc[0] + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// looksLikeSecret reports whether a value is long and random enough to be
+// a credential rather than a word, a placeholder or a template
+func looksLikeSecret(value string, minLength int, minEntropy float64) bool {
+	if len(value) < minLength || strings.ContainsAny(value, " \t") || placeholderSecret.MatchString(value) {
+		return false
+	}
+	if minLength >= randomSecretMinLength && (!randomSecret.MatchString(value) || !strings.ContainsAny(value, "0123456789")) {
+		return false
+	}
+	return shannonEntropy(value) >= minEntropy
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// secretFinding reports a hard-coded credential
+func secretFinding(p string, line, column int, kind string) AnalysisResult {
+	return AnalysisResult{
+		Rule:    RuleHardcodedSecret,
+		File:    p,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf("hard-coded secret (%s); load it from the environment or a secret store", kind),
+		Level:   "error",
+	}
+}
+
+// Go APIs checked by the security rules
+var (
+	goWeakCrypto = map[string]string{
+		"crypto/md5":  "MD5 is a broken hash; use SHA-256 or stronger",
+		"crypto/sha1": "SHA-1 is a broken hash; use SHA-256 or stronger",
+		"crypto/des":  "DES is a broken cipher; use AES-GCM",
+		"crypto/rc4":  "RC4 is a broken cipher; use AES-GCM",
+	}
+	goSQLMethods = map[string]bool{
+		"Query": true, "QueryContext": true, "QueryRow": true, "QueryRowContext": true,
+		"Exec": true, "ExecContext": true, "Prepare": true, "PrepareContext": true, "Raw": true,
+	}
+	goFileSinks = map[string]map[string]int{ // package -> function -> index of the path argument
+		"os":        {"Open": 0, "OpenFile": 0, "ReadFile": 0, "WriteFile": 0, "Create": 0, "Remove": 0, "RemoveAll": 0, "ReadDir": 0, "Mkdir": 0, "MkdirAll": 0},
+		"io/ioutil": {"ReadFile": 0, "WriteFile": 0, "ReadDir": 0},
+		"net/http":  {"ServeFile": 2},
+	}
+	// goInputCalls and goInputFields read request input, e.g. r.FormValue
+	// or c.Query for gin
+	goInputCalls  = map[string]bool{"FormValue": true, "PostFormValue": true, "Query": true, "DefaultQuery": true, "Param": true, "PostForm": true, "DefaultPostForm": true, "GetHeader": true, "QueryParam": true}
+	goInputFields = map[string]bool{"URL": true, "Form": true, "PostForm": true, "Header": true, "Body": true}
+	// goSanitizers make input safe for paths and commands
+	goSanitizers = map[string]bool{"path/filepath.Base": true, "path.Base": true, "strconv.Atoi": true, "strconv.ParseInt": true, "strconv.ParseUint": true, "strconv.ParseBool": true, "strconv.ParseFloat": true, "strconv.Quote": true}
+	goShells     = map[string]bool{"sh": true, "bash": true, "zsh": true, "cmd": true, "cmd.exe": true, "powershell": true, "pwsh": true}
+	sqlKeyword   = regexp.MustCompile(`(?i)^\s*(?:select|insert|update|delete|replace|merge)\b|\b(?:from|where|values|set)\b`)
+)
+
+// goSecurity checks one Go file
+type goSecurity struct {
+	path     string
+	fset     *token.FileSet
+	imports  map[string]string // local name -> import path
+	consts   map[string]bool   // constants declared in the file
+	input    map[any]bool      // variables holding request input
+	sql      map[any]bool      // variables holding dynamically built SQL
+	findings []AnalysisResult
+	seen     map[token.Pos]bool
+}
+
+// goSecurityFindings checks a Go file. Files that do not parse are only
+// checked for secrets.
+func goSecurityFindings(p string, src []byte) []AnalysisResult {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, p, src, 0)
+	if err != nil || f == nil {
+		var findings []AnalysisResult
+		for i, line := range bytes.Split(src, []byte("\n")) {
+			code, _, _ := splitLineComment(string(line), "//")
+			if kind, col, ok := lineSecret(code); ok {
+				findings = append(findings, secretFinding(p, i+1, col, kind))
+			}
+		}
+		return findings
+	}
+
+	g := &goSecurity{
+		path:    p,
+		fset:    fset,
+		imports: make(map[string]string),
+		consts:  make(map[string]bool),
+		input:   make(map[any]bool),
+		sql:     make(map[any]bool),
+		seen:    make(map[token.Pos]bool),
+	}
+	for _, imp := range f.Imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+		name := importName(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		g.imports[name] = importPath
+	}
+	for _, decl := range f.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.CONST {
+			for _, spec := range gd.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					g.consts[name.Name] = true
+				}
+			}
+		}
+	}
+
+	var stack []ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		g.visit(n, stack)
+		stack = append(stack, n)
+		return true
+	})
+	return g.findings
+}
+
+// visit checks a node; stack holds its ancestors
+func (g *goSecurity) visit(n ast.Node, stack []ast.Node) {
+	switch n := n.(type) {
+	case *ast.AssignStmt:
+		if len(n.Lhs) == len(n.Rhs) || len(n.Rhs) == 1 {
+			for i, lhs := range n.Lhs {
+				rhs := n.Rhs[min(i, len(n.Rhs)-1)]
+				g.track(lhs, rhs)
+				if sel, ok := lhs.(*ast.SelectorExpr); ok && sel.Sel.Name == "InsecureSkipVerify" && isTrue(rhs) {
+					g.report(n, RuleInsecureTLS, "error", "TLS certificate verification is disabled")
+				}
+			}
+		}
+	case *ast.ValueSpec:
+		for i, name := range n.Names {
+			if i < len(n.Values) {
+				g.track(name, n.Values[i])
+			}
+		}
+	case *ast.KeyValueExpr:
+		if key, ok := n.Key.(*ast.Ident); ok && key.Name == "InsecureSkipVerify" && isTrue(n.Value) {
+			g.report(n, RuleInsecureTLS, "error", "TLS certificate verification is disabled")
+		}
+	case *ast.BasicLit:
+		if n.Kind != token.STRING {
+			return
+		}
+		value, err := strconv.Unquote(n.Value)
+		if err != nil {
+			return
+		}
+		if kind, _, ok := knownToken(value); ok {
+			g.report(n, RuleHardcodedSecret, "error", fmt.Sprintf("hard-coded secret (%s); load it from the environment or a secret store", kind))
+		} else if name := boundName(n, stack); name != "" && secretName.MatchString(name) && looksLikeSecret(value, namedSecretMinLength, namedSecretMinEntropy) {
+			g.report(n, RuleHardcodedSecret, "error", fmt.Sprintf("hard-coded secret (credential assigned to %s); load it from the environment or a secret store", name))
+		} else if looksLikeSecret(value, randomSecretMinLength, randomSecretMinEntropy) {
+			g.report(n, RuleHardcodedSecret, "error", "hard-coded secret (random-looking key); load it from the environment or a secret store")
+		}
+	case *ast.CallExpr:
+		g.checkCall(n, stack)
+	}
+}
+
+// checkCall checks a call against the Go security rules
+func (g *goSecurity) checkCall(call *ast.CallExpr, stack []ast.Node) {
+	pkg, name := g.pkgFunc(call)
+	switch {
+	case goWeakCrypto[pkg] != "":
+		g.report(call, RuleWeakCrypto, "warning", goWeakCrypto[pkg])
+	case pkg == "math/rand" || pkg == "math/rand/v2":
+		if n := boundName(call, stack); n != "" && secretName.MatchString(n) {
+			g.report(call, RuleWeakCrypto, "warning", "math/rand is predictable; use crypto/rand for secrets")
+		}
+	case pkg == "os/exec" && (name == "Command" || name == "CommandContext"):
+		args := call.Args
+		if name == "CommandContext" && len(args) > 0 {
+			args = args[1:]
+		}
+		g.checkCommand(call, args)
+	case goFileSinks[pkg] != nil:
+		if i, ok := goFileSinks[pkg][name]; ok && i < len(call.Args) && g.isInput(call.Args[i]) {
+			g.report(call, RulePathTraversal, "error", fmt.Sprintf("%s.%s opens a path taken from the request; resolve it under a base directory and reject '..'", path.Base(pkg), name))
+		}
+	case pkg == "":
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return
+		}
+		if goSQLMethods[sel.Sel.Name] {
+			i := 0
+			if strings.HasSuffix(sel.Sel.Name, "Context") {
+				i = 1
+			}
+			if i < len(call.Args) && g.isDynamicSQL(call.Args[i]) {
+				g.report(call, RuleSQLInjection, "error", "SQL query built from strings; pass values as query parameters")
+			}
+		}
+		if (sel.Sel.Name == "File" || sel.Sel.Name == "FileAttachment") && len(call.Args) > 0 && g.isInput(call.Args[0]) {
+			g.report(call, RulePathTraversal, "error", "file served from a path taken from the request; resolve it under a base directory and reject '..'")
+		}
+	}
+}
+
+// checkCommand reports commands run with request input or through a shell
+// with a script that is not constant
+func (g *goSecurity) checkCommand(call *ast.CallExpr, args []ast.Expr) {
+	for _, arg := range args {
+		if g.isInput(arg) {
+			g.report(call, RuleCommandInjection, "error", "command built from request input; validate it against an allow list")
+			return
+		}
+	}
+	if len(args) < 3 {
+		return
+	}
+	program, ok := stringLit(args[0])
+	if !ok || !goShells[path.Base(program)] {
+		return
+	}
+	for i := 1; i < len(args)-1; i++ {
+		if flag, ok := stringLit(args[i]); ok && (flag == "-c" || strings.EqualFold(flag, "/c") || strings.EqualFold(flag, "-Command")) && !g.isConstant(args[i+1]) {
+			g.report(call, RuleCommandInjection, "error", "shell script built at run time; run the program directly with separate arguments")
+			return
+		}
+	}
+}
+
+// track records variables assigned request input or dynamic SQL
+func (g *goSecurity) track(lhs, rhs ast.Expr) {
+	id, ok := lhs.(*ast.Ident)
+	if !ok || id.Name == "_" {
+		return
+	}
+	key := varKey(id)
+	g.input[key] = g.isInput(rhs)
+	g.sql[key] = g.isDynamicSQL(rhs)
+}
+
+// isInput reports whether an expression holds request input that has not
+// been sanitized
+func (g *goSecurity) isInput(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if pkg, name := g.pkgFunc(n); goSanitizers[pkg+"."+name] {
+				return false
+			}
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && goInputCalls[sel.Sel.Name] {
+				if pkg, _ := g.pkgFunc(n); pkg == "" {
+					found = true
+				}
+			}
+		case *ast.SelectorExpr:
+			if goInputFields[n.Sel.Name] && isRequest(n.X) {
+				found = true
+			}
+		case *ast.Ident:
+			found = g.input[varKey(n)]
+		}
+		return !found
+	})
+	return found
+}
+
+// isDynamicSQL reports whether an expression builds SQL text from values
+// that are not constant
+func (g *goSecurity) isDynamicSQL(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return g.isDynamicSQL(e.X)
+	case *ast.Ident:
+		return g.sql[varKey(e)]
+	case *ast.BinaryExpr:
+		return e.Op == token.ADD && g.hasSQLText(e) && !g.isConstant(e)
+	case *ast.CallExpr:
+		pkg, name := g.pkgFunc(e)
+		if pkg != "fmt" || name != "Sprintf" || len(e.Args) < 2 {
+			return false
+		}
+		format, ok := stringLit(e.Args[0])
+		return ok && sqlKeyword.MatchString(format) && !g.isConstant(e)
+	}
+	return false
+}
+
+// hasSQLText reports whether a string literal in expr looks like SQL
+func (g *goSecurity) hasSQLText(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if s, ok := stringLit(n); ok && sqlKeyword.MatchString(s) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// isConstant reports whether an expression only combines literals and
+// constants
+func (g *goSecurity) isConstant(expr ast.Expr) bool {
+	constant := true
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if !g.consts[n.Name] && n.Name != "true" && n.Name != "false" {
+				constant = false
+			}
+		case *ast.CallExpr:
+			if pkg, _ := g.pkgFunc(n); pkg != "fmt" {
+				constant = false
+			}
+			for _, arg := range n.Args {
+				constant = constant && g.isConstant(arg)
+			}
+			return false
+		case *ast.SelectorExpr:
+			constant = false
+		}
+		return constant
+	})
+	return constant
+}
+
+// pkgFunc returns the import path and name of a package-level function a
+// call invokes, or an empty path for other calls
+func (g *goSecurity) pkgFunc(call *ast.CallExpr) (string, string) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", ""
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok || (x.Obj != nil && x.Obj.Kind != ast.Pkg) {
+		return "", ""
+	}
+	return g.imports[x.Name], sel.Sel.Name
+}
+
+// report adds a finding at a node, once per position
+func (g *goSecurity) report(n ast.Node, rule, level, message string) {
+	if g.seen[n.Pos()] {
+		return
+	}
+	g.seen[n.Pos()] = true
+	pos := g.fset.Position(n.Pos())
+	g.findings = append(g.findings, AnalysisResult{
+		Rule:    rule,
+		File:    g.path,
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Message: message,
+		Level:   level,
+	})
+}
+
+// boundName returns the name a value is assigned or bound to: the
+// nearest named variable or struct field, else the enclosing function
+func boundName(n ast.Node, stack []ast.Node) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		var name string
+		switch s := stack[i].(type) {
+		case *ast.AssignStmt:
+			name = exprName(s.Lhs[0])
+		case *ast.ValueSpec:
+			name = s.Names[0].Name
+		case *ast.KeyValueExpr:
+			name = exprName(s.Key)
+		case *ast.FuncDecl:
+			return s.Name.Name
+		case *ast.FuncLit:
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// exprName returns the name of an identifier, selector or string key
+func exprName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	if s, ok := stringLit(expr); ok {
+		return s
+	}
+	return ""
+}
+
+// isRequest reports whether an expression is an HTTP request by its
+// conventional name, such as r or c.Request
+func isRequest(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name == "r" || e.Name == "req" || e.Name == "request"
+	case *ast.SelectorExpr:
+		return e.Sel.Name == "Request"
+	}
+	return false
+}
+
+// varKey identifies a variable by its declaration, or by name when the
+// declaration is not resolved
+func varKey(id *ast.Ident) any {
+	if id.Obj != nil {
+		return id.Obj
+	}
+	return id.Name
+}
+
+// stringLit returns the value of a string literal
+func stringLit(n ast.Node) (string, bool) {
+	lit, ok := n.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// isTrue reports whether an expression is the constant true
+func isTrue(expr ast.Expr) bool {
+	id, ok := expr.(*ast.Ident)
+	return ok && id.Name == "true"
+}
@@ -1,10 +1,12 @@
 package analyzer
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // SourceFile represents a source code file
@@ -12,155 +14,181 @@ type SourceFile struct {
 	Path     string `json:"path"`
 	Language string `json:"language"`
 	Content  string `json:"content,omitempty"`
+	AbsPath  string `json:"-"` // location on disk, read when Content is empty
+}
+
+// readSource returns the content of a source file
+func readSource(file SourceFile) ([]byte, error) {
+	if file.Content != "" || file.AbsPath == "" {
+		return []byte(file.Content), nil
+	}
+	return os.ReadFile(file.AbsPath)
 }
 
 // AnalysisResult represents results from static analysis
 type AnalysisResult struct {
-	File    string `json:"file"`
-	Line    int    `json:"line"`
-	Column  int    `json:"column"`
-	Message string `json:"message"`
-	Level   string `json:"level"` // error, warning, info
+	Rule        string `json:"rule,omitempty"`
+	File        string `json:"file"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	Message     string `json:"message"`
+	Level       string `json:"level"`                 // error, warning, info
+	Fingerprint string `json:"fingerprint,omitempty"` // stable identity across line shifts, see FingerprintFindings
+
+	Suppression *FindingSuppression `json:"suppression,omitempty"` // set when an inline comment silences the finding
 }
 
 // ErrorLog represents an error from a log file
 type ErrorLog struct {
-	File    string `json:"file"`
-	Line    int    `json:"line"`
-	Message string `json:"message"`
+	File      string       `json:"file"`
+	Line      int          `json:"line"`
+	Message   string       `json:"message"`
+	Language  string       `json:"language,omitempty"`
+	Frames    []StackFrame `json:"frames,omitempty"` // innermost frame first
+	Cause     *ErrorLog    `json:"cause,omitempty"`  // chained exception that caused this one
+	Source    *LogSource   `json:"source,omitempty"` // log line the error was extracted from
+	Timestamp time.Time    `json:"timestamp,omitzero"`
+	Count     int          `json:"count,omitempty"` // occurrences when deduplicated
 }
 
 // GraphNode represents a node in the code knowledge graph
 type GraphNode struct {
-	ID        string   `json:"id"`
-	Type      string   `json:"type"` // file, function, class, etc.
-	Name      string   `json:"name"`
-	Path      string   `json:"path,omitempty"`
-	Relations []string `json:"relations,omitempty"`
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"` // file, function, class, etc.
+	Name       string                 `json:"name"`
+	Path       string                 `json:"path,omitempty"`
+	Relations  []string               `json:"relations,omitempty"` // IDs of the containing nodes
+	Package    string                 `json:"package,omitempty"`
+	Receiver   string                 `json:"receiver,omitempty"` // receiver type of a method
+	StartLine  int                    `json:"startLine,omitempty"`
+	EndLine    int                    `json:"endLine,omitempty"`
+	Edges      []GraphEdge            `json:"edges,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// GraphEdge represents a typed edge to another node in the code knowledge graph
+type GraphEdge struct {
+	Target string `json:"target"`
+	Type   string `json:"type"` // contains, imports, calls, implements, embeds, references, duplicate_of
 }
 
 // Service provides code analysis operations
-type Service struct{}
+type Service struct {
+	Pipeline PipelineOptions // concurrency of file processing
+}
 
 // NewService creates a new analyzer service
 func NewService() *Service {
 	return &Service{}
 }
 
+// languageOf determines the language of a source file from its extension
+func languageOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return "Go"
+	case ".js", ".jsx":
+		return "JavaScript"
+	case ".ts", ".tsx":
+		return "TypeScript"
+	case ".py":
+		return "Python"
+	case ".java":
+		return "Java"
+	case ".c", ".cpp", ".cc", ".h", ".hpp":
+		return "C/C++"
+	}
+	return ""
+}
+
 // IndexSourceFiles finds and indexes all source files in a repository
 func (s *Service) IndexSourceFiles(repoPath string) ([]SourceFile, error) {
-	var files []SourceFile
-
-	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			// Skip .git and other hidden directories
-			if strings.HasPrefix(info.Name(), ".") {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		// Determine language based on file extension
-		ext := strings.ToLower(filepath.Ext(path))
-		var language string
-
-		switch ext {
-		case ".go":
-			language = "Go"
-		case ".js", ".jsx":
-			language = "JavaScript"
-		case ".ts", ".tsx":
-			language = "TypeScript"
-		case ".py":
-			language = "Python"
-		case ".java":
-			language = "Java"
-		case ".c", ".cpp", ".cc", ".h", ".hpp":
-			language = "C/C++"
-		default:
-			// Skip non-source files
-			return nil
-		}
+	files, _, err := s.IndexSourceFilesContext(context.Background(), repoPath)
+	return files, err
+}
 
-		// Get relative path from the repo root
-		relPath, err := filepath.Rel(repoPath, path)
-		if err != nil {
-			return err
-		}
+// IndexSourceFilesContext indexes the source files of a repository,
+// reading directories concurrently. Directories that cannot be read are
+// reported as file errors.
+func (s *Service) IndexSourceFilesContext(ctx context.Context, repoPath string) ([]SourceFile, []FileError, error) {
+	return walkSourceFiles(ctx, repoPath, s.Pipeline)
+}
 
-		files = append(files, SourceFile{
-			Path:     relPath,
-			Language: language,
-		})
+// RunStaticAnalysis performs static code analysis on the source files
+func (s *Service) RunStaticAnalysis(files []SourceFile) ([]AnalysisResult, error) {
+	results, _, err := s.RunStaticAnalysisContext(context.Background(), files)
+	return results, err
+}
 
-		return nil
+// RunStaticAnalysisContext analyzes the source files concurrently. Files
+// that fail are reported as file errors.
+func (s *Service) RunStaticAnalysisContext(ctx context.Context, files []SourceFile) ([]AnalysisResult, []FileError, error) {
+	perFile, fileErrs, err := processFiles(ctx, files, s.Pipeline, true, func(file SourceFile, src []byte) ([]AnalysisResult, error) {
+		return analyzeFile(file, src), nil
 	})
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to index source files: %w", err)
+		return nil, nil, err
 	}
 
-	return files, nil
+	var results []AnalysisResult
+	for _, r := range perFile {
+		results = append(results, r...)
+	}
+	return results, fileErrs, nil
 }
 
-// RunStaticAnalysis performs static code analysis on the source files
-func (s *Service) RunStaticAnalysis(files []SourceFile) ([]AnalysisResult, error) {
+// analyzeFile runs the static analysis of one file
+func analyzeFile(file SourceFile, src []byte) []AnalysisResult {
+	findings := append(lintFile(file), complexityFindings(file, src)...)
+	return append(findings, securityFindings(file, src)...)
+}
+
+// lintFile runs the lint checks of one file
+func lintFile(file SourceFile) []AnalysisResult {
 	// This would typically involve running actual static analysis tools
 	// Here we're providing a simplified mock implementation
-	var results []AnalysisResult
-
-	for _, file := range files {
-		// Mock analysis based on file extension
-		switch strings.ToLower(filepath.Ext(file.Path)) {
-		case ".go":
-			results = append(results, AnalysisResult{
-				File:    file.Path,
-				Line:    10,
-				Column:  5,
-				Message: "Function exceeds maximum cyclomatic complexity",
-				Level:   "warning",
-			})
-		case ".js", ".jsx", ".ts", ".tsx":
-			results = append(results, AnalysisResult{
-				File:    file.Path,
-				Line:    20,
-				Column:  15,
-				Message: "Unused variable",
-				Level:   "warning",
-			})
-		case ".py":
-			results = append(results, AnalysisResult{
-				File:    file.Path,
-				Line:    30,
-				Column:  1,
-				Message: "Missing docstring",
-				Level:   "info",
-			})
-		}
+	switch strings.ToLower(filepath.Ext(file.Path)) {
+	case ".js", ".jsx", ".ts", ".tsx":
+		return []AnalysisResult{{
+			Rule:    "unused-variable",
+			File:    file.Path,
+			Line:    20,
+			Column:  15,
+			Message: "Unused variable",
+			Level:   "warning",
+		}}
+	case ".py":
+		return []AnalysisResult{{
+			Rule:    "missing-docstring",
+			File:    file.Path,
+			Line:    30,
+			Column:  1,
+			Message: "Missing docstring",
+			Level:   "info",
+		}}
 	}
-
-	return results, nil
+	return nil
 }
 
 // ParseErrorLogs parses build or runtime error logs
 func (s *Service) ParseErrorLogs(repoPath string) ([]ErrorLog, error) {
-	// This would typically involve parsing actual error logs
-	// Here we're providing a simplified mock implementation
-	logs := []ErrorLog{
-		{
-			File:    "main.go",
-			Line:    42,
-			Message: "undefined: someVariable",
-		},
-		{
-			File:    "handlers/user.go",
-			Line:    15,
-			Message: "cannot use x (type int) as type string",
-		},
+	return s.ParseErrorLogsWithOptions(repoPath, DefaultLogOptions())
+}
+
+// ParseErrorLogsWithOptions parses every log file discovered in the repository
+func (s *Service) ParseErrorLogsWithOptions(repoPath string, opts LogOptions) ([]ErrorLog, error) {
+	logFiles, err := s.DiscoverLogFiles(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []ErrorLog
+	for _, logFile := range logFiles {
+		fileLogs, err := s.ParseLogFile(repoPath, logFile, opts)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, fileLogs...)
 	}
 
 	return logs, nil
@@ -168,85 +196,128 @@ func (s *Service) ParseErrorLogs(repoPath string) ([]ErrorLog, error) {
 
 // BuildCodeKnowledgeGraph builds a graph representation of the code
 func (s *Service) BuildCodeKnowledgeGraph(files []SourceFile) ([]GraphNode, error) {
-	// This would typically involve building an actual code graph
-	// Here we're providing a simplified mock implementation
-	var graph []GraphNode
+	graph, _, err := s.BuildCodeKnowledgeGraphContext(context.Background(), files)
+	return graph, err
+}
+
+// BuildCodeKnowledgeGraphContext builds the code graph, parsing and lexing
+// files concurrently. Files that cannot be read or parsed are reported as
+// file errors and appear as plain file nodes.
+func (s *Service) BuildCodeKnowledgeGraphContext(ctx context.Context, files []SourceFile) ([]GraphNode, []FileError, error) {
+	// Go sources are type-checked to build declarations and their relations
+	prog, fileErrs, err := loadGoProgramContext(ctx, files, s.Pipeline)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph := buildGoGraph(prog)
+
+	// Other supported languages are lexed for their symbols and imports
+	var lexed []SourceFile
+	for _, file := range files {
+		if symbolLanguages[file.Language] {
+			lexed = append(lexed, file)
+		}
+	}
+	extracted, symbolErrs, err := processFiles(ctx, lexed, s.Pipeline, true, func(file SourceFile, src []byte) (*symbolFile, error) {
+		sf, _ := extractSymbols(file, src)
+		return sf, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	fileErrs = append(fileErrs, symbolErrs...)
+
+	var symbolFiles []*symbolFile
+	paths := make(map[string]bool)
+	for _, sf := range extracted {
+		if sf != nil {
+			symbolFiles = append(symbolFiles, sf)
+			paths[sf.Path] = true
+		}
+	}
 
-	for i, file := range files {
-		// Create a node for each file
-		fileID := fmt.Sprintf("file-%d", i)
+	seen := make(map[string]bool, len(graph))
+	for _, node := range graph {
+		seen[node.ID] = true
+	}
+	for _, node := range buildSymbolGraph(symbolFiles, paths) {
+		if !seen[node.ID] {
+			seen[node.ID] = true
+			graph = append(graph, node)
+		}
+	}
+
+	// Remaining files are added as plain file nodes
+	for _, file := range files {
+		fileID := fileNodeID(filepath.ToSlash(file.Path))
+		if seen[fileID] {
+			continue
+		}
+		seen[fileID] = true
 		graph = append(graph, GraphNode{
 			ID:   fileID,
-			Type: "file",
+			Type: NodeFile,
 			Name: filepath.Base(file.Path),
-			Path: file.Path,
+			Path: filepath.ToSlash(file.Path),
 		})
-
-		// Add some mock function nodes for each file
-		for j := 0; j < 3; j++ {
-			funcID := fmt.Sprintf("func-%d-%d", i, j)
-			graph = append(graph, GraphNode{
-				ID:        funcID,
-				Type:      "function",
-				Name:      fmt.Sprintf("function%d", j),
-				Relations: []string{fileID},
-			})
-		}
 	}
 
-	return graph, nil
+	return graph, fileErrs, nil
 }
 
 // MapErrorsToGraph maps error logs to nodes in the code graph
 func (s *Service) MapErrorsToGraph(logs []ErrorLog, graph []GraphNode) []string {
-	// This would typically involve complex mapping logic
-	// Here we're providing a simplified mock implementation
-	var errorNodeIDs []string
-
-	for _, log := range logs {
-		for _, node := range graph {
-			if node.Type == "file" && strings.HasSuffix(node.Path, log.File) {
-				errorNodeIDs = append(errorNodeIDs, node.ID)
-				break
-			}
-		}
-	}
-
-	return errorNodeIDs
+	return mappedNodeIDs(s.MapErrorsToGraphDetailed(logs, graph))
 }
 
-// LocalizeErrors finds specific nodes in the graph responsible for errors
+// LocalizeErrors finds specific nodes in the graph responsible for errors,
+// most suspicious first
 func (s *Service) LocalizeErrors(errorNodeIDs []string, graph []GraphNode) []string {
-	// This would typically involve graph traversal algorithms
-	// Here we're providing a simplified mock implementation
-	var suspectNodeIDs []string
+	return s.LocalizeErrorsWithOptions(errorNodeIDs, graph, DefaultLocalizeOptions())
+}
 
-	// For simplicity, just collect related function nodes
-	for _, errorID := range errorNodeIDs {
-		for _, node := range graph {
-			if node.Type == "function" {
-				for _, relID := range node.Relations {
-					if relID == errorID {
-						suspectNodeIDs = append(suspectNodeIDs, node.ID)
-					}
-				}
-			}
-		}
-	}
+// LocalizeErrorsWithOptions localizes errors with the given strategy, e.g.
+// combining graph propagation with coverage spectra
+func (s *Service) LocalizeErrorsWithOptions(errorNodeIDs []string, graph []GraphNode, opts LocalizeOptions) []string {
+	suspects := s.RankSuspects(errorNodeIDs, graph, opts)
 
+	suspectNodeIDs := make([]string, len(suspects))
+	for i, suspect := range suspects {
+		suspectNodeIDs[i] = suspect.NodeID
+	}
 	return suspectNodeIDs
 }
 
-// DiagnoseRootCause identifies the root cause of the errors
-func (s *Service) DiagnoseRootCause(suspectNodeIDs []string, graph []GraphNode) map[string]string {
-	// This would typically involve sophisticated analysis
-	// Here we're providing a simplified mock implementation
+// DiagnoseRootCause identifies the root cause of the errors in logs with the
+// repository's rule catalogue, keeping the most confident diagnosis of each
+// suspect
+func (s *Service) DiagnoseRootCause(repoPath string, logs []ErrorLog, suspectNodeIDs []string, graph []GraphNode) map[string]string {
 	diagnosis := make(map[string]string)
 
+	catalog, err := s.LoadRuleCatalog(repoPath)
+	var diagnoses []Diagnosis
+	if err == nil {
+		diagnoses, err = s.DiagnoseRootCauseWithOptions(suspectNodeIDs, graph, DiagnoseOptions{
+			RepoPath: repoPath,
+			Logs:     logs,
+			Catalog:  catalog,
+		})
+	}
+	if err == nil {
+		for _, d := range diagnoses {
+			if _, ok := diagnosis[d.NodeID]; !ok {
+				diagnosis[d.NodeID] = d.Cause
+			}
+		}
+	}
+
 	for _, nodeID := range suspectNodeIDs {
+		if _, ok := diagnosis[nodeID]; ok {
+			continue
+		}
 		for _, node := range graph {
 			if node.ID == nodeID {
-				diagnosis[nodeID] = fmt.Sprintf("Potential issue in %s: incorrect API usage", node.Name)
+				diagnosis[nodeID] = fmt.Sprintf("Potential issue in %s: no known error signature matched", node.Name)
 			}
 		}
 	}
@@ -0,0 +1,451 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StackFrame represents a single frame of a runtime stack trace
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Thread   string `json:"thread,omitempty"` // goroutine or thread the frame belongs to
+	InRepo   bool   `json:"inRepo"`           // whether File was resolved to a repository file
+}
+
+var (
+	// Go panics and fatal errors
+	goPanicStart     = regexp.MustCompile(`^(panic|fatal error): (.+)$`)
+	goGoroutine      = regexp.MustCompile(`^goroutine (\d+) \[([^\]]+)\]:$`)
+	goFrameLocation  = regexp.MustCompile(`^\s+(.+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+	goCreatedBy      = regexp.MustCompile(`^created by (\S+)(?: in goroutine \d+)?$`)
+	goFunctionSuffix = regexp.MustCompile(`\([^()]*\)$`)
+
+	// Python tracebacks
+	pyTracebackStart = regexp.MustCompile(`^Traceback \(most recent call last\):$`)
+	pyFrame          = regexp.MustCompile(`^\s+File "([^"]+)", line (\d+)(?:, in (.+))?$`)
+
+	// Java and Kotlin traces
+	javaExceptionStart = regexp.MustCompile(`^(?:Exception in thread "([^"]+)" )?((?:[a-zA-Z_$][\w$]*\.)+[A-Z][\w$]*(?:Exception|Error|Throwable)[\w$]*)(?::\s?(.*))?$`)
+	javaCausedBy       = regexp.MustCompile(`^Caused by: ((?:[a-zA-Z_$][\w$]*\.)+[\w$]+)(?::\s?(.*))?$`)
+	javaFrame          = regexp.MustCompile(`^\s+at ([\w$.<>/]+)\(([^:()]+)(?::(\d+))?\)$`)
+
+	// Node.js stacks
+	nodeErrorStart   = regexp.MustCompile(`^(?:Uncaught )?([A-Z]\w*(?:Error|Exception)):\s?(.*)$`)
+	nodeFrameWithFn  = regexp.MustCompile(`^\s+at (?:async )?(.+?) \((.+):(\d+):(\d+)\)$`)
+	nodeFrameAnonyms = regexp.MustCompile(`^\s+at (?:async )?(.+):(\d+):(\d+)$`)
+)
+
+// ParseStackTraces extracts every runtime stack trace found in text.
+// Go panics (including multi-goroutine dumps), Python tracebacks, Java/Kotlin
+// traces and Node.js stacks are recognised. Frames are ordered innermost
+// (most recent call) first and their paths are normalized relative to
+// repoPath when the file can be found in the repository.
+func (s *Service) ParseStackTraces(text, repoPath string) []ErrorLog {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	logs, _ := parseTraceLines(lines, newPathResolver(repoPath))
+	return logs
+}
+
+// traceSpan is the range of lines [start, end) consumed by a parsed trace
+type traceSpan struct {
+	start, end int
+}
+
+// parseTraceLines parses every stack trace in lines, returning the traces
+// together with the line span each one was read from
+func parseTraceLines(lines []string, resolver *pathResolver) ([]ErrorLog, []traceSpan) {
+	var (
+		logs  []ErrorLog
+		spans []traceSpan
+	)
+	for i := 0; i < len(lines); {
+		var (
+			log  *ErrorLog
+			next int
+		)
+
+		switch line := lines[i]; {
+		case goPanicStart.MatchString(line):
+			log, next = parseGoPanic(lines, i)
+		case pyTracebackStart.MatchString(line):
+			log, next = parsePythonTraceback(lines, i)
+		case javaExceptionStart.MatchString(line) && i+1 < len(lines) && javaFrame.MatchString(lines[i+1]):
+			log, next = parseJavaTrace(lines, i)
+		case nodeErrorStart.MatchString(line) && i+1 < len(lines) && isNodeFrame(lines[i+1]):
+			log, next = parseNodeStack(lines, i)
+		}
+
+		if log == nil {
+			i++
+			continue
+		}
+
+		resolver.normalize(log)
+		logs = append(logs, *log)
+		spans = append(spans, traceSpan{start: i, end: next})
+		i = next
+	}
+
+	return logs, spans
+}
+
+// maxTracePreamble bounds how many lines past the start of a trace are
+// searched for its first frame
+const maxTracePreamble = 10
+
+// parseGoPanic parses a Go panic or fatal error followed by goroutine dumps
+func parseGoPanic(lines []string, start int) (*ErrorLog, int) {
+	m := goPanicStart.FindStringSubmatch(lines[start])
+	log := &ErrorLog{
+		Message:  strings.TrimSpace(lines[start]),
+		Language: "Go",
+	}
+	if m[1] == "panic" {
+		log.Message = "panic: " + strings.TrimSuffix(m[2], " [recovered]")
+	}
+
+	thread := ""
+	i := start + 1
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			continue
+		case goGoroutine.MatchString(trimmed):
+			g := goGoroutine.FindStringSubmatch(trimmed)
+			thread = "goroutine " + g[1]
+			continue
+		case strings.HasPrefix(trimmed, "panic: ") && thread == "":
+			// Nested panic raised while handling the first one
+			log.Message += "\n" + trimmed
+			continue
+		case strings.HasPrefix(trimmed, "[signal ") && thread == "":
+			log.Message += "\n" + trimmed
+			continue
+		}
+
+		// Every frame is a function line followed by an indented location line
+		if i+1 >= len(lines) || !goFrameLocation.MatchString(lines[i+1]) {
+			if thread == "" && i-start < maxTracePreamble {
+				continue
+			}
+			break
+		}
+
+		function := trimmed
+		if cb := goCreatedBy.FindStringSubmatch(trimmed); cb != nil {
+			function = "created by " + cb[1]
+		} else {
+			function = goFunctionSuffix.ReplaceAllString(function, "")
+		}
+
+		loc := goFrameLocation.FindStringSubmatch(lines[i+1])
+		lineNo, _ := strconv.Atoi(loc[2])
+		log.Frames = append(log.Frames, StackFrame{
+			Function: function,
+			File:     loc[1],
+			Line:     lineNo,
+			Thread:   thread,
+		})
+		i++
+	}
+
+	return log, i
+}
+
+// parsePythonTraceback parses a Python traceback, including chained exceptions
+func parsePythonTraceback(lines []string, start int) (*ErrorLog, int) {
+	var (
+		log    *ErrorLog
+		frames []StackFrame
+	)
+
+	i := start + 1
+	for i < len(lines) {
+		line := lines[i]
+
+		if m := pyFrame.FindStringSubmatch(line); m != nil {
+			lineNo, _ := strconv.Atoi(m[2])
+			frames = append(frames, StackFrame{Function: m[3], File: m[1], Line: lineNo})
+			i++
+			// Skip the source excerpt and caret markers printed below the frame
+			for i < len(lines) && strings.HasPrefix(lines[i], "    ") && !pyFrame.MatchString(lines[i]) {
+				i++
+			}
+			continue
+		}
+
+		// The exception line is the first unindented line after the frames
+		if len(frames) == 0 || strings.TrimSpace(line) == "" || strings.HasPrefix(line, " ") {
+			i++
+			if len(frames) == 0 && i-start > maxTracePreamble {
+				break
+			}
+			continue
+		}
+
+		// Python prints the most recent call last; store it innermost first
+		for l, r := 0, len(frames)-1; l < r; l, r = l+1, r-1 {
+			frames[l], frames[r] = frames[r], frames[l]
+		}
+		current := &ErrorLog{
+			Message:  strings.TrimSpace(line),
+			Language: "Python",
+			Frames:   frames,
+			Cause:    log,
+		}
+		log = current
+		frames = nil
+		i++
+
+		// A chained exception continues with another traceback
+		j := i
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+			j++
+		}
+		if j < len(lines) && isPythonChainMarker(lines[j]) {
+			j++
+			for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+				j++
+			}
+			if j < len(lines) && pyTracebackStart.MatchString(lines[j]) {
+				i = j + 1
+				continue
+			}
+		}
+		break
+	}
+
+	return log, i
+}
+
+// isPythonChainMarker reports whether line separates two chained exceptions
+func isPythonChainMarker(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "During handling of the above exception, another exception occurred:" ||
+		line == "The above exception was the direct cause of the following exception:"
+}
+
+// parseJavaTrace parses a Java or Kotlin stack trace with its "Caused by" chain
+func parseJavaTrace(lines []string, start int) (*ErrorLog, int) {
+	m := javaExceptionStart.FindStringSubmatch(lines[start])
+	thread := m[1]
+	root := &ErrorLog{
+		Message:  joinMessage(m[2], m[3]),
+		Language: "Java",
+	}
+
+	current := root
+	i := start + 1
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if f := javaFrame.FindStringSubmatch(line); f != nil {
+			lineNo, _ := strconv.Atoi(f[3])
+			current.Frames = append(current.Frames, StackFrame{
+				Function: f[1],
+				File:     javaSourcePath(f[1], f[2]),
+				Line:     lineNo,
+				Thread:   thread,
+			})
+			if strings.HasSuffix(f[2], ".kt") {
+				current.Language = "Kotlin"
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "... ") && strings.HasSuffix(trimmed, "more") {
+			continue
+		}
+
+		if c := javaCausedBy.FindStringSubmatch(trimmed); c != nil {
+			cause := &ErrorLog{Message: joinMessage(c[1], c[2]), Language: current.Language}
+			current.Cause = cause
+			current = cause
+			continue
+		}
+
+		break
+	}
+
+	return root, i
+}
+
+// javaSourcePath derives a package-qualified source path from a frame, so
+// com.acme.Foo.bar in Foo.java becomes com/acme/Foo.java
+func javaSourcePath(function, file string) string {
+	parts := strings.Split(function, ".")
+	if len(parts) < 3 {
+		return file
+	}
+	// Drop the class and method names, keeping the package
+	pkg := parts[:len(parts)-2]
+	for _, p := range pkg {
+		if p == "" || strings.ContainsAny(p, "<>$/") {
+			return file
+		}
+	}
+	return strings.Join(pkg, "/") + "/" + file
+}
+
+// parseNodeStack parses a Node.js error stack
+func parseNodeStack(lines []string, start int) (*ErrorLog, int) {
+	m := nodeErrorStart.FindStringSubmatch(lines[start])
+	log := &ErrorLog{
+		Message:  joinMessage(m[1], m[2]),
+		Language: "JavaScript",
+	}
+
+	i := start + 1
+	for ; i < len(lines); i++ {
+		var function, file, lineStr string
+		if f := nodeFrameWithFn.FindStringSubmatch(lines[i]); f != nil {
+			function, file, lineStr = f[1], f[2], f[3]
+		} else if f := nodeFrameAnonyms.FindStringSubmatch(lines[i]); f != nil {
+			function, file, lineStr = "<anonymous>", f[1], f[2]
+		} else {
+			break
+		}
+
+		lineNo, _ := strconv.Atoi(lineStr)
+		log.Frames = append(log.Frames, StackFrame{
+			Function: function,
+			File:     strings.TrimPrefix(file, "file://"),
+			Line:     lineNo,
+		})
+	}
+
+	return log, i
+}
+
+// isNodeFrame reports whether line is a Node.js stack frame
+func isNodeFrame(line string) bool {
+	return nodeFrameWithFn.MatchString(line) || nodeFrameAnonyms.MatchString(line)
+}
+
+// joinMessage joins an exception type and its optional message
+func joinMessage(kind, message string) string {
+	if message == "" {
+		return kind
+	}
+	return kind + ": " + message
+}
+
+// pathResolver maps file paths found in logs onto files in a repository
+type pathResolver struct {
+	repoPath string
+	byName   map[string][]string // base name -> repository-relative paths
+}
+
+// newPathResolver creates a resolver for the repository at repoPath
+func newPathResolver(repoPath string) *pathResolver {
+	return &pathResolver{repoPath: repoPath}
+}
+
+// normalize rewrites the frame paths of log and its causes to repository-relative
+// paths, and points log.File and log.Line at the innermost repository frame
+func (r *pathResolver) normalize(log *ErrorLog) {
+	for l := log; l != nil; l = l.Cause {
+		for i := range l.Frames {
+			l.Frames[i].File, l.Frames[i].InRepo = r.resolve(l.Frames[i].File)
+		}
+		if l.File != "" {
+			l.File, _ = r.resolve(l.File)
+		}
+		if l.File == "" {
+			for _, frame := range l.Frames {
+				if frame.InRepo {
+					l.File = frame.File
+					l.Line = frame.Line
+					break
+				}
+			}
+		}
+	}
+}
+
+// resolve returns the repository-relative form of path and whether the file
+// exists in the repository. Unresolvable paths are returned cleaned.
+func (r *pathResolver) resolve(path string) (string, bool) {
+	cleaned := filepath.ToSlash(filepath.Clean(strings.ReplaceAll(path, `\`, "/")))
+	if r.repoPath == "" || path == "" {
+		return cleaned, false
+	}
+
+	// Paths under the repository root are made relative directly
+	if filepath.IsAbs(cleaned) {
+		if rel, err := filepath.Rel(r.repoPath, cleaned); err == nil && !strings.HasPrefix(rel, "..") {
+			if _, err := os.Stat(filepath.Join(r.repoPath, rel)); err == nil {
+				return filepath.ToSlash(rel), true
+			}
+		}
+	}
+
+	// Otherwise pick the repository file sharing the longest path suffix,
+	// which handles CI checkouts in other directories and Java package paths.
+	// A shared base name alone is not enough, so files such as the Go
+	// runtime's panic.go are not taken for a repository file of that name,
+	// unless the whole repository path matches. Ties are left unresolved.
+	if r.byName == nil {
+		r.index()
+	}
+	candidates := r.byName[filepath.Base(cleaned)]
+	best, bestScore, tied := "", 0, false
+	for _, candidate := range candidates {
+		score := commonSuffixSegments(candidate, cleaned)
+		if score < 2 && score < strings.Count(candidate, "/")+1 {
+			continue
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = candidate, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+	if best == "" || tied {
+		return cleaned, false
+	}
+	return best, true
+}
+
+// index builds the base name lookup table for the repository
+func (r *pathResolver) index() {
+	r.byName = make(map[string][]string)
+	_ = filepath.Walk(r.repoPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != r.repoPath && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(r.repoPath, path)
+		if err != nil {
+			return nil
+		}
+		r.byName[info.Name()] = append(r.byName[info.Name()], filepath.ToSlash(rel))
+		return nil
+	})
+}
+
+// commonSuffixSegments counts the trailing path segments shared by a and b
+func commonSuffixSegments(a, b string) int {
+	as := strings.Split(a, "/")
+	bs := strings.Split(b, "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[len(as)-1-n] == bs[len(bs)-1-n] {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,286 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule IDs of the findings reported by the suppression audit
+const (
+	RuleUnusedSuppression   = "unused-suppression"
+	RuleSuppressionNoReason = "suppression-without-reason"
+)
+
+// Suppression is an inline comment that silences findings on one line
+type Suppression struct {
+	File       string   `json:"file"`
+	Line       int      `json:"line"`            // line of the comment
+	TargetLine int      `json:"targetLine"`      // line whose findings are suppressed
+	Rules      []string `json:"rules,omitempty"` // every rule when empty
+	Reason     string   `json:"reason,omitempty"`
+	Syntax     string   `json:"syntax"` // nolint, codeanalyzer:ignore, eslint-disable, noqa, pylint
+	Used       bool     `json:"used"`
+}
+
+// FindingSuppression records why a finding is suppressed, as in SARIF
+type FindingSuppression struct {
+	Kind          string `json:"kind"` // inSource
+	Justification string `json:"justification,omitempty"`
+	Line          int    `json:"line"` // line of the suppression comment
+}
+
+// SuppressionReport audits the suppressions of a repository
+type SuppressionReport struct {
+	Suppressions  []Suppression `json:"suppressions"`
+	Unused        []Suppression `json:"unused"`        // matched no finding
+	MissingReason []Suppression `json:"missingReason"` // give no reason
+}
+
+// suppressionSyntax recognizes one suppression comment syntax. The rules
+// group holds a comma separated rule list, the reason group the
+// optional justification.
+type suppressionSyntax struct {
+	name     string
+	pattern  *regexp.Regexp
+	nextLine bool // applies to the next line even when trailing code
+}
+
+var (
+	// codeanalyzer:ignore rule[,rule] reason, in any language
+	ignoreSyntax = suppressionSyntax{
+		name:    "codeanalyzer:ignore",
+		pattern: regexp.MustCompile(`^codeanalyzer:ignore(?:\s+(?P<rules>[\w./-]+(?:,[\w./-]+)*))?(?:\s+(?P<reason>.*))?$`),
+	}
+	// nolint, nolint:rule[,rule] // reason
+	nolintSyntax = suppressionSyntax{
+		name:    "nolint",
+		pattern: regexp.MustCompile(`^nolint(?::(?P<rules>[\w./-]+(?:,[\w./-]+)*))?(?:\s*//\s*(?P<reason>.*))?$`),
+	}
+	// eslint-disable-line rule[, rule] -- reason
+	eslintLineSyntax = suppressionSyntax{
+		name:    "eslint-disable",
+		pattern: regexp.MustCompile(`^eslint-disable-line(?:\s+(?P<rules>[\w@./-]+(?:\s*,\s*[\w@./-]+)*))?(?:\s+--\s*(?P<reason>.*))?$`),
+	}
+	// eslint-disable-next-line rule[, rule] -- reason
+	eslintNextLineSyntax = suppressionSyntax{
+		name:     "eslint-disable",
+		pattern:  regexp.MustCompile(`^eslint-disable-next-line(?:\s+(?P<rules>[\w@./-]+(?:\s*,\s*[\w@./-]+)*))?(?:\s+--\s*(?P<reason>.*))?$`),
+		nextLine: true,
+	}
+	// noqa, noqa: rule[,rule] reason
+	noqaSyntax = suppressionSyntax{
+		name:    "noqa",
+		pattern: regexp.MustCompile(`^(?i:noqa)(?::\s*(?P<rules>[\w./-]+(?:\s*,\s*[\w./-]+)*))?(?:\s+(?P<reason>.*))?$`),
+	}
+	// pylint: disable=rule[,rule] reason
+	pylintSyntax = suppressionSyntax{
+		name:    "pylint",
+		pattern: regexp.MustCompile(`^pylint:\s*disable=(?P<rules>[\w./-]+(?:\s*,\s*[\w./-]+)*)(?:\s+(?P<reason>.*))?$`),
+	}
+)
+
+// suppressionSyntaxes lists the syntaxes honored per language
+var suppressionSyntaxes = map[string][]suppressionSyntax{
+	"Go":         {ignoreSyntax, nolintSyntax},
+	"JavaScript": {ignoreSyntax, eslintLineSyntax, eslintNextLineSyntax, nolintSyntax},
+	"TypeScript": {ignoreSyntax, eslintLineSyntax, eslintNextLineSyntax, nolintSyntax},
+	"Python":     {ignoreSyntax, noqaSyntax, pylintSyntax},
+	"Java":       {ignoreSyntax, nolintSyntax},
+	"C/C++":      {ignoreSyntax, nolintSyntax},
+}
+
+// ApplySuppressions marks the findings silenced by inline comments as
+// suppressed. Suppressed findings are kept, so they still show up in
+// results and SARIF. The report lists every suppression with those that
+// matched nothing and those without a reason.
+func (s *Service) ApplySuppressions(files []SourceFile, findings []AnalysisResult) ([]AnalysisResult, *SuppressionReport, error) {
+	report := &SuppressionReport{Suppressions: []Suppression{}, Unused: []Suppression{}, MissingReason: []Suppression{}}
+	byLine := make(map[string]map[int][]int) // file -> target line -> suppressions
+	for _, file := range files {
+		src, err := readSource(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		p := normalizeGraphPath(file.Path)
+		for _, sup := range parseSuppressions(p, file.Language, string(src)) {
+			if byLine[p] == nil {
+				byLine[p] = make(map[int][]int)
+			}
+			byLine[p][sup.TargetLine] = append(byLine[p][sup.TargetLine], len(report.Suppressions))
+			report.Suppressions = append(report.Suppressions, sup)
+		}
+	}
+
+	result := make([]AnalysisResult, len(findings))
+	copy(result, findings)
+	for i := range result {
+		f := &result[i]
+		for _, j := range byLine[normalizeGraphPath(f.File)][f.Line] {
+			sup := &report.Suppressions[j]
+			if !sup.matches(f.Rule) {
+				continue
+			}
+			sup.Used = true
+			if f.Suppression == nil {
+				f.Suppression = &FindingSuppression{Kind: "inSource", Justification: sup.Reason, Line: sup.Line}
+			}
+		}
+	}
+
+	for _, sup := range report.Suppressions {
+		if !sup.Used {
+			report.Unused = append(report.Unused, sup)
+		}
+		if sup.Reason == "" {
+			report.MissingReason = append(report.MissingReason, sup)
+		}
+	}
+	return result, report, nil
+}
+
+// matches reports whether the suppression silences a rule
+func (sup *Suppression) matches(rule string) bool {
+	if len(sup.Rules) == 0 {
+		return true
+	}
+	for _, r := range sup.Rules {
+		if r == rule || r == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// Findings reports unused suppressions and suppressions without a reason
+// as findings of their own
+func (r *SuppressionReport) Findings() []AnalysisResult {
+	var findings []AnalysisResult
+	for _, sup := range r.Unused {
+		findings = append(findings, AnalysisResult{
+			Rule:    RuleUnusedSuppression,
+			File:    sup.File,
+			Line:    sup.Line,
+			Message: fmt.Sprintf("%s suppression matches no finding", sup.Syntax),
+			Level:   "warning",
+		})
+	}
+	for _, sup := range r.MissingReason {
+		findings = append(findings, AnalysisResult{
+			Rule:    RuleSuppressionNoReason,
+			File:    sup.File,
+			Line:    sup.Line,
+			Message: fmt.Sprintf("%s suppression gives no reason", sup.Syntax),
+			Level:   "info",
+		})
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+// parseSuppressions finds the suppression comments of a file. A comment
+// trailing code applies to its own line, a comment on a line of its own to
+// the next line with code.
+func parseSuppressions(path, language, src string) []Suppression {
+	syntaxes := suppressionSyntaxes[language]
+	if len(syntaxes) == 0 {
+		return nil
+	}
+	marker := "//"
+	if language == "Python" {
+		marker = "#"
+	}
+
+	lines := strings.Split(src, "\n")
+	var sups []Suppression
+	var pending []int // own-line suppressions waiting for a line of code
+	for i, line := range lines {
+		code, comment, ok := splitLineComment(line, marker)
+		if strings.TrimSpace(code) != "" {
+			for _, j := range pending {
+				sups[j].TargetLine = i + 1
+			}
+			pending = pending[:0]
+		}
+		if !ok {
+			continue
+		}
+
+		// The suppression may follow another comment on the same line
+		for rest := comment; ; {
+			sup, nextLine, ok := parseSuppression(strings.TrimSpace(rest), syntaxes)
+			if !ok {
+				idx := strings.Index(rest, marker)
+				if idx < 0 {
+					break
+				}
+				rest = rest[idx+len(marker):]
+				continue
+			}
+			sup.File = path
+			sup.Line = i + 1
+			if nextLine || strings.TrimSpace(code) == "" {
+				pending = append(pending, len(sups))
+			} else {
+				sup.TargetLine = i + 1
+			}
+			sups = append(sups, sup)
+			break
+		}
+	}
+
+	// Suppressions at the end of the file apply to nothing
+	for _, j := range pending {
+		sups[j].TargetLine = 0
+	}
+	return sups
+}
+
+// parseSuppression parses the text of one comment
+func parseSuppression(text string, syntaxes []suppressionSyntax) (Suppression, bool, bool) {
+	for _, syntax := range syntaxes {
+		m := syntax.pattern.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		sup := Suppression{Syntax: syntax.name}
+		if rules := m[syntax.pattern.SubexpIndex("rules")]; rules != "" {
+			for _, r := range strings.Split(rules, ",") {
+				sup.Rules = append(sup.Rules, strings.TrimSpace(r))
+			}
+		}
+		if idx := syntax.pattern.SubexpIndex("reason"); idx >= 0 {
+			sup.Reason = strings.TrimSpace(m[idx])
+		}
+		return sup, syntax.nextLine, true
+	}
+	return Suppression{}, false, false
+}
+
+// splitLineComment splits a line at the first comment marker outside a
+// string literal. Strings spanning lines are not tracked.
+func splitLineComment(line, marker string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case strings.HasPrefix(line[i:], marker):
+			return line[:i], line[i+len(marker):], true
+		}
+	}
+	return line, "", false
+}
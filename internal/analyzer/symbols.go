@@ -0,0 +1,670 @@
+package analyzer
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// symbolFile holds the symbols extracted from a non-Go source file
+type symbolFile struct {
+	Path     string
+	Language string
+	Lines    int
+	Symbols  []symbol
+	Imports  []string // module specifiers as written in the source
+}
+
+// symbol is a class, function or method declared in a source file
+type symbol struct {
+	Kind      string // NodeClass, NodeInterface, NodeFunction or NodeMethod
+	Name      string
+	Qualified string // name qualified by enclosing classes and functions
+	Parent    int    // index of the enclosing symbol, or -1
+	StartLine int
+	EndLine   int
+}
+
+// extractSymbols parses a JavaScript, TypeScript, Python or Java source file
+func extractSymbols(file SourceFile, src []byte) (*symbolFile, bool) {
+	sf := &symbolFile{
+		Path:     filepath.ToSlash(file.Path),
+		Language: file.Language,
+		Lines:    strings.Count(string(src), "\n") + 1,
+	}
+
+	switch file.Language {
+	case "JavaScript", "TypeScript":
+		extractCLikeSymbols(sf, tokenize(src, true), jsRules)
+	case "Java":
+		extractCLikeSymbols(sf, tokenize(src, false), javaRules)
+	case "Python":
+		extractPythonSymbols(sf, src)
+	default:
+		return nil, false
+	}
+
+	for i := range sf.Symbols {
+		sym := &sf.Symbols[i]
+		sym.Qualified = sym.Name
+		if sym.Parent >= 0 {
+			sym.Qualified = sf.Symbols[sym.Parent].Qualified + "." + sym.Name
+		}
+	}
+	return sf, true
+}
+
+// tokenKind classifies lexer tokens
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokPunct
+	tokString
+	tokNumber
+)
+
+// lexToken is a lexical token with the line it starts on
+type lexToken struct {
+	Kind tokenKind
+	Text string
+	Line int
+}
+
+// tokenize splits C-like source (JavaScript, TypeScript, Java) into tokens,
+// dropping comments. String contents are kept for import specifiers.
+// Regular expression literals are recognised when regex is set.
+func tokenize(src []byte, regex bool) []lexToken {
+	var (
+		toks []lexToken
+		line = 1
+		s    = string(src)
+	)
+
+	// A slash starts a regular expression unless it follows an operand
+	regexAllowed := func() bool {
+		if len(toks) == 0 {
+			return true
+		}
+		last := toks[len(toks)-1]
+		switch last.Kind {
+		case tokIdent:
+			return last.Text == "return" || last.Text == "typeof" || last.Text == "case"
+		case tokPunct:
+			return last.Text != ")" && last.Text != "]" && last.Text != "}"
+		}
+		return false
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				end = len(s) - i - 2
+			}
+			line += strings.Count(s[i:i+2+end], "\n")
+			i += end + 4
+		case strings.HasPrefix(s[i:], `"""`):
+			// Java text block
+			end := strings.Index(s[i+3:], `"""`)
+			if end < 0 {
+				end = len(s) - i - 3
+			}
+			toks = append(toks, lexToken{tokString, s[i+3 : i+3+end], line})
+			line += strings.Count(s[i:i+3+end], "\n")
+			i += end + 6
+		case c == '"' || c == '\'' || c == '`':
+			start, startLine := i, line
+			i++
+			depth := 0 // ${ } nesting inside template literals
+			for i < len(s) {
+				if s[i] == '\\' {
+					i += 2
+					continue
+				}
+				if s[i] == '\n' {
+					line++
+					if c != '`' {
+						break
+					}
+				}
+				if c == '`' && strings.HasPrefix(s[i:], "${") {
+					depth++
+					i += 2
+					continue
+				}
+				if c == '`' && depth > 0 && s[i] == '}' {
+					depth--
+				} else if s[i] == c && depth == 0 {
+					break
+				}
+				i++
+			}
+			end := i
+			if end > len(s) {
+				end = len(s)
+			}
+			toks = append(toks, lexToken{tokString, s[start+1 : end], startLine})
+			i++
+		case c == '/' && regex && regexAllowed():
+			i++
+			inClass := false
+			for i < len(s) && s[i] != '\n' {
+				if s[i] == '\\' {
+					i += 2
+					continue
+				}
+				if s[i] == '[' {
+					inClass = true
+				} else if s[i] == ']' {
+					inClass = false
+				} else if s[i] == '/' && !inClass {
+					break
+				}
+				i++
+			}
+			i++
+			// Skip flags
+			for i < len(s) && isIdentByte(s[i]) {
+				i++
+			}
+			toks = append(toks, lexToken{tokString, "", line})
+		case isIdentStart(c):
+			start := i
+			i++
+			for i < len(s) && isIdentByte(s[i]) {
+				i++
+			}
+			toks = append(toks, lexToken{tokIdent, s[start:i], line})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(s) && (isIdentByte(s[i]) || s[i] == '.') {
+				i++
+			}
+			toks = append(toks, lexToken{tokNumber, s[start:i], line})
+		case strings.HasPrefix(s[i:], "=>"):
+			toks = append(toks, lexToken{tokPunct, "=>", line})
+			i += 2
+		default:
+			toks = append(toks, lexToken{tokPunct, string(c), line})
+			i++
+		}
+	}
+	return toks
+}
+
+// isIdentStart reports whether c can start an identifier
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || unicode.IsLetter(rune(c)) || c >= 0x80
+}
+
+// isIdentByte reports whether c can continue an identifier
+func isIdentByte(c byte) bool {
+	return isIdentStart(c) && c != '@' || c >= '0' && c <= '9'
+}
+
+// clikeRules describes the declaration syntax of a C-like language
+type clikeRules struct {
+	classKeywords     map[string]string // keyword -> node type
+	nonMethodKeywords map[string]bool   // identifiers followed by ( that are not declarations
+	javaStyle         bool
+}
+
+var controlKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true,
+	"new": true, "typeof": true, "function": true, "synchronized": true, "super": true,
+	"this": true, "throw": true, "await": true, "else": true, "do": true, "try": true,
+	"import": true, "require": true, "with": true, "yield": true, "delete": true,
+}
+
+var (
+	jsRules = clikeRules{
+		classKeywords:     map[string]string{"class": NodeClass, "interface": NodeInterface},
+		nonMethodKeywords: controlKeywords,
+	}
+	javaRules = clikeRules{
+		classKeywords:     map[string]string{"class": NodeClass, "interface": NodeInterface, "enum": NodeClass, "record": NodeClass},
+		nonMethodKeywords: controlKeywords,
+		javaStyle:         true,
+	}
+)
+
+// clikeScope is an open brace; sym is the symbol whose body it is, or -1
+type clikeScope struct {
+	sym   int
+	class bool
+}
+
+// extractCLikeSymbols finds imports, classes, functions and methods in tokens
+func extractCLikeSymbols(sf *symbolFile, toks []lexToken, rules clikeRules) {
+	var (
+		scopes  []clikeScope
+		pending = -1 // symbol whose body starts at the next {
+	)
+
+	current := func() clikeScope {
+		if len(scopes) == 0 {
+			return clikeScope{sym: -1}
+		}
+		return scopes[len(scopes)-1]
+	}
+	// enclosing returns the innermost symbol around the current position
+	enclosing := func() int {
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if scopes[i].sym >= 0 {
+				return scopes[i].sym
+			}
+		}
+		return -1
+	}
+	add := func(kind, name string, line int) int {
+		sf.Symbols = append(sf.Symbols, symbol{Kind: kind, Name: name, Parent: enclosing(), StartLine: line, EndLine: line})
+		return len(sf.Symbols) - 1
+	}
+	text := func(i int) string {
+		if i < 0 || i >= len(toks) {
+			return ""
+		}
+		return toks[i].Text
+	}
+
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+
+		switch {
+		case tok.Kind == tokPunct && tok.Text == "{":
+			scope := clikeScope{sym: pending}
+			if pending >= 0 {
+				kind := sf.Symbols[pending].Kind
+				scope.class = kind == NodeClass || kind == NodeInterface
+			}
+			scopes = append(scopes, scope)
+			pending = -1
+			continue
+		case tok.Kind == tokPunct && tok.Text == "}":
+			if len(scopes) > 0 {
+				if sym := scopes[len(scopes)-1].sym; sym >= 0 {
+					sf.Symbols[sym].EndLine = tok.Line
+				}
+				scopes = scopes[:len(scopes)-1]
+			}
+			continue
+		case tok.Kind == tokPunct && tok.Text == ";":
+			// Declarations without bodies, such as abstract methods
+			pending = -1
+			continue
+		case tok.Kind != tokIdent:
+			continue
+		}
+
+		// Imports
+		if imp, ok := importSpecifier(toks, i, rules.javaStyle); ok {
+			sf.Imports = append(sf.Imports, imp)
+			continue
+		}
+
+		// Classes and interfaces
+		if kind, ok := rules.classKeywords[tok.Text]; ok && i+1 < len(toks) && toks[i+1].Kind == tokIdent {
+			if text(i-1) == "." || (tok.Text == "record" && !rules.javaStyle) {
+				continue
+			}
+			pending = add(kind, toks[i+1].Text, tok.Line)
+			i++
+			continue
+		}
+
+		// function name( ... ) {
+		if !rules.javaStyle && tok.Text == "function" {
+			name := "<anonymous>"
+			j := i + 1
+			if text(j) == "*" {
+				j++
+			}
+			if j < len(toks) && toks[j].Kind == tokIdent {
+				name = toks[j].Text
+			} else if text(i-1) == "=" || text(i-1) == ":" {
+				name = assignedName(toks, i-1)
+			}
+			if name != "<anonymous>" {
+				pending = add(NodeFunction, name, tok.Line)
+			}
+			continue
+		}
+
+		// const name = ( ... ) => and class fields holding arrow functions
+		isVar := tok.Text == "const" || tok.Text == "let" || tok.Text == "var"
+		if !rules.javaStyle && (isVar && i+1 < len(toks) && toks[i+1].Kind == tokIdent || current().class && text(i-1) != ".") {
+			nameAt := i
+			if isVar {
+				nameAt = i + 1
+			}
+			if eq := assignmentOperator(toks, nameAt+1); eq > 0 {
+				if end, ok := arrowFunction(toks, eq+1); ok {
+					kind := NodeFunction
+					if !isVar {
+						kind = NodeMethod
+					}
+					sym := add(kind, toks[nameAt].Text, tok.Line)
+					if text(end+1) == "{" {
+						pending = sym
+					} else {
+						sf.Symbols[sym].EndLine = statementEndLine(toks, end+1)
+					}
+					i = end
+					continue
+				}
+			}
+			if isVar {
+				continue
+			}
+		}
+
+		// Methods: name( ... ) { directly inside a class body
+		if current().class && text(i+1) == "(" && !rules.nonMethodKeywords[tok.Text] && !strings.HasPrefix(tok.Text, "@") {
+			closing := matchingParen(toks, i+1)
+			if closing < 0 {
+				continue
+			}
+			j := closing + 1
+			// Skip return type annotations and throws clauses up to the body
+			for j < len(toks) && toks[j].Text != "{" && toks[j].Text != ";" && toks[j].Text != "=>" && toks[j].Text != "}" {
+				j++
+			}
+			if text(j) == "{" {
+				pending = add(NodeMethod, tok.Text, tok.Line)
+				i = j - 1
+			}
+			continue
+		}
+	}
+}
+
+// importSpecifier returns the module imported by the statement at toks[i]
+func importSpecifier(toks []lexToken, i int, javaStyle bool) (string, bool) {
+	tok := toks[i]
+	if i > 0 && toks[i-1].Text == "." {
+		return "", false
+	}
+
+	if javaStyle {
+		if tok.Text != "import" {
+			return "", false
+		}
+		var parts []string
+		for j := i + 1; j < len(toks) && toks[j].Text != ";"; j++ {
+			if toks[j].Text == "static" {
+				continue
+			}
+			parts = append(parts, toks[j].Text)
+		}
+		return strings.TrimSuffix(strings.Join(parts, ""), ".*"), len(parts) > 0
+	}
+
+	switch tok.Text {
+	case "import", "export":
+		// import x from "m", import "m", export * from "m", import("m")
+		for j := i + 1; j < len(toks) && j < i+64; j++ {
+			if toks[j].Kind == tokString {
+				if j == i+1 || toks[j-1].Text == "from" || toks[j-1].Text == "(" && j == i+2 {
+					return toks[j].Text, true
+				}
+			}
+			if toks[j].Text == ";" || toks[j].Text == "{" && tok.Text == "export" && j == i+1 {
+				break
+			}
+			if tok.Text == "export" && j == i+1 && toks[j].Text != "*" && toks[j].Text != "{" {
+				break
+			}
+		}
+	case "require":
+		if i+2 < len(toks) && toks[i+1].Text == "(" && toks[i+2].Kind == tokString {
+			return toks[i+2].Text, true
+		}
+	}
+	return "", false
+}
+
+// assignedName returns the property or variable name assigned at toks[i],
+// which is an "=" or ":" token
+func assignedName(toks []lexToken, i int) string {
+	if i > 0 && toks[i-1].Kind == tokIdent {
+		return toks[i-1].Text
+	}
+	return "<anonymous>"
+}
+
+// assignmentOperator returns the position of the = following a declared
+// name at toks[i], skipping a type annotation on the same line, or 0
+func assignmentOperator(toks []lexToken, i int) int {
+	if i >= len(toks) {
+		return 0
+	}
+	if toks[i].Text == "=" {
+		return i
+	}
+	if toks[i].Text != ":" && toks[i].Text != "?" {
+		return 0
+	}
+	for j := i + 1; j < len(toks) && toks[j].Line == toks[i].Line; j++ {
+		switch toks[j].Text {
+		case "=":
+			return j
+		case ";", "{", "(":
+			return 0
+		}
+	}
+	return 0
+}
+
+// arrowFunction reports whether an arrow function starts at toks[i] and
+// returns the position of its => token
+func arrowFunction(toks []lexToken, i int) (int, bool) {
+	if i < len(toks) && toks[i].Text == "async" {
+		i++
+	}
+	if i >= len(toks) {
+		return 0, false
+	}
+	switch {
+	case toks[i].Kind == tokIdent && i+1 < len(toks) && toks[i+1].Text == "=>":
+		return i + 1, true
+	case toks[i].Text == "(":
+		closing := matchingParen(toks, i)
+		if closing < 0 {
+			return 0, false
+		}
+		// Optional TypeScript return type annotation
+		j := closing + 1
+		if j < len(toks) && toks[j].Text == ":" {
+			for j < len(toks) && toks[j].Text != "=>" && toks[j].Text != ";" && toks[j].Text != "{" {
+				j++
+			}
+		}
+		if j < len(toks) && toks[j].Text == "=>" {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// statementEndLine returns the last line of the expression statement starting at toks[i]
+func statementEndLine(toks []lexToken, i int) int {
+	depth := 0
+	line := toks[len(toks)-1].Line
+	for j := i; j < len(toks); j++ {
+		switch toks[j].Text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth < 0 {
+				return toks[j-1].Line
+			}
+		case ";":
+			if depth == 0 {
+				return toks[j].Line
+			}
+		}
+		if depth == 0 && j+1 < len(toks) && toks[j+1].Line > toks[j].Line && !continuesExpression(toks[j], toks[j+1]) {
+			return toks[j].Line
+		}
+		line = toks[j].Line
+	}
+	return line
+}
+
+// continuesExpression reports whether an expression continues from a to b on the next line
+func continuesExpression(a, b lexToken) bool {
+	if a.Kind == tokPunct && a.Text != ")" && a.Text != "]" && a.Text != "}" {
+		return true
+	}
+	return b.Kind == tokPunct && b.Text != "(" && b.Text != "[" && b.Text != "{"
+}
+
+// matchingParen returns the position of the ) closing the ( at toks[i]
+func matchingParen(toks []lexToken, i int) int {
+	depth := 0
+	for j := i; j < len(toks); j++ {
+		switch toks[j].Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// symbolNodeID returns the graph node ID of a symbol in a non-Go file
+func symbolNodeID(sf *symbolFile, sym symbol) string {
+	prefix := "func:"
+	switch sym.Kind {
+	case NodeClass, NodeInterface:
+		prefix = "type:"
+	case NodeMethod:
+		prefix = "method:"
+	}
+	return prefix + sf.Path + "#" + sym.Qualified
+}
+
+// buildSymbolGraph returns graph nodes for the symbols of non-Go files.
+// Imports are resolved to the repository files in paths where possible and
+// otherwise to external package nodes.
+func buildSymbolGraph(files []*symbolFile, paths map[string]bool) []GraphNode {
+	b := &goGraphBuilder{index: make(map[string]int), edges: make(map[string]bool)}
+
+	for _, sf := range files {
+		fileID := fileNodeID(sf.Path)
+		b.addNode(GraphNode{
+			ID:        fileID,
+			Type:      NodeFile,
+			Name:      path.Base(sf.Path),
+			Path:      sf.Path,
+			StartLine: 1,
+			EndLine:   sf.Lines,
+			Properties: map[string]interface{}{
+				"language": sf.Language,
+			},
+		})
+
+		ids := make([]string, len(sf.Symbols))
+		for i, sym := range sf.Symbols {
+			ids[i] = symbolNodeID(sf, sym)
+			node := GraphNode{
+				ID:        ids[i],
+				Type:      sym.Kind,
+				Name:      sym.Name,
+				Path:      sf.Path,
+				StartLine: sym.StartLine,
+				EndLine:   sym.EndLine,
+			}
+			if sym.Kind == NodeMethod && sym.Parent >= 0 {
+				node.Receiver = sf.Symbols[sym.Parent].Name
+			}
+			b.addNode(node)
+
+			parent := fileID
+			if sym.Parent >= 0 {
+				parent = ids[sym.Parent]
+			}
+			b.addEdge(parent, EdgeContains, ids[i])
+		}
+	}
+
+	for _, sf := range files {
+		for _, spec := range sf.Imports {
+			target := resolveImport(sf, spec, paths)
+			if target == "" {
+				target = packageNodeID(spec)
+				b.addNode(GraphNode{
+					ID:         target,
+					Type:       NodePackage,
+					Name:       spec,
+					Package:    spec,
+					Properties: map[string]interface{}{"external": true},
+				})
+			}
+			b.addEdge(fileNodeID(sf.Path), EdgeImports, target)
+		}
+	}
+
+	return b.nodes
+}
+
+// resolveImport resolves an import specifier to a repository file node
+func resolveImport(sf *symbolFile, spec string, paths map[string]bool) string {
+	var candidates []string
+	switch sf.Language {
+	case "JavaScript", "TypeScript":
+		if !strings.HasPrefix(spec, ".") {
+			return ""
+		}
+		base := path.Join(path.Dir(sf.Path), spec)
+		candidates = append(candidates, base)
+		for _, ext := range []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs"} {
+			candidates = append(candidates, base+ext, base+"/index"+ext)
+		}
+	case "Python":
+		dir := ""
+		rel := strings.TrimLeft(spec, ".")
+		if dots := len(spec) - len(rel); dots > 0 {
+			// Relative imports start from the importing package
+			dir = path.Dir(sf.Path)
+			for i := 1; i < dots; i++ {
+				dir = path.Dir(dir)
+			}
+		}
+		base := path.Join(dir, strings.ReplaceAll(rel, ".", "/"))
+		candidates = append(candidates, base+".py", base+"/__init__.py")
+	case "Java":
+		suffix := strings.ReplaceAll(spec, ".", "/") + ".java"
+		for p := range paths {
+			if p == suffix || strings.HasSuffix(p, "/"+suffix) {
+				return fileNodeID(p)
+			}
+		}
+		return ""
+	}
+
+	for _, candidate := range candidates {
+		if paths[candidate] {
+			return fileNodeID(candidate)
+		}
+	}
+	return ""
+}
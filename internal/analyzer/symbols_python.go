@@ -0,0 +1,172 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	pyDef        = regexp.MustCompile(`^(?:async\s+)?def\s+([A-Za-z_]\w*)`)
+	pyClass      = regexp.MustCompile(`^class\s+([A-Za-z_]\w*)`)
+	pyImport     = regexp.MustCompile(`^import\s+(.+)$`)
+	pyFromImport = regexp.MustCompile(`^from\s+(\S+)\s+import\s+(.+)$`)
+)
+
+// pyBlock is a def or class whose body is still open
+type pyBlock struct {
+	sym    int
+	indent int
+}
+
+// extractPythonSymbols finds imports, classes, functions and methods in
+// Python source using indentation to delimit their bodies
+func extractPythonSymbols(sf *symbolFile, src []byte) {
+	var (
+		blocks   []pyBlock
+		scan     pyLineScanner
+		lastLine int // last line holding code
+	)
+
+	closeBlocks := func(indent int) {
+		for len(blocks) > 0 && blocks[len(blocks)-1].indent >= indent {
+			sf.Symbols[blocks[len(blocks)-1].sym].EndLine = lastLine
+			blocks = blocks[:len(blocks)-1]
+		}
+	}
+
+	for n, line := range strings.Split(string(src), "\n") {
+		lineNo := n + 1
+		continuation := scan.inString != "" || scan.depth > 0
+		code := scan.scan(line)
+		trimmed := strings.TrimSpace(code)
+		if trimmed == "" {
+			if !continuation && strings.TrimSpace(line) == "" {
+				continue
+			}
+			if continuation {
+				lastLine = lineNo
+			}
+			continue
+		}
+		if continuation {
+			lastLine = lineNo
+			continue
+		}
+
+		indent := indentWidth(line)
+		closeBlocks(indent)
+		lastLine = lineNo
+
+		parent := -1
+		if len(blocks) > 0 {
+			parent = blocks[len(blocks)-1].sym
+		}
+
+		if m := pyDef.FindStringSubmatch(trimmed); m != nil {
+			kind := NodeFunction
+			if parent >= 0 && sf.Symbols[parent].Kind == NodeClass {
+				kind = NodeMethod
+			}
+			sf.Symbols = append(sf.Symbols, symbol{Kind: kind, Name: m[1], Parent: parent, StartLine: lineNo, EndLine: lineNo})
+			blocks = append(blocks, pyBlock{sym: len(sf.Symbols) - 1, indent: indent})
+			continue
+		}
+		if m := pyClass.FindStringSubmatch(trimmed); m != nil {
+			sf.Symbols = append(sf.Symbols, symbol{Kind: NodeClass, Name: m[1], Parent: parent, StartLine: lineNo, EndLine: lineNo})
+			blocks = append(blocks, pyBlock{sym: len(sf.Symbols) - 1, indent: indent})
+			continue
+		}
+
+		if m := pyImport.FindStringSubmatch(trimmed); m != nil {
+			for _, part := range strings.Split(m[1], ",") {
+				if fields := strings.Fields(part); len(fields) > 0 {
+					sf.Imports = append(sf.Imports, fields[0])
+				}
+			}
+		} else if m := pyFromImport.FindStringSubmatch(trimmed); m != nil {
+			if strings.Trim(m[1], ".") != "" {
+				sf.Imports = append(sf.Imports, m[1])
+				continue
+			}
+			// from . import a, b imports sibling modules
+			for _, part := range strings.Split(strings.Trim(m[2], "()"), ",") {
+				if fields := strings.Fields(part); len(fields) > 0 {
+					sf.Imports = append(sf.Imports, m[1]+fields[0])
+				}
+			}
+		}
+	}
+
+	closeBlocks(0)
+}
+
+// indentWidth returns the indentation of a line, expanding tabs to 8 columns
+func indentWidth(line string) int {
+	width := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += 8 - width%8
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// pyLineScanner tracks strings and brackets that span lines
+type pyLineScanner struct {
+	inString string // open triple-quote delimiter
+	depth    int    // open (, [ and { brackets
+}
+
+// scan consumes a physical line and returns its code with strings and
+// comments blanked out
+func (p *pyLineScanner) scan(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		if p.inString != "" {
+			end := strings.Index(line[i:], p.inString)
+			if end < 0 {
+				return b.String()
+			}
+			i += end + len(p.inString)
+			p.inString = ""
+			b.WriteString(" ")
+			continue
+		}
+
+		c := line[i]
+		switch {
+		case c == '#':
+			return b.String()
+		case strings.HasPrefix(line[i:], `"""`) || strings.HasPrefix(line[i:], "'''"):
+			p.inString = line[i : i+3]
+			i += 3
+		case c == '"' || c == '\'':
+			i++
+			for i < len(line) && line[i] != c {
+				if line[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+			b.WriteString(" ")
+		default:
+			switch c {
+			case '(', '[', '{':
+				p.depth++
+			case ')', ']', '}':
+				if p.depth > 0 {
+					p.depth--
+				}
+			}
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,318 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// CommitInfo describes a commit
+type CommitInfo struct {
+	Hash    string    `json:"hash"`
+	Message string    `json:"message"`
+	Author  string    `json:"author"`
+	When    time.Time `json:"when"`
+}
+
+// LineRange is an inclusive range of lines
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// FileChange is a file changed by a commit, with the changed line ranges
+// in the new version of the file
+type FileChange struct {
+	Path    string      `json:"path"`              // empty when the file was deleted
+	OldPath string      `json:"oldPath,omitempty"` // empty when the file was added
+	Lines   []LineRange `json:"lines"`
+}
+
+// CommitDiff is the change a commit made to its first parent
+type CommitDiff struct {
+	Commit CommitInfo   `json:"commit"`
+	Patch  string       `json:"patch"`
+	Files  []FileChange `json:"files"`
+}
+
+// repoPath returns the directory of a repository of the workspace; IDs
+// are plain directory names, so they cannot point outside the workspace
+func (s *Service) repoPath(repoID string) (string, error) {
+	if repoID == "" || repoID == "." || repoID == ".." || strings.ContainsAny(repoID, `/\`) {
+		return "", fmt.Errorf("invalid repository id %q", repoID)
+	}
+	return filepath.Join(s.WorkspacePath, repoID), nil
+}
+
+// openRepository opens a repository of the workspace
+func (s *Service) openRepository(repoID string) (*git.Repository, error) {
+	repoPath, err := s.repoPath(repoID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+		return nil, errors.New("repository not found")
+	}
+
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+	return repo, nil
+}
+
+// resolveCommit resolves a branch, tag, hash or revision expression
+func resolveCommit(repo *git.Repository, ref string) (*object.Commit, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", ref, err)
+	}
+	return commit, nil
+}
+
+// commitInfo converts a go-git commit
+func commitInfo(c *object.Commit) CommitInfo {
+	return CommitInfo{
+		Hash:    c.Hash.String(),
+		Message: strings.TrimSpace(c.Message),
+		Author:  c.Author.Name,
+		When:    c.Author.When,
+	}
+}
+
+// ResolveRef resolves a branch, tag, hash or revision expression to the
+// commit it names
+func (s *Service) ResolveRef(repoID, ref string) (CommitInfo, error) {
+	repo, err := s.openRepository(repoID)
+	if err != nil {
+		return CommitInfo{}, err
+	}
+	commit, err := resolveCommit(repo, ref)
+	if err != nil {
+		return CommitInfo{}, err
+	}
+	return commitInfo(commit), nil
+}
+
+// HeadRef returns the branch checked out in a repository, or HEAD when it
+// is detached, and the commit it points to
+func (s *Service) HeadRef(repoID string) (string, CommitInfo, error) {
+	repo, err := s.openRepository(repoID)
+	if err != nil {
+		return "", CommitInfo{}, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", CommitInfo{}, fmt.Errorf("failed to get repository head: %w", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", CommitInfo{}, fmt.Errorf("failed to get head commit: %w", err)
+	}
+
+	ref := "HEAD"
+	if head.Name().IsBranch() {
+		ref = head.Name().Short()
+	}
+	return ref, commitInfo(commit), nil
+}
+
+// CommitRange lists the commits between a good and a bad ref, oldest
+// first, ending with bad. History is followed along first parents from bad
+// until it reaches good or one of its ancestors.
+func (s *Service) CommitRange(repoID, good, bad string) ([]CommitInfo, error) {
+	repo, err := s.openRepository(repoID)
+	if err != nil {
+		return nil, err
+	}
+	goodCommit, err := resolveCommit(repo, good)
+	if err != nil {
+		return nil, err
+	}
+	badCommit, err := resolveCommit(repo, bad)
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything reachable from good is known to be good
+	reachable := make(map[plumbing.Hash]bool)
+	ancestors, err := repo.Log(&git.LogOptions{From: goodCommit.Hash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit log: %w", err)
+	}
+	err = ancestors.ForEach(func(c *object.Commit) error {
+		reachable[c.Hash] = true
+		return nil
+	})
+	ancestors.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit log: %w", err)
+	}
+
+	var commits []CommitInfo
+	for c := badCommit; !reachable[c.Hash]; {
+		commits = append(commits, commitInfo(c))
+		if c.NumParents() == 0 {
+			return nil, fmt.Errorf("%s is not an ancestor of %s", good, bad)
+		}
+		if c, err = c.Parent(0); err != nil {
+			return nil, fmt.Errorf("failed to get parent commit: %w", err)
+		}
+	}
+
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
+
+// CheckoutCommit writes the tree of a commit into dir, a scratch worktree
+// that leaves the repository's own worktree untouched
+func (s *Service) CheckoutCommit(repoID, ref, dir string) error {
+	repo, err := s.openRepository(repoID)
+	if err != nil {
+		return err
+	}
+	commit, err := resolveCommit(repo, ref)
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to get commit tree: %w", err)
+	}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		path := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if f.Mode == filemode.Symlink {
+			target, err := f.Contents()
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, path)
+		}
+
+		perm := os.FileMode(0644)
+		if f.Mode == filemode.Executable {
+			perm = 0755
+		}
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check out %s: %w", ref, err)
+	}
+	return nil
+}
+
+// CommitDiff returns the patch of a commit against its first parent, and
+// the lines it changed in each file
+func (s *Service) CommitDiff(repoID, ref string) (*CommitDiff, error) {
+	repo, err := s.openRepository(repoID)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := resolveCommit(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit tree: %w", err)
+	}
+	// Root commits are compared with the empty tree
+	parentTree := &object.Tree{}
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent commit: %w", err)
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, fmt.Errorf("failed to get parent tree: %w", err)
+		}
+	}
+	patch, err := parentTree.Patch(tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff commit: %w", err)
+	}
+
+	result := &CommitDiff{
+		Commit: commitInfo(commit),
+		Patch:  patch.String(),
+		Files:  []FileChange{},
+	}
+	for _, fp := range patch.FilePatches() {
+		from, to := fp.Files()
+		change := FileChange{Lines: []LineRange{}}
+		if from != nil {
+			change.OldPath = from.Path()
+		}
+		if to != nil {
+			change.Path = to.Path()
+			change.Lines = changedLines(fp.Chunks())
+		}
+		result.Files = append(result.Files, change)
+	}
+	return result, nil
+}
+
+// changedLines returns the ranges of added lines in the new version of a
+// file; a deletion marks the line that follows it
+func changedLines(chunks []diff.Chunk) []LineRange {
+	ranges := []LineRange{}
+	add := func(start, end int) {
+		if n := len(ranges); n > 0 && ranges[n-1].End >= start-1 {
+			ranges[n-1].End = max(ranges[n-1].End, end)
+			return
+		}
+		ranges = append(ranges, LineRange{Start: start, End: end})
+	}
+
+	line := 0 // last line of the new file emitted so far
+	for _, chunk := range chunks {
+		n := strings.Count(chunk.Content(), "\n")
+		if !strings.HasSuffix(chunk.Content(), "\n") && chunk.Content() != "" {
+			n++
+		}
+		switch chunk.Type() {
+		case diff.Equal:
+			line += n
+		case diff.Add:
+			add(line+1, line+n)
+			line += n
+		case diff.Delete:
+			add(line+1, line+1)
+		}
+	}
+	return ranges
+}
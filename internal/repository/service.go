@@ -9,6 +9,7 @@ import (
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 )
 
 // RepoInfo contains information about a repository
@@ -248,6 +249,49 @@ func (s *Service) ListFiles(repoID string) ([]FileInfo, error) {
 	return files, nil
 }
 
+// FileChurn counts how many of the most recent commits touched each file,
+// as a change-frequency signal for fault localization
+func (s *Service) FileChurn(repoID string, maxCommits int) (map[string]int, error) {
+	repo, err := s.openRepository(repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository head: %w", err)
+	}
+
+	commits, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit log: %w", err)
+	}
+	defer commits.Close()
+
+	churn := make(map[string]int)
+	count := 0
+	err = commits.ForEach(func(c *object.Commit) error {
+		if maxCommits > 0 && count >= maxCommits {
+			return storer.ErrStop
+		}
+		count++
+
+		stats, err := c.Stats()
+		if err != nil {
+			return fmt.Errorf("failed to get stats for commit %s: %w", c.Hash, err)
+		}
+		for _, stat := range stats {
+			churn[stat.Name]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return churn, nil
+}
+
 // detectLanguage detects the language of a file based on its extension
 func detectLanguage(filename string) string {
 	ext := filepath.Ext(filename)
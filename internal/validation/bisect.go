@@ -0,0 +1,171 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+	"github.com/teathis/codeanalyzer/internal/repository"
+)
+
+// bisectSkipExitCode is the exit code git bisect run treats as untestable
+const bisectSkipExitCode = 125
+
+// BisectReport is the result of bisecting a failure
+type BisectReport struct {
+	Bisect     *analyzer.BisectResult `json:"bisect"`
+	Regression *analyzer.Regression   `json:"regression,omitempty"` // set when the culprit is unambiguous
+	LogPath    string                 `json:"logPath,omitempty"`
+	ErrorLogs  []analyzer.ErrorLog    `json:"errorLogs"` // errors of the culprit's failing test run
+}
+
+// Bisect finds the commit between good and bad that made the test command
+// fail. Each commit is checked out into a scratch worktree and built and
+// tested under opts; commits that do not build, time out or exit with 125
+// are skipped. The culprit's diff and the graph nodes it touched are
+// reported, and its failing test output is saved as a log of the repository.
+func (s *Service) Bisect(ctx context.Context, repos *repository.Service, repoID, good, bad string, opts Options, bisectOpts analyzer.BisectOptions) (*BisectReport, error) {
+	if len(opts.TestCommand) == 0 {
+		return nil, errors.New("no test command configured")
+	}
+
+	commits, err := repos.CommitRange(repoID, good, bad)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(commits))
+	for i, c := range commits {
+		hashes[i] = c.Hash
+	}
+
+	tmp, err := os.MkdirTemp("", "codeanalyzer-bisect-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bisect directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Reruns reuse the worktree of the commit under test
+	var worktree, checkedOut string
+	failures := make(map[string]*CommandResult)
+	test := func(ctx context.Context, commit string) (analyzer.BisectVerdict, error) {
+		if commit != checkedOut {
+			if worktree != "" {
+				os.RemoveAll(worktree)
+			}
+			worktree = filepath.Join(tmp, commit)
+			if err := repos.CheckoutCommit(repoID, commit, worktree); err != nil {
+				return "", err
+			}
+			checkedOut = commit
+		}
+
+		if len(opts.BuildCommand) > 0 {
+			build, err := run(ctx, worktree, opts.BuildCommand, opts)
+			if err != nil {
+				return "", err
+			}
+			if !build.Success {
+				return analyzer.BisectSkip, nil
+			}
+		}
+		result, err := run(ctx, worktree, opts.TestCommand, opts)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case result.Success:
+			return analyzer.BisectGood, nil
+		case result.TimedOut || result.ExitCode == bisectSkipExitCode:
+			return analyzer.BisectSkip, nil
+		}
+		failures[commit] = result
+		return analyzer.BisectBad, nil
+	}
+
+	bisect, err := s.analyzer.Bisect(ctx, hashes, test, bisectOpts)
+	if err != nil {
+		return nil, err
+	}
+	report := &BisectReport{Bisect: bisect, ErrorLogs: []analyzer.ErrorLog{}}
+	if bisect.Culprit == "" {
+		return report, nil
+	}
+
+	if report.Regression, err = s.regression(repos, repoID, bisect.Culprit, filepath.Join(tmp, "culprit")); err != nil {
+		return nil, err
+	}
+	report.Regression.Bisect = bisect
+
+	// The known bad commit is not tested unless verified, so it may have no output
+	if result := failures[bisect.Culprit]; result != nil {
+		if err := s.saveBisectLog(repos, repoID, bisect.Culprit, result, report); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// regression describes the culprit commit, mapping its changes onto the
+// code graph of its own tree
+func (s *Service) regression(repos *repository.Service, repoID, commit, worktree string) (*analyzer.Regression, error) {
+	diff, err := repos.CommitDiff(repoID, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	regression := &analyzer.Regression{
+		Commit:       diff.Commit.Hash,
+		Message:      diff.Commit.Message,
+		Author:       diff.Commit.Author,
+		Diff:         diff.Patch,
+		Files:        []analyzer.ChangedFile{},
+		TouchedNodes: []string{},
+	}
+	for _, f := range diff.Files {
+		if f.Path == "" {
+			continue // deleted files have no nodes left
+		}
+		changed := analyzer.ChangedFile{Path: f.Path, Lines: make([]analyzer.LineRange, len(f.Lines))}
+		for i, r := range f.Lines {
+			changed.Lines[i] = analyzer.LineRange{Start: r.Start, End: r.End}
+		}
+		regression.Files = append(regression.Files, changed)
+	}
+
+	if err := repos.CheckoutCommit(repoID, commit, worktree); err != nil {
+		return nil, err
+	}
+	files, err := s.analyzer.IndexSourceFiles(worktree)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := s.analyzer.BuildCodeKnowledgeGraph(files)
+	if err != nil {
+		return nil, err
+	}
+	regression.TouchedNodes = s.analyzer.TouchedNodes(regression.Files, graph)
+	return regression, nil
+}
+
+// saveBisectLog stores the culprit's failing test output as a log of the
+// repository and parses the errors in it
+func (s *Service) saveBisectLog(repos *repository.Service, repoID, commit string, result *CommandResult, report *BisectReport) error {
+	repoPath := filepath.Join(repos.WorkspacePath, repoID)
+	output := fmt.Sprintf("$ %s\n%s\n", strings.Join(result.Command, " "), result.Output)
+	logPath, err := s.analyzer.SaveLog(repoPath, "bisect-"+commit[:min(12, len(commit))]+".log", strings.NewReader(output))
+	if err != nil {
+		return err
+	}
+	report.LogPath = logPath
+
+	logs, err := s.analyzer.ParseLogFile(repoPath, logPath, analyzer.DefaultLogOptions())
+	if err != nil {
+		return err
+	}
+	report.ErrorLogs = logs
+	return nil
+}
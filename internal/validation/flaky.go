@@ -0,0 +1,64 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// testPackagePattern matches the package patterns go test is given: ".",
+// "./"-relative directories or import paths, optionally ending in "/...".
+// Elements cannot start with a dot or a dash, so a pattern is never taken
+// for a flag and never leaves the repository.
+var testPackagePattern = regexp.MustCompile(`^(\.|\./[\w~+][\w.~+-]*(/[\w~+][\w.~+-]*)*|[\w~+][\w.~+-]*(/[\w~+][\w.~+-]*)*)(/\.\.\.)?$`)
+
+// RunTestsRepeatedly runs the tests of pkg count times in a copy of the
+// repository with go test -json and returns the per-test results of each
+// run. Test caching is disabled so every run executes the tests.
+func (s *Service) RunTestsRepeatedly(ctx context.Context, repoPath, pkg string, count int, opts Options) ([]analyzer.TestRun, error) {
+	if _, err := os.Stat(filepath.Join(repoPath, "go.mod")); err != nil {
+		return nil, errors.New("repeated test runs need a Go module")
+	}
+	if count < 1 {
+		return nil, errors.New("count must be positive")
+	}
+	if pkg == "" {
+		pkg = "./..."
+	}
+	if !testPackagePattern.MatchString(pkg) {
+		return nil, fmt.Errorf("invalid package pattern: %q", pkg)
+	}
+
+	tmp, err := os.MkdirTemp("", "codeanalyzer-flaky-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create test directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := copyTree(repoPath, tmp); err != nil {
+		return nil, fmt.Errorf("failed to copy repository: %w", err)
+	}
+
+	command := []string{"go", "test", "-json", "-count=1", pkg}
+	runs := make([]analyzer.TestRun, 0, count)
+	for i := 0; i < count; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := run(ctx, tmp, command, opts)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, analyzer.TestRun{
+			CreatedAt: time.Now(),
+			Source:    "run",
+			Results:   result.Results,
+		})
+	}
+	return runs, nil
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// runSandboxed runs a command in its own process group, killed as a whole
+// when ctx is done. With isolate set, the command runs in new user and
+// network namespaces, which leave it only an unconfigured loopback device;
+// where namespaces are unavailable it fails with ErrNoIsolation rather than
+// running unisolated.
+func runSandboxed(ctx context.Context, dir string, command, env []string, isolate bool) (string, int, error) {
+	cmd := newCommand(ctx, dir, command, env)
+	if isolate {
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	}
+	output, exitCode, err := runCommand(cmd)
+	if isolate && namespacesUnavailable(err) {
+		return "", 0, fmt.Errorf("%w: %v", ErrNoIsolation, err)
+	}
+	return output, exitCode, err
+}
+
+// newCommand creates a command that kills its process group on cancellation
+func newCommand(ctx context.Context, dir string, command, env []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Orphaned children holding the output pipes must not block Wait
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
+
+// namespacesUnavailable reports whether starting a process failed because
+// the kernel or container forbids creating namespaces
+func namespacesUnavailable(err error) bool {
+	return errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EACCES)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package validation
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// runSandboxed runs a command, killed when ctx is done. Network isolation
+// needs Linux namespaces, so commands that must be isolated fail with
+// ErrNoIsolation.
+func runSandboxed(ctx context.Context, dir string, command, env []string, isolate bool) (string, int, error) {
+	if isolate {
+		return "", 0, ErrNoIsolation
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.WaitDelay = 5 * time.Second
+	return runCommand(cmd)
+}
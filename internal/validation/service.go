@@ -0,0 +1,458 @@
+package validation
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// maxOutput is the amount of command output kept per command; the tail is
+// kept since failures are reported last
+const maxOutput = 1 << 20
+
+// ErrNoIsolation is returned when a command must run without network access
+// but the sandbox cannot isolate it
+var ErrNoIsolation = errors.New("network isolation is unavailable")
+
+// Options configures how a patch is validated
+type Options struct {
+	BuildCommand []string      // command that must succeed before testing, optional
+	TestCommand  []string      // test command; go test -json reports per-test results
+	Timeout      time.Duration // limit per command
+	CPUSeconds   int           // CPU time limit per command, 0 for none
+	MemoryBytes  int64         // address space limit per command, 0 for none
+	AllowNetwork bool          // run commands with network access
+	Baseline     bool          // test the unpatched copy too, to report pass/fail deltas
+}
+
+// CommandResult is the outcome of a build or test command
+type CommandResult struct {
+	Command  []string              `json:"command"`
+	ExitCode int                   `json:"exitCode"`
+	Success  bool                  `json:"success"`
+	TimedOut bool                  `json:"timedOut"`
+	Duration time.Duration         `json:"duration"`
+	Output   string                `json:"output"`
+	Tests    map[string]string     `json:"tests,omitempty"` // test -> pass, fail or skip
+	Results  []analyzer.TestResult `json:"-"`               // per-test results with timings
+}
+
+// Report is the result of validating a patch
+type Report struct {
+	PatchID         string              `json:"patchId"`
+	Applied         bool                `json:"applied"`
+	ApplyError      string              `json:"applyError,omitempty"`
+	Files           []string            `json:"files"`
+	Build           *CommandResult      `json:"build,omitempty"`
+	Test            *CommandResult      `json:"test,omitempty"`
+	Baseline        *CommandResult      `json:"baseline,omitempty"`
+	Fixed           []string            `json:"fixed"`        // tests failing before the patch and passing after
+	Broken          []string            `json:"broken"`       // tests passing before the patch and failing after
+	StillFailing    []string            `json:"stillFailing"` // tests failing before and after
+	NetworkIsolated bool                `json:"networkIsolated"`
+	Valid           bool                `json:"valid"`
+	LogPath         string              `json:"logPath,omitempty"`
+	ErrorLogs       []analyzer.ErrorLog `json:"errorLogs"`
+}
+
+// Service validates candidate patches in throwaway copies of a repository
+type Service struct {
+	analyzer *analyzer.Service
+}
+
+// NewService creates a new validation service
+func NewService(analyzerService *analyzer.Service) *Service {
+	return &Service{analyzer: analyzerService}
+}
+
+// DefaultOptions returns the build and test commands for the kind of
+// project found at repoPath
+func DefaultOptions(repoPath string) Options {
+	opts := Options{
+		Timeout:     10 * time.Minute,
+		CPUSeconds:  600,
+		MemoryBytes: 4 << 30,
+		Baseline:    true,
+	}
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(repoPath, name))
+		return err == nil
+	}
+	switch {
+	case exists("go.mod"):
+		opts.BuildCommand = []string{"go", "build", "./..."}
+		opts.TestCommand = []string{"go", "test", "-json", "./..."}
+	case exists("package.json"):
+		opts.TestCommand = []string{"npm", "test", "--silent"}
+	case exists("pom.xml"):
+		opts.TestCommand = []string{"mvn", "-o", "-q", "test"}
+	case exists("pyproject.toml"), exists("requirements.txt"), exists("setup.py"):
+		opts.TestCommand = []string{"python", "-m", "pytest", "-q"}
+	}
+	return opts
+}
+
+// ValidatePatch applies a patch to a copy of the repository, builds and
+// tests it, and reports the outcome. The captured output is saved as an
+// uploaded log of the repository, so ParseErrorLogs picks it up, and the
+// errors found in it are returned with the report.
+func (s *Service) ValidatePatch(ctx context.Context, repoPath string, patch analyzer.Patch, opts Options) (*Report, error) {
+	if len(opts.TestCommand) == 0 && len(opts.BuildCommand) == 0 {
+		return nil, errors.New("no build or test command configured")
+	}
+
+	tmp, err := os.MkdirTemp("", "codeanalyzer-validate-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validation directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	report := &Report{
+		PatchID:      patch.ID,
+		Files:        []string{},
+		Fixed:        []string{},
+		Broken:       []string{},
+		StillFailing: []string{},
+		ErrorLogs:    []analyzer.ErrorLog{},
+	}
+
+	patched := filepath.Join(tmp, "patched")
+	if err := copyTree(repoPath, patched); err != nil {
+		return nil, fmt.Errorf("failed to copy repository: %w", err)
+	}
+	files, err := analyzer.ApplyUnifiedDiff(patched, patch.Diff)
+	if err != nil {
+		report.ApplyError = err.Error()
+		return report, nil
+	}
+	report.Applied = true
+	report.Files = files
+
+	if opts.Baseline && len(opts.TestCommand) > 0 {
+		base := filepath.Join(tmp, "base")
+		if err := copyTree(repoPath, base); err != nil {
+			return nil, fmt.Errorf("failed to copy repository: %w", err)
+		}
+		if report.Baseline, err = run(ctx, base, opts.TestCommand, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	buildOK := true
+	if len(opts.BuildCommand) > 0 {
+		if report.Build, err = run(ctx, patched, opts.BuildCommand, opts); err != nil {
+			return nil, err
+		}
+		buildOK = report.Build.Success
+	}
+	if buildOK && len(opts.TestCommand) > 0 {
+		if report.Test, err = run(ctx, patched, opts.TestCommand, opts); err != nil {
+			return nil, err
+		}
+	}
+	report.NetworkIsolated = !opts.AllowNetwork
+	report.Valid = buildOK && (report.Test == nil || report.Test.Success)
+	if report.Baseline != nil && report.Test != nil {
+		report.Fixed, report.Broken, report.StillFailing = testDeltas(report.Baseline.Tests, report.Test.Tests)
+	}
+
+	if err := s.saveLogs(repoPath, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// unsafeLogName matches characters not allowed in saved log names
+var unsafeLogName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// saveLogs stores the build and test output of the patched copy as a log
+// of the repository and parses the errors in it
+func (s *Service) saveLogs(repoPath string, report *Report) error {
+	var sb strings.Builder
+	for _, result := range []*CommandResult{report.Build, report.Test} {
+		if result == nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "$ %s\n%s\n", strings.Join(result.Command, " "), result.Output)
+	}
+	if sb.Len() == 0 {
+		return nil
+	}
+
+	name := "validation-" + strings.Trim(unsafeLogName.ReplaceAllString(report.PatchID, "_"), "_") + ".log"
+	logPath, err := s.analyzer.SaveLog(repoPath, name, strings.NewReader(sb.String()))
+	if err != nil {
+		return err
+	}
+	report.LogPath = logPath
+
+	logs, err := s.analyzer.ParseLogFile(repoPath, logPath, analyzer.DefaultLogOptions())
+	if err != nil {
+		return err
+	}
+	report.ErrorLogs = logs
+	return nil
+}
+
+// testDeltas compares per-test results before and after a patch
+func testDeltas(before, after map[string]string) (fixed, broken, stillFailing []string) {
+	fixed, broken, stillFailing = []string{}, []string{}, []string{}
+	for test, result := range after {
+		switch prev := before[test]; {
+		case prev == "fail" && result == "pass":
+			fixed = append(fixed, test)
+		case prev == "pass" && result == "fail":
+			broken = append(broken, test)
+		case prev == "fail" && result == "fail":
+			stillFailing = append(stillFailing, test)
+		}
+	}
+	// Tests that no longer run after the patch count as broken
+	for test, prev := range before {
+		if _, ok := after[test]; !ok && prev == "pass" {
+			broken = append(broken, test)
+		}
+	}
+	sort.Strings(fixed)
+	sort.Strings(broken)
+	sort.Strings(stillFailing)
+	return fixed, broken, stillFailing
+}
+
+// run executes a command in dir under the configured limits. It only fails
+// when the command cannot be isolated from the network as required.
+func run(ctx context.Context, dir string, command []string, opts Options) (*CommandResult, error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	result := &CommandResult{Command: command}
+	start := time.Now()
+	output, exitCode, err := runSandboxed(ctx, dir, limitedCommand(command, opts), sandboxEnv(opts), !opts.AllowNetwork)
+	if errors.Is(err, ErrNoIsolation) {
+		return nil, err
+	}
+	result.Duration = time.Since(start)
+	result.ExitCode = exitCode
+	result.TimedOut = ctx.Err() == context.DeadlineExceeded
+	result.Success = err == nil && exitCode == 0 && !result.TimedOut
+	if err != nil {
+		output += fmt.Sprintf("\n%s: %v\n", command[0], err)
+	}
+	if result.TimedOut {
+		output += fmt.Sprintf("\n%s: timed out after %s\n", command[0], opts.Timeout)
+	}
+
+	if isGoTestJSON(command) {
+		result.Results = analyzer.ParseGoTestJSON(output)
+		result.Tests, output = parseTestEvents(output)
+	}
+	result.Output = output
+	return result, nil
+}
+
+// limitedCommand wraps a command in a shell that applies CPU and memory limits
+func limitedCommand(command []string, opts Options) []string {
+	var limits []string
+	if opts.CPUSeconds > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -t %d", opts.CPUSeconds))
+	}
+	if opts.MemoryBytes > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -v %d", opts.MemoryBytes/1024))
+	}
+	if len(limits) == 0 || !shellAvailable() {
+		return command
+	}
+	script := strings.Join(limits, " && ") + ` && exec "$@"`
+	return append([]string{"/bin/sh", "-c", script, "sh"}, command...)
+}
+
+// shellAvailable reports whether /bin/sh exists to apply limits with
+func shellAvailable() bool {
+	_, err := os.Stat("/bin/sh")
+	return err == nil
+}
+
+// sandboxEnv returns the command environment; without network access,
+// package managers are switched to offline mode and proxies point nowhere
+func sandboxEnv(opts Options) []string {
+	env := os.Environ()
+	if opts.AllowNetwork {
+		return env
+	}
+	return append(env,
+		"GOPROXY=off",
+		"GOTOOLCHAIN=local",
+		"HTTP_PROXY=http://127.0.0.1:9",
+		"HTTPS_PROXY=http://127.0.0.1:9",
+		"http_proxy=http://127.0.0.1:9",
+		"https_proxy=http://127.0.0.1:9",
+		"npm_config_offline=true",
+		"PIP_NO_INDEX=1",
+	)
+}
+
+// runCommand starts cmd and collects the tail of its combined output
+func runCommand(cmd *exec.Cmd) (string, int, error) {
+	out := &tailBuffer{limit: maxOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out.String(), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return out.String(), -1, err
+	}
+	return out.String(), 0, nil
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+// Write appends p, dropping the oldest output beyond the limit
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the kept output
+func (b *tailBuffer) String() string {
+	if b.truncated {
+		return "[output truncated]\n" + string(b.buf)
+	}
+	return string(b.buf)
+}
+
+// isGoTestJSON reports whether a command is go test with JSON output
+func isGoTestJSON(command []string) bool {
+	if len(command) < 2 || filepath.Base(command[0]) != "go" || command[1] != "test" {
+		return false
+	}
+	for _, arg := range command[2:] {
+		if arg == "-json" || arg == "--json" {
+			return true
+		}
+	}
+	return false
+}
+
+// testEvent is an event of go test -json
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+// parseTestEvents collects per-test results from go test -json output and
+// turns the output back into the plain text go test would have printed
+func parseTestEvents(output string) (map[string]string, string) {
+	tests := make(map[string]string)
+	var text strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxOutput)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var event testEvent
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &event) != nil {
+			// Build errors and other output outside the event stream
+			text.WriteString(line + "\n")
+			continue
+		}
+		text.WriteString(event.Output)
+		if event.Test == "" {
+			continue
+		}
+		switch event.Action {
+		case "pass", "fail", "skip":
+			tests[event.Package+"."+event.Test] = event.Action
+		}
+	}
+	return tests, text.String()
+}
+
+// copyTree copies a repository into dst, leaving out version control and
+// analyzer data, and symbolic links leading out of the repository
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == ".git" || rel == filepath.FromSlash(".codeanalyzer")) {
+			return filepath.SkipDir
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			// Links leading out of the tree would let writes in the copy reach the host
+			if resolved := filepath.Join(filepath.Dir(rel), link); filepath.IsAbs(link) || !filepath.IsLocal(resolved) {
+				return nil
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+// copyFile copies a regular file
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+const mitText = `MIT License
+
+Copyright (c) 2024 Example Corp
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+`
+
+const bsd3Text = `Copyright (c) 2019, The Authors. All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+* Redistributions of source code must retain the above copyright notice, this
+  list of conditions and the following disclaimer.
+
+* Redistributions in binary form must reproduce the above copyright notice,
+  this list of conditions and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the copyright holder nor the names of its
+  contributors may be used to endorse or promote products derived from
+  this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+`
+
+// commonsClause is a condition added to a permissive license
+const commonsClause = `
+"Commons Clause" License Condition v1.0
+
+The Software is provided to you by the Licensor under the License, as
+defined below, subject to the following condition.
+
+Without limiting other conditions in the License, the grant of rights
+under the License will not include, and the License does not grant to
+you, the right to Sell the Software.
+
+For purposes of the foregoing, "Sell" means practicing any or all of the
+rights granted to you under the License to provide to third parties, for
+a fee or other consideration (including without limitation fees for
+hosting or consulting/support services related to the Software), a
+product or service whose value derives, entirely or substantially, from
+the functionality of the Software. Any license notice or attribution
+required by the License must also include this Commons Clause License
+Condition notice.
+`
+
+// licenseText reads an embedded license template from the analyzer sources
+func licenseText(t *testing.T, id string) string {
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "internal", "analyzer", "licenses", id+".txt"))
+		if err == nil {
+			return string(data)
+		}
+		parent := filepath.Dir(dir)
+		require.NotEqual(t, dir, parent, "no license template %s", id)
+		dir = parent
+	}
+}
+
+// TestDetectLicenses tests license identification for the repository, its
+// source headers and its vendored, cached and installed dependencies, the
+// license policy findings and the SPDX export
+func TestDetectLicenses(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"LICENSE":                     mitText,
+		"third_party/LICENSE.txt":     bsd3Text,
+		"license.go":                  "package app\n",
+		".codeanalyzer/licenses.yaml": "allow: [MIT, Apache-2.0, BSD-3-Clause, Custom-1.0]\ndeny: [GPL-3.0]\nignore: [github.com/ignored/mod]\n",
+		"go.mod": `module example.com/app
+
+go 1.22
+
+require (
+	github.com/vend/lib v1.0.0
+	github.com/Cached/Mod v1.2.0
+	github.com/missing/mod v0.1.0
+	github.com/ignored/mod v0.1.0
+	github.com/custom/lib v0.3.0
+	github.com/extra/lib v1.0.0
+)
+`,
+		"vendor/github.com/vend/lib/LICENSE":     "Copyright 2020 Vend\n\n" + mitText[len("MIT License\n\nCopyright (c) 2024 Example Corp\n"):],
+		"vendor/github.com/custom/lib/COPYING":   "Copyright (c) 2021 Custom Inc.\n\nThe custom license lets anyone use this software for any purpose\nas long as this notice is kept in every copy of it.\n",
+		"vendor/github.com/extra/lib/LICENSE":    mitText + commonsClause,
+		"cmd/main.go":                            "// SPDX-License-Identifier: Apache-2.0 WITH LLVM-exception\npackage main\n\nfunc main() {}\n",
+		"web/util.js":                            "/* SPDX-License-Identifier: MIT AND GPL-3.0-or-later */\nexport const pad = 1;\n",
+		"web/package.json":                       `{"dependencies": {"left-pad": "^1.3.0", "dual": "^2.0.0"}}`,
+		"web/node_modules/left-pad/package.json": `{"name": "left-pad", "license": "WTFPL"}`,
+		"web/node_modules/dual/package.json":     `{"name": "dual", "licenses": [{"type": "MIT"}, {"type": "GPL-3.0-only"}]}`,
+	})
+	modCache := t.TempDir()
+	cached := filepath.Join(modCache, "github.com", "!cached", "!mod@v1.2.0")
+	require.NoError(t, os.MkdirAll(cached, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(cached, "LICENSE"), []byte(licenseText(t, "GPL-3.0-only")), 0644))
+	templates := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(templates, "Custom-1.0.template.txt"), []byte(
+		`<<var;name="copyright";original="Copyright (c) <year> <owner>";match=".+">>
+
+The custom license lets anyone use this software for any purpose
+<<beginOptional>>as long as this notice is kept in every copy of it.<<endOptional>>
+`), 0644))
+
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	deps, _, err := svc.ParseDependencies(root)
+	require.NoError(t, err)
+	report, err := svc.DetectLicenses(root, files, deps, analyzer.LicenseOptions{ModCache: modCache, Templates: templates})
+	require.NoError(t, err)
+
+	require.Len(t, report.Repository, 2)
+	assert.Equal(t, "LICENSE", report.Repository[0].File)
+	assert.Equal(t, "MIT", report.Repository[0].License)
+	assert.Equal(t, 1.0, report.Repository[0].Confidence)
+	assert.Equal(t, "BSD-3-Clause", report.Repository[1].License)
+
+	var headers []string
+	for _, h := range report.Headers {
+		headers = append(headers, fmt.Sprintf("%s:%d %s", h.File, h.Line, h.License))
+	}
+	assert.ElementsMatch(t, []string{
+		"cmd/main.go:1 Apache-2.0 WITH LLVM-exception",
+		"web/util.js:1 MIT AND GPL-3.0-or-later",
+	}, headers)
+
+	licenses := make(map[string]analyzer.DependencyLicense)
+	for _, dl := range report.Dependencies {
+		licenses[dl.Dependency.Name] = dl
+	}
+	assert.Equal(t, "MIT", licenses["github.com/vend/lib"].License)
+	assert.Equal(t, "vendor/github.com/vend/lib", licenses["github.com/vend/lib"].Location)
+	assert.Equal(t, "GPL-3.0-only", licenses["github.com/Cached/Mod"].License)
+	assert.Equal(t, cached, licenses["github.com/Cached/Mod"].Location)
+	assert.Empty(t, licenses["github.com/missing/mod"].License)
+	assert.Equal(t, "Custom-1.0", licenses["github.com/custom/lib"].License)
+	// A license with added terms is not the license it extends
+	assert.Empty(t, licenses["github.com/extra/lib"].License)
+	require.Len(t, licenses["github.com/extra/lib"].Matches, 1)
+	assert.Less(t, licenses["github.com/extra/lib"].Matches[0].Confidence, 0.8)
+	assert.Equal(t, "WTFPL", licenses["left-pad"].License)
+	assert.Equal(t, "manifest", licenses["left-pad"].Matches[0].Source)
+	assert.Equal(t, "MIT OR GPL-3.0-only", licenses["dual"].License)
+
+	// Policy violations are findings
+	policy, err := svc.LoadLicensePolicy(root)
+	require.NoError(t, err)
+	require.NotNil(t, policy)
+	var found []string
+	for _, f := range svc.LicenseFindings(root, report, policy) {
+		found = append(found, fmt.Sprintf("%s:%d %s %s", f.File, f.Line, f.Rule, f.Level))
+	}
+	assert.ElementsMatch(t, []string{
+		"web/util.js:1 license-denied error",
+		"go.mod:7 license-denied error",
+		"go.mod:8 license-unknown warning",
+		"go.mod:11 license-unknown warning",
+		"web/package.json:1 license-not-allowed warning",
+	}, found)
+
+	_, err = analyzer.ParseLicensePolicy([]byte("allow: [MIT]\nunknown: fatal\n"))
+	assert.Error(t, err)
+	_, err = analyzer.ParseLicensePolicy([]byte("allowed: [MIT]\n"))
+	assert.Error(t, err)
+
+	// SPDX export
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	doc := svc.ExportSBOM("app", report, created)
+	assert.Equal(t, "SPDX-2.3", doc.SPDXVersion)
+	assert.Equal(t, "2024-05-01T12:00:00Z", doc.CreationInfo.Created)
+	assert.Equal(t, doc.DocumentNamespace, svc.ExportSBOM("app", report, created).DocumentNamespace)
+	require.Len(t, doc.Packages, 1+len(deps))
+	assert.Equal(t, "BSD-3-Clause AND MIT", doc.Packages[0].LicenseConcluded)
+	packages := make(map[string]analyzer.SPDXPackage)
+	for _, p := range doc.Packages {
+		packages[p.Name] = p
+	}
+	assert.Equal(t, "GPL-3.0-only", packages["github.com/Cached/Mod"].LicenseConcluded)
+	assert.Equal(t, "NOASSERTION", packages["github.com/Cached/Mod"].LicenseDeclared)
+	assert.Equal(t, "pkg:golang/github.com/Cached/Mod@v1.2.0", packages["github.com/Cached/Mod"].ExternalRefs[0].ReferenceLocator)
+	assert.Equal(t, "NOASSERTION", packages["github.com/missing/mod"].LicenseConcluded)
+	assert.Equal(t, "WTFPL", packages["left-pad"].LicenseDeclared)
+	assert.Contains(t, doc.Relationships, analyzer.SPDXRelationship{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Package-app"})
+	assert.Contains(t, doc.Relationships, analyzer.SPDXRelationship{SPDXElementID: "SPDXRef-Package-app", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: "SPDXRef-Package-npm-left-pad"})
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"SPDXID":"SPDXRef-DOCUMENT"`)
+}
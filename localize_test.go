@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// localizeGraph is handler -> service -> repo, with an unrelated helper
+var localizeGraph = []analyzer.GraphNode{
+	{ID: "file:api.go", Type: analyzer.NodeFile, Path: "api.go", Edges: []analyzer.GraphEdge{
+		{Target: "func:handler", Type: analyzer.EdgeContains},
+		{Target: "func:service", Type: analyzer.EdgeContains},
+	}},
+	{ID: "file:store.go", Type: analyzer.NodeFile, Path: "store.go", Edges: []analyzer.GraphEdge{
+		{Target: "func:repo", Type: analyzer.EdgeContains},
+	}},
+	{ID: "file:util.go", Type: analyzer.NodeFile, Path: "util.go", Edges: []analyzer.GraphEdge{
+		{Target: "func:helper", Type: analyzer.EdgeContains},
+	}},
+	{ID: "func:handler", Type: analyzer.NodeFunction, Name: "handler", Path: "api.go", StartLine: 1, EndLine: 10, Edges: []analyzer.GraphEdge{
+		{Target: "func:service", Type: analyzer.EdgeCalls},
+	}},
+	{ID: "func:service", Type: analyzer.NodeFunction, Name: "service", Path: "api.go", StartLine: 12, EndLine: 20, Edges: []analyzer.GraphEdge{
+		{Target: "func:repo", Type: analyzer.EdgeCalls},
+	}},
+	{ID: "func:repo", Type: analyzer.NodeFunction, Name: "repo", Path: "store.go", StartLine: 1, EndLine: 30},
+	{ID: "func:helper", Type: analyzer.NodeFunction, Name: "helper", Path: "util.go", StartLine: 1, EndLine: 90},
+}
+
+// TestRankSuspects tests suspicion propagation and explanation paths
+func TestRankSuspects(t *testing.T) {
+	svc := analyzer.NewService()
+	suspects := svc.RankSuspects([]string{"func:repo"}, localizeGraph, analyzer.DefaultLocalizeOptions())
+
+	require.Len(t, suspects, 3, "unreachable functions are not suspects")
+	assert.Equal(t, "func:repo", suspects[0].NodeID)
+	assert.Equal(t, "func:service", suspects[1].NodeID)
+	assert.Equal(t, "func:handler", suspects[2].NodeID)
+	assert.Equal(t, []string{"func:repo", "func:service", "func:handler"}, suspects[2].Explanation)
+	for i := 1; i < len(suspects); i++ {
+		assert.GreaterOrEqual(t, suspects[i-1].Score, suspects[i].Score)
+	}
+
+	// Heavy churn on api.go lifts its functions
+	opts := analyzer.DefaultLocalizeOptions()
+	opts.ChurnWeight = 2
+	opts.Churn = map[string]int{"api.go": 40, "store.go": 1}
+	suspects = svc.RankSuspects([]string{"func:repo"}, localizeGraph, opts)
+	assert.NotEqual(t, "func:repo", suspects[0].NodeID)
+	assert.Equal(t, 1.0, suspects[0].Churn)
+
+	assert.Equal(t, []string{"func:repo", "func:service", "func:handler"}, svc.LocalizeErrors([]string{"func:repo"}, localizeGraph))
+	assert.Empty(t, svc.LocalizeErrors([]string{"func:missing"}, localizeGraph))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestParseLogStream tests error extraction, source pointers and deduplication
+func TestParseLogStream(t *testing.T) {
+	log := `2024-03-01T10:00:00Z starting server
+2024-03-01T10:00:01Z handlers/user.go:15:3: cannot use x (type int) as type string
+2024-03-01T10:00:02Z handlers/user.go:15:3: cannot use x (type int) as type string
+2024-03-01T10:05:00Z panic: runtime error: index out of range [5] with length 3
+2024-03-01T10:05:00Z
+2024-03-01T10:05:00Z goroutine 1 [running]:
+2024-03-01T10:05:00Z main.main()
+2024-03-01T10:05:00Z 	/build/main.go:42 +0x1d
+`
+
+	svc := analyzer.NewService()
+	logs, err := svc.ParseLogStream(strings.NewReader(log), "server.log", "", analyzer.DefaultLogOptions())
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+
+	assert.Equal(t, "handlers/user.go", logs[0].File)
+	assert.Equal(t, 15, logs[0].Line)
+	assert.Equal(t, 2, logs[0].Count)
+	assert.Equal(t, &analyzer.LogSource{Path: "server.log", Line: 2}, logs[0].Source)
+
+	assert.Contains(t, logs[1].Message, "index out of range")
+	assert.Equal(t, 4, logs[1].Source.Line)
+	require.Len(t, logs[1].Frames, 1)
+	assert.Equal(t, 42, logs[1].Frames[0].Line)
+
+	// Only the panic falls inside the time window
+	opts := analyzer.LogOptions{Since: time.Date(2024, 3, 1, 10, 1, 0, 0, time.UTC)}
+	logs, err = svc.ParseLogStream(strings.NewReader(log), "server.log", "", opts)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Contains(t, logs[0].Message, "panic")
+
+	// Timestamps keep the indentation of trace frames, and oversized lines
+	// are truncated rather than failing the log
+	log = "[2024-03-01 10:00:00] Traceback (most recent call last):\n" +
+		"[2024-03-01 10:00:00]   File \"app/main.py\", line 7, in run\n" +
+		"[2024-03-01 10:00:00]     handle()\n" +
+		"[2024-03-01 10:00:00] ValueError: bad input\n" +
+		strings.Repeat("x", 2<<20) + "\n" +
+		"app/util.py:3: warning: unused import\n"
+	logs, err = svc.ParseLogStream(strings.NewReader(log), "worker.log", "", analyzer.DefaultLogOptions())
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	require.Len(t, logs[0].Frames, 1)
+	assert.Equal(t, "app/main.py", logs[0].Frames[0].File)
+	assert.Equal(t, 7, logs[0].Frames[0].Line)
+	assert.Equal(t, 6, logs[1].Source.Line)
+}
+
+// TestDiscoverLogFiles tests log discovery and uploaded logs
+func TestDiscoverLogFiles(t *testing.T) {
+	repo := t.TempDir()
+	for _, f := range []string{"build.log", "ci/test-output.txt", "test-results/junit.xml", "main.go", "node_modules/x/debug.log"} {
+		path := filepath.Join(repo, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("main.go:3: undefined: x\n"), 0644))
+	}
+
+	svc := analyzer.NewService()
+	uploaded, err := svc.SaveLog(repo, "../../pasted.txt", strings.NewReader("main.go:4: boom\n"))
+	require.NoError(t, err)
+	assert.Equal(t, analyzer.UploadedLogsDir+"/pasted.txt", uploaded)
+
+	// A second upload under the same name keeps the first
+	second, err := svc.SaveLog(repo, "pasted.txt", strings.NewReader("main.go:5: bang\n"))
+	require.NoError(t, err)
+	assert.Equal(t, analyzer.UploadedLogsDir+"/pasted-1.txt", second)
+	first, err := os.ReadFile(filepath.Join(repo, uploaded))
+	require.NoError(t, err)
+	assert.Equal(t, "main.go:4: boom\n", string(first))
+
+	files, err := svc.DiscoverLogFiles(repo)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"build.log", "ci/test-output.txt", "test-results/junit.xml", uploaded, second}, files)
+
+	logs, err := svc.ParseErrorLogs(repo)
+	require.NoError(t, err)
+	assert.Len(t, logs, 5)
+}
@@ -1,16 +1,33 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+	"github.com/teathis/codeanalyzer/internal/repository"
+	"github.com/teathis/codeanalyzer/internal/validation"
 )
 
+// churnCommits is the number of recent commits counted for file churn
+const churnCommits = 200
+
+// maxBisectRetries caps the reruns of a failing commit a client can ask for
+const maxBisectRetries = 5
+
+// maxFlakyRuns caps the repeated test runs a client can ask for
+const maxFlakyRuns = 20
+
 // Clone a git repository to the workspace
 func clone_repo(repoURL, workspacePath string) (string, error) {
 	// In a real implementation, this would use go-git to clone the repository
@@ -31,65 +48,234 @@ func clone_repo(repoURL, workspacePath string) (string, error) {
 	return filepath.Base(repoDir), nil
 }
 
-// Index all source files in a repository
-func index_source_files(repoPath string) ([]map[string]string, error) {
-	files := []map[string]string{
-		{"path": "src/main.go", "language": "Go"},
-		{"path": "src/utils/helpers.go", "language": "Go"},
-		{"path": "src/api/routes.go", "language": "Go"},
-		{"path": "web/src/App.js", "language": "JavaScript"},
+// Resolve a repository ID from the URL to its directory in the workspace
+func repo_dir(workspacePath, id string) (string, bool) {
+	repoDir := filepath.Join(workspacePath, filepath.Base(filepath.Clean("/"+id)))
+	info, err := os.Stat(repoDir)
+	if err != nil || !info.IsDir() {
+		return "", false
 	}
-	return files, nil
+	return repoDir, true
 }
 
-// Run static analysis on source files
-func run_static_analysis(files []map[string]string) ([]map[string]interface{}, error) {
-	results := []map[string]interface{}{
-		{"file": "src/main.go", "line": 42, "column": 5, "message": "Unused variable", "level": "warning"},
-		{"file": "src/api/routes.go", "line": 15, "column": 3, "message": "Error not handled", "level": "error"},
-		{"file": "web/src/App.js", "line": 23, "column": 10, "message": "React Hook useEffect has missing dependency", "level": "warning"},
+// Read the since/until time window for log parsing from the query string
+func log_options_from_query(c *gin.Context) (analyzer.LogOptions, error) {
+	opts := analyzer.DefaultLogOptions()
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return opts, err
+		}
+		opts.Since = t
 	}
-	return results, nil
+	if until := c.Query("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return opts, err
+		}
+		opts.Until = t
+	}
+	if c.Query("dedupe") == "false" {
+		opts.Deduplicate = false
+	}
+	return opts, nil
 }
 
-// Parse error logs in a repository
-func parse_error_logs(repoPath string) ([]map[string]interface{}, error) {
-	logs := []map[string]interface{}{
-		{"file": "src/api/routes.go", "line": 15, "message": "panic: runtime error: nil pointer dereference"},
-		{"file": "src/utils/helpers.go", "line": 35, "message": "index out of range [5] with length 3"},
+// Diagnose the failures found by a bisection, attaching the culprit commit,
+// and suggest patches for the diagnoses
+func diagnose_regression(analyzerService *analyzer.Service, repoService *repository.Service, repoID, repoDir string, report *validation.BisectReport) ([]analyzer.Diagnosis, []analyzer.Patch, error) {
+	files, err := analyzerService.IndexSourceFiles(repoDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Complexity metrics weigh the suspects, and copies of a suspect's code are flagged with it
+	if _, err := analyzerService.ComputeMetrics(files, graph); err != nil {
+		return nil, nil, err
+	}
+	clones, err := analyzerService.DetectClones(files, analyzer.CloneOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	graph = analyzerService.AddDuplicateEdges(graph, clones)
+	deps, _, err := analyzerService.ParseDependencies(repoDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph = analyzerService.AddDependencyNodes(graph, deps)
+
+	// Failures of tests known to be flaky are weak evidence
+	history, err := analyzerService.LoadTestHistory(repoDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := analyzer.DefaultLocalizeOptions()
+	opts.FlakyTests = analyzerService.DetectFlakyTests(history, graph).FlakyNodes()
+	// Recently changed files are more likely to hold the fault
+	if opts.Churn, err = repoService.FileChurn(repoID, churnCommits); err != nil {
+		return nil, nil, err
+	}
+
+	errorNodes := analyzerService.MapErrorsToGraph(report.ErrorLogs, graph)
+	suspects := analyzerService.LocalizeErrorsWithOptions(errorNodes, graph, opts)
+	catalog, err := analyzerService.LoadRuleCatalog(repoDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	diagnoses, err := analyzerService.DiagnoseRootCauseWithOptions(suspects, graph, analyzer.DiagnoseOptions{
+		RepoPath: repoDir,
+		Logs:     report.ErrorLogs,
+		Catalog:  catalog,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	diagnoses = analyzerService.AttachRegression(diagnoses, report.Regression, graph)
+	patches, err := analyzerService.SuggestFixes(repoDir, diagnoses, graph)
+	if err != nil {
+		return nil, nil, err
 	}
-	return logs, nil
+	return diagnoses, patches, nil
 }
 
-// Build a knowledge graph of code relationships
-func build_code_knowledge_graph(files []map[string]string) ([]map[string]interface{}, error) {
-	graph := []map[string]interface{}{
-		{"id": "file-1", "type": "file", "name": "main.go", "path": "src/main.go"},
-		{"id": "func-1", "type": "function", "name": "main", "relations": []string{"file-1"}},
-		{"id": "file-2", "type": "file", "name": "routes.go", "path": "src/api/routes.go"},
-		{"id": "func-2", "type": "function", "name": "setupRoutes", "relations": []string{"file-2"}},
+// Report the flakiness of a repository's tests over its recorded test runs
+func flaky_report(analyzerService *analyzer.Service, repoDir string, runs []analyzer.TestRun) (*analyzer.FlakyReport, error) {
+	files, err := analyzerService.IndexSourceFiles(repoDir)
+	if err != nil {
+		return nil, err
 	}
-	return graph, nil
+	graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
+	if err != nil {
+		return nil, err
+	}
+	return analyzerService.DetectFlakyTests(runs, graph), nil
 }
 
-// Map error logs to nodes in the knowledge graph
-func map_errors_to_graph(errorLogs []map[string]interface{}, codeGraph []map[string]interface{}) []string {
-	// Return IDs of nodes that might be related to errors
-	return []string{"file-2", "func-2"}
+// Analyze the tree of a base ref in a scratch directory and fingerprint its findings
+func analyze_base_ref(analyzerService *analyzer.Service, repoService *repository.Service, repoID, ref string) (*analyzer.Baseline, error) {
+	commit, err := repoService.ResolveRef(repoID, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "codeanalyzer-base-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := repoService.CheckoutCommit(repoID, commit.Hash, dir); err != nil {
+		return nil, err
+	}
+
+	findings, _, err := analyzerService.AnalyzeFindings(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &analyzer.Baseline{Ref: ref, Commit: commit.Hash, CreatedAt: time.Now(), Findings: findings}, nil
 }
 
-// Localize errors to specific nodes in the graph
-func localize_errors(errorNodes []string, codeGraph []map[string]interface{}) []string {
-	// Return suspected node IDs
-	return []string{"func-2"}
+// Parse the dependency manifests of a ref in a scratch directory
+func dependencies_at_ref(analyzerService *analyzer.Service, repoService *repository.Service, repoID, ref string) ([]analyzer.Dependency, []analyzer.FileError, error) {
+	commit, err := repoService.ResolveRef(repoID, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "codeanalyzer-deps-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := repoService.CheckoutCommit(repoID, commit.Hash, dir); err != nil {
+		return nil, nil, err
+	}
+
+	return analyzerService.ParseDependencies(dir)
 }
 
-// Diagnose root cause of errors
-func diagnose_root_cause(suspectNodes []string, codeGraph []map[string]interface{}) map[string]string {
-	diagnosis := map[string]string{
-		"func-2": "Null pointer dereference in handler function. API endpoint tries to access a property of a nil object.",
+// Extract the exported Go API of a repository at a ref
+func api_at_ref(analyzerService *analyzer.Service, repoService *repository.Service, repoID, ref string) (analyzer.API, error) {
+	commit, err := repoService.ResolveRef(repoID, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "codeanalyzer-api-*")
+	if err != nil {
+		return nil, err
 	}
-	return diagnosis
+	defer os.RemoveAll(dir)
+	if err := repoService.CheckoutCommit(repoID, commit.Hash, dir); err != nil {
+		return nil, err
+	}
+
+	files, err := analyzerService.IndexSourceFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return analyzerService.ExtractAPI(files), nil
+}
+
+// Detect the licenses of a repository and its dependencies, with the
+// templates and module cache configured for the server
+func license_report(analyzerService *analyzer.Service, repoDir string) (*analyzer.LicenseReport, error) {
+	files, err := analyzerService.IndexSourceFiles(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	deps, depErrs, err := analyzerService.ParseDependencies(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	report, err := analyzerService.DetectLicenses(repoDir, files, deps, analyzer.LicenseOptions{
+		Templates: os.Getenv("SPDX_TEMPLATES"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Errors = depErrs
+	return report, nil
+}
+
+// Find the OSV database to match against. Clients may only pick a database
+// by name from the configured OSV_DATABASE_DIR; otherwise OSV_DATABASE is used.
+func vulnerability_database(name string) (string, error) {
+	if name == "" {
+		if database := os.Getenv("OSV_DATABASE"); database != "" {
+			return database, nil
+		}
+		return "", errors.New("no vulnerability database configured")
+	}
+
+	dir := os.Getenv("OSV_DATABASE_DIR")
+	if dir == "" {
+		return "", errors.New("no vulnerability database directory configured")
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid vulnerability database name: %s", name)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Build the sandbox options for a repository. Commands come from the server
+// configuration (VALIDATION_BUILD_COMMAND and VALIDATION_TEST_COMMAND) or the
+// project defaults, never from clients; a client timeout may only shorten
+// the default one.
+func validation_options(repoDir string, timeoutSeconds int) validation.Options {
+	opts := validation.DefaultOptions(repoDir)
+	if build := strings.Fields(os.Getenv("VALIDATION_BUILD_COMMAND")); len(build) > 0 {
+		opts.BuildCommand = build
+	}
+	if test := strings.Fields(os.Getenv("VALIDATION_TEST_COMMAND")); len(test) > 0 {
+		opts.TestCommand = test
+	}
+	if timeout := time.Duration(timeoutSeconds) * time.Second; timeout > 0 && timeout < opts.Timeout {
+		opts.Timeout = timeout
+	}
+	return opts
 }
 
 func main() {
@@ -112,6 +298,13 @@ func main() {
 		log.Fatalf("Failed to create workspace directory: %v", err)
 	}
 
+	repoService, err := repository.NewService(workspaceDir)
+	if err != nil {
+		log.Fatalf("Failed to create repository service: %v", err)
+	}
+	analyzerService := analyzer.NewService()
+	validationService := validation.NewService(analyzerService)
+
 	// API routes
 	api := r.Group("/api")
 	{
@@ -171,10 +364,783 @@ func main() {
 			c.JSON(http.StatusOK, repos)
 		})
 
+		// Log ingestion endpoints
+		api.POST("/repositories/:id/logs", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			opts, err := log_options_from_query(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			// Logs are either uploaded as multipart files or pasted as JSON text
+			var saved []string
+			if strings.HasPrefix(c.ContentType(), "multipart/") {
+				form, err := c.MultipartForm()
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				for _, header := range form.File["files"] {
+					f, err := header.Open()
+					if err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+						return
+					}
+					logPath, err := analyzerService.SaveLog(repoDir, header.Filename, f)
+					f.Close()
+					if err != nil {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+						return
+					}
+					saved = append(saved, logPath)
+				}
+			} else {
+				var request struct {
+					Name string `json:"name"`
+					Text string `json:"text" binding:"required"`
+				}
+				if err := c.ShouldBindJSON(&request); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				if request.Name == "" {
+					request.Name = "pasted-" + time.Now().Format("20060102150405") + ".log"
+				}
+				logPath, err := analyzerService.SaveLog(repoDir, request.Name, strings.NewReader(request.Text))
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				saved = append(saved, logPath)
+			}
+
+			if len(saved) == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "No log files provided"})
+				return
+			}
+
+			errorLogs := []analyzer.ErrorLog{}
+			for _, logPath := range saved {
+				logs, err := analyzerService.ParseLogFile(repoDir, logPath, opts)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				errorLogs = append(errorLogs, logs...)
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"files":     saved,
+				"errorLogs": errorLogs,
+			})
+		})
+
+		api.GET("/repositories/:id/logs", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			opts, err := log_options_from_query(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			logFiles, err := analyzerService.DiscoverLogFiles(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			errorLogs, err := analyzerService.ParseErrorLogsWithOptions(repoDir, opts)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"files":     logFiles,
+				"errorLogs": errorLogs,
+			})
+		})
+
+		// Fix suggestion endpoint; the patches can then be validated
+		api.POST("/repositories/:id/fixes", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			var request struct {
+				Diagnoses []analyzer.Diagnosis `json:"diagnoses" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			files, err := analyzerService.IndexSourceFiles(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			patches, err := analyzerService.SuggestFixes(repoDir, request.Diagnoses, graph)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"patches": patches})
+		})
+
+		// Patch validation endpoint
+		api.POST("/repositories/:id/patches/validate", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			var request struct {
+				Patch          analyzer.Patch `json:"patch" binding:"required"`
+				TimeoutSeconds int            `json:"timeoutSeconds"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			opts := validation_options(repoDir, request.TimeoutSeconds)
+			report, err := validationService.ValidatePatch(c.Request.Context(), repoDir, request.Patch, opts)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, report)
+		})
+
+		api.POST("/repositories/:id/analyze", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			files, err := analyzerService.IndexSourceFiles(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			// Only files changed since the last run, and their dependents, are analyzed
+			result, err := analyzerService.AnalyzeIncremental(repoDir, files)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			// Whole-repository passes such as metrics and dead code are not
+			// cached and have their own endpoints
+			findings := result.Findings
+			architecture, err := analyzerService.LoadArchitectureConfig(repoDir)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if architecture != nil {
+				findings = append(findings, analyzerService.ArchitectureFindings(analyzerService.CheckArchitecture(files, result.Graph, architecture))...)
+			}
+
+			// Findings are fingerprinted like those of /api/analyze; suppressed ones are kept and marked
+			findings, suppressions, err := analyzerService.ApplySuppressions(files, analyzerService.FingerprintFindings(repoDir, findings, result.Graph))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if c.Query("format") == "sarif" {
+				c.JSON(http.StatusOK, analyzer.ToSARIF(append(findings, suppressions.Findings()...)))
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"results":      findings,
+				"suppressions": suppressions,
+				"graph":        result.Graph,
+				"cache":        result.Stats,
+			})
+		})
+
+		api.POST("/repositories/:id/metrics", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			files, err := analyzerService.IndexSourceFiles(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			report, err := analyzerService.ComputeMetrics(files, graph)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			// Each run adds a point to the trend, one per commit when the repository has history
+			snapshot := analyzer.MetricsSnapshot{Summary: report.Summary}
+			if commit, err := repoService.ResolveRef(c.Param("id"), "HEAD"); err == nil {
+				snapshot.Commit = commit.Hash
+			}
+			trend, err := analyzerService.RecordMetrics(repoDir, snapshot)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"metrics": report, "trend": trend})
+		})
+
+		api.GET("/repositories/:id/metrics", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			trend, err := analyzerService.LoadMetricsHistory(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"trend": trend})
+		})
+
+		api.POST("/repositories/:id/clones", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			var opts analyzer.CloneOptions
+			if minTokens := c.Query("minTokens"); minTokens != "" {
+				n, err := strconv.Atoi(minTokens)
+				if err != nil || n <= 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "minTokens must be a positive number"})
+					return
+				}
+				opts.MinTokens = n
+			}
+
+			files, err := analyzerService.IndexSourceFiles(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			report, err := analyzerService.DetectClones(files, opts)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			graph = analyzerService.AddDuplicateEdges(graph, report)
+
+			c.JSON(http.StatusOK, gin.H{"clones": report, "graph": graph})
+		})
+
+		api.GET("/repositories/:id/deadcode", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			opts := analyzer.DeadCodeOptions{
+				Exported:            c.Query("exported") == "true",
+				MainAndTestsAsRoots: c.Query("mainAndTests") == "true",
+			}
+
+			files, err := analyzerService.IndexSourceFiles(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			findings, suppressions, err := analyzerService.ApplySuppressions(files, analyzerService.FingerprintFindings(repoDir, analyzerService.FindDeadCode(files, graph, opts), graph))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"results": findings, "suppressions": suppressions})
+		})
+
+		api.GET("/repositories/:id/architecture", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			// Without layering rules only import cycles are reported
+			config, err := analyzerService.LoadArchitectureConfig(repoDir)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if config == nil {
+				config = &analyzer.ArchitectureConfig{}
+			}
+
+			files, err := analyzerService.IndexSourceFiles(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			violations := analyzerService.CheckArchitecture(files, graph, config)
+
+			c.JSON(http.StatusOK, gin.H{
+				"violations": violations,
+				"results":    analyzerService.ArchitectureFindings(violations),
+			})
+		})
+
+		api.GET("/repositories/:id/api", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+			base := c.Query("base")
+			if base == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "No base ref given"})
+				return
+			}
+
+			baseAPI, err := api_at_ref(analyzerService, repoService, c.Param("id"), base)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			// The working tree is compared unless a head ref is given
+			var headAPI analyzer.API
+			if head := c.Query("head"); head != "" {
+				headAPI, err = api_at_ref(analyzerService, repoService, c.Param("id"), head)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			} else {
+				files, err := analyzerService.IndexSourceFiles(repoDir)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				headAPI = analyzerService.ExtractAPI(files)
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"base":   base,
+				"head":   c.Query("head"),
+				"report": analyzer.CompareAPI(baseAPI, headAPI),
+			})
+		})
+
+		api.GET("/repositories/:id/dependencies", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			// The working tree is used unless a head ref is given
+			var (
+				deps    []analyzer.Dependency
+				depErrs []analyzer.FileError
+				err     error
+			)
+			if head := c.Query("head"); head != "" {
+				deps, depErrs, err = dependencies_at_ref(analyzerService, repoService, c.Param("id"), head)
+			} else {
+				deps, depErrs, err = analyzerService.ParseDependencies(repoDir)
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			// Manifests that cannot be parsed are reported next to the others
+			response := gin.H{"dependencies": deps, "errors": depErrs}
+			if base := c.Query("base"); base != "" {
+				baseDeps, _, err := dependencies_at_ref(analyzerService, repoService, c.Param("id"), base)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				response["changes"] = analyzer.DiffDependencies(baseDeps, deps)
+			}
+
+			c.JSON(http.StatusOK, response)
+		})
+
+		api.POST("/repositories/:id/vulnerabilities", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			// The database is a local OSV directory or zip, as analysis machines are offline
+			var request struct {
+				Database           string `json:"database"` // name of a database in OSV_DATABASE_DIR
+				IncludeUnreachable bool   `json:"includeUnreachable"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			database, err := vulnerability_database(request.Database)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			db, err := analyzer.LoadVulnerabilityDatabase(database)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			files, err := analyzerService.IndexSourceFiles(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			deps, depErrs, err := analyzerService.ParseDependencies(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			matches := analyzerService.MatchVulnerabilities(files, deps, graph, db, analyzer.VulnerabilityOptions{
+				IncludeUnreachable: request.IncludeUnreachable,
+			})
+
+			c.JSON(http.StatusOK, gin.H{
+				"matches": matches,
+				"results": analyzerService.VulnerabilityFindings(repoDir, matches),
+				"errors":  depErrs,
+			})
+		})
+
+		api.GET("/repositories/:id/licenses", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			policy, err := analyzerService.LoadLicensePolicy(repoDir)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			report, err := license_report(analyzerService, repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"licenses": report,
+				"policy":   policy,
+				"results":  analyzerService.LicenseFindings(repoDir, report, policy),
+			})
+		})
+
+		api.GET("/repositories/:id/sbom", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			report, err := license_report(analyzerService, repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, analyzerService.ExportSBOM(c.Param("id"), report, time.Time{}))
+		})
+
+		api.GET("/repositories/:id/baseline", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			baseline, err := analyzerService.LoadBaseline(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if baseline == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No baseline stored"})
+				return
+			}
+
+			c.JSON(http.StatusOK, baseline)
+		})
+
+		api.POST("/repositories/:id/bisect", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			var request struct {
+				Good           string `json:"good" binding:"required"`
+				Bad            string `json:"bad" binding:"required"`
+				TimeoutSeconds int    `json:"timeoutSeconds"`
+				Retries        int    `json:"retries"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			opts := validation_options(repoDir, request.TimeoutSeconds)
+			bisectOpts := analyzer.BisectOptions{Retries: min(request.Retries, maxBisectRetries), VerifyBad: true}
+
+			report, err := validationService.Bisect(c.Request.Context(), repoService, c.Param("id"), request.Good, request.Bad, opts, bisectOpts)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if report.Regression == nil {
+				c.JSON(http.StatusOK, gin.H{"report": report, "diagnoses": []analyzer.Diagnosis{}, "patches": []analyzer.Patch{}})
+				return
+			}
+
+			// Diagnose the culprit's failures and attach the commit to them
+			diagnoses, patches, err := diagnose_regression(analyzerService, repoService, c.Param("id"), repoDir, report)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"report": report, "diagnoses": diagnoses, "patches": patches})
+		})
+
+		// Flaky test endpoints
+		api.POST("/repositories/:id/flaky", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			var request struct {
+				Package        string   `json:"package"`
+				Count          int      `json:"count"`
+				Outputs        []string `json:"outputs"` // earlier go test -json outputs
+				TimeoutSeconds int      `json:"timeoutSeconds"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			// Uploaded outputs are ingested as they are; otherwise the tests are run
+			var runs []analyzer.TestRun
+			if len(request.Outputs) > 0 {
+				for _, output := range request.Outputs {
+					runs = append(runs, analyzer.TestRun{
+						CreatedAt: time.Now(),
+						Source:    "upload",
+						Results:   analyzer.ParseGoTestJSON(output),
+					})
+				}
+			} else {
+				count := min(request.Count, maxFlakyRuns)
+				if count <= 0 {
+					count = 5
+				}
+				var err error
+				runs, err = validationService.RunTestsRepeatedly(c.Request.Context(), repoDir, request.Package, count, validation_options(repoDir, request.TimeoutSeconds))
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+
+			history, err := analyzerService.RecordTestRuns(repoDir, runs)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			report, err := flaky_report(analyzerService, repoDir, history)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, report)
+		})
+
+		api.GET("/repositories/:id/flaky", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			history, err := analyzerService.LoadTestHistory(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			report, err := flaky_report(analyzerService, repoDir, history)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, report)
+		})
+
+		// Spectrum-based fault localization from per-test coverage
+		api.POST("/repositories/:id/spectrum", func(c *gin.Context) {
+			repoDir, ok := repo_dir(workspaceDir, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+				return
+			}
+
+			var request struct {
+				Runs []struct {
+					Name    string `json:"name"`
+					Failed  bool   `json:"failed"`
+					Format  string `json:"format"` // go or lcov
+					Profile string `json:"profile"`
+				} `json:"runs" binding:"required"`
+				Formula  string `json:"formula"`  // ochiai, tarantula or dstar
+				Strategy string `json:"strategy"` // spectrum or combined with the repository's error logs
+				Limit    int    `json:"limit"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			opts := analyzer.DefaultLocalizeOptions()
+			opts.Strategy = analyzer.StrategyCombined
+			if request.Strategy != "" {
+				opts.Strategy = request.Strategy
+			}
+			if opts.Strategy != analyzer.StrategySpectrum && opts.Strategy != analyzer.StrategyCombined {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown strategy: " + request.Strategy})
+				return
+			}
+			switch request.Formula {
+			case "":
+				request.Formula = analyzer.FormulaOchiai
+			case analyzer.FormulaOchiai, analyzer.FormulaTarantula, analyzer.FormulaDStar:
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown formula: " + request.Formula})
+				return
+			}
+			opts.Limit = request.Limit
+
+			var runs []analyzer.CoverageRun
+			for _, run := range request.Runs {
+				cov, err := analyzerService.ParseCoverage(repoDir, run.Format, strings.NewReader(run.Profile))
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("run %s: %v", run.Name, err)})
+					return
+				}
+				runs = append(runs, analyzer.CoverageRun{Name: run.Name, Failed: run.Failed, Coverage: cov})
+			}
+
+			files, err := analyzerService.IndexSourceFiles(repoDir)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			report := analyzerService.ComputeSpectrum(runs, graph)
+			opts.Spectrum = report.NodeScores(request.Formula)
+
+			// The combined strategy also spreads suspicion from the errors in the repository's logs
+			var errorNodes []string
+			if opts.Strategy == analyzer.StrategyCombined {
+				errorLogs, err := analyzerService.ParseErrorLogs(repoDir)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				errorNodes = analyzerService.MapErrorsToGraph(errorLogs, graph)
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"spectrum": report,
+				"suspects": analyzerService.RankSuspects(errorNodes, graph, opts),
+			})
+		})
+
 		// Analysis endpoints
 		api.POST("/analyze", func(c *gin.Context) {
 			var request struct {
-				RepoPath string `json:"repoPath" binding:"required"`
+				RepoPath       string `json:"repoPath" binding:"required"`
+				BaseRef        string `json:"baseRef"`
+				UpdateBaseline bool   `json:"updateBaseline"`
+				Format         string `json:"format"` // json or sarif
 			}
 			if err := c.ShouldBindJSON(&request); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -182,51 +1148,91 @@ func main() {
 			}
 
 			// Check if the repository path exists and is within our workspace
-			fullPath := filepath.Join(workspaceDir, request.RepoPath)
-			if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+			fullPath, ok := repo_dir(workspaceDir, request.RepoPath)
+			if !ok {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Repository not found"})
 				return
 			}
+			repoID := filepath.Base(fullPath)
 
 			// Index source files
-			files, err := index_source_files(fullPath)
+			files, err := analyzerService.IndexSourceFiles(fullPath)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 
-			// Run static analysis
-			analysisResults, err := run_static_analysis(files)
+			// Run static analysis, fingerprinting findings so they can be compared across commits
+			findings, suppressions, err := analyzerService.AnalyzeFindings(fullPath)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 
+			// Compare with the base ref if given, otherwise with the stored baseline
+			var base *analyzer.Baseline
+			if request.BaseRef != "" {
+				base, err = analyze_base_ref(analyzerService, repoService, repoID, request.BaseRef)
+			} else {
+				base, err = analyzerService.LoadBaseline(fullPath)
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			analysisResults := findings
+			var comparison *analyzer.FindingComparison
+			if base != nil {
+				cmp := analyzer.CompareFindings(base.Findings, findings)
+				comparison = &cmp
+				analysisResults = cmp.New
+			}
+
+			if request.UpdateBaseline {
+				// The current findings become the accepted ones, recorded against the checked out commit
+				ref, head, err := repoService.HeadRef(repoID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				if err := analyzerService.SaveBaseline(fullPath, &analyzer.Baseline{Ref: ref, Commit: head.Hash, Findings: findings}); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+			}
+
+			if request.Format == "sarif" {
+				c.JSON(http.StatusOK, analyzer.ToSARIF(append(analysisResults, suppressions.Findings()...)))
+				return
+			}
+
 			// Parse error logs
-			errorLogs, err := parse_error_logs(fullPath)
+			errorLogs, err := analyzerService.ParseErrorLogs(fullPath)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 
 			// Build code knowledge graph
-			graph, err := build_code_knowledge_graph(files)
+			graph, err := analyzerService.BuildCodeKnowledgeGraph(files)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 
 			// Map errors to graph
-			mappedErrors := map_errors_to_graph(errorLogs, graph)
+			errorNodes := analyzerService.MapErrorsToGraph(errorLogs, graph)
 
 			// Localize errors
-			errorNodes := localize_errors(mappedErrors, graph)
+			suspects := analyzerService.LocalizeErrors(errorNodes, graph)
 
 			// Diagnose root cause
-			diagnosis := diagnose_root_cause(errorNodes, graph)
+			diagnosis := analyzerService.DiagnoseRootCause(fullPath, errorLogs, suspects, graph)
 
 			c.JSON(http.StatusOK, gin.H{
 				"analysisResults": analysisResults,
+				"comparison":      comparison,
+				"suppressions":    suppressions,
 				"errorLogs":       errorLogs,
 				"diagnosis":       diagnosis,
 			})
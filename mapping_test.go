@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// mappingGraph is a code graph with two files sharing a name suffix
+var mappingGraph = []analyzer.GraphNode{
+	{ID: "file:handlers/admin_user.go", Type: analyzer.NodeFile, Path: "handlers/admin_user.go", StartLine: 1, EndLine: 40},
+	{ID: "func:handlers.AdminUser", Type: analyzer.NodeFunction, Path: "handlers/admin_user.go", StartLine: 10, EndLine: 30},
+	{ID: "file:handlers/user.go", Type: analyzer.NodeFile, Path: "handlers/user.go", StartLine: 1, EndLine: 60},
+	{ID: "type:handlers.User", Type: analyzer.NodeStruct, Path: "handlers/user.go", StartLine: 5, EndLine: 8},
+	{ID: "method:handlers.User.Save", Type: analyzer.NodeMethod, Path: "handlers/user.go", StartLine: 10, EndLine: 40},
+	{ID: "func:handlers.validate", Type: analyzer.NodeFunction, Path: "handlers/user.go", StartLine: 42, EndLine: 55},
+}
+
+// TestMapErrorsToGraphDetailed tests exact path matching and innermost symbol lookup
+func TestMapErrorsToGraphDetailed(t *testing.T) {
+	logs := []analyzer.ErrorLog{
+		{File: "user.go", Line: 15, Message: "ambiguous basename"},
+		{File: "./handlers/user.go", Line: 45, Message: "invalid input"},
+		{
+			Message: "panic: nil map",
+			Frames: []analyzer.StackFrame{
+				{Function: "handlers.User.Save", File: "/ci/build/handlers/user.go", Line: 20},
+				{Function: "main.main", File: "main.go", Line: 3},
+			},
+		},
+		{File: "handlers/user.go", Line: 2, Message: "imported and not used"},
+	}
+
+	report := analyzer.NewService().MapErrorsToGraphDetailed(logs, mappingGraph)
+
+	require.Len(t, report.Unmapped, 1)
+	assert.Equal(t, "ambiguous basename", report.Unmapped[0].Message)
+
+	byError := make(map[int][]analyzer.ErrorMapping)
+	for _, m := range report.Mappings {
+		byError[m.ErrorIndex] = append(byError[m.ErrorIndex], m)
+	}
+
+	require.Len(t, byError[1], 1)
+	assert.Equal(t, "func:handlers.validate", byError[1][0].NodeID)
+	assert.Equal(t, 1.0, byError[1][0].Confidence)
+
+	require.Len(t, byError[2], 1)
+	assert.Equal(t, "method:handlers.User.Save", byError[2][0].NodeID)
+	assert.Equal(t, 0, byError[2][0].Frame)
+	assert.Less(t, byError[2][0].Confidence, 1.0)
+
+	require.Len(t, byError[3], 1)
+	assert.Equal(t, "file:handlers/user.go", byError[3][0].NodeID)
+
+	ids := analyzer.NewService().MapErrorsToGraph(logs, mappingGraph)
+	assert.Equal(t, "func:handlers.validate", ids[0])
+	assert.NotContains(t, ids, "func:handlers.AdminUser")
+}
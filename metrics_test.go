@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestComputeMetrics tests the size, complexity and coupling metrics of
+// files, functions and packages, and that they are stored on graph nodes
+func TestComputeMetrics(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"store/store.go": `package store
+
+import "strings"
+
+// Get returns a value
+func Get(k string) string {
+	if k == "" && strings.HasPrefix(k, "x") {
+		return "none"
+	}
+	for i := 0; i < 3; i++ {
+		switch i {
+		case 1:
+			k += "a"
+		default:
+		}
+	}
+	return k
+}
+
+func helper() string { return Get("a") }
+`,
+		"api/api.go": "package api\n\nimport \"example.com/app/store\"\n\n// Handle serves a key\nfunc Handle(k string) string { return store.Get(k) }\n",
+		"py/run.py": `def run(x):
+    # comment
+    if x and x > 1:
+        return [y for y in x if y]
+    return None
+`,
+		"web/f.js": `export function f(a) {
+  /* block
+     comment */
+  return a ? a.b ?? 1 : 0;
+}
+`,
+	})
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+	report, err := svc.ComputeMetrics(files, graph)
+	require.NoError(t, err)
+	assert.Empty(t, report.Errors)
+
+	byID := make(map[string]analyzer.CodeMetrics)
+	for _, list := range [][]analyzer.NodeMetrics{report.Files, report.Functions, report.Packages} {
+		for _, n := range list {
+			byID[n.ID] = n.Metrics
+		}
+	}
+
+	get := byID["func:example.com/app/store.Get"]
+	assert.Equal(t, 5, get.Cyclomatic) // if, &&, for, case
+	assert.Equal(t, 13, get.LOC)
+	assert.Equal(t, 2, get.FanIn) // helper and api.Handle
+	assert.Equal(t, 0, get.FanOut)
+	assert.Greater(t, get.HalsteadVolume, 0.0)
+	assert.Greater(t, get.HalsteadEffort, get.HalsteadVolume)
+	assert.Greater(t, get.Maintainability, 0.0)
+	assert.Less(t, get.Maintainability, 100.0)
+
+	helper := byID["func:example.com/app/store.helper"]
+	assert.Equal(t, 1, helper.Cyclomatic)
+	assert.Equal(t, 1, helper.FanOut)
+	assert.Greater(t, helper.Maintainability, get.Maintainability)
+
+	file := byID["file:store/store.go"]
+	assert.Equal(t, 20, file.LOC)
+	assert.Equal(t, 3, file.BlankLines)
+	assert.Equal(t, 1, file.CommentLines)
+	assert.Equal(t, 16, file.SLOC)
+	assert.InDelta(t, 1.0/20, file.CommentRatio, 1e-9)
+	assert.Equal(t, 6, file.Cyclomatic) // both functions
+
+	// Packages are coupled through their imports
+	store := byID["pkg:example.com/app/store"]
+	assert.Equal(t, 6, store.Cyclomatic)
+	assert.Equal(t, 20, store.LOC)
+	assert.Equal(t, 1, store.AfferentCoupling)
+	assert.Equal(t, 1, store.EfferentCoupling) // strings
+	assert.InDelta(t, 0.5, store.Instability, 1e-9)
+	api := byID["pkg:example.com/app/api"]
+	assert.Equal(t, 0, api.AfferentCoupling)
+	assert.Equal(t, 1, api.EfferentCoupling)
+	assert.InDelta(t, 1, api.Instability, 1e-9)
+
+	// Other languages are lexed for their metrics
+	run := byID["func:py/run.py#run"]
+	assert.Equal(t, 5, run.Cyclomatic) // if, and, for, if
+	assert.Equal(t, 1, run.CommentLines)
+	js := byID["file:web/f.js"]
+	assert.Equal(t, 3, js.Cyclomatic) // ?, ??
+	assert.Equal(t, 2, js.CommentLines)
+	assert.Equal(t, 3, js.SLOC)
+
+	// Metrics are stored as node properties
+	for _, node := range graph {
+		if node.ID == "func:example.com/app/store.Get" {
+			assert.Equal(t, 5, node.Properties["cyclomatic"])
+			assert.Equal(t, 2, node.Properties["fanIn"])
+		}
+	}
+
+	assert.Equal(t, 4, report.Summary.Files)
+	assert.Equal(t, 5, report.Summary.Functions)
+	assert.Equal(t, 5, report.Summary.MaxCyclomatic)
+
+	// Snapshots of the summary form a trend, one per commit
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err = svc.RecordMetrics(root, analyzer.MetricsSnapshot{Commit: "a", CreatedAt: start, Summary: report.Summary})
+	require.NoError(t, err)
+	_, err = svc.RecordMetrics(root, analyzer.MetricsSnapshot{Commit: "b", CreatedAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+	trend, err := svc.RecordMetrics(root, analyzer.MetricsSnapshot{Commit: "a", CreatedAt: start.Add(2 * time.Hour), Summary: report.Summary})
+	require.NoError(t, err)
+	require.Len(t, trend, 2)
+	assert.Equal(t, "b", trend[0].Commit)
+	assert.Equal(t, "a", trend[1].Commit)
+	loaded, err := svc.LoadMetricsHistory(root)
+	require.NoError(t, err)
+	assert.Equal(t, trend[1].Summary, loaded[1].Summary)
+}
+
+// branchyGo returns a Go function named name with the given number of if
+// statements, so its cyclomatic complexity is branches+1
+func branchyGo(name string, branches int) string {
+	var sb strings.Builder
+	sb.WriteString("func " + name + "(x int) int {\n")
+	for i := 0; i < branches; i++ {
+		fmt.Fprintf(&sb, "\tif x == %d {\n\t\treturn %d\n\t}\n", i, i)
+	}
+	sb.WriteString("\treturn x\n}\n")
+	return sb.String()
+}
+
+// TestComplexityFindings tests that functions over the cyclomatic
+// complexity threshold are reported and simpler ones are not
+func TestComplexityFindings(t *testing.T) {
+	var python strings.Builder
+	python.WriteString("class Router:\n    def route(self, x):\n")
+	for i := 0; i < analyzer.MaxCyclomaticComplexity; i++ {
+		fmt.Fprintf(&python, "        if x == %d:\n            return %d\n", i, i)
+	}
+	python.WriteString("        return x\n\n\ndef simple():\n    return 1\n")
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"calc/calc.go": "package calc\n\n" +
+			branchyGo("Limit", analyzer.MaxCyclomaticComplexity-1) + "\n" +
+			"type T struct{}\n\n" +
+			strings.Replace(branchyGo("Pick", analyzer.MaxCyclomaticComplexity), "func ", "func (t *T) ", 1),
+		"py/router.py": python.String(),
+	})
+	svc := analyzer.NewService()
+	findings, _, err := svc.AnalyzeFindings(root)
+	require.NoError(t, err)
+
+	var complex []analyzer.AnalysisResult
+	for _, f := range findings {
+		if f.Rule == analyzer.RuleCyclomaticComplexity {
+			f.Fingerprint = ""
+			complex = append(complex, f)
+		}
+	}
+	limitLines := strings.Count(branchyGo("Limit", analyzer.MaxCyclomaticComplexity-1), "\n")
+	assert.Equal(t, []analyzer.AnalysisResult{
+		{
+			Rule:    analyzer.RuleCyclomaticComplexity,
+			File:    "calc/calc.go",
+			Line:    limitLines + 6,
+			Column:  1,
+			Message: "T.Pick has a cyclomatic complexity of 16 (maximum 15)",
+			Level:   "warning",
+		},
+		{
+			Rule:    analyzer.RuleCyclomaticComplexity,
+			File:    "py/router.py",
+			Line:    2,
+			Column:  1,
+			Message: "Router.route has a cyclomatic complexity of 16 (maximum 15)",
+			Level:   "warning",
+		},
+	}, complex)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestMatchVulnerabilities tests offline matching against an OSV database
+// in a directory and a zip, and the reachability of Go advisories
+func TestMatchVulnerabilities(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": `module example.com/app
+
+go 1.22
+
+require (
+	golang.org/x/net v0.10.0
+	github.com/safe/lib v1.2.0
+	github.com/other/lib v2.0.0
+)
+`,
+		"web/web.go": `package web
+
+import "golang.org/x/net/html"
+
+// Parse parses a page
+func Parse(s string) error {
+	_, err := html.Parse(nil)
+	return err
+}
+
+// Page holds a tokenizer
+type Page struct {
+	z *html.Tokenizer
+}
+
+// Tokens reads the tokens of a page
+func (p *Page) Tokens() {
+	for t := p.z.Next(); t != html.ErrorToken; t = p.z.Next() {
+	}
+}
+`,
+		// Imports http2 but only calls a local ServeConn
+		"srv/srv.go": `package srv
+
+import "golang.org/x/net/http2"
+
+var _ = http2.ErrCodeNo
+
+type server struct{}
+
+func (server) ServeConn() {}
+
+// Serve serves
+func Serve() {
+	var s server
+	s.ServeConn()
+}
+`,
+		"py/requirements.txt": "Django==3.2.0\nrequests==2.31.0\n",
+	})
+	entries := map[string]string{
+		// Called: html.Parse
+		"GO-2023-0001.json": `{"id": "GO-2023-0001", "aliases": ["CVE-2023-0001"], "summary": "Quadratic parsing",
+			"affected": [{"package": {"ecosystem": "Go", "name": "golang.org/x/net"},
+				"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "0.13.0"}]}],
+				"ecosystem_specific": {"imports": [{"path": "golang.org/x/net/html", "symbols": ["Parse", "Tokenizer.Next"]}]}}]}`,
+		// Never called: only a local method of the same name is
+		"GO-2023-0002.json": `{"id": "GO-2023-0002", "summary": "Stream reset",
+			"affected": [{"package": {"ecosystem": "Go", "name": "golang.org/x/net"},
+				"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "0.17.0"}]}],
+				"ecosystem_specific": {"imports": [{"path": "golang.org/x/net/http2", "symbols": ["Server.ServeConn"]}]}}]}`,
+		// Fixed before the version in use
+		"GO-2022-0003.json": `{"id": "GO-2022-0003",
+			"affected": [{"package": {"ecosystem": "Go", "name": "github.com/safe/lib"},
+				"ranges": [{"type": "SEMVER", "events": [{"introduced": "1.0.0"}, {"fixed": "1.1.0"}]}]}]}`,
+		"PYSEC-2021-1.json": `[{"id": "PYSEC-2021-1", "summary": "SQL injection",
+			"affected": [{"package": {"ecosystem": "PyPI", "name": "django"},
+				"ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "3.2"}, {"fixed": "3.2.5"}, {"introduced": "4.0"}, {"fixed": "4.0.2"}]}]}]}]`,
+		"PYSEC-2023-2.json": `{"id": "PYSEC-2023-2",
+			"affected": [{"package": {"ecosystem": "PyPI", "name": "requests"},
+				"versions": ["2.30.0"], "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "2.0"}, {"last_affected": "2.30.0"}]}]}]}`,
+	}
+	dbDir := t.TempDir()
+	zipPath := filepath.Join(t.TempDir(), "all.zip")
+	out, err := os.Create(zipPath)
+	require.NoError(t, err)
+	archive := zip.NewWriter(out)
+	for name, content := range entries {
+		require.NoError(t, os.WriteFile(filepath.Join(dbDir, name), []byte(content), 0644))
+		w, err := archive.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	require.NoError(t, out.Close())
+
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+	deps, _, err := svc.ParseDependencies(root)
+	require.NoError(t, err)
+
+	for _, source := range []string{dbDir, zipPath} {
+		db, err := analyzer.LoadVulnerabilityDatabase(source)
+		require.NoError(t, err)
+		assert.Len(t, db.Entries, 5)
+
+		matches := svc.MatchVulnerabilities(files, deps, graph, db, analyzer.VulnerabilityOptions{})
+		require.Len(t, matches, 2)
+		golang, django := matches[0], matches[1]
+		assert.Equal(t, "GO-2023-0001", golang.Advisory)
+		require.NotNil(t, golang.Reachable)
+		assert.True(t, *golang.Reachable)
+		assert.Equal(t, []string{"golang.org/x/net/html.Parse", "golang.org/x/net/html.Tokenizer.Next"}, golang.Symbols)
+		assert.Equal(t, []string{"func:example.com/app/web.Parse", "method:example.com/app/web.Page.Tokens"}, golang.CalledFrom)
+		assert.Equal(t, []string{"0.13.0"}, golang.FixedVersions)
+		assert.Equal(t, "PYSEC-2021-1", django.Advisory)
+		assert.Nil(t, django.Reachable)
+		assert.Equal(t, []string{"3.2.5", "4.0.2"}, django.FixedVersions)
+
+		// Unreachable advisories can be kept
+		all := svc.MatchVulnerabilities(files, deps, graph, db, analyzer.VulnerabilityOptions{IncludeUnreachable: true})
+		require.Len(t, all, 3)
+		assert.Equal(t, "GO-2023-0002", all[1].Advisory)
+		assert.False(t, *all[1].Reachable)
+
+		findings := svc.VulnerabilityFindings(root, all)
+		require.Len(t, findings, 3)
+		assert.Equal(t, analyzer.AnalysisResult{
+			Rule:    "GO-2023-0001",
+			File:    "go.mod",
+			Line:    6,
+			Column:  1,
+			Message: "golang.org/x/net v0.10.0 is affected by GO-2023-0001 (CVE-2023-0001): Quadratic parsing; fixed in 0.13.0; called: golang.org/x/net/html.Parse, golang.org/x/net/html.Tokenizer.Next",
+			Level:   "error",
+		}, findings[0])
+		assert.Equal(t, "info", findings[1].Level)
+		assert.Equal(t, "py/requirements.txt", findings[2].File)
+		assert.Equal(t, 1, findings[2].Line)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// writeSyntheticRepo writes a repository of n source files spread over
+// packages of 20 files, half Go and the rest JavaScript and Python
+func writeSyntheticRepo(tb testing.TB, n int) string {
+	root := tb.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/synthetic\n\ngo 1.22\n")
+
+	for i := 0; i < n; i++ {
+		pkg := fmt.Sprintf("pkg%03d", i/20)
+		switch i % 4 {
+		case 0, 1:
+			var deps string
+			if i >= 20 {
+				deps = fmt.Sprintf("\nimport dep \"example.com/synthetic/pkg%03d\"\n\nvar _ = dep.F%d\n", i/20-1, i-20)
+			}
+			write(fmt.Sprintf("%s/f%d.go", pkg, i), fmt.Sprintf(`package %s
+%s
+// F%d doubles a number
+func F%d(x int) int {
+	if x > 0 {
+		return x * 2
+	}
+	return -x
+}
+
+// T%d holds a value
+type T%d struct{ V int }
+
+// Get returns the value
+func (t *T%d) Get() int { return F%d(t.V) }
+`, pkg, deps, i, i, i, i, i, i))
+		case 2:
+			write(fmt.Sprintf("web/%s/m%d.js", pkg, i), fmt.Sprintf(`import { helper } from './m%d';
+
+export class Widget%d {
+  render(x) {
+    return helper(x) + 1;
+  }
+}
+`, i-2, i))
+		case 3:
+			write(fmt.Sprintf("py/%s/m%d.py", pkg, i), fmt.Sprintf(`import os
+
+
+class Model%d:
+    def run(self, x):
+        return os.path.join(x, "%d")
+`, i, i))
+		}
+	}
+	return root
+}
+
+// TestPipelineMatchesSequential tests that concurrent indexing, analysis
+// and graph building give the same results as a single worker
+func TestPipelineMatchesSequential(t *testing.T) {
+	root := writeSyntheticRepo(t, 200)
+
+	run := func(workers int) ([]analyzer.SourceFile, []analyzer.AnalysisResult, []string) {
+		svc := &analyzer.Service{Pipeline: analyzer.PipelineOptions{Workers: workers, QueueSize: 1, MaxBytes: 512}}
+		files, fileErrs, err := svc.IndexSourceFilesContext(context.Background(), root)
+		require.NoError(t, err)
+		assert.Empty(t, fileErrs)
+		results, fileErrs, err := svc.RunStaticAnalysisContext(context.Background(), files)
+		require.NoError(t, err)
+		assert.Empty(t, fileErrs)
+		graph, fileErrs, err := svc.BuildCodeKnowledgeGraphContext(context.Background(), files)
+		require.NoError(t, err)
+		assert.Empty(t, fileErrs)
+		return files, results, graphEdges(graph)
+	}
+
+	files, results, edges := run(1)
+	parallelFiles, parallelResults, parallelEdges := run(8)
+	assert.Len(t, files, 200)
+	assert.Equal(t, files, parallelFiles)
+	assert.Equal(t, results, parallelResults)
+	assert.Equal(t, edges, parallelEdges)
+
+	// Files keep the order of filepath.Walk
+	var walked []string
+	require.NoError(t, filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if !info.IsDir() && !strings.HasSuffix(path, ".mod") {
+			rel, _ := filepath.Rel(root, path)
+			walked = append(walked, rel)
+		}
+		return nil
+	}))
+	for i, f := range files {
+		assert.Equal(t, walked[i], f.Path)
+	}
+}
+
+// TestPipelineErrors tests that per-file failures are reported without
+// aborting the run, and that cancellation does abort it
+func TestPipelineErrors(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"a/a.go": "package a\n\n// A is fine\nfunc A() {}\n",
+	})
+	svc := analyzer.NewService()
+	files, _, err := svc.IndexSourceFilesContext(context.Background(), root)
+	require.NoError(t, err)
+	files = append(files,
+		analyzer.SourceFile{Path: "missing/gone.go", Language: "Go", AbsPath: filepath.Join(root, "missing/gone.go")},
+		analyzer.SourceFile{Path: "missing/gone.py", Language: "Python", AbsPath: filepath.Join(root, "missing/gone.py")},
+	)
+
+	graph, fileErrs, err := svc.BuildCodeKnowledgeGraphContext(context.Background(), files)
+	require.NoError(t, err)
+	require.Len(t, fileErrs, 2)
+	assert.Equal(t, "missing/gone.go", fileErrs[0].Path)
+	assert.Equal(t, "missing/gone.py", fileErrs[1].Path)
+	nodes := make(map[string]bool)
+	for _, node := range graph {
+		nodes[node.ID] = true
+	}
+	assert.True(t, nodes["func:example.com/app/a.A"])
+	assert.True(t, nodes["file:missing/gone.go"])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = svc.BuildCodeKnowledgeGraphContext(ctx, files)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, _, err = svc.IndexSourceFilesContext(ctx, root)
+	assert.ErrorIs(t, err, context.Canceled)
+}
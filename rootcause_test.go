@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+const rootCauseSource = `package cache
+
+import "strconv"
+
+// Fill writes keys from several goroutines
+func Fill(m map[string]int, n int) {
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			m[strconv.Itoa(i)] = i
+		}(i)
+	}
+}
+
+// First returns the first element
+func First(xs []int, i int) int {
+	v, _ := strconv.Atoi("1")
+	return xs[i] + v
+}
+`
+
+// TestDiagnoseRootCause tests catalogue matching against errors and code
+func TestDiagnoseRootCause(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"go.mod":         "module example.com/app\n\ngo 1.22\n",
+		"cache/cache.go": rootCauseSource,
+	})
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+
+	logs := []analyzer.ErrorLog{{
+		Message: "fatal error: concurrent map writes",
+		Frames:  []analyzer.StackFrame{{Function: "cache.Fill.func1", File: "cache/cache.go", Line: 9}},
+	}}
+	diagnoses, err := svc.DiagnoseRootCauseWithOptions([]string{"func:example.com/app/cache.Fill"}, graph, analyzer.DiagnoseOptions{
+		RepoPath: root,
+		Logs:     logs,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, diagnoses)
+	d := diagnoses[0]
+	assert.Equal(t, "concurrent-map-writes", d.RuleID)
+	assert.Equal(t, 0.9, d.Confidence)
+	assert.Contains(t, d.Cause, "Fill")
+	assert.NotEmpty(t, d.Remediations)
+	require.Len(t, d.Evidence, 2)
+	assert.Equal(t, "error", d.Evidence[0].Kind)
+	assert.Equal(t, analyzer.Evidence{Kind: "code", File: "cache/cache.go", Line: 9, Snippet: "m[strconv.Itoa(i)] = i"}, d.Evidence[1])
+
+	// An unrelated panic still matches, with lower confidence and no code evidence
+	logs = []analyzer.ErrorLog{{Message: "panic: runtime error: index out of range [3] with length 3"}}
+	diagnoses, err = svc.DiagnoseRootCauseWithOptions([]string{"func:example.com/app/cache.First"}, graph, analyzer.DiagnoseOptions{
+		RepoPath: root,
+		Logs:     logs,
+	})
+	require.NoError(t, err)
+	require.Len(t, diagnoses, 1)
+	assert.Equal(t, "index-out-of-range", diagnoses[0].RuleID)
+	assert.InDelta(t, 0.85*0.6, diagnoses[0].Confidence, 1e-9)
+	assert.Equal(t, 17, diagnoses[0].Evidence[1].Line)
+	assert.Contains(t, diagnoses[0].Cause, "index out of range [3] with length 3")
+
+	// Without matching errors the suspect falls back to a generic diagnosis
+	assert.Equal(t, map[string]string{
+		"func:example.com/app/cache.First": "Potential issue in First: no known error signature matched",
+	}, svc.DiagnoseRootCause(root, nil, []string{"func:example.com/app/cache.First"}, graph))
+	assert.Equal(t, map[string]string{
+		"func:example.com/app/cache.First": diagnoses[0].Cause,
+	}, svc.DiagnoseRootCause(root, logs, []string{"func:example.com/app/cache.First"}, graph))
+}
+
+// TestLoadRuleCatalog tests repository rule files overriding the defaults
+func TestLoadRuleCatalog(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		".codeanalyzer/rules/10-off.yaml": "rules:\n  - id: deadlock\n    disabled: true\n",
+		".codeanalyzer/rules/20-custom.json": `{"rules": [{
+			"id": "pool-exhausted",
+			"name": "Connection pool exhausted",
+			"errors": ["too many connections"],
+			"cause": "{name} leaks database connections",
+			"confidence": 0.7
+		}]}`,
+	})
+	svc := analyzer.NewService()
+	catalog, err := svc.LoadRuleCatalog(root)
+	require.NoError(t, err)
+
+	rules := make(map[string]analyzer.RootCauseRule)
+	for _, r := range catalog.Rules {
+		rules[r.ID] = r
+	}
+	assert.Contains(t, rules, "nil-dereference")
+	assert.True(t, rules["deadlock"].Disabled)
+	assert.Equal(t, 0.7, rules["pool-exhausted"].Confidence)
+
+	graph := []analyzer.GraphNode{{ID: "func:db.Open", Type: analyzer.NodeFunction, Name: "Open"}}
+	diagnoses, err := svc.DiagnoseRootCauseWithOptions([]string{"func:db.Open"}, graph, analyzer.DiagnoseOptions{
+		Logs:    []analyzer.ErrorLog{{Message: "pq: sorry, too many connections for role"}, {Message: "all goroutines are asleep - deadlock!"}},
+		Catalog: catalog,
+	})
+	require.NoError(t, err)
+	require.Len(t, diagnoses, 1, "disabled rules do not match")
+	assert.Equal(t, "Open leaks database connections", diagnoses[0].Cause)
+	assert.Equal(t, map[string]string{"func:db.Open": "Open leaks database connections"},
+		svc.DiagnoseRootCause(root, []analyzer.ErrorLog{{Message: "too many connections"}}, []string{"func:db.Open"}, graph))
+
+	_, err = analyzer.ParseRuleCatalog([]byte(`{"rules": [{"id": "bad", "errors": ["("], "cause": "x"}]}`), "json")
+	assert.Error(t, err)
+	_, err = analyzer.ParseRuleCatalog([]byte("rules:\n  - id: bad\n    ast: [nope]\n    cause: x\n"), "yaml")
+	assert.Error(t, err)
+}
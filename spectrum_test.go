@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestParseCoverage tests Go cover profile and LCOV parsing
+func TestParseCoverage(t *testing.T) {
+	svc := analyzer.NewService()
+
+	profile := `mode: set
+example.com/app/api.go:3.10,5.2 2 1
+example.com/app/api.go:7.10,8.2 1 0
+example.com/app/store.go:1.1,2.2 1 4
+`
+	cov, err := svc.ParseGoCoverProfile(strings.NewReader(profile), "example.com/app")
+	require.NoError(t, err)
+	assert.Equal(t, map[int]bool{3: true, 4: true, 5: true}, cov["api.go"])
+	assert.Equal(t, map[int]bool{1: true, 2: true}, cov["store.go"])
+
+	// Only whole path elements of the module path are trimmed
+	cov, err = svc.ParseGoCoverProfile(strings.NewReader("mode: set\nexample.com/appx/x.go:1.1,1.2 1 1\n"), "example.com/app")
+	require.NoError(t, err)
+	assert.Contains(t, cov, "example.com/appx/x.go")
+
+	_, err = svc.ParseGoCoverProfile(strings.NewReader("garbage"), "")
+	assert.Error(t, err)
+
+	root := writeRepo(t, map[string]string{"src/util.js": "module.exports = 1\n"})
+	lcov := `TN:
+SF:/ci/build/src/util.js
+DA:1,3
+DA:2,0
+end_of_record
+`
+	cov, err = svc.ParseLCOV(strings.NewReader(lcov), root)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]bool{1: true}, cov["src/util.js"])
+
+	// ParseCoverage picks the parser by format, and the module path from go.mod
+	cov, err = svc.ParseCoverage(root, analyzer.CoverageFormatLCOV, strings.NewReader(lcov))
+	require.NoError(t, err)
+	assert.Equal(t, map[int]bool{1: true}, cov["src/util.js"])
+	require.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/app\n\ngo 1.22\n"), 0644))
+	cov, err = svc.ParseCoverage(root, analyzer.CoverageFormatGo, strings.NewReader(profile))
+	require.NoError(t, err)
+	assert.Equal(t, map[int]bool{1: true, 2: true}, cov["store.go"])
+	_, err = svc.ParseCoverage(root, "xml", strings.NewReader(profile))
+	assert.Error(t, err)
+}
+
+// TestComputeSpectrum tests suspiciousness formulas and spectrum localization
+func TestComputeSpectrum(t *testing.T) {
+	svc := analyzer.NewService()
+
+	// Line 15 of service is executed by the failing run only
+	runs := []analyzer.CoverageRun{
+		{Name: "TestFail", Failed: true, Coverage: analyzer.Coverage{
+			"api.go":   {2: true, 15: true},
+			"store.go": {5: true},
+		}},
+		{Name: "TestPass", Coverage: analyzer.Coverage{
+			"api.go":   {2: true},
+			"store.go": {5: true},
+			"util.go":  {3: true},
+		}},
+	}
+	report := svc.ComputeSpectrum(runs, localizeGraph)
+	assert.Equal(t, 1, report.FailedRuns)
+	assert.Equal(t, 1, report.PassedRuns)
+	require.Len(t, report.Lines, 3, "lines only passing runs execute are not suspicious")
+	assert.Equal(t, "api.go", report.Lines[0].File)
+	assert.Equal(t, 15, report.Lines[0].Line)
+	assert.Equal(t, 1.0, report.Lines[0].Ochiai)
+	assert.Equal(t, 1.0, report.Lines[0].Tarantula)
+	assert.InDelta(t, 0.5, report.Lines[1].Tarantula, 1e-9)
+
+	ochiai := report.NodeScores(analyzer.FormulaOchiai)
+	assert.Equal(t, 1.0, ochiai["func:service"])
+	assert.InDelta(t, 0.7071, ochiai["func:repo"], 1e-3)
+	assert.NotContains(t, ochiai, "func:helper")
+	dstar := report.NodeScores(analyzer.FormulaDStar)
+	assert.Equal(t, 1.0, dstar["func:service"])
+	assert.Less(t, dstar["func:repo"], 1e-3)
+
+	// Spectrum alone works without error nodes
+	opts := analyzer.DefaultLocalizeOptions()
+	opts.Strategy = analyzer.StrategySpectrum
+	opts.Spectrum = ochiai
+	suspects := svc.RankSuspects(nil, localizeGraph, opts)
+	require.Len(t, suspects, 3)
+	assert.Equal(t, "func:service", suspects[0].NodeID)
+
+	// Combined, the spectrum overrides graph propagation from the error node
+	opts.Strategy = analyzer.StrategyCombined
+	ids := svc.LocalizeErrorsWithOptions([]string{"func:repo"}, localizeGraph, opts)
+	assert.Equal(t, []string{"func:service", "func:repo", "func:handler"}, ids)
+
+	opts.Strategy = analyzer.StrategyGraph
+	ids = svc.LocalizeErrorsWithOptions([]string{"func:repo"}, localizeGraph, opts)
+	assert.Equal(t, "func:repo", ids[0])
+}
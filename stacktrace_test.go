@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// newStackTraceRepo creates a repository layout for frame path normalization
+func newStackTraceRepo(t *testing.T) string {
+	root := t.TempDir()
+	for _, f := range []string{
+		"main.go",
+		"internal/users/user.go",
+		"internal/admin/admin_user.go",
+		"app/service.py",
+		"src/main/java/com/acme/Foo.java",
+		"src/index.js",
+	} {
+		path := filepath.Join(root, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+	return root
+}
+
+// TestParseGoPanic tests parsing of a multi-goroutine Go panic dump
+func TestParseGoPanic(t *testing.T) {
+	repo := newStackTraceRepo(t)
+	trace := `panic: runtime error: invalid memory address or nil pointer dereference
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x47b2c5]
+
+goroutine 1 [running]:
+github.com/acme/svc/internal/users.(*User).Name(0x0)
+	/home/ci/build/internal/users/user.go:12 +0x5
+main.main()
+	/home/ci/build/main.go:8 +0x1d
+
+goroutine 6 [chan receive]:
+main.worker(...)
+	/home/ci/build/main.go:30
+created by main.main in goroutine 1
+	/home/ci/build/main.go:20 +0x99
+exit status 2`
+
+	logs := analyzer.NewService().ParseStackTraces(trace, repo)
+	require.Len(t, logs, 1)
+
+	log := logs[0]
+	assert.Equal(t, "Go", log.Language)
+	assert.Contains(t, log.Message, "nil pointer dereference")
+	assert.Equal(t, "internal/users/user.go", log.File)
+	assert.Equal(t, 12, log.Line)
+	require.Len(t, log.Frames, 4)
+	assert.Equal(t, "github.com/acme/svc/internal/users.(*User).Name", log.Frames[0].Function)
+	assert.Equal(t, "goroutine 1", log.Frames[0].Thread)
+	assert.Equal(t, "main.worker", log.Frames[2].Function)
+	assert.Equal(t, "goroutine 6", log.Frames[2].Thread)
+	assert.Equal(t, "created by main.main", log.Frames[3].Function)
+	assert.True(t, log.Frames[3].InRepo)
+}
+
+// TestParsePythonChainedTraceback tests parsing of chained Python exceptions
+func TestParsePythonChainedTraceback(t *testing.T) {
+	repo := newStackTraceRepo(t)
+	trace := `Traceback (most recent call last):
+  File "/srv/app/service.py", line 3, in load
+    return cache["key"]
+KeyError: 'key'
+
+The above exception was the direct cause of the following exception:
+
+Traceback (most recent call last):
+  File "/srv/app/service.py", line 10, in <module>
+    main()
+  File "/srv/app/service.py", line 6, in main
+    load()
+app.errors.LoadFailed: cache miss`
+
+	logs := analyzer.NewService().ParseStackTraces(trace, repo)
+	require.Len(t, logs, 1)
+
+	log := logs[0]
+	assert.Equal(t, "app.errors.LoadFailed: cache miss", log.Message)
+	require.Len(t, log.Frames, 2)
+	assert.Equal(t, "main", log.Frames[0].Function)
+	assert.Equal(t, "app/service.py", log.Frames[0].File)
+	require.NotNil(t, log.Cause)
+	assert.Equal(t, "KeyError: 'key'", log.Cause.Message)
+	assert.Equal(t, 3, log.Cause.Line)
+}
+
+// TestParseJavaCausedBy tests parsing of Java traces with a cause chain
+func TestParseJavaCausedBy(t *testing.T) {
+	repo := newStackTraceRepo(t)
+	trace := `Exception in thread "main" java.lang.IllegalStateException: bad state
+	at com.acme.Foo.bar(Foo.java:10)
+	at com.acme.Main.main(Main.java:5)
+Caused by: java.lang.NullPointerException
+	at com.acme.Foo.baz(Foo.java:20)
+	... 1 more`
+
+	logs := analyzer.NewService().ParseStackTraces(trace, repo)
+	require.Len(t, logs, 1)
+
+	log := logs[0]
+	assert.Equal(t, "java.lang.IllegalStateException: bad state", log.Message)
+	assert.Equal(t, "src/main/java/com/acme/Foo.java", log.File)
+	assert.Equal(t, "main", log.Frames[0].Thread)
+	assert.False(t, log.Frames[1].InRepo)
+	require.NotNil(t, log.Cause)
+	assert.Equal(t, 20, log.Cause.Frames[0].Line)
+}
+
+// TestParseNodeStack tests parsing of a Node.js error stack
+func TestParseNodeStack(t *testing.T) {
+	repo := newStackTraceRepo(t)
+	trace := `TypeError: Cannot read properties of undefined (reading 'id')
+    at getUser (/app/src/index.js:10:5)
+    at Module._compile (node:internal/modules/cjs/loader:1105:14)
+    at /app/src/index.js:3:1`
+
+	logs := analyzer.NewService().ParseStackTraces(trace, repo)
+	require.Len(t, logs, 1)
+
+	log := logs[0]
+	assert.Equal(t, "JavaScript", log.Language)
+	require.Len(t, log.Frames, 3)
+	assert.Equal(t, "getUser", log.Frames[0].Function)
+	assert.Equal(t, "src/index.js", log.File)
+	assert.False(t, log.Frames[1].InRepo)
+	assert.Equal(t, "<anonymous>", log.Frames[2].Function)
+}
+
+// TestResolveStdlibFrames tests that frames outside the repository are not
+// mapped onto repository files sharing only their base name, and that
+// equally good matches are left unresolved
+func TestResolveStdlibFrames(t *testing.T) {
+	repo := writeRepo(t, map[string]string{
+		"internal/util/panic.go": "package util\n",
+		"internal/util/run.go":   "package util\n",
+		"a/x/shared.go":          "package x\n",
+		"b/x/shared.go":          "package x\n",
+	})
+	trace := `panic: boom
+
+goroutine 1 [running]:
+panic({0x4a0f20, 0xc000012345})
+	/usr/local/go/src/runtime/panic.go:770 +0x132
+example.com/app/x.Shared()
+	/home/ci/build/x/shared.go:5 +0x1d
+example.com/app/internal/util.Run()
+	/home/ci/build/internal/util/run.go:8 +0x1d`
+
+	logs := analyzer.NewService().ParseStackTraces(trace, repo)
+	require.Len(t, logs, 1)
+
+	log := logs[0]
+	require.Len(t, log.Frames, 3)
+	assert.False(t, log.Frames[0].InRepo)
+	assert.Equal(t, "/usr/local/go/src/runtime/panic.go", log.Frames[0].File)
+	assert.False(t, log.Frames[1].InRepo)
+	assert.True(t, log.Frames[2].InRepo)
+	assert.Equal(t, "internal/util/run.go", log.File)
+	assert.Equal(t, 8, log.Line)
+}
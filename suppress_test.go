@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+)
+
+// TestApplySuppressions tests the suppression comment syntaxes of each
+// language and the audit of unused and unexplained suppressions
+func TestApplySuppressions(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"app/app.go": `package app
+
+func Load() error {
+	err := run() //nolint:errcheck // run never fails here
+	// codeanalyzer:ignore shadow,unused generated code
+	v := 1
+	url := "http://example.com" // nolint:unused
+	_ = v //nolint:shadow
+	return err
+}
+`,
+		"web/app.js": `function main() {
+  // eslint-disable-next-line no-eval -- input is trusted
+  eval(code);
+  var x = 1; // eslint-disable-line no-unused-vars
+}
+`,
+		"py/app.py": `import os  # noqa: F401
+x = "a # noqa: E501"
+# codeanalyzer:ignore missing-docstring legacy module
+def run():  # type: ignore  # pylint: disable=invalid-name
+    pass
+`,
+	})
+	svc := analyzer.NewService()
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+
+	finding := func(file, rule string, line int) analyzer.AnalysisResult {
+		return analyzer.AnalysisResult{Rule: rule, File: file, Line: line, Message: rule, Level: "warning"}
+	}
+	findings := []analyzer.AnalysisResult{
+		finding("app/app.go", "errcheck", 4),
+		finding("app/app.go", "ineffassign", 4),
+		finding("app/app.go", "unused", 6),
+		finding("app/app.go", "unused", 9),
+		finding("web/app.js", "no-eval", 3),
+		finding("web/app.js", "no-unused-vars", 4),
+		finding("py/app.py", "F401", 1),
+		finding("py/app.py", "E501", 2),
+		finding("py/app.py", "missing-docstring", 4),
+		finding("py/app.py", "invalid-name", 4),
+	}
+	result, report, err := svc.ApplySuppressions(files, findings)
+	require.NoError(t, err)
+	require.Len(t, result, len(findings))
+
+	suppressed := make(map[string]bool)
+	for _, f := range result {
+		suppressed[fmt.Sprintf("%s %s %d", f.File, f.Rule, f.Line)] = f.Suppression != nil
+	}
+	assert.Equal(t, map[string]bool{
+		"app/app.go errcheck 4":         true,
+		"app/app.go ineffassign 4":      false, // another rule
+		"app/app.go unused 6":           true,  // own-line comment applies to the next line
+		"app/app.go unused 9":           false, // no comment
+		"web/app.js no-eval 3":          true,
+		"web/app.js no-unused-vars 4":   true,
+		"py/app.py F401 1":              true,
+		"py/app.py E501 2":              false, // inside a string
+		"py/app.py missing-docstring 4": true,
+		"py/app.py invalid-name 4":      true, // after another comment
+	}, suppressed)
+	assert.Equal(t, "run never fails here", result[0].Suppression.Justification)
+	assert.Equal(t, "inSource", result[0].Suppression.Kind)
+
+	audit := func(sups []analyzer.Suppression) []string {
+		var lines []string
+		for _, sup := range sups {
+			lines = append(lines, fmt.Sprintf("%s:%d %s", sup.File, sup.Line, sup.Syntax))
+		}
+		return lines
+	}
+	assert.Len(t, report.Suppressions, 9)
+	assert.Equal(t, []string{"app/app.go:7 nolint", "app/app.go:8 nolint"}, audit(report.Unused))
+	assert.Equal(t, []string{
+		"app/app.go:7 nolint", "app/app.go:8 nolint",
+		"py/app.py:1 noqa", "py/app.py:4 pylint",
+		"web/app.js:4 eslint-disable",
+	}, audit(report.MissingReason))
+	assert.Len(t, report.Findings(), 7)
+
+	// SARIF keeps suppressed results with their justification
+	log := analyzer.ToSARIF(append(result, report.Findings()...))
+	data, err := json.Marshal(log)
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "2.1.0", decoded["version"])
+
+	run := log.Runs[0]
+	assert.Len(t, run.Results, len(findings)+7)
+	first := run.Results[0]
+	assert.Equal(t, "errcheck", first.RuleID)
+	assert.Equal(t, "errcheck", run.Tool.Driver.Rules[first.RuleIndex].ID)
+	assert.Equal(t, "app/app.go", first.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, 4, first.Locations[0].PhysicalLocation.Region.StartLine)
+	require.Len(t, first.Suppressions, 1)
+	assert.Equal(t, "run never fails here", first.Suppressions[0].Justification)
+	assert.Empty(t, run.Results[1].Suppressions)
+}
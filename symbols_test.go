@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBuildMultiLanguageKnowledgeGraph tests symbol extraction for TypeScript, Python and Java
+func TestBuildMultiLanguageKnowledgeGraph(t *testing.T) {
+	root := writeRepo(t, map[string]string{
+		"web/api.ts": `import { format } from './format';
+import axios from "axios";
+
+export class UserClient {
+  constructor(private base: string) {}
+
+  async fetchUser(id: string): Promise<User> {
+    const res = await axios.get(` + "`${this.base}/users/${id}`" + `);
+    return format(res.data);
+  }
+}
+
+export const isAdmin = (u: User): boolean =>
+  u.role === "admin";
+`,
+		"web/format.js": `export function format(user) {
+  return { name: user.name };
+}
+`,
+		"svc/users.py": `from .db import query
+
+
+class UserRepo:
+    """Loads users.
+
+    def not_a_method(self):
+    """
+
+    def get(self, uid):
+        rows = query(
+            "select * from users where id = %s",
+            uid,
+        )
+        return rows[0]
+`,
+		"svc/db.py": "def query(sql, *args):\n    return []\n",
+		"src/main/java/com/acme/Users.java": `package com.acme;
+
+import java.util.Map;
+
+public class Users {
+    @Override
+    public String toString() {
+        return "users";
+    }
+}
+`,
+	})
+
+	nodes := buildGraph(t, root)
+
+	fetch, ok := nodes["method:web/api.ts#UserClient.fetchUser"]
+	require.True(t, ok)
+	assert.Equal(t, 7, fetch.StartLine)
+	assert.Equal(t, 10, fetch.EndLine)
+	assert.Equal(t, "UserClient", fetch.Receiver)
+
+	isAdmin := nodes["func:web/api.ts#isAdmin"]
+	assert.Equal(t, 13, isAdmin.StartLine)
+	assert.Equal(t, 14, isAdmin.EndLine)
+
+	api := nodes["file:web/api.ts"]
+	assert.True(t, hasEdge(api, "imports", "file:web/format.js"))
+	assert.True(t, hasEdge(api, "imports", "pkg:axios"))
+	assert.True(t, hasEdge(api, "contains", "type:web/api.ts#UserClient"))
+
+	get, ok := nodes["method:svc/users.py#UserRepo.get"]
+	require.True(t, ok)
+	assert.Equal(t, 10, get.StartLine)
+	assert.Equal(t, 15, get.EndLine)
+	assert.NotContains(t, nodes, "method:svc/users.py#UserRepo.not_a_method")
+	assert.True(t, hasEdge(nodes["file:svc/users.py"], "imports", "file:svc/db.py"))
+
+	toString, ok := nodes["method:src/main/java/com/acme/Users.java#Users.toString"]
+	require.True(t, ok)
+	assert.Equal(t, 7, toString.StartLine)
+	assert.Equal(t, 9, toString.EndLine)
+	assert.True(t, hasEdge(nodes["file:src/main/java/com/acme/Users.java"], "imports", "pkg:java.util.Map"))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/teathis/codeanalyzer/internal/analyzer"
+	"github.com/teathis/codeanalyzer/internal/validation"
+)
+
+// newValidationRepo writes a module whose out-of-range test panics
+func newValidationRepo(t *testing.T) string {
+	return writeRepo(t, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.22\n",
+		"calc/calc.go": `package calc
+
+// At returns the element at i
+func At(xs []int, i int) (int, error) {
+	return xs[i], nil
+}
+`,
+		"calc/calc_test.go": `package calc
+
+import "testing"
+
+func TestAt(t *testing.T) {
+	if v, _ := At([]int{4}, 0); v != 4 {
+		t.Fatal(v)
+	}
+}
+
+func TestAtOutOfRange(t *testing.T) {
+	if _, err := At([]int{4}, 3); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+`,
+	})
+}
+
+// TestValidatePatch tests building and testing fixes in an isolated copy
+func TestValidatePatch(t *testing.T) {
+	root := newValidationRepo(t)
+	svc := analyzer.NewService()
+	validator := validation.NewService(svc)
+	opts := validation.DefaultOptions(root)
+	require.Equal(t, []string{"go", "test", "-json", "./..."}, opts.TestCommand)
+
+	files, err := svc.IndexSourceFiles(root)
+	require.NoError(t, err)
+	graph, err := svc.BuildCodeKnowledgeGraph(files)
+	require.NoError(t, err)
+	patches, err := svc.SuggestFixes(root, []analyzer.Diagnosis{{
+		NodeID: "func:example.com/app/calc.At",
+		RuleID: "index-out-of-range",
+		Fixes:  []string{"bounds-check"},
+	}}, graph)
+	require.NoError(t, err)
+	require.Len(t, patches, 1)
+
+	report, err := validator.ValidatePatch(context.Background(), root, patches[0], opts)
+	require.NoError(t, err)
+	assert.True(t, report.Applied)
+	assert.Equal(t, []string{"calc/calc.go"}, report.Files)
+	assert.True(t, report.Build.Success)
+	assert.True(t, report.Valid, report.Test.Output)
+	assert.False(t, report.Baseline.Success)
+	assert.Equal(t, []string{"example.com/app/calc.TestAtOutOfRange"}, report.Fixed)
+	assert.Empty(t, report.Broken)
+	assert.Equal(t, "pass", report.Test.Tests["example.com/app/calc.TestAt"])
+
+	// A patch that breaks the build is rejected, and its errors are fed back
+	broken := analyzer.Patch{ID: "broken", Diff: `--- a/calc/calc.go
++++ b/calc/calc.go
+@@ -3,4 +3,4 @@
+ // At returns the element at i
+ func At(xs []int, i int) (int, error) {
+-	return xs[i], nil
++	return xs[i], missing
+ }
+`}
+	report, err = validator.ValidatePatch(context.Background(), root, broken, opts)
+	require.NoError(t, err)
+	assert.True(t, report.Applied)
+	assert.False(t, report.Build.Success)
+	assert.Nil(t, report.Test)
+	assert.False(t, report.Valid)
+	require.NotEmpty(t, report.ErrorLogs)
+	assert.Equal(t, "calc/calc.go", report.ErrorLogs[0].File)
+	assert.Equal(t, 5, report.ErrorLogs[0].Line)
+
+	logs, err := svc.ParseErrorLogs(root)
+	require.NoError(t, err)
+	assert.NotEmpty(t, logs, "validation logs are stored with the repository")
+
+	// Patches whose context does not match are not applied
+	report, err = validator.ValidatePatch(context.Background(), root, analyzer.Patch{ID: "stale", Diff: `--- a/calc/calc.go
++++ b/calc/calc.go
+@@ -1,1 +1,1 @@
+-package other
++package calc2
+`}, opts)
+	require.NoError(t, err)
+	assert.False(t, report.Applied)
+	assert.NotEmpty(t, report.ApplyError)
+}
+
+// TestPatchSymlinkEscape tests that patches cannot write through symbolic
+// links, in the repository or in the validation copy
+func TestPatchSymlinkEscape(t *testing.T) {
+	root := newValidationRepo(t)
+	outside := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "out")))
+	require.NoError(t, os.Symlink("calc", filepath.Join(root, "inner")))
+	create := func(p string) string {
+		return "--- /dev/null\n+++ b/" + p + "\n@@ -0,0 +1,1 @@\n+pwned\n"
+	}
+
+	// Applied in place, paths through links are refused
+	_, err := analyzer.ApplyUnifiedDiff(root, create("out/pwned.txt"))
+	assert.Error(t, err)
+	_, err = analyzer.ApplyUnifiedDiff(root, create("inner/pwned.txt"))
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(outside, "pwned.txt"))
+	assert.NoFileExists(t, filepath.Join(root, "calc", "pwned.txt"))
+
+	// The validation copy leaves out links leading out of the repository
+	validator := validation.NewService(analyzer.NewService())
+	opts := validation.DefaultOptions(root)
+	report, err := validator.ValidatePatch(context.Background(), root, analyzer.Patch{ID: "escape", Diff: create("out/pwned.txt")}, opts)
+	require.NoError(t, err)
+	assert.True(t, report.Applied)
+	assert.NoFileExists(t, filepath.Join(outside, "pwned.txt"))
+	report, err = validator.ValidatePatch(context.Background(), root, analyzer.Patch{ID: "inner", Diff: create("inner/pwned.txt")}, opts)
+	require.NoError(t, err)
+	assert.False(t, report.Applied)
+	assert.Contains(t, report.ApplyError, "symbolic link")
+}
+
+// TestValidatePatchTimeout tests that commands are stopped at the timeout
+func TestValidatePatchTimeout(t *testing.T) {
+	root := newValidationRepo(t)
+	validator := validation.NewService(analyzer.NewService())
+	opts := validation.Options{TestCommand: []string{"sleep", "10"}, Timeout: 200 * time.Millisecond}
+
+	start := time.Now()
+	report, err := validator.ValidatePatch(context.Background(), root, analyzer.Patch{ID: "noop", Diff: `--- a/calc/calc.go
++++ b/calc/calc.go
+@@ -1,1 +1,1 @@
+-package calc
++package calc
+`}, opts)
+	require.NoError(t, err)
+	assert.True(t, report.Test.TimedOut)
+	assert.False(t, report.Valid)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}